@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveCooldown is the time after a decrease during which further
+	// pushback is attributed to the same episode
+	adaptiveCooldown = 5 * time.Second
+	// adaptiveSamples is the number of healthy responses measured before
+	// latency spikes are acted on
+	adaptiveSamples = 20
+	// adaptiveSpike is how much slower than the baseline a response must be
+	// to count as a spike
+	adaptiveSpike = 4
+)
+
+// adaptiveLimiter bounds the requests in flight to a limit that is halved
+// when the server pushes back (429, 503 or a latency spike) and grows by one
+// per window of healthy responses, up to the configured worker count
+type adaptiveLimiter struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	limit, max   int
+	inFlight     int
+	healthy      int           // healthy responses since the limit last changed
+	samples      int           // latency samples in the baseline
+	baseline     time.Duration // moving average of the time to response headers
+	lastDecrease time.Time
+}
+
+// newAdaptiveLimiter starts at the full limit; a healthy server never sees
+// fewer requests than the fixed worker pools used to send
+func newAdaptiveLimiter(limit int) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: limit, max: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits for a slot under the current limit
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+// release frees a slot
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.cond.Signal()
+	l.mu.Unlock()
+}
+
+// observe adjusts the limit from the outcome of a request: its status (0
+// on transport errors) and the time it took to get the response headers
+func (l *adaptiveLimiter) observe(status int, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		l.decrease(fmt.Sprintf("HTTP %d", status))
+	case status == 0 || status >= 500:
+		// Failures say nothing about load; they neither grow nor shrink the limit
+	case l.samples >= adaptiveSamples && latency > adaptiveSpike*l.baseline && latency > time.Second:
+		l.decrease(fmt.Sprintf("latency %s, usually %s", latency.Round(time.Millisecond), l.baseline.Round(time.Millisecond)))
+	default:
+		if l.samples < adaptiveSamples {
+			l.samples++
+			l.baseline += (latency - l.baseline) / time.Duration(l.samples)
+		} else {
+			l.baseline += (latency - l.baseline) / adaptiveSamples
+		}
+		if l.limit < l.max {
+			if l.healthy++; l.healthy >= l.limit {
+				l.limit++
+				l.healthy = 0
+				l.cond.Broadcast()
+				if l.limit == l.max {
+					fmt.Println("🚀 Server healthy again, concurrency back to", l.max)
+				}
+			}
+		}
+	}
+}
+
+// decrease halves the limit unless it was just decreased
+func (l *adaptiveLimiter) decrease(reason string) {
+	if time.Since(l.lastDecrease) < adaptiveCooldown || l.limit == 1 {
+		return
+	}
+	previous := l.limit
+	l.limit = max(1, l.limit/2)
+	l.healthy = 0
+	l.lastDecrease = time.Now()
+	fmt.Printf("🐢 Server pushback (%s): concurrency %d → %d\n", reason, previous, l.limit)
+}
+
+// adaptiveTransport holds back requests to paused hosts, then passes them
+// through the limiter and the pacer if any; the slot is held until the
+// response body is closed, so long downloads count as load. Pacing is not
+// counted as latency.
+type adaptiveTransport struct {
+	next    http.RoundTripper
+	limiter *adaptiveLimiter
+	pacer   *hostPacer
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A host that asked for a pause gets no request, not even a slot
+	if err := pauses.wait(req); err != nil {
+		return nil, err
+	}
+	t.limiter.acquire()
+	if err := t.pacer.wait(req); err != nil {
+		t.limiter.release()
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.limiter.observe(0, time.Since(start))
+		t.limiter.release()
+		return nil, err
+	}
+	t.limiter.observe(resp.StatusCode, time.Since(start))
+	pauses.observe(req, resp)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: t.limiter.release}
+	return resp, nil
+}
+
+// releasingBody frees the limiter slot of a response when it is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close implements io.Closer
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// agreementCookie tells the archive that its data agreement was accepted
+const agreementCookie = "openintel-data-agreement-accepted=true"
+
+// agreementTransport adds the agreement cookie to every request sent to
+// the site of the archive, listings, probes and downloads alike, and to no
+// other host
+type agreementTransport struct {
+	next http.RoundTripper
+	host string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *agreementTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Cookie") == "" && sameSite(req.URL.Hostname(), t.host) {
+		req = req.Clone(req.Context())
+		req.Header.Set("Cookie", agreementCookie)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// archiveHost returns the host serving the listing pages
+func archiveHost() string {
+	u, err := url.Parse(listing{}.URL())
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
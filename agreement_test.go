@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// roundTripFunc turns a function into an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAgreementTransport(t *testing.T) {
+	tests := []struct {
+		name, url, cookie string
+		want              string // the Cookie header the archive receives
+	}{
+		{"archive", "https://openintel.nl/download/", "", agreementCookie},
+		{"storage subdomain", "https://object.openintel.nl/part-00000.gz.parquet", "", agreementCookie},
+		{"upper case host", "https://OPENINTEL.NL/download/", "", agreementCookie},
+		{"another site", "https://example.com/", "", ""},
+		{"lookalike suffix", "https://openintel.nl.example.com/", "", ""},
+		{"address", "https://192.0.2.1/", "", ""},
+		{"cookie already set", "https://openintel.nl/download/", "session=1", "session=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			transport := &agreementTransport{host: "openintel.nl", next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				got = req.Header.Get("Cookie")
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+			})}
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.cookie != "" {
+				req.Header.Set("Cookie", tt.cookie)
+			}
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Cookie sent to %s = %q, want %q", tt.url, got, tt.want)
+			}
+			// RoundTrip must not modify the request of its caller
+			if req.Header.Get("Cookie") != tt.cookie {
+				t.Errorf("caller's Cookie header changed to %q", req.Header.Get("Cookie"))
+			}
+		})
+	}
+}
+
+func TestArchiveHost(t *testing.T) {
+	if got := archiveHost(); got != "openintel.nl" {
+		t.Errorf("archiveHost() = %q, want openintel.nl", got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// daySnapshot is the per-domain record sets of one dataset/day
+type daySnapshot struct {
+	date    string
+	domains map[string]map[string]bool // name -> "TYPE value"
+}
+
+// nsSet returns the name servers of a domain in a snapshot
+func (s *daySnapshot) nsSet(name string) map[string]bool {
+	set := make(map[string]bool)
+	for rr := range s.domains[name] {
+		if ns, ok := strings.CutPrefix(rr, "NS "); ok {
+			set[ns] = true
+		}
+	}
+	return set
+}
+
+// providerShares returns the share of domains served by each DNS provider
+func (s *daySnapshot) providerShares() map[string]float64 {
+	counts := make(map[string]int)
+	withNS := 0
+	for name := range s.domains {
+		providers := make(map[string]bool)
+		for ns := range s.nsSet(name) {
+			providers[nsProvider(ns)] = true
+		}
+		if len(providers) > 0 {
+			withNS++
+		}
+		for provider := range providers {
+			counts[provider]++
+		}
+	}
+	shares := make(map[string]float64, len(counts))
+	for provider, n := range counts {
+		shares[provider] = 100 * float64(n) / float64(withNS)
+	}
+	return shares
+}
+
+// anomalyThresholds configures when a change is reported
+type anomalyThresholds struct {
+	nsChurn       float64 // percent of domains changing name servers
+	providerShift float64 // percentage points a provider share moves
+	recordChurn   float64 // fraction of a domain's records replaced
+	minRecords    int     // records a domain needs for recordChurn to apply
+}
+
+// runAnomalies flags days where domains or whole datasets change abnormally
+// compared with the previous day of the same dataset
+func runAnomalies(args []string) int {
+	flags := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	t := anomalyThresholds{}
+	flags.Float64Var(&t.nsChurn, "max-ns-churn", 5, "Percent of a dataset's domains that may change name servers in a day")
+	flags.Float64Var(&t.providerShift, "max-provider-shift", 2, "Percentage points a DNS provider's share may move in a day")
+	flags.Float64Var(&t.recordChurn, "max-record-churn", 0.8, "Fraction of a domain's records that may be replaced in a day")
+	flags.IntVar(&t.minRecords, "min-records", 3, "Records a domain needs before its churn is checked")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	previous := make(map[string]*daySnapshot)
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		snapshot := &daySnapshot{date: day[0].Date, domains: make(map[string]map[string]bool)}
+		err := scanRecords(day, nil, func(r *record) error {
+			name := strings.ToLower(r.QueryName)
+			if snapshot.domains[name] == nil {
+				snapshot.domains[name] = make(map[string]bool)
+			}
+			if r.ResponseType != "" {
+				snapshot.domains[name][strings.TrimSpace(r.ResponseType+" "+strings.ToLower(r.Value()))] = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		dataset := day[0].Dataset
+		if before := previous[dataset]; before != nil {
+			for _, a := range compareSnapshots(before, snapshot, t) {
+				rows = append(rows, append([]string{snapshot.date, dataset}, a...))
+			}
+		}
+		previous[dataset] = snapshot
+	}
+
+	headers := []string{"date", "dataset", "scope", "subject", "kind", "value", "threshold", "since"}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "📊 %d anomalies\n", len(rows))
+	if len(rows) > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// compareSnapshots returns the anomalies between two consecutive snapshots as
+// scope, subject, kind, value, threshold and base day columns
+func compareSnapshots(before, after *daySnapshot, t anomalyThresholds) [][]string {
+	var anomalies [][]string
+	report := func(scope, subject, kind string, value, threshold float64) {
+		anomalies = append(anomalies, []string{scope, subject, kind,
+			strconv.FormatFloat(value, 'f', 2, 64), strconv.FormatFloat(threshold, 'f', 2, 64), before.date})
+	}
+
+	names := make([]string, 0, len(after.domains))
+	for name := range after.domains {
+		if _, ok := before.domains[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	nsChanged := 0
+	withNS := 0
+	for _, name := range names {
+		oldNS, newNS := before.nsSet(name), after.nsSet(name)
+		if len(oldNS) > 0 && len(newNS) > 0 {
+			withNS++
+			if len(setDifference(oldNS, newNS)) > 0 || len(setDifference(newNS, oldNS)) > 0 {
+				nsChanged++
+			}
+			if overlap := len(oldNS) - len(setDifference(oldNS, newNS)); overlap == 0 {
+				report("domain", name, "ns-replaced", 1, 0)
+			}
+		}
+
+		old, current := before.domains[name], after.domains[name]
+		if len(old) < t.minRecords {
+			continue
+		}
+		replaced := float64(len(setDifference(old, current))) / float64(len(old))
+		if replaced > t.recordChurn {
+			report("domain", name, "record-churn", replaced, t.recordChurn)
+		}
+	}
+
+	if withNS > 0 {
+		if churn := 100 * float64(nsChanged) / float64(withNS); churn > t.nsChurn {
+			report("dataset", "*", "ns-churn", churn, t.nsChurn)
+		}
+	}
+
+	oldShares, newShares := before.providerShares(), after.providerShares()
+	providers := make(map[string]bool)
+	for p := range oldShares {
+		providers[p] = true
+	}
+	for p := range newShares {
+		providers[p] = true
+	}
+	for _, provider := range sortedKeys(providers) {
+		shift := newShares[provider] - oldShares[provider]
+		if shift > t.providerShift || -shift > t.providerShift {
+			report("dataset", provider, "provider-shift", shift, t.providerShift)
+		}
+	}
+	return anomalies
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveFile is a downloaded file together with the dataset and day it belongs to
+type archiveFile struct {
+	Path    string
+	Dataset string
+	Date    string
+}
+
+// archiveFilter selects the part of the local archive an analysis runs on
+type archiveFilter struct {
+	Datasets string
+	From     string
+	To       string
+	GeoIP    string
+	ASNTable string
+	ASNames  string
+	Cymru    bool
+	PSL      bool
+	Memory   string
+}
+
+// addArchiveFlags registers the flags shared by the analysis commands
+func addArchiveFlags(flags *flag.FlagSet) *archiveFilter {
+	filter := &archiveFilter{}
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	flags.StringVar(&filter.Datasets, "dataset", "", "Comma-separated datasets to include (default all)")
+	flags.StringVar(&filter.From, "from", "", "First day to include (YYYY-MM-DD)")
+	flags.StringVar(&filter.To, "to", "", "Last day to include (YYYY-MM-DD)")
+	flags.StringVar(&filter.GeoIP, "geoip", "", "MaxMind GeoLite2 City or Country database to enrich addresses with")
+	flags.StringVar(&filter.ASNTable, "asn-table", "", "pyasn-style prefix-to-ASN file to enrich addresses with")
+	flags.StringVar(&filter.ASNames, "as-names", "", "pyasn asnames JSON file naming the ASNs of --asn-table")
+	flags.BoolVar(&filter.Cymru, "cymru", false, "Look up the origin ASN of addresses with Team Cymru (one DNS query per address)")
+	flags.BoolVar(&filter.PSL, "refresh-psl", false, "Download the current public suffix list before grouping by registrable domain")
+	flags.IntVar(&parseWorkers, "parse-workers", parseWorkers, "Row groups decoded in parallel")
+	flags.StringVar(&filter.Memory, "memory-limit", "", "Memory budget of the scan, e.g. 2GiB (default unlimited)")
+	return filter
+}
+
+// validate checks the date bounds of the filter
+func (f *archiveFilter) validate() error {
+	for _, date := range []string{f.From, f.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", date)
+		}
+	}
+	if f.From != "" && f.To != "" && f.From > f.To {
+		return fmt.Errorf("--from %s is after --to %s", f.From, f.To)
+	}
+	return nil
+}
+
+// includes reports whether a dataset/day passes the filter
+func (f *archiveFilter) includes(dataset, date string) bool {
+	if f.From != "" && date < f.From {
+		return false
+	}
+	if f.To != "" && date > f.To {
+		return false
+	}
+	if f.Datasets == "" {
+		return true
+	}
+	for _, name := range strings.Split(f.Datasets, ",") {
+		if strings.TrimSpace(name) == dataset {
+			return true
+		}
+	}
+	return false
+}
+
+// files lists the archive files selected by the filter in chronological order
+// and loads the enrichment databases and suffix list the analysis should use
+func (f *archiveFilter) files() ([]archiveFile, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	if parseWorkers < 1 {
+		return nil, fmt.Errorf("--parse-workers must be positive")
+	}
+	if f.Memory != "" {
+		limit, err := parseSize(f.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("--memory-limit: %w", err)
+		}
+		applyMemoryLimit(limit)
+	}
+	if f.GeoIP != "" {
+		if err := enableGeoIP(f.GeoIP); err != nil {
+			return nil, err
+		}
+	}
+	if err := enableASN(f.ASNTable, f.ASNames, f.Cymru); err != nil {
+		return nil, err
+	}
+	if err := useSuffixList(f.PSL); err != nil {
+		return nil, err
+	}
+
+	manifests, err := loadManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []archiveFile
+	for _, m := range manifests {
+		if !f.includes(m.Dataset, m.Date) {
+			continue
+		}
+		for _, entry := range m.Files {
+			path := filepath.Join(downloadDir, entry.Name)
+			if _, err := os.Stat(path); err != nil {
+				fmt.Fprintln(os.Stderr, "⚠️  Skipping missing file:", path)
+				continue
+			}
+			files = append(files, archiveFile{Path: path, Dataset: m.Dataset, Date: m.Date})
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Date != files[j].Date {
+			return files[i].Date < files[j].Date
+		}
+		return files[i].Dataset < files[j].Dataset
+	})
+	return files, nil
+}
+
+// groupByDay splits files sorted by files() into one group per dataset/day
+func groupByDay(files []archiveFile) [][]archiveFile {
+	var groups [][]archiveFile
+	for start := 0; start < len(files); {
+		end := start
+		for end < len(files) && files[end].Date == files[start].Date && files[end].Dataset == files[start].Dataset {
+			end++
+		}
+		groups = append(groups, files[start:end])
+		start = end
+	}
+	return groups
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// asnTable maps announced prefixes to their origin AS, one map per prefix length
+type asnTable struct {
+	prefixes map[int]map[netip.Prefix]uint32
+	lengths  []int // prefix lengths present, longest first
+	names    map[uint32]string
+}
+
+// loadASNTable reads a pyasn-style IPASN file: one "prefix<TAB>asn" line per
+// announced prefix, with ; comments. An optional pyasn asnames JSON file maps
+// AS numbers to names.
+func loadASNTable(path, namesPath string) (*asnTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &asnTable{prefixes: make(map[int]map[netip.Prefix]uint32), names: make(map[uint32]string)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected prefix and ASN", path, line)
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid prefix %q", path, line, fields[0])
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid ASN %q", path, line, fields[1])
+		}
+		prefix = prefix.Masked()
+		if t.prefixes[prefix.Bits()] == nil {
+			t.prefixes[prefix.Bits()] = make(map[netip.Prefix]uint32)
+		}
+		t.prefixes[prefix.Bits()][prefix] = uint32(asn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for bits := 128; bits >= 0; bits-- {
+		if t.prefixes[bits] != nil {
+			t.lengths = append(t.lengths, bits)
+		}
+	}
+
+	if namesPath != "" {
+		data, err := os.ReadFile(namesPath)
+		if err != nil {
+			return nil, err
+		}
+		var names map[string]string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return nil, fmt.Errorf("%s: %w", namesPath, err)
+		}
+		for number, name := range names {
+			if asn, err := strconv.ParseUint(number, 10, 32); err == nil {
+				t.names[uint32(asn)] = name
+			}
+		}
+	}
+	return t, nil
+}
+
+// lookup returns the origin AS of the longest prefix covering an address
+func (t *asnTable) lookup(addr netip.Addr) (uint32, bool) {
+	for _, bits := range t.lengths {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if asn, ok := t.prefixes[bits][prefix]; ok {
+			return asn, true
+		}
+	}
+	return 0, false
+}
+
+// cymruOrigin resolves the origin AS of an address through the Team Cymru
+// IP-to-ASN DNS service
+func cymruOrigin(addr netip.Addr) (uint32, string, bool) {
+	var query string
+	if addr.Is4() {
+		b := addr.As4()
+		query = fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", b[3], b[2], b[1], b[0])
+	} else {
+		b := addr.As16()
+		var nibbles []string
+		for i := len(b) - 1; i >= 0; i-- {
+			nibbles = append(nibbles, strconv.FormatUint(uint64(b[i]&0xf), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+		}
+		query = strings.Join(nibbles, ".") + ".origin6.asn.cymru.com"
+	}
+
+	// "13335 | 104.16.0.0/13 | US | arin | 2014-03-28"; multi-origin prefixes list several ASNs
+	asn, ok := firstCymruField(query)
+	if !ok {
+		return 0, "", false
+	}
+	number, err := strconv.ParseUint(strings.Fields(asn)[0], 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+
+	// "13335 | US | arin | 2010-07-14 | CLOUDFLARENET, US"
+	name := ""
+	if records, err := net.LookupTXT(fmt.Sprintf("AS%d.asn.cymru.com", number)); err == nil && len(records) > 0 {
+		if fields := strings.Split(records[0], "|"); len(fields) == 5 {
+			name = strings.TrimSpace(fields[4])
+		}
+	}
+	return uint32(number), name, true
+}
+
+// firstCymruField returns the first field of a Team Cymru TXT answer
+func firstCymruField(query string) (string, bool) {
+	records, err := net.LookupTXT(query)
+	if err != nil || len(records) == 0 {
+		return "", false
+	}
+	field, _, _ := strings.Cut(records[0], "|")
+	field = strings.TrimSpace(field)
+	return field, field != ""
+}
+
+// enableASN attaches the origin AS of every A and AAAA address, from a prefix
+// table when one is given and from Team Cymru otherwise
+func enableASN(path, namesPath string, cymru bool) error {
+	type origin struct {
+		asn  uint32
+		name string
+		ok   bool
+	}
+	var mu sync.Mutex
+	cache := make(map[netip.Addr]origin)
+
+	var resolve func(addr netip.Addr) origin
+	switch {
+	case path != "":
+		table, err := loadASNTable(path, namesPath)
+		if err != nil {
+			return fmt.Errorf("loading ASN table: %w", err)
+		}
+		resolve = func(addr netip.Addr) origin {
+			asn, ok := table.lookup(addr)
+			return origin{asn, table.names[asn], ok}
+		}
+	case cymru:
+		resolve = func(addr netip.Addr) origin {
+			asn, name, ok := cymruOrigin(addr)
+			return origin{asn, name, ok}
+		}
+	default:
+		return nil
+	}
+
+	recordEnrichers = append(recordEnrichers, func(r *record) {
+		ip := r.address()
+		if ip == nil {
+			return
+		}
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return
+		}
+		addr = addr.Unmap()
+		mu.Lock()
+		o, cached := cache[addr]
+		mu.Unlock()
+		if !cached {
+			o = resolve(addr)
+			mu.Lock()
+			cache[addr] = o
+			mu.Unlock()
+		}
+		if o.ok {
+			r.OriginASN = o.asn
+			r.OriginASName = o.name
+		}
+	})
+	return nil
+}
+
+// runASN reports the origin networks hosting the domains of each day and dataset
+func runASN(args []string) int {
+	flags := flag.NewFlagSet("asn", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	limit := flags.Int("top", 10, "Networks reported per day and dataset (0 for all)")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		// AS -> domains, and the name reported for each AS
+		networks := make(map[string]map[string]bool)
+		names := make(map[string]string)
+		hosted := make(map[string]bool)
+		err := scanRecords(day, nil, func(r *record) error {
+			if r.address() == nil {
+				return nil
+			}
+			as, name := r.origin()
+			if as == "" {
+				return nil
+			}
+			domain := strings.ToLower(r.QueryName)
+			hosted[domain] = true
+			if networks[as] == nil {
+				networks[as] = make(map[string]bool)
+			}
+			networks[as][domain] = true
+			if names[as] == "" {
+				names[as] = name
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		counts := make(map[string]int, len(networks))
+		for as, domains := range networks {
+			counts[as] = len(domains)
+		}
+		for _, as := range topKeys(counts, *limit) {
+			rows = append(rows, []string{day[0].Date, day[0].Dataset, as, names[as], strconv.Itoa(counts[as]), percent(counts[as], len(hosted))})
+		}
+	}
+
+	if err := writeTable(*format, []string{"date", "dataset", "asn", "as_name", "domains", "share"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// origin returns the origin AS of a record's address, preferring the
+// enrichment over the as and as_full columns of the measurement
+func (r *record) origin() (string, string) {
+	if r.OriginASN != 0 {
+		return strconv.FormatUint(uint64(r.OriginASN), 10), r.OriginASName
+	}
+	return r.AS, r.ASFull
+}
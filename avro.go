@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// avroMagic starts every Avro object container file
+var avroMagic = []byte("Obj\x01")
+
+// avroLong appends a zig-zag varint, the encoding of Avro int and long
+func avroLong(b *bytes.Buffer, v int64) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for u >= 0x80 {
+		b.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	b.WriteByte(byte(u))
+}
+
+// avroString appends a length-prefixed string or bytes value
+func avroString(b *bytes.Buffer, s string) {
+	avroLong(b, int64(len(s)))
+	b.WriteString(s)
+}
+
+// avroOptional appends the union branch of a ["null", T] value; the value
+// itself follows when present is true
+func avroOptional(b *bytes.Buffer, present bool) {
+	if present {
+		avroLong(b, 1)
+	} else {
+		avroLong(b, 0)
+	}
+}
+
+// writeAvroFile writes count records, already encoded into body, as an
+// uncompressed Avro object container file with the given schema and metadata
+func writeAvroFile(path, schema string, metadata map[string]string, count int, body []byte) (int64, error) {
+	var b bytes.Buffer
+	b.Write(avroMagic)
+
+	meta := map[string]string{"avro.schema": schema, "avro.codec": "null"}
+	for k, v := range metadata {
+		meta[k] = v
+	}
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	avroLong(&b, int64(len(meta)))
+	for _, k := range keys {
+		avroString(&b, k)
+		avroString(&b, meta[k])
+	}
+	avroLong(&b, 0)
+
+	sync := make([]byte, 16)
+	if _, err := rand.Read(sync); err != nil {
+		return 0, err
+	}
+	b.Write(sync)
+
+	if count > 0 {
+		avroLong(&b, int64(count))
+		avroLong(&b, int64(len(body)))
+		b.Write(body)
+		b.Write(sync)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o644); err != nil {
+		return 0, err
+	}
+	return int64(b.Len()), os.Rename(tmp, path)
+}
+
+// avroReader decodes the records of an uncompressed Avro container file
+type avroReader struct {
+	r    *bufio.Reader
+	sync []byte
+}
+
+// openAvro reads the header of an Avro container file
+func openAvro(data []byte) (*avroReader, error) {
+	a := &avroReader{r: bufio.NewReader(bytes.NewReader(data))}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(a.r, magic); err != nil || !bytes.Equal(magic, avroMagic) {
+		return nil, errors.New("not an Avro container file")
+	}
+	for {
+		n, err := a.long()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			n = -n
+			if _, err := a.long(); err != nil {
+				return nil, err
+			}
+		}
+		for ; n > 0; n-- {
+			key, err := a.string()
+			if err != nil {
+				return nil, err
+			}
+			value, err := a.string()
+			if err != nil {
+				return nil, err
+			}
+			if key == "avro.codec" && value != "null" {
+				return nil, fmt.Errorf("unsupported Avro codec %q", value)
+			}
+		}
+	}
+	a.sync = make([]byte, 16)
+	_, err := io.ReadFull(a.r, a.sync)
+	return a, err
+}
+
+// block starts the next data block and returns its record count, 0 at the
+// end of the file; the records are followed by a call to endBlock
+func (a *avroReader) block() (int64, error) {
+	count, err := a.long()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := a.long(); err != nil { // block size in bytes
+		return 0, err
+	}
+	return count, nil
+}
+
+// endBlock checks the sync marker closing a block
+func (a *avroReader) endBlock() error {
+	marker := make([]byte, 16)
+	if _, err := io.ReadFull(a.r, marker); err != nil {
+		return err
+	}
+	if !bytes.Equal(marker, a.sync) {
+		return errors.New("corrupt Avro block: sync marker mismatch")
+	}
+	return nil
+}
+
+// long decodes an int or long
+func (a *avroReader) long() (int64, error) {
+	var u uint64
+	for shift := 0; ; shift += 7 {
+		b, err := a.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+// string decodes a string or bytes value
+func (a *avroReader) string() (string, error) {
+	n, err := a.long()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(a.r, b)
+	return string(b), err
+}
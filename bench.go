@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// benchRow is a synthetic resource record of the benchmark files
+type benchRow struct {
+	QueryName    string `parquet:"query_name"`
+	QueryType    string `parquet:"query_type"`
+	ResponseName string `parquet:"response_name"`
+	ResponseType string `parquet:"response_type"`
+	TTL          int64  `parquet:"response_ttl"`
+	Timestamp    int64  `parquet:"timestamp"`
+	IP4Address   string `parquet:"ip4_address,optional"`
+	NSAddress    string `parquet:"ns_address,optional"`
+}
+
+// benchServer imitates the archive: every dataset/day lists the same number
+// of files, all served from one synthetic parquet file
+type benchServer struct {
+	addr     string
+	files    int
+	body     []byte
+	latency  time.Duration
+	requests atomic.Int64
+}
+
+// ServeHTTP implements http.Handler
+func (s *benchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.latency)
+
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		w.Header().Set("Content-Length", fmt.Sprint(len(s.body)))
+		if r.Method != http.MethodHead {
+			w.Write(s.body)
+		}
+		return
+	}
+
+	// Listing pages get file names unique to their dataset/day
+	page := crc32.ChecksumIEEE([]byte(r.URL.Path))
+	fmt.Fprint(w, "<html><body>")
+	for i := 0; i < s.files; i++ {
+		fmt.Fprintf(w, `<a class="flex-container" href="http://%s/files/part-%05d-%08x-c000.gz.parquet">part %d</a>`, s.addr, i, page, i)
+	}
+	fmt.Fprint(w, "</body></html>")
+}
+
+// benchFile builds a parquet file of about size bytes of synthetic records
+func benchFile(size int64) ([]byte, error) {
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[benchRow](&buf, parquet.Compression(&parquet.Snappy))
+	random := rand.New(rand.NewSource(1))
+
+	rows := make([]benchRow, 1024)
+	for int64(buf.Len()) < size {
+		for i := range rows {
+			name := fmt.Sprintf("host%d.domain%d.example.", random.Intn(1000), random.Intn(1_000_000))
+			rows[i] = benchRow{QueryName: name, ResponseName: name, TTL: int64(random.Intn(86400)), Timestamp: 1704067200000 + int64(random.Intn(86_400_000))}
+			if random.Intn(4) == 0 {
+				rows[i].QueryType, rows[i].ResponseType = "NS", "NS"
+				rows[i].NSAddress = fmt.Sprintf("ns%d.provider%d.net.", random.Intn(4), random.Intn(500))
+			} else {
+				rows[i].QueryType, rows[i].ResponseType = "A", "A"
+				rows[i].IP4Address = fmt.Sprintf("%d.%d.%d.%d", random.Intn(224), random.Intn(256), random.Intn(256), random.Intn(256))
+			}
+		}
+		if _, err := w.Write(rows); err != nil {
+			return nil, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runBench crawls and scans a synthetic archive served locally, so the
+// throughput of the engine can be compared between versions and settings
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	days := flags.Int("days", 4, "Days listed per dataset")
+	files := flags.Int("files", 8, "Files listed per dataset/day")
+	size := flags.String("size", "4MiB", "Approximate size of each file")
+	latency := flags.Duration("latency", 0, "Delay added by the server to every response, e.g. 20ms")
+	flags.IntVar(&workerLimit, "workers", workerLimit, "Number of concurrent file downloads")
+	flags.IntVar(&listingWorkers, "list-workers", listingWorkers, "Number of listing pages fetched concurrently")
+	flags.IntVar(&parseWorkers, "parse-workers", parseWorkers, "Row groups decoded in parallel")
+	pprofAddr := flags.String("pprof-addr", "", "Serve runtime profiles on this address while the benchmark runs (optional)")
+	keep := flags.Bool("keep", false, "Keep the downloaded archive instead of deleting it")
+	verbose := flags.Bool("verbose", false, "Show the output of the crawler")
+	flags.Parse(args)
+
+	fileSize, err := parseSize(*size)
+	if err != nil {
+		fmt.Println("❌ Error: --size:", err)
+		return exitUsage
+	}
+	if *days < 1 || *files < 1 || workerLimit < 1 || listingWorkers < 1 || parseWorkers < 1 {
+		fmt.Println("❌ Error: --days, --files and the worker counts must be positive")
+		return exitUsage
+	}
+	if *pprofAddr != "" {
+		if err := startPprof(*pprofAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error starting pprof:", err)
+			return exitFailed
+		}
+	}
+
+	body, err := benchFile(fileSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error building the benchmark file:", err)
+		return exitFailed
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error starting the benchmark server:", err)
+		return exitFailed
+	}
+	defer listener.Close()
+	server := &benchServer{addr: listener.Addr().String(), files: *files, body: body, latency: *latency}
+	go http.Serve(listener, server)
+	baseURL = "http://" + server.addr + "/download/forward-dns/basis=toplist/source=%s/year=%d/month=%02d/day=%02d/"
+
+	downloadDir, err = os.MkdirTemp("", "gopenintel-bench-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error creating the benchmark archive:", err)
+		return exitFailed
+	}
+	if *keep {
+		fmt.Println("📂 Benchmark archive:", downloadDir)
+	} else {
+		defer os.RemoveAll(downloadDir)
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error configuring the HTTP client:", err)
+		return exitFailed
+	}
+
+	expected := *days * len(datasets) * *files
+	fmt.Printf("🏁 %d dataset/days of %d files of %s, %d download and %d listing workers\n",
+		*days*len(datasets), *files, formatSize(int64(len(body))), workerLimit, listingWorkers)
+
+	// The crawler reports every file; only the totals matter here
+	stdout := os.Stdout
+	if !*verbose {
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+			defer devNull.Close()
+		}
+	}
+	start := time.Now()
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	crawlPages(func(fn func(year, month, day int)) {
+		for i := 0; i < *days; i++ {
+			day := first.AddDate(0, 0, i)
+			fn(day.Year(), int(day.Month()), day.Day())
+		}
+	})
+	crawl := time.Since(start)
+	os.Stdout = stdout
+
+	manifests, err := loadManifests()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading manifests:", err)
+		return exitFailed
+	}
+	var archive []archiveFile
+	var downloaded int64
+	for _, m := range manifests {
+		for _, entry := range m.Files {
+			archive = append(archive, archiveFile{Path: filepath.Join(downloadDir, entry.Name), Dataset: m.Dataset, Date: m.Date})
+			downloaded += entry.Size
+		}
+	}
+	fmt.Printf("📊 Downloaded %d/%d files (%s) in %s: %s/s, %d requests\n", len(archive), expected,
+		formatSize(downloaded), crawl.Round(time.Millisecond), formatSize(int64(float64(downloaded)/crawl.Seconds())), server.requests.Load())
+
+	start = time.Now()
+	records := 0
+	err = scanRecords(archive, nil, func(r *record) error {
+		records++
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error scanning the archive:", err)
+		return exitFailed
+	}
+	scan := time.Since(start)
+	fmt.Printf("📊 Scanned %d records in %s: %.0f records/s, parse workers: %d\n",
+		records, scan.Round(time.Millisecond), float64(records)/scan.Seconds(), parseWorkers)
+
+	if len(archive) < expected {
+		fmt.Fprintln(os.Stderr, "❌ Some files were not downloaded; rerun with --verbose")
+		return exitFailed
+	}
+	return exitOK
+}
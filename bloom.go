@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// bloomMagic starts every exported filter file
+const bloomMagic = "GOIBLOOM"
+
+// bloomFilter is a standard bloom filter over normalized FQDNs. Bit i of the
+// k probes of a name is (h1 + i*h2) mod m, with h1 and h2 the first two
+// big-endian uint64 of the SHA-256 of the name.
+type bloomFilter struct {
+	bits  []byte
+	m     uint64 // number of bits
+	k     uint32 // probes per name
+	count uint64 // names added
+}
+
+// newBloomFilter sizes a filter for n names at the given false-positive rate
+func newBloomFilter(n uint64, fpRate float64) *bloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 7) / 8 * 8
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{bits: make([]byte, m/8), m: m, k: k}
+}
+
+// bloomHashes returns the two hashes the probe positions of a name derive from
+func bloomHashes(name string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(name))
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16])
+}
+
+// add inserts a normalized name
+func (b *bloomFilter) add(name string) {
+	h1, h2 := bloomHashes(name)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+	b.count++
+}
+
+// has reports whether a normalized name may have been added
+func (b *bloomFilter) has(name string) bool {
+	h1, h2 := bloomHashes(name)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTo stores the filter as the magic, m, k and count in big endian
+// followed by the bit array, bit i being bit i%8 of byte i/8
+func (b *bloomFilter) writeTo(w io.Writer) error {
+	header := make([]byte, len(bloomMagic)+8+4+8)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint64(header[8:], b.m)
+	binary.BigEndian.PutUint32(header[16:], b.k)
+	binary.BigEndian.PutUint64(header[20:], b.count)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(b.bits)
+	return err
+}
+
+// readBloomFilter loads a filter written by writeTo
+func readBloomFilter(path string) (*bloomFilter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 28 || string(data[:8]) != bloomMagic {
+		return nil, errors.New("not a bloom filter file")
+	}
+	b := &bloomFilter{
+		m:     binary.BigEndian.Uint64(data[8:]),
+		k:     binary.BigEndian.Uint32(data[16:]),
+		count: binary.BigEndian.Uint64(data[20:]),
+		bits:  data[28:],
+	}
+	if b.m == 0 || uint64(len(b.bits))*8 < b.m || b.k == 0 {
+		return nil, errors.New("corrupt bloom filter header")
+	}
+	return b, nil
+}
+
+// runBloom dispatches the bloom build and bloom check commands
+func runBloom(args []string) int {
+	if len(args) > 0 && args[0] == "build" {
+		return runBloomBuild(args[1:])
+	}
+	if len(args) > 0 && args[0] == "check" {
+		return runBloomCheck(args[1:])
+	}
+	fmt.Println("❌ Error: usage is bloom build [options] | bloom check --filter=FILE [name...]")
+	return exitUsage
+}
+
+// runBloomBuild exports a bloom filter of every FQDN observed in the selection
+func runBloomBuild(args []string) int {
+	flags := flag.NewFlagSet("bloom build", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	output := flags.String("output", "domains.bloom", "File receiving the filter")
+	fpRate := flags.Float64("fp-rate", 0.001, "Target false-positive rate")
+	flags.Parse(args)
+
+	if *fpRate <= 0 || *fpRate >= 1 {
+		fmt.Println("❌ Error: --fp-rate must be between 0 and 1")
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// The filter is sized from the exact number of distinct names
+	names := make(map[string]bool)
+	err = scanRecords(files, nil, func(r *record) error {
+		names[normalizeDomain(r.QueryName)] = true
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+
+	bf := newBloomFilter(uint64(len(names)), *fpRate)
+	for name := range names {
+		bf.add(name)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Println("❌ Error creating filter:", err)
+		return exitFailed
+	}
+	w := bufio.NewWriter(f)
+	if err := bf.writeTo(w); err != nil || w.Flush() != nil || f.Close() != nil {
+		fmt.Println("❌ Error writing filter:", *output)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 %d names from %d files in %s (%d KiB, %d probes)\n",
+		bf.count, len(files), *output, len(bf.bits)/1024, bf.k)
+	return exitOK
+}
+
+// runBloomCheck tests names against an exported filter; they are read from
+// the arguments or, without arguments, one per line from stdin
+func runBloomCheck(args []string) int {
+	flags := flag.NewFlagSet("bloom check", flag.ExitOnError)
+	path := flags.String("filter", "domains.bloom", "Filter file written by bloom build")
+	flags.Parse(args)
+
+	bf, err := readBloomFilter(*path)
+	if err != nil {
+		fmt.Println("❌ Error reading filter:", err)
+		return exitUsage
+	}
+
+	check := func(name string) bool {
+		present := bf.has(normalizeDomain(name))
+		fmt.Printf("%s\t%t\n", name, present)
+		return present
+	}
+
+	found := 0
+	if flags.NArg() > 0 {
+		for _, name := range flags.Args() {
+			if check(name) {
+				found++
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if name := strings.TrimSpace(scanner.Text()); name != "" && check(name) {
+				found++
+			}
+		}
+	}
+
+	if found == 0 {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the size of the chunks files are written and hashed in;
+// large enough to keep the syscalls per GB low, small enough to pool one per
+// worker
+const copyBufferSize = 1 << 20
+
+var copyBuffers = sync.Pool{New: func() any {
+	buf := make([]byte, copyBufferSize)
+	return &buf
+}}
+
+// copyBuffered copies src to dst in full chunks of a pooled buffer. Unlike
+// io.Copy it fills the buffer before each write, so a download arriving in
+// small network reads still reaches the disk in large writes. Only io.EOF
+// ends the copy cleanly; a body cut short, which net/http reports as
+// io.ErrUnexpectedEOF, is returned like any other error.
+func copyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	var written int64
+	for {
+		n, err := fillBuffer(src, *buf)
+		if n > 0 {
+			if _, err := dst.Write((*buf)[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// fillBuffer reads from src until buf is full or src fails, returning the
+// error of src as is, io.EOF included
+func fillBuffer(src io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		read, err := src.Read(buf[n:])
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
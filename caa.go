@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// noIssuer is reported for issue properties with an empty issuer, which
+// forbid issuance by any CA
+const noIssuer = "(none)"
+
+// caaIssuer returns the CA domain of an issue or issuewild property value,
+// dropping its parameters
+func caaIssuer(value string) string {
+	issuer, _, _ := strings.Cut(value, ";")
+	issuer = strings.ToLower(strings.TrimSpace(issuer))
+	if issuer == "" {
+		return noIssuer
+	}
+	return issuer
+}
+
+// runCAA reports which certificate authorities domains authorize through
+// CAA records per day and dataset
+func runCAA(args []string) int {
+	flags := flag.NewFlagSet("caa", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	limit := flags.Int("top", 10, "Authorities reported per tag, day and dataset (0 for all)")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		domains := make(map[string]bool)
+		withCAA := make(map[string]bool)
+		// tag -> issuer -> domains
+		issuers := make(map[string]map[string]map[string]bool)
+
+		err := scanRecords(day, nil, func(r *record) error {
+			name := strings.ToLower(r.QueryName)
+			domains[name] = true
+			if r.ResponseType != "CAA" {
+				return nil
+			}
+			withCAA[name] = true
+
+			tag := strings.ToLower(r.CAATag)
+			issuer := r.CAAValue
+			switch tag {
+			case "issue", "issuewild", "issuemail":
+				issuer = caaIssuer(issuer)
+			case "iodef":
+				issuer = strings.TrimSpace(issuer)
+			}
+			if issuers[tag] == nil {
+				issuers[tag] = make(map[string]map[string]bool)
+			}
+			if issuers[tag][issuer] == nil {
+				issuers[tag][issuer] = make(map[string]bool)
+			}
+			issuers[tag][issuer][name] = true
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		date, dataset := day[0].Date, day[0].Dataset
+		fmt.Fprintf(os.Stderr, "📊 %s %s: %d of %d names publish CAA (%s%%)\n",
+			dataset, date, len(withCAA), len(domains), percent(len(withCAA), len(domains)))
+
+		tags := make([]string, 0, len(issuers))
+		for tag := range issuers {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			counts := make(map[string]int, len(issuers[tag]))
+			for issuer, names := range issuers[tag] {
+				counts[issuer] = len(names)
+			}
+			for _, issuer := range topKeys(counts, *limit) {
+				rows = append(rows, []string{date, dataset, tag, issuer, strconv.Itoa(counts[issuer]), percent(counts[issuer], len(withCAA))})
+			}
+		}
+	}
+
+	if err := writeTable(*format, []string{"date", "dataset", "tag", "value", "domains", "share"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// remoteState is what a HEAD request reports about a downloaded file
+type remoteState struct {
+	Entry    manifestEntry
+	Manifest *manifest
+	Problem  string
+}
+
+// runCheck issues HEAD requests for downloaded files and flags those whose
+// remote size or Last-Modified no longer matches the manifest; with -date,
+// it tells whether a day is published upstream instead
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	only := flags.String("dataset", "", "Comma-separated datasets to check (default all)")
+	date := flags.String("date", "", "Only tell whether this day (YYYY-MM-DD, today or yesterday) is published upstream, for workflow sensors")
+	addProxyFlags(flags)
+	addTLSFlags(flags)
+	addDNSFlags(flags)
+	addNetworkFlags(flags)
+	addTorFlags(flags)
+	addPolitenessFlags(flags)
+	addTimeoutFlags(flags)
+	flags.Parse(args)
+	if torMode {
+		torDefaults(flags)
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Println("❌ Error: check accepts at most one path.")
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		downloadDir = flags.Arg(0)
+	}
+	selected := datasets
+	if *only != "" {
+		var err error
+		if selected, err = selectDatasets(*only); err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+	}
+	var day time.Time
+	if *date != "" {
+		var err error
+		if day, err = parseDay(*date); err != nil {
+			fmt.Println("❌ Error: -date:", err)
+			return exitUsage
+		}
+	}
+
+	if err := configureHTTPClient(); err != nil {
+		fmt.Println("❌ Error configuring the HTTP client:", err)
+		return exitUsage
+	}
+	if *date != "" {
+		return checkPublished(selected, day)
+	}
+
+	manifests, err := loadManifests()
+	if err != nil {
+		fmt.Println("❌ Error reading manifests:", err)
+		return exitFailed
+	}
+	if len(manifests) == 0 {
+		fmt.Println("❌ No manifests found in", filepath.Join(downloadDir, manifestDir))
+		return exitFailed
+	}
+
+	fmt.Println("🔍 Checking remote state for archive:", downloadDir)
+
+	results := make(chan remoteState)
+	sem := make(chan struct{}, workerLimit)
+	var wg sync.WaitGroup
+
+	go func() {
+		for _, m := range manifests {
+			if !slices.Contains(selected, m.Dataset) {
+				continue
+			}
+			for _, entry := range m.Files {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func(m *manifest, entry manifestEntry) {
+					defer wg.Done()
+					defer func() { <-sem }()
+					results <- remoteState{Entry: entry, Manifest: m, Problem: checkRemote(entry)}
+				}(m, entry)
+			}
+		}
+		wg.Wait()
+		close(results)
+	}()
+
+	checked, changed := 0, 0
+	for r := range results {
+		checked++
+		if r.Problem != "" {
+			changed++
+			fmt.Printf("⚠️  %s: %s (%s %s)\n", r.Problem, r.Entry.Name, r.Manifest.Dataset, r.Manifest.Date)
+		}
+	}
+
+	fmt.Printf("📊 Checked %d files: %d unchanged, %d differ from upstream\n", checked, checked-changed, changed)
+	if changed > 0 {
+		return exitFailed
+	}
+	fmt.Println("✅ Archive matches upstream")
+	return exitOK
+}
+
+// checkPublished tells whether the listing of a day has files upstream for
+// every dataset, exiting 0 only then, so that workflow sensors can gate the
+// tasks that need the day
+func checkPublished(selected []string, day time.Time) int {
+	published := 0
+	for _, dataset := range selected {
+		page := listing{Dataset: dataset, Year: day.Year(), Month: int(day.Month()), Day: day.Day()}
+		links, ok := fetchListing(page.URL())
+		switch {
+		case !ok:
+			fmt.Printf("❌ Could not check whether %s %s is published\n", dataset, page.Date())
+		case len(links) == 0:
+			fmt.Printf("⏳ %s %s is not published yet\n", dataset, page.Date())
+		default:
+			fmt.Printf("✅ %s %s is published: %d files\n", dataset, page.Date(), len(uniqueLinks(links)))
+			published++
+		}
+	}
+	if published < len(selected) {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// checkRemote compares a manifest entry with the remote HEAD response and
+// returns a non-empty description when they differ
+func checkRemote(entry manifestEntry) string {
+	req, err := http.NewRequestWithContext(aborting, http.MethodHead, entry.SourceURL, nil)
+	if err != nil {
+		return "Invalid source URL"
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "Unreachable"
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "Removed upstream"
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("Unexpected status %d", resp.StatusCode)
+	}
+
+	if resp.ContentLength >= 0 && resp.ContentLength != entry.Size {
+		return fmt.Sprintf("Size changed (local %d, remote %d)", entry.Size, resp.ContentLength)
+	}
+
+	remoteModified := resp.Header.Get("Last-Modified")
+	if remoteModified == "" {
+		return ""
+	}
+	if entry.LastModified != "" {
+		if remoteModified != entry.LastModified {
+			return fmt.Sprintf("Last-Modified changed (local %s, remote %s)", entry.LastModified, remoteModified)
+		}
+		return ""
+	}
+
+	// Without a stored validator, a remote file newer than our copy was re-published
+	if modified, err := http.ParseTime(remoteModified); err == nil && modified.After(entry.FetchedAt) {
+		return fmt.Sprintf("Re-published upstream on %s", remoteModified)
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// runCoverage compares which registrable domains each toplist covers on the
+// same day: pairwise overlap, Jaccard index and rank correlation, and the
+// domains unique to each list
+func runCoverage(args []string) int {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// date -> dataset -> domain -> best rank (0 when the files carry none)
+	days := make(map[string]map[string]map[string]int64)
+	err = scanRecords(files, nil, func(r *record) error {
+		if days[r.Date] == nil {
+			days[r.Date] = make(map[string]map[string]int64)
+		}
+		lists := days[r.Date]
+		if lists[r.Dataset] == nil {
+			lists[r.Dataset] = make(map[string]int64)
+		}
+		domain := registrableDomain(r.QueryName)
+		if rank, ok := lists[r.Dataset][domain]; !ok || r.Rank > 0 && (rank == 0 || r.Rank < rank) {
+			lists[r.Dataset][domain] = r.Rank
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var rows [][]string
+	for _, date := range dates {
+		lists := days[date]
+		names := make([]string, 0, len(lists))
+		for name := range lists {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// Each list on its own: size and the domains no other list has
+		for _, name := range names {
+			unique := 0
+			for domain := range lists[name] {
+				shared := false
+				for _, other := range names {
+					if _, ok := lists[other][domain]; other != name && ok {
+						shared = true
+						break
+					}
+				}
+				if !shared {
+					unique++
+				}
+			}
+			size := len(lists[name])
+			rows = append(rows, []string{date, name, "", strconv.Itoa(size), "", strconv.Itoa(unique), "", ""})
+		}
+
+		for i, a := range names {
+			for _, b := range names[i+1:] {
+				overlap := 0
+				for domain := range lists[a] {
+					if _, ok := lists[b][domain]; ok {
+						overlap++
+					}
+				}
+				union := len(lists[a]) + len(lists[b]) - overlap
+				jaccard := 0.0
+				if union > 0 {
+					jaccard = float64(overlap) / float64(union)
+				}
+				correlation := ""
+				if rho, ok := rankCorrelation(lists[a], lists[b]); ok {
+					correlation = strconv.FormatFloat(rho, 'f', 4, 64)
+				}
+				rows = append(rows, []string{date, a, b, strconv.Itoa(union), strconv.Itoa(overlap), "",
+					strconv.FormatFloat(jaccard, 'f', 4, 64), correlation})
+			}
+		}
+	}
+
+	headers := []string{"date", "dataset", "other", "domains", "overlap", "unique", "jaccard", "spearman"}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// rankCorrelation computes Spearman's rank correlation over the domains both
+// lists rank; it needs at least three of them
+func rankCorrelation(a, b map[string]int64) (float64, bool) {
+	var xs, ys []float64
+	for domain, ra := range a {
+		if rb, ok := b[domain]; ok && ra > 0 && rb > 0 {
+			xs = append(xs, float64(ra))
+			ys = append(ys, float64(rb))
+		}
+	}
+	if len(xs) < 3 {
+		return 0, false
+	}
+	return pearson(ranked(xs), ranked(ys)), true
+}
+
+// ranked replaces values by their rank, ties getting their average rank
+func ranked(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+
+	ranks := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j < len(order) && values[order[j]] == values[order[i]] {
+			j++
+		}
+		for k := i; k < j; k++ {
+			ranks[order[k]] = float64(i+j+1) / 2
+		}
+		i = j
+	}
+	return ranks
+}
+
+// pearson returns the correlation coefficient of two equally long series
+func pearson(xs, ys []float64) float64 {
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+
+	var cov, vx, vy float64
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+		vx += (xs[i] - mx) * (xs[i] - mx)
+		vy += (ys[i] - my) * (ys[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
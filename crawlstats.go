@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Exit codes of the crawler
+const (
+	exitOK      = 0   // every listing and file was processed
+	exitFailed  = 1   // more failures than allowed, or the run could not start
+	exitUsage   = 2   // invalid options
+	exitPartial = 3   // completed, with failures within -max-failures
+	exitAborted = 130 // stopped by a signal
+)
+
+// succeeded reports whether a crawl that ended with code counts as a
+// success, its failures being within -max-failures
+func succeeded(code int) bool {
+	return code == exitOK || code == exitPartial
+}
+
+// stats counts the work of the crawl and what failed
+var stats crawlStats
+
+// crawlStats are the counters of a crawl
+type crawlStats struct {
+	pages, failedPages atomic.Int64
+	files, failedFiles atomic.Int64
+	emptyPages         atomic.Int64 // listing pages that loaded but linked to no file
+	rateLimited        atomic.Int64 // 429 responses
+	lockedPages        atomic.Int64 // days skipped while another instance held their -lock
+	filteredFiles      atomic.Int64 // files left out by -include and -exclude
+}
+
+// attempts returns the listing pages and files the crawl tried
+func (s *crawlStats) attempts() int64 {
+	return s.pages.Load() + s.files.Load()
+}
+
+// failures returns the listing pages and files that failed
+func (s *crawlStats) failures() int64 {
+	return s.failedPages.Load() + s.failedFiles.Load()
+}
+
+// summary describes the counters, warning about rate limiting, days locked
+// by other instances and empty listing pages, and tells how many files
+// -include and -exclude left out
+func (s *crawlStats) summary() string {
+	line := fmt.Sprintf("📊 %d listing pages (%d failed), %d files (%d failed)",
+		s.pages.Load(), s.failedPages.Load(), s.files.Load(), s.failedFiles.Load())
+	if limited := s.rateLimited.Load(); limited > 0 {
+		line += fmt.Sprintf("\n⏸️  %d requests were rate limited (HTTP 429); consider a lower -workers or a -delay", limited)
+	}
+	if locked := s.lockedPages.Load(); locked > 0 {
+		line += fmt.Sprintf("\n🔒 %d dataset/days were skipped while other instances crawled them; run again to check them", locked)
+	}
+	if filtered := s.filteredFiles.Load(); filtered > 0 {
+		line += fmt.Sprintf("\n🔎 %d files were left out by -include and -exclude", filtered)
+	}
+	if empty := s.emptyPages.Load(); empty > 0 {
+		line += fmt.Sprintf("\n🚨 %d listing pages loaded without any file link; check whether the page layout changed", empty)
+	}
+	return line
+}
+
+// failureThreshold is the number of failures a crawl tolerates, either
+// fixed or as a percentage of its attempts
+type failureThreshold struct {
+	count   int64
+	percent float64
+}
+
+// parseFailureThreshold parses a count such as 10 or a percentage such as 5%
+func parseFailureThreshold(s string) (failureThreshold, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.ParseFloat(p, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return failureThreshold{}, fmt.Errorf("invalid percentage %q", s)
+		}
+		return failureThreshold{percent: percent}, nil
+	}
+	count, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || count < 0 {
+		return failureThreshold{}, fmt.Errorf("invalid count %q (expected e.g. 10 or 5%%)", s)
+	}
+	return failureThreshold{count: count}, nil
+}
+
+// limit returns the failures tolerated out of the given attempts
+func (t failureThreshold) limit(attempts int64) int64 {
+	if t.percent > 0 {
+		return int64(t.percent / 100 * float64(attempts))
+	}
+	return t.count
+}
@@ -0,0 +1,100 @@
+package main
+
+import "testing"
+
+func TestParseFailureThreshold(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    failureThreshold
+		wantErr bool
+	}{
+		{"0", failureThreshold{}, false},
+		{"10", failureThreshold{count: 10}, false},
+		{"5%", failureThreshold{percent: 5}, false},
+		{"0.5%", failureThreshold{percent: 0.5}, false},
+		{"100%", failureThreshold{percent: 100}, false},
+		{"", failureThreshold{}, true},
+		{"-1", failureThreshold{}, true},
+		{"ten", failureThreshold{}, true},
+		{"1.5", failureThreshold{}, true},
+		{"%", failureThreshold{}, true},
+		{"-5%", failureThreshold{}, true},
+		{"101%", failureThreshold{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseFailureThreshold(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFailureThreshold(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseFailureThreshold(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureThresholdLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold failureThreshold
+		attempts  int64
+		want      int64
+	}{
+		{"none", failureThreshold{}, 1000, 0},
+		{"count", failureThreshold{count: 10}, 3, 10},
+		{"percentage", failureThreshold{percent: 5}, 1000, 50},
+		{"percentage rounded down", failureThreshold{percent: 5}, 39, 1},
+		{"percentage without attempts", failureThreshold{percent: 5}, 0, 0},
+		{"everything", failureThreshold{percent: 100}, 7, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.threshold.limit(tt.attempts); got != tt.want {
+				t.Errorf("limit(%d) = %d, want %d", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlOutcome(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxFailures        string
+		pages, failedPages int64
+		files, failedFiles int64
+		want               int
+	}{
+		{"clean", "0", 10, 0, 100, 0, exitOK},
+		{"one failure by default", "0", 10, 0, 100, 1, exitFailed},
+		{"within the count", "3", 10, 1, 100, 2, exitPartial},
+		{"above the count", "3", 10, 2, 100, 2, exitFailed},
+		{"within the percentage", "2%", 50, 1, 150, 3, exitPartial},
+		{"above the percentage", "2%", 50, 2, 150, 3, exitFailed},
+		{"clean with a threshold", "5%", 10, 0, 100, 0, exitOK},
+	}
+	t.Cleanup(func() { setStats(0, 0, 0, 0) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, err := parseFailureThreshold(tt.maxFailures)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setStats(tt.pages, tt.failedPages, tt.files, tt.failedFiles)
+			if got, reason := crawlOutcome(threshold); got != tt.want {
+				t.Errorf("crawlOutcome() = %d (%s), want %d", got, reason, tt.want)
+			}
+			if got := succeeded(tt.want); got != (tt.want != exitFailed) {
+				t.Errorf("succeeded(%d) = %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// setStats sets the counters crawlOutcome weighs
+func setStats(pages, failedPages, files, failedFiles int64) {
+	stats.pages.Store(pages)
+	stats.failedPages.Store(failedPages)
+	stats.files.Store(files)
+	stats.failedFiles.Store(failedFiles)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// throughputInterval is how often the dashboard throughput is sampled
+	throughputInterval = 10 * time.Second
+	// throughputSamples is how many samples the server keeps, an hour
+	throughputSamples = 360
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// throughputSample is the download rate of every job over an interval
+type throughputSample struct {
+	Time           time.Time `json:"time"`
+	BytesPerSecond float64   `json:"bytes_per_second"`
+	FilesPerMinute float64   `json:"files_per_minute"`
+}
+
+// coverageDay is a day of a dataset present in an archive
+type coverageDay struct {
+	Date       string `json:"date"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Incomplete bool   `json:"incomplete,omitempty"`
+}
+
+// coverageDataset lists the days of a dataset present in an archive
+type coverageDataset struct {
+	Dataset string        `json:"dataset"`
+	Days    []coverageDay `json:"days"`
+}
+
+// coverageArchive is the coverage of one download directory under the root
+type coverageArchive struct {
+	Dir      string            `json:"dir"`
+	Datasets []coverageDataset `json:"datasets"`
+}
+
+// dashboard serves the web UI
+func (s *jobServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+// throughput returns the samples of the last hour, oldest first
+func (s *jobServer) throughput(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	samples := slices.Clone(s.samples)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"interval_seconds": throughputInterval.Seconds(), "samples": samples})
+}
+
+// sampleThroughput records how much the jobs downloaded every
+// throughputInterval until ctx is done
+func (s *jobServer) sampleThroughput(ctx context.Context) {
+	ticker := time.NewTicker(throughputInterval)
+	defer ticker.Stop()
+	var lastBytes int64
+	var lastFiles int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			var bytes int64
+			var files int
+			for _, job := range s.order {
+				bytes += job.Progress.Bytes
+				files += job.Progress.Files
+			}
+			s.samples = append(s.samples, throughputSample{
+				Time:           now.UTC(),
+				BytesPerSecond: float64(bytes-lastBytes) / throughputInterval.Seconds(),
+				FilesPerMinute: float64(files-lastFiles) / throughputInterval.Minutes(),
+			})
+			if len(s.samples) > throughputSamples {
+				s.samples = slices.Delete(s.samples, 0, len(s.samples)-throughputSamples)
+			}
+			s.mu.Unlock()
+			lastBytes, lastFiles = bytes, files
+		}
+	}
+}
+
+// coverage returns the dataset days present in the archives under the root,
+// read from their manifests: the root itself, its subdirectories and the
+// destinations of the jobs
+func (s *jobServer) coverage(w http.ResponseWriter, r *http.Request) {
+	dirs := []string{"."}
+	if matches, err := filepath.Glob(filepath.Join(s.root, "*", manifestDir)); err == nil {
+		for _, match := range matches {
+			rel, _ := filepath.Rel(s.root, filepath.Dir(match))
+			dirs = append(dirs, filepath.ToSlash(rel))
+		}
+	}
+	s.mu.Lock()
+	for _, job := range s.order {
+		dirs = append(dirs, job.Dir)
+	}
+	s.mu.Unlock()
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	archives := []coverageArchive{}
+	for _, dir := range dirs {
+		if archive := s.archiveCoverage(dir); len(archive.Datasets) > 0 {
+			archives = append(archives, archive)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"archives": archives})
+}
+
+// archiveCoverage reads the manifests of one archive
+func (s *jobServer) archiveCoverage(dir string) coverageArchive {
+	archive := coverageArchive{Dir: dir}
+	paths, _ := filepath.Glob(filepath.Join(s.root, filepath.FromSlash(dir), manifestDir, "*", "*.json"))
+	byDataset := make(map[string]*coverageDataset)
+	for _, path := range paths {
+		m, err := readManifest(path)
+		if err != nil {
+			continue
+		}
+		day := coverageDay{Date: m.Date, Files: len(m.Files), Incomplete: m.Incomplete}
+		for _, entry := range m.Files {
+			day.Bytes += entry.Size
+		}
+		dataset := byDataset[m.Dataset]
+		if dataset == nil {
+			dataset = &coverageDataset{Dataset: m.Dataset}
+			byDataset[m.Dataset] = dataset
+		}
+		dataset.Days = append(dataset.Days, day)
+	}
+	for _, dataset := range byDataset {
+		slices.SortFunc(dataset.Days, func(a, b coverageDay) int { return strings.Compare(a.Date, b.Date) })
+		archive.Datasets = append(archive.Datasets, *dataset)
+	}
+	slices.SortFunc(archive.Datasets, func(a, b coverageDataset) int { return strings.Compare(a.Dataset, b.Dataset) })
+	return archive
+}
+
+// fileSize returns the size of a downloaded file, 0 if it is gone
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// readDatesFile loads the list of days to download from a file.
+// Each non-empty line holds one date in YYYY-MM-DD format; lines starting
+// with '#' are treated as comments. Duplicate dates are ignored.
+func readDatesFile(path string) ([]time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dates []time.Time
+	seen := make(map[time.Time]bool)
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		date, err := time.Parse(dateLayout, line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q (expected YYYY-MM-DD)", lineNum, line)
+		}
+		if date.Year() < defaultYear || date.Year() > maxYear {
+			return nil, fmt.Errorf("line %d: date %s is outside %d-%d", lineNum, line, defaultYear, maxYear)
+		}
+
+		if !seen[date] {
+			seen[date] = true
+			dates = append(dates, date)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("no dates found in %s", path)
+	}
+	return dates, nil
+}
+
+// parseDay parses a day given as YYYY-MM-DD, today or yesterday, in UTC
+// like the archive
+func parseDay(s string) (time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	switch s {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	day, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD, today or yesterday)", s)
+	}
+	return day, nil
+}
+
+// selectDays validates the requested year range and loads the explicit date
+// list when a dates file is given; a nil result means the whole range
+func selectDays(startYear, endYear int, datesFile string) ([]time.Time, error) {
+	if startYear < defaultYear || endYear > maxYear || startYear > endYear {
+		return nil, fmt.Errorf("year range must be between %d and %d", defaultYear, maxYear)
+	}
+	if datesFile == "" {
+		return nil, nil
+	}
+
+	dates, err := readDatesFile(datesFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading dates file: %w", err)
+	}
+	return dates, nil
+}
+
+// forEachDay calls fn for every day to crawl: the explicit dates when given,
+// otherwise every calendar day of the year range up to today, so that no
+// request is made for days like February 30 or dates not published yet
+func forEachDay(startYear, endYear int, dates []time.Time, fn func(year, month, day int)) {
+	if dates != nil {
+		// Loop through the explicit dates
+		for _, date := range dates {
+			fn(date.Year(), int(date.Month()), date.Day())
+		}
+		return
+	}
+
+	last := time.Date(endYear, time.December, 31, 0, 0, 0, 0, time.UTC)
+	if today := time.Now().UTC().Truncate(24 * time.Hour); today.Before(last) {
+		last = today
+	}
+	for date := time.Date(startYear, time.January, 1, 0, 0, 0, 0, time.UTC); !date.After(last); date = date.AddDate(0, 0, 1) {
+		fn(date.Year(), int(date.Month()), date.Day())
+	}
+}
+
+// selectDatasets parses a comma-separated list of datasets to crawl
+func selectDatasets(list string) ([]string, error) {
+	var selected []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(datasets, name) {
+			return nil, fmt.Errorf("unknown dataset %q (expected %s)", name, strings.Join(datasets, ", "))
+		}
+		if !slices.Contains(selected, name) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// lockTTL is how long the lock of a day outlives an instance that died;
+	// live instances renew their locks every quarter of it
+	lockTTL = 2 * time.Minute
+	// lockDir holds the lock files of -lock file, under the download
+	// directory
+	lockDir = "locks"
+)
+
+// dayLocks keeps instances sharing a destination from crawling the same
+// dataset/day at the same time when the crawler is started with -lock; nil
+// without
+var dayLocks *lockManager
+
+// dayLocker takes, renews and releases named leases on behalf of owner
+type dayLocker interface {
+	// acquire takes a lease, or reports who holds it
+	acquire(ctx context.Context, name, owner string) (bool, string, error)
+	// renew extends a lease the owner holds
+	renew(ctx context.Context, name, owner string) error
+	// release drops a lease the owner holds
+	release(ctx context.Context, name, owner string) error
+	close()
+}
+
+// lockManager holds the locks of the days being crawled and renews them
+// until they are released
+type lockManager struct {
+	locker dayLocker
+	owner  string // host and process of this instance
+	mu     sync.Mutex
+	held   map[string]bool
+	stop   context.CancelFunc
+}
+
+// openDayLocks returns the lock manager of a -lock spec: a redis:// URL, or
+// "file" for lock files in the download directory, for shared mounts
+func openDayLocks(spec string) (*lockManager, error) {
+	var locker dayLocker
+	if spec == "file" {
+		locker = fileLocker{dir: filepath.Join(downloadDir, lockDir)}
+	} else {
+		u, err := url.Parse(spec)
+		if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			return nil, fmt.Errorf("-lock %q: expected a redis:// URL or file", spec)
+		}
+		options, err := redis.ParseURL(spec)
+		if err != nil {
+			return nil, err
+		}
+		client := redis.NewClient(options)
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("connecting to Redis: %w", err)
+		}
+		locker = redisLocker{client: client}
+	}
+
+	host, _ := os.Hostname()
+	ctx, stop := context.WithCancel(context.Background())
+	m := &lockManager{locker: locker, owner: fmt.Sprintf("%s:%d", host, os.Getpid()), held: make(map[string]bool), stop: stop}
+	go m.keepAlive(ctx)
+	fmt.Println("🔒 Locking every dataset/day while it is crawled, as", m.owner)
+	return m, nil
+}
+
+// lockName names the lock of a listing page
+func lockName(page listing) string {
+	return page.Dataset + "/" + page.Date()
+}
+
+// lock takes the lock of a day before it is crawled; it reports false,
+// having said why, when the day is locked by another instance or could
+// not be locked
+func (m *lockManager) lock(page listing) bool {
+	name := lockName(page)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ok, holder, err := m.locker.acquire(ctx, name, m.owner)
+	if err != nil {
+		fmt.Printf("❌ Error locking %s: %v\n", name, err)
+		recordFailure("listing", page.URL(), 1, fmt.Errorf("locking: %w", err))
+		stats.pages.Add(1)
+		stats.failedPages.Add(1)
+		return false
+	}
+	if !ok {
+		fmt.Printf("🔒 Skipping %s: %s is crawling it\n", name, holder)
+		stats.lockedPages.Add(1)
+		return false
+	}
+	m.mu.Lock()
+	m.held[name] = true
+	m.mu.Unlock()
+	return true
+}
+
+// unlock releases the lock of a day once its manifest is written
+func (m *lockManager) unlock(page listing) {
+	name := lockName(page)
+	m.mu.Lock()
+	delete(m.held, name)
+	m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := m.locker.release(ctx, name, m.owner); err != nil {
+		fmt.Printf("❌ Error unlocking %s: %v\n", name, err)
+	}
+}
+
+// keepAlive renews the locks held until ctx is done
+func (m *lockManager) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(lockTTL / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		names := make([]string, 0, len(m.held))
+		for name := range m.held {
+			names = append(names, name)
+		}
+		m.mu.Unlock()
+		for _, name := range names {
+			renew, cancel := context.WithTimeout(ctx, lockTTL/4)
+			if err := m.locker.renew(renew, name, m.owner); err != nil && ctx.Err() == nil {
+				fmt.Printf("🔒 Could not renew the lock of %s, another instance may take it over: %v\n", name, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// close stops renewing the locks; any still held expire after lockTTL
+func (m *lockManager) close() {
+	m.stop()
+	m.locker.close()
+}
+
+// errLockLost is returned when renewing or releasing a lock someone else
+// holds now
+var errLockLost = errors.New("the lock expired and was taken over")
+
+// redisRenewScript extends a lease if KEYS[1] still holds ARGV[1]
+var redisRenewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// redisReleaseScript deletes KEYS[1] if it still holds ARGV[1]
+var redisReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// redisLocker keeps leases as openintel:lock:<dataset>/<date> keys holding
+// their owner and expiring after lockTTL
+type redisLocker struct {
+	client *redis.Client
+}
+
+// acquire implements dayLocker
+func (l redisLocker) acquire(ctx context.Context, name, owner string) (bool, string, error) {
+	key := "openintel:lock:" + name
+	ok, err := l.client.SetNX(ctx, key, owner, lockTTL).Result()
+	if err != nil || ok {
+		return ok, "", err
+	}
+	holder, err := l.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		// Released in between; try once more
+		ok, err = l.client.SetNX(ctx, key, owner, lockTTL).Result()
+		return ok, "another instance", err
+	}
+	return false, holder, err
+}
+
+// renew implements dayLocker
+func (l redisLocker) renew(ctx context.Context, name, owner string) error {
+	renewed, err := redisRenewScript.Run(ctx, l.client, []string{"openintel:lock:" + name}, owner, lockTTL.Milliseconds()).Int()
+	if err == nil && renewed == 0 {
+		return errLockLost
+	}
+	return err
+}
+
+// release implements dayLocker
+func (l redisLocker) release(ctx context.Context, name, owner string) error {
+	released, err := redisReleaseScript.Run(ctx, l.client, []string{"openintel:lock:" + name}, owner).Int()
+	if err == nil && released == 0 {
+		return errLockLost
+	}
+	return err
+}
+
+// close implements dayLocker
+func (l redisLocker) close() {
+	l.client.Close()
+}
+
+// fileLocker keeps leases as files created exclusively, which NFS and
+// other shared file systems support, holding their owner; a lease is
+// renewed by touching its file and expires when the file is older than
+// lockTTL. Two instances finding the same expired file at once may both
+// take the lock over, so the clocks of the instances must agree.
+type fileLocker struct {
+	dir string
+}
+
+// path returns the lock file of a lease
+func (l fileLocker) path(name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(name)+".lock")
+}
+
+// acquire implements dayLocker
+func (l fileLocker) acquire(ctx context.Context, name, owner string) (bool, string, error) {
+	path := l.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, "", err
+	}
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.WriteString(owner + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err == nil, "", err
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, "", err
+		}
+
+		holder, info, err := l.read(path)
+		if errors.Is(err, fs.ErrNotExist) && attempt < 2 {
+			continue // released in between
+		}
+		if err != nil {
+			return false, "", err
+		}
+		if attempt > 0 || time.Since(info.ModTime()) < lockTTL {
+			return false, holder, nil
+		}
+		// The holder died without releasing it
+		fmt.Printf("🔒 Taking over the expired lock of %s from %s\n", name, holder)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, "", err
+		}
+	}
+}
+
+// read returns the owner of a lock file and its file info
+func (l fileLocker) read(path string) (string, fs.FileInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(string(data)), info, nil
+}
+
+// renew implements dayLocker
+func (l fileLocker) renew(ctx context.Context, name, owner string) error {
+	path := l.path(name)
+	holder, _, err := l.read(path)
+	if err != nil {
+		return err
+	}
+	if holder != owner {
+		return errLockLost
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// release implements dayLocker
+func (l fileLocker) release(ctx context.Context, name, owner string) error {
+	path := l.path(name)
+	holder, _, err := l.read(path)
+	if err != nil {
+		return err
+	}
+	if holder != owner {
+		return errLockLost
+	}
+	return os.Remove(path)
+}
+
+// close implements dayLocker
+func (fileLocker) close() {}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// deltaTypes maps the neutral column types to Delta (Spark SQL) types
+var deltaTypes = map[string]string{
+	"boolean": "boolean", "int": "integer", "long": "long", "float": "float", "double": "double",
+	"string": "string", "binary": "binary", "date": "date", "timestamp": "timestamp",
+}
+
+// deltaField is a column of a Delta table schema
+type deltaField struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Nullable bool           `json:"nullable"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// deltaMetadata is the metaData action describing the table
+type deltaMetadata struct {
+	ID               string            `json:"id"`
+	Format           map[string]any    `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+// deltaAdd is the add action of a data file
+type deltaAdd struct {
+	Path             string            `json:"path"`
+	PartitionValues  map[string]string `json:"partitionValues"`
+	Size             int64             `json:"size"`
+	ModificationTime int64             `json:"modificationTime"`
+	DataChange       bool              `json:"dataChange"`
+	Stats            string            `json:"stats,omitempty"`
+}
+
+// deltaAction is one line of a commit file
+type deltaAction struct {
+	Protocol   map[string]int `json:"protocol,omitempty"`
+	MetaData   *deltaMetadata `json:"metaData,omitempty"`
+	Add        *deltaAdd      `json:"add,omitempty"`
+	CommitInfo map[string]any `json:"commitInfo,omitempty"`
+}
+
+// deltaLog is the state of a table replayed from its transaction log
+type deltaLog struct {
+	Version  int64 // last committed version, -1 for a new table
+	Metadata *deltaMetadata
+	Fields   []deltaField
+	Days     map[string]bool // "dataset/date" partitions with files
+}
+
+// runExportDelta stages the selected days as a Delta Lake table partitioned
+// by dataset and date, committing each dataset/day as its own transaction
+func runExportDelta(args []string) int {
+	flags := flag.NewFlagSet("export-delta", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	output := flags.String("output", "", "Table directory to create or extend")
+	flags.Parse(args)
+
+	if *output == "" {
+		fmt.Println("❌ Error: --output is required")
+		return exitUsage
+	}
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	log, err := readDeltaLog(*output)
+	if err != nil {
+		fmt.Println("❌ Error reading transaction log:", err)
+		return exitFailed
+	}
+
+	committed, skipped := 0, 0
+	for _, day := range groupByDay(files) {
+		if log.Days[day[0].Dataset+"/"+day[0].Date] {
+			skipped++
+			continue
+		}
+		var staged []*lakeFile
+		for _, file := range day {
+			f, err := stageLakeFile(*output, file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "❌ Error staging file:", err)
+				return exitFailed
+			}
+			staged = append(staged, f)
+		}
+		if err := commitDeltaDay(*output, log, staged); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error committing %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "🔺 Committed %s %s as version %d: %d files\n", day[0].Dataset, day[0].Date, log.Version, len(staged))
+		committed++
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Committed %d dataset/days (%d already in the table) to %s\n", committed, skipped, *output)
+	return exitOK
+}
+
+// readDeltaLog replays the JSON commits of a table directory
+func readDeltaLog(dir string) (*deltaLog, error) {
+	log := &deltaLog{Version: -1, Days: make(map[string]bool)}
+	commits, err := filepath.Glob(filepath.Join(dir, "_delta_log", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(commits)
+
+	for _, path := range commits {
+		var version int64
+		if _, err := fmt.Sscanf(filepath.Base(path), "%020d.json", &version); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var action deltaAction
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if action.MetaData != nil {
+				log.Metadata = action.MetaData
+			}
+			if action.Add != nil {
+				log.Days[action.Add.PartitionValues["dataset"]+"/"+action.Add.PartitionValues["date"]] = true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		log.Version = version
+	}
+
+	if log.Metadata != nil {
+		var schema struct {
+			Fields []deltaField `json:"fields"`
+		}
+		if err := json.Unmarshal([]byte(log.Metadata.SchemaString), &schema); err != nil {
+			return nil, fmt.Errorf("invalid table schema: %w", err)
+		}
+		log.Fields = schema.Fields
+	}
+	return log, nil
+}
+
+// commitDeltaDay writes the next commit adding the files of one dataset/day,
+// with a new metaData action when the files bring new columns
+func commitDeltaDay(dir string, log *deltaLog, staged []*lakeFile) error {
+	now := time.Now().UnixMilli()
+	var actions []deltaAction
+
+	if log.Version < 0 {
+		actions = append(actions, deltaAction{Protocol: map[string]int{"minReaderVersion": 1, "minWriterVersion": 2}})
+		log.Metadata = &deltaMetadata{
+			ID:               newUUID(),
+			Format:           map[string]any{"provider": "parquet", "options": map[string]string{}},
+			PartitionColumns: []string{"dataset", "date"},
+			Configuration:    map[string]string{},
+			CreatedTime:      now,
+		}
+		log.Fields = []deltaField{
+			{Name: "dataset", Type: "string", Nullable: true, Metadata: map[string]any{}},
+			{Name: "date", Type: "date", Nullable: true, Metadata: map[string]any{}},
+		}
+	}
+
+	// New columns are appended to the schema; type changes are only reported
+	known := make(map[string]string, len(log.Fields))
+	for _, f := range log.Fields {
+		known[f.Name] = f.Type
+	}
+	changed := log.Version < 0
+	for _, file := range staged {
+		for _, c := range file.Columns {
+			t := deltaTypes[c.Type]
+			switch current, ok := known[c.Name]; {
+			case !ok:
+				known[c.Name] = t
+				log.Fields = append(log.Fields, deltaField{Name: c.Name, Type: t, Nullable: true, Metadata: map[string]any{}})
+				changed = true
+			case current != t:
+				fmt.Fprintf(os.Stderr, "⚠️  Column %s is %s in %s but %s in the table\n", c.Name, t, file.Path, current)
+			}
+		}
+	}
+	if changed {
+		schema, _ := json.Marshal(map[string]any{"type": "struct", "fields": log.Fields})
+		log.Metadata.SchemaString = string(schema)
+		actions = append(actions, deltaAction{MetaData: log.Metadata})
+	}
+
+	var rows int64
+	for _, f := range staged {
+		stats, _ := json.Marshal(map[string]int64{"numRecords": f.Rows})
+		actions = append(actions, deltaAction{Add: &deltaAdd{
+			Path:             f.Rel,
+			PartitionValues:  map[string]string{"dataset": f.Dataset, "date": f.Date},
+			Size:             f.Size,
+			ModificationTime: now,
+			DataChange:       true,
+			Stats:            string(stats),
+		}})
+		rows += f.Rows
+	}
+	actions = append(actions, deltaAction{CommitInfo: map[string]any{
+		"timestamp":           now,
+		"operation":           "WRITE",
+		"operationParameters": map[string]string{"mode": "Append", "partitionBy": `["dataset","date"]`},
+		"operationMetrics":    map[string]string{"numFiles": fmt.Sprint(len(staged)), "numOutputRows": fmt.Sprint(rows)},
+		"engineInfo":          "gopenintel",
+	}})
+
+	var body bytes.Buffer
+	for _, action := range actions {
+		line, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	logDir := filepath.Join(dir, "_delta_log")
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return err
+	}
+	// Creating the commit exclusively is what makes concurrent writers
+	// fail instead of overwriting each other
+	version := log.Version + 1
+	path := filepath.Join(logDir, fmt.Sprintf("%020d.json", version))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Link(tmp, path); err != nil {
+		os.Remove(tmp)
+		if os.IsExist(err) {
+			return fmt.Errorf("version %d was committed concurrently", version)
+		}
+		return err
+	}
+	os.Remove(tmp)
+
+	log.Version = version
+	for _, f := range staged {
+		log.Days[f.Dataset+"/"+f.Date] = true
+	}
+	return nil
+}
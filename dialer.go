@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ipv4Only bool   // Connect over IPv4 only
+	ipv6Only bool   // Connect over IPv6 only
+	bindAddr string // Local address or interface outgoing connections leave from
+)
+
+// addNetworkFlags registers the address family and source address flags of
+// the commands that talk to the archive
+func addNetworkFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&ipv4Only, "ipv4", false, "Connect over IPv4 only")
+	flags.BoolVar(&ipv6Only, "ipv6", false, "Connect over IPv6 only")
+	flags.StringVar(&bindAddr, "bind", "", "Local IP address or network interface outgoing connections leave from (optional)")
+}
+
+// familyDialer is a net.Dialer restricted to the address family chosen by
+// -ipv4 or -ipv6, "4" or "6", if any, and bound to the -bind address
+type familyDialer struct {
+	net.Dialer
+	family string
+	bind   net.IP
+}
+
+// newDialer returns the dialer of the archive client, bound to the -bind
+// address if given
+func newDialer() (*familyDialer, error) {
+	if ipv4Only && ipv6Only {
+		return nil, errors.New("-ipv4 and -ipv6 cannot be combined")
+	}
+	d := &familyDialer{Dialer: net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}}
+	switch {
+	case ipv4Only:
+		d.family = "4"
+		fmt.Println("📍 Connecting over IPv4 only")
+	case ipv6Only:
+		d.family = "6"
+		fmt.Println("📍 Connecting over IPv6 only")
+	}
+	if bindAddr != "" {
+		ip, err := bindIP(bindAddr, d.family)
+		if err != nil {
+			return nil, err
+		}
+		// The dialer only connects to addresses of the family of its
+		// local address
+		d.bind = ip
+		fmt.Println("📍 Binding outgoing connections to", ip)
+	}
+	return d, nil
+}
+
+// bindIP returns the address to bind to for -bind: the address itself, or
+// the first global address of the family on the named interface
+func bindIP(addr, family string) (net.IP, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		if !familyMatches(ip, family) {
+			return nil, fmt.Errorf("-bind %s is not an IPv%s address", addr, family)
+		}
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return nil, fmt.Errorf("-bind %s: not an IP address or interface: %w", addr, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() && familyMatches(ipNet.IP, family) {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("-bind %s: the interface has no global address to bind to", addr)
+}
+
+// familyMatches reports whether ip belongs to the family, "" matching both
+func familyMatches(ip net.IP, family string) bool {
+	switch family {
+	case "4":
+		return ip.To4() != nil
+	case "6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// DialContext implements proxy.ContextDialer, restricting tcp and udp
+// connections to the family and binding them
+func (d *familyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" || network == "udp" {
+		network += d.family
+	}
+	dialer := d.Dialer
+	if d.bind != nil {
+		if strings.HasPrefix(network, "udp") {
+			dialer.LocalAddr = &net.UDPAddr{IP: d.bind}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: d.bind}
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// Dial implements proxy.Dialer
+func (d *familyDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// lookupIP resolves a host name to the addresses of the family
+func (d *familyDialer) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return resolver.LookupIP(ctx, "ip"+d.family, host)
+}
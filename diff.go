@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// domainChange lists the record changes of a domain present on both days
+type domainChange struct {
+	Name    string   `json:"name"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// datasetDiff is the comparison of one dataset between two days
+type datasetDiff struct {
+	Dataset string         `json:"dataset"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Added   []string       `json:"added"`
+	Removed []string       `json:"removed"`
+	Changed []domainChange `json:"changed"`
+}
+
+// runDiff compares the records of a dataset between two days
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	dataset := flags.String("dataset", "", "Dataset to compare")
+	from := flags.String("from", "", "Base day (YYYY-MM-DD)")
+	to := flags.String("to", "", "Day compared with the base day (YYYY-MM-DD)")
+	asJSON := flags.Bool("json", false, "Print the diff as JSON")
+	flags.Parse(args)
+
+	if *dataset == "" || *from == "" || *to == "" {
+		fmt.Println("❌ Error: usage is diff --dataset=NAME --from=YYYY-MM-DD --to=YYYY-MM-DD")
+		return exitUsage
+	}
+
+	before, err := loadDayRecords(*dataset, *from)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+	after, err := loadDayRecords(*dataset, *to)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+
+	d := diffDays(before, after)
+	d.Dataset, d.From, d.To = *dataset, *from, *to
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(d)
+		return exitOK
+	}
+
+	fmt.Printf("📊 %s %s → %s: %d added, %d removed, %d changed\n",
+		d.Dataset, d.From, d.To, len(d.Added), len(d.Removed), len(d.Changed))
+	for _, name := range d.Added {
+		fmt.Println("+", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Println("-", name)
+	}
+	for _, c := range d.Changed {
+		fmt.Println("~", c.Name)
+		for _, rr := range c.Added {
+			fmt.Println("    +", rr)
+		}
+		for _, rr := range c.Removed {
+			fmt.Println("    -", rr)
+		}
+	}
+	return exitOK
+}
+
+// loadDayRecords returns the records of a dataset/day as a set of
+// "TYPE value" strings per query name
+func loadDayRecords(dataset, date string) (map[string]map[string]bool, error) {
+	filter := &archiveFilter{Datasets: dataset, From: date, To: date}
+	files, err := filter.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files for %s on %s", dataset, date)
+	}
+
+	domains := make(map[string]map[string]bool)
+	err = scanRecords(files, nil, func(r *record) error {
+		name := strings.ToLower(r.QueryName)
+		if name == "" {
+			return nil
+		}
+		if domains[name] == nil {
+			domains[name] = make(map[string]bool)
+		}
+		if r.ResponseType != "" {
+			domains[name][strings.TrimSpace(r.ResponseType+" "+r.Value())] = true
+		}
+		return nil
+	})
+	return domains, err
+}
+
+// diffDays compares the per-domain record sets of two days
+func diffDays(before, after map[string]map[string]bool) *datasetDiff {
+	d := &datasetDiff{Added: []string{}, Removed: []string{}, Changed: []domainChange{}}
+
+	for name, records := range after {
+		old, ok := before[name]
+		if !ok {
+			d.Added = append(d.Added, name)
+			continue
+		}
+		change := domainChange{Name: name, Added: setDifference(records, old), Removed: setDifference(old, records)}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			d.Changed = append(d.Changed, change)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+	return d
+}
+
+// setDifference returns the sorted members of a that are not in b
+func setDifference(a, b map[string]bool) []string {
+	out := []string{}
+	for key := range a {
+		if !b[key] {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskPollInterval is how often paused downloads check the free space again
+const diskPollInterval = 30 * time.Second
+
+// disk is the free-space guard of the download directory
+var disk = &diskGuard{}
+
+// preflightLinks holds the listing pages fetched by the preflight, so the
+// crawl does not request them a second time
+var preflightLinks map[string][]string
+
+// diskGuard pauses downloads while the free space of the archive, minus the
+// bytes still to be written by the downloads in flight, is below a floor
+type diskGuard struct {
+	floor    int64 // 0 disables the guard
+	reserved atomic.Int64
+	mu       sync.Mutex
+	paused   bool
+}
+
+// wait blocks until there is room for another download; it reports false
+// when the crawl is stopped while waiting
+func (g *diskGuard) wait() bool {
+	if g.floor == 0 {
+		return true
+	}
+	for {
+		free, err := freeSpace(downloadDir)
+		if err != nil || free < 0 || free-g.reserved.Load() >= g.floor {
+			g.resume()
+			return true
+		}
+		g.mu.Lock()
+		if !g.paused {
+			g.paused = true
+			fmt.Printf("💾 Low disk space: %s free in %s, keeping %s free; pausing downloads\n", formatSize(free), downloadDir, formatSize(g.floor))
+		}
+		g.mu.Unlock()
+		select {
+		case <-time.After(diskPollInterval):
+		case <-stopping.Done():
+			return false
+		}
+	}
+}
+
+// resume announces the end of a pause
+func (g *diskGuard) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		fmt.Println("💾 Disk space available again, resuming downloads")
+	}
+}
+
+// reserve accounts for the announced size of a download being written and
+// returns the function that releases it
+func (g *diskGuard) reserve(size int64) func() {
+	if g.floor == 0 || size <= 0 {
+		return func() {}
+	}
+	g.reserved.Add(size)
+	return func() { g.reserved.Add(-size) }
+}
+
+// preflight lists every page of the run and asks for the size of the files
+// not downloaded yet, and fails when they do not fit above the floor
+func preflight(forEach func(fn func(year, month, day int))) error {
+	fmt.Println("📏 Estimating the space needed by the run")
+
+	pages := make(chan listing)
+	go func() {
+		forEach(func(year, month, day int) {
+			for _, dataset := range datasets {
+				pages <- listing{Dataset: dataset, Year: year, Month: month, Day: day}
+			}
+		})
+		close(pages)
+	}()
+
+	var (
+		mu             sync.Mutex
+		needed         int64
+		files, unknown int
+		wg             sync.WaitGroup
+		workers        = workerLimit + listingWorkers
+		fetched        = make(map[string][]string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				if stopped() {
+					continue
+				}
+				links, ok := listPage(page)
+				if !ok {
+					continue
+				}
+				for _, link := range links {
+					if _, err := os.Stat(filepath.Join(dayDir(page), localName(link))); err == nil {
+						continue
+					}
+					size := remoteSize(link)
+					mu.Lock()
+					files++
+					if size < 0 {
+						unknown++
+					} else {
+						needed += size
+					}
+					mu.Unlock()
+				}
+				mu.Lock()
+				fetched[page.URL()] = links
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accessDenied.Load() {
+		return errors.New("the archive denied access")
+	}
+	preflightLinks = fetched
+
+	free, err := freeSpace(downloadDir)
+	if err != nil {
+		return fmt.Errorf("reading free space of %s: %w", downloadDir, err)
+	}
+	fmt.Printf("📏 %d files to download, %s", files, formatSize(needed))
+	if unknown > 0 {
+		fmt.Printf(" (%d without a size)", unknown)
+	}
+	fmt.Println()
+	if free < 0 {
+		fmt.Println("⚠️  Free space is unknown on this platform; skipping the check")
+		return nil
+	}
+	if needed > free-disk.floor {
+		return fmt.Errorf("not enough disk space in %s: the run needs %s, %s is free and %s must stay free (-min-free)",
+			downloadDir, formatSize(needed), formatSize(free), formatSize(disk.floor))
+	}
+	fmt.Printf("✅ %s free in %s\n", formatSize(free), downloadDir)
+	return nil
+}
+
+// remoteSize asks for the size of a remote file, -1 when it is not announced
+func remoteSize(fileURL string) int64 {
+	req, err := http.NewRequestWithContext(aborting, http.MethodHead, fileURL, nil)
+	if err != nil {
+		return -1
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
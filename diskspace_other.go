@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// freeSpace reports the free space as unknown (-1) where statfs is not available
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
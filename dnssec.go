@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dnssecState records which DNSSEC records were seen for a domain
+type dnssecState struct {
+	ds, dnskey, rrsig bool
+}
+
+// signed reports whether the domain has a delegation signer and keys, i.e. a
+// chain of trust validators can follow
+func (s dnssecState) signed() bool {
+	return s.ds && s.dnskey
+}
+
+// runDNSSEC reports DNSSEC deployment per TLD or per toplist over time
+func runDNSSEC(args []string) int {
+	flags := flag.NewFlagSet("dnssec", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	by := flags.String("by", "tld", "Group domains by \"tld\" or report whole \"dataset\" rates")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if *by != "tld" && *by != "dataset" {
+		fmt.Println("❌ Error: --by must be tld or dataset")
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		// Records of subdomains count towards their registrable domain
+		domains := make(map[string]*dnssecState)
+		err := scanRecords(day, nil, func(r *record) error {
+			domain := registrableDomain(r.QueryName)
+			state, ok := domains[domain]
+			if !ok {
+				state = &dnssecState{}
+				domains[domain] = state
+			}
+			switch r.ResponseType {
+			case "DS":
+				state.ds = true
+			case "DNSKEY":
+				state.dnskey = true
+			case "RRSIG":
+				state.rrsig = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		groups := make(map[string][]dnssecState)
+		for domain, state := range domains {
+			group := day[0].Dataset
+			if *by == "tld" {
+				group = domain[strings.LastIndex(domain, ".")+1:]
+			}
+			groups[group] = append(groups[group], *state)
+		}
+
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var ds, dnskey, rrsig, signed int
+			for _, state := range groups[name] {
+				if state.ds {
+					ds++
+				}
+				if state.dnskey {
+					dnskey++
+				}
+				if state.rrsig {
+					rrsig++
+				}
+				if state.signed() {
+					signed++
+				}
+			}
+			total := len(groups[name])
+			row := []string{day[0].Date, day[0].Dataset}
+			if *by == "tld" {
+				row = append(row, name)
+			}
+			rows = append(rows, append(row, strconv.Itoa(total),
+				strconv.Itoa(ds), strconv.Itoa(dnskey), strconv.Itoa(rrsig), strconv.Itoa(signed), percent(signed, total)))
+		}
+	}
+
+	headers := []string{"date", "dataset"}
+	if *by == "tld" {
+		headers = append(headers, "tld")
+	}
+	headers = append(headers, "domains", "ds", "dnskey", "rrsig", "signed", "share")
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runBuildDB ingests the selected days into a single .duckdb file through
+// the duckdb CLI, with one view per dataset over the record table
+func runBuildDB(args []string) int {
+	flags := flag.NewFlagSet("build-db", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	output := flags.String("output", "openintel.duckdb", "DuckDB database to create or extend")
+	table := flags.String("table", "records", "Table receiving the records")
+	duckdb := flags.String("duckdb", "duckdb", "Path of the duckdb CLI")
+	printSQL := flags.Bool("print-sql", false, "Print the SQL script instead of running it")
+	flags.Parse(args)
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if len(files) == 0 {
+		fmt.Println("❌ Error: no archive files match the filter")
+		return exitFailed
+	}
+
+	script := buildDBScript(*table, groupByDay(files))
+	if *printSQL {
+		fmt.Print(script)
+		return exitOK
+	}
+
+	if _, err := exec.LookPath(*duckdb); err != nil {
+		fmt.Println("❌ Error: duckdb CLI not found (install it or pass --duckdb):", err)
+		return exitFailed
+	}
+	cmd := exec.Command(*duckdb, "-bail", *output)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error running duckdb:", err)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Loaded %d files into %s\n", len(files), *output)
+	return exitOK
+}
+
+// buildDBScript returns the SQL loading each dataset/day in its own
+// transaction; days already in the table are replaced so reruns are safe
+func buildDBScript(table string, days [][]archiveFile) string {
+	var sql strings.Builder
+	quoted := sqlIdentifier(table)
+
+	// The table takes its schema from the first day, plus the two columns
+	// the file layout encodes
+	fmt.Fprintf(&sql, "CREATE TABLE IF NOT EXISTS %s AS SELECT *, ''::VARCHAR AS dataset, NULL::DATE AS date FROM %s LIMIT 0;\n",
+		quoted, duckdbParquetScan(days[0]))
+
+	datasets := make(map[string]bool)
+	for _, day := range days {
+		dataset, date := duckdbString(day[0].Dataset), duckdbString(day[0].Date)
+		datasets[day[0].Dataset] = true
+		fmt.Fprintf(&sql, ".print '🦆 Loading %s %s'\n", day[0].Dataset, day[0].Date)
+		sql.WriteString("BEGIN TRANSACTION;\n")
+		fmt.Fprintf(&sql, "DELETE FROM %s WHERE dataset = %s AND date = DATE %s;\n", quoted, dataset, date)
+		fmt.Fprintf(&sql, "INSERT INTO %s BY NAME SELECT *, %s AS dataset, DATE %s AS date FROM %s;\n",
+			quoted, dataset, date, duckdbParquetScan(day))
+		sql.WriteString("COMMIT;\n")
+	}
+
+	for _, dataset := range sortedKeys(datasets) {
+		fmt.Fprintf(&sql, "CREATE OR REPLACE VIEW %s AS SELECT * FROM %s WHERE dataset = %s;\n",
+			sqlIdentifier(dataset), quoted, duckdbString(dataset))
+	}
+	fmt.Fprintf(&sql, "CREATE INDEX IF NOT EXISTS %s ON %s (dataset, date);\n", sqlIdentifier(table+"_day_idx"), quoted)
+	sql.WriteString("CHECKPOINT;\n")
+	return sql.String()
+}
+
+// duckdbParquetScan reads the files of one dataset/day, tolerating columns
+// that only some files have
+func duckdbParquetScan(files []archiveFile) string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		path, err := filepath.Abs(f.Path)
+		if err != nil {
+			path = f.Path
+		}
+		paths[i] = duckdbString(path)
+	}
+	return "read_parquet([" + strings.Join(paths, ", ") + "], union_by_name = true)"
+}
+
+// duckdbString quotes a SQL string literal
+func duckdbString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// elasticTypes maps export column kinds to Elasticsearch field types
+var elasticTypes = map[string]string{"text": "keyword", "bigint": "long", "date": "date"}
+
+// elasticSink bulk-indexes documents into an Elasticsearch or OpenSearch cluster
+type elasticSink struct {
+	URL    string
+	User   string
+	APIKey string
+	client *http.Client
+
+	body    bytes.Buffer
+	pending int
+}
+
+// runIndexElastic bulk-indexes the selected records into one index per day,
+// <prefix>-YYYY.MM.DD, so retention can be managed with ILM or ISM policies
+func runIndexElastic(args []string) int {
+	flags := flag.NewFlagSet("index-elastic", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	selection := addExportFlags(flags)
+	sink := &elasticSink{}
+	flags.StringVar(&sink.URL, "url", "http://localhost:9200", "Elasticsearch or OpenSearch URL")
+	flags.StringVar(&sink.User, "user", os.Getenv("ELASTIC_USER"), "Basic auth credentials as USER:PASSWORD (default $ELASTIC_USER)")
+	flags.StringVar(&sink.APIKey, "api-key", os.Getenv("ELASTIC_API_KEY"), "Encoded API key (default $ELASTIC_API_KEY)")
+	prefix := flags.String("index-prefix", "openintel", "Prefix of the daily index names")
+	batch := flags.Int("batch", 5000, "Documents sent per bulk request")
+	policy := flags.String("ilm-policy", "", "ILM policy set on the daily indices through the index template")
+	noTemplate := flags.Bool("no-template", false, "Do not install the index template")
+	flags.Parse(args)
+
+	if *batch < 1 {
+		fmt.Println("❌ Error: --batch must be at least 1")
+		return exitUsage
+	}
+	if err := selection.prepare("dataset", "date"); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	sink.URL = strings.TrimSuffix(sink.URL, "/")
+	sink.client = &http.Client{Timeout: 2 * time.Minute}
+
+	if !*noTemplate {
+		if err := sink.putTemplate(*prefix, *policy, selection); err != nil {
+			fmt.Println("❌ Error installing index template:", err)
+			return exitFailed
+		}
+	}
+
+	total := 0
+	for _, day := range groupByDay(files) {
+		index := *prefix + "-" + strings.ReplaceAll(day[0].Date, "-", ".")
+		n := 0
+		err := scanRecords(day, nil, func(r *record) error {
+			if !selection.includes(r) {
+				return nil
+			}
+			if err := sink.add(index, selection.document(r)); err != nil {
+				return err
+			}
+			n++
+			if sink.pending >= *batch {
+				return sink.flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = sink.flush()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error indexing %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "🔎 Indexed %s %s into %s: %d documents\n", day[0].Dataset, day[0].Date, index, n)
+		total += n
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Indexed %d documents into %s\n", total, sink.URL)
+	return exitOK
+}
+
+// putTemplate installs the index template mapping the exported columns of
+// every <prefix>-* index
+func (s *elasticSink) putTemplate(prefix, policy string, selection *exportSelection) error {
+	properties := make(map[string]any, len(selection.columns))
+	for _, c := range selection.columns {
+		properties[c.Name] = map[string]string{"type": elasticTypes[c.Kind]}
+	}
+	template := map[string]any{"mappings": map[string]any{"properties": properties}}
+	if policy != "" {
+		template["settings"] = map[string]any{"index.lifecycle.name": policy}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"index_patterns": []string{prefix + "-*"},
+		"template":       template,
+	})
+	_, err := s.request(http.MethodPut, "/_index_template/"+prefix, "application/json", body)
+	return err
+}
+
+// add queues a document for the next bulk request; its ID is derived from
+// its content so indexing a day again overwrites instead of duplicating
+func (s *elasticSink) add(index string, doc map[string]any) error {
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	sum := sha1.Sum(append([]byte(index+"\x00"), source...))
+	action, _ := json.Marshal(map[string]any{"index": map[string]string{"_index": index, "_id": hex.EncodeToString(sum[:])}})
+
+	s.body.Write(action)
+	s.body.WriteByte('\n')
+	s.body.Write(source)
+	s.body.WriteByte('\n')
+	s.pending++
+	return nil
+}
+
+// flush sends the queued documents in one bulk request
+func (s *elasticSink) flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+	data, err := s.request(http.MethodPost, "/_bulk", "application/x-ndjson", s.body.Bytes())
+	if err != nil {
+		return err
+	}
+	s.body.Reset()
+	s.pending = 0
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, status := range item {
+			if status.Error != nil {
+				if first == nil {
+					first = status.Error
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("%d documents rejected, first error: %s", failed, first)
+}
+
+// request sends an authenticated request to the cluster and returns the
+// response body of successful requests
+func (s *elasticSink) request(method, path, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	} else if user, password, ok := strings.Cut(s.User, ":"); ok {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
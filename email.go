@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// smtpTimeout bounds one delivery of a report
+	smtpTimeout = 2 * time.Minute
+	// smtpAttempts is how many times a report is sent before it is given
+	// up, unless the server rejects it for good
+	smtpAttempts = 3
+)
+
+// emailReport mails the outcome of a crawl through an SMTP relay, with the
+// failures attached as CSV
+type emailReport struct {
+	To     string
+	From   string
+	Server string
+	On     string
+
+	recipients []string
+	sender     string
+	server     *url.URL
+}
+
+// addEmailFlags registers the email report options of the crawler
+func addEmailFlags(flags *flag.FlagSet, r *emailReport) {
+	flags.StringVar(&r.To, "email-to", "", "Comma-separated addresses to mail a report to when the crawl ends (optional)")
+	flags.StringVar(&r.From, "email-from", "", "Sender of the reports (default gopenintel@<host>)")
+	flags.StringVar(&r.Server, "smtp", os.Getenv("SMTP_URL"), "SMTP relay of the reports, as smtp://[USER:PASSWORD@]HOST[:587] with STARTTLS when offered, or smtps:// for TLS (default $SMTP_URL)")
+	flags.StringVar(&r.On, "email-on", "always", "When to mail a report: always, or failure only")
+}
+
+// setup parses the email options; it reports false when they ask for no
+// report
+func (r *emailReport) setup() (bool, error) {
+	if r.On != "always" && r.On != "failure" {
+		return false, fmt.Errorf("-email-on %q: expected always or failure", r.On)
+	}
+	for _, raw := range strings.Split(r.To, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(raw)
+		if err != nil {
+			return false, fmt.Errorf("-email-to %q: %w", raw, err)
+		}
+		r.recipients = append(r.recipients, address.Address)
+	}
+	if len(r.recipients) == 0 {
+		if r.From != "" {
+			return false, errors.New("-email-from requires -email-to")
+		}
+		return false, nil
+	}
+
+	if r.From == "" {
+		host, _ := os.Hostname()
+		r.From = "gopenintel@" + host
+	}
+	sender, err := mail.ParseAddress(r.From)
+	if err != nil {
+		return false, fmt.Errorf("-email-from %q: %w", r.From, err)
+	}
+	r.sender = sender.Address
+	r.From = sender.String()
+
+	if r.Server == "" {
+		return false, errors.New("-email-to requires -smtp or $SMTP_URL")
+	}
+	u, err := url.Parse(r.Server)
+	if err != nil || (u.Scheme != "smtp" && u.Scheme != "smtps") || u.Hostname() == "" {
+		// Not the URL itself, which may hold a password
+		return false, errors.New("-smtp: expected an smtp:// or smtps:// URL")
+	}
+	r.server = u
+	return true, nil
+}
+
+// send mails the report of a crawl that ended with code
+func (r *emailReport) send(code int, reason string, elapsed time.Duration) {
+	if succeeded(code) && r.On == "failure" {
+		return
+	}
+	message, err := r.message(code, reason, elapsed)
+	if err != nil {
+		fmt.Println("❌ Error writing the email report:", err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err = r.deliver(message)
+		var reply *textproto.Error
+		if err == nil || attempt == smtpAttempts || errors.As(err, &reply) && reply.Code >= 500 {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+	if err != nil {
+		fmt.Printf("❌ Error mailing the report through %s: %v\n", r.server.Host, err)
+		return
+	}
+	fmt.Println("📧 Report mailed to", strings.Join(r.recipients, ", "))
+}
+
+// message writes the report as a MIME message: the summary as text, and
+// the failures of the run as an attached failures.csv
+func (r *emailReport) message(code int, reason string, elapsed time.Duration) ([]byte, error) {
+	failures, dropped := recordedFailures()
+	headline := crawlHeadline(code, elapsed)
+	host, _ := os.Hostname()
+
+	var b bytes.Buffer
+	parts := multipart.NewWriter(&b)
+	header := func(name, value string) { fmt.Fprintf(&b, "%s: %s\r\n", name, value) }
+	header("From", r.From)
+	header("To", strings.Join(r.recipients, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", "[gopenintel] "+headline))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%d.%d@%s>", time.Now().UnixNano(), os.Getpid(), host))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	b.WriteString("\r\n")
+
+	text := headline + "\n\n" + stats.summary() + "\n" + reason + "\n"
+	switch {
+	case len(failures) == 0:
+		text += "\nNothing failed.\n"
+	case dropped > 0:
+		text += fmt.Sprintf("\nThe first %d URLs that failed are listed in the attached failures.csv; %d more are not.\n", len(failures), dropped)
+	default:
+		text += fmt.Sprintf("\nThe %d URLs that failed are listed in the attached failures.csv.\n", len(failures))
+	}
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	body := quotedprintable.NewWriter(part)
+	body.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(failures) > 0 {
+		var csv bytes.Buffer
+		if err := writeFailuresCSV(&csv, failures); err != nil {
+			return nil, err
+		}
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {`text/csv; charset=utf-8; name="failures.csv"`},
+			"Content-Disposition":       {`attachment; filename="failures.csv"`},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(csv.Bytes())
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// deliver sends a message through the relay once
+func (r *emailReport) deliver(message []byte) error {
+	host, port := r.server.Hostname(), r.server.Port()
+	if port == "" {
+		port = map[string]string{"smtp": "587", "smtps": "465"}[r.server.Scheme]
+	}
+	address := net.JoinHostPort(host, port)
+	config := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if r.server.Scheme == "smtps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, config)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && r.server.Scheme == "smtp" {
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if user := r.server.User; user != nil {
+		password, _ := user.Password()
+		// PlainAuth refuses to send the password unencrypted, but to localhost
+		if err := client.Auth(smtp.PlainAuth("", user.Username(), password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(r.sender); err != nil {
+		return err
+	}
+	for _, recipient := range r.recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
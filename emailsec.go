@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// spfLookupMechanisms are the SPF terms that cost a DNS lookup (RFC 7208 4.6.4)
+var spfLookupMechanisms = map[string]bool{"include": true, "a": true, "mx": true, "ptr": true, "exists": true, "redirect": true}
+
+// mailPosture is the email-security configuration of one domain on one day
+type mailPosture struct {
+	MX           bool
+	SPF          []string // normalized SPF records; more than one is a permerror
+	DMARC        map[string]string
+	DKIM         map[string]bool // selectors
+	dmarcRecords int
+}
+
+// runEmailSecurity extracts SPF, DMARC and DKIM records into a per domain,
+// per day email-security posture dataset
+func runEmailSecurity(args []string) int {
+	flags := flag.NewFlagSet("email-security", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		domains := make(map[string]*mailPosture)
+		posture := func(domain string) *mailPosture {
+			p, ok := domains[domain]
+			if !ok {
+				p = &mailPosture{DMARC: make(map[string]string), DKIM: make(map[string]bool)}
+				domains[domain] = p
+			}
+			return p
+		}
+
+		err := scanRecords(day, nil, func(r *record) error {
+			name := strings.ToLower(r.QueryName)
+			switch r.ResponseType {
+			case "MX":
+				posture(name).MX = true
+			case "TXT":
+				text := unquoteTXT(r.TXTText)
+				lower := strings.ToLower(text)
+				switch {
+				case strings.HasPrefix(name, "_dmarc.") && strings.HasPrefix(lower, "v=dmarc1"):
+					p := posture(strings.TrimPrefix(name, "_dmarc."))
+					p.dmarcRecords++
+					p.DMARC = parseTagList(text)
+				case strings.Contains(name, "._domainkey.") && (strings.HasPrefix(lower, "v=dkim1") || strings.Contains(lower, "p=")):
+					i := strings.Index(name, "._domainkey.")
+					posture(name[i+len("._domainkey."):]).DKIM[name[:i]] = true
+				case lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 "):
+					p := posture(name)
+					p.SPF = append(p.SPF, strings.Join(strings.Fields(lower), " "))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		names := make([]string, 0, len(domains))
+		for name := range domains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rows = append(rows, domains[name].row(day[0].Date, day[0].Dataset, name))
+		}
+	}
+
+	headers := []string{"date", "dataset", "domain", "mx", "spf", "spf_all", "spf_includes", "spf_lookups",
+		"dmarc_policy", "dmarc_subdomain_policy", "dmarc_pct", "dmarc_rua", "dkim_selectors", "problems"}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// row flattens the posture into report columns
+func (p *mailPosture) row(date, dataset, domain string) []string {
+	var problems []string
+	spf, all, includes, lookups := "", "", []string(nil), 0
+	switch len(p.SPF) {
+	case 0:
+		if p.MX {
+			problems = append(problems, "no-spf")
+		}
+	case 1:
+		spf = p.SPF[0]
+	default:
+		spf = p.SPF[0]
+		problems = append(problems, "multiple-spf")
+	}
+	if spf != "" {
+		all, includes, lookups = parseSPF(spf)
+		if lookups > 10 {
+			problems = append(problems, "spf-lookup-limit")
+		}
+		if all == "+all" {
+			problems = append(problems, "spf-pass-all")
+		}
+	}
+
+	policy := p.DMARC["p"]
+	subPolicy := p.DMARC["sp"]
+	if subPolicy == "" {
+		subPolicy = policy
+	}
+	pct := p.DMARC["pct"]
+	if policy != "" && pct == "" {
+		pct = "100"
+	}
+	switch {
+	case p.dmarcRecords > 1:
+		problems = append(problems, "multiple-dmarc")
+	case p.dmarcRecords == 0 && p.MX:
+		problems = append(problems, "no-dmarc")
+	case policy == "none":
+		problems = append(problems, "dmarc-monitor-only")
+	}
+
+	selectors := make([]string, 0, len(p.DKIM))
+	for selector := range p.DKIM {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+
+	return []string{date, dataset, domain, strconv.FormatBool(p.MX), spf, all, strings.Join(includes, " "),
+		strconv.Itoa(lookups), policy, subPolicy, pct, p.DMARC["rua"], strings.Join(selectors, " "), strings.Join(problems, " ")}
+}
+
+// parseSPF returns the qualified all mechanism, the included domains and the
+// number of DNS lookups of a normalized SPF record
+func parseSPF(spf string) (all string, includes []string, lookups int) {
+	for _, term := range strings.Fields(spf)[1:] {
+		qualifier := "+"
+		if strings.ContainsAny(term[:1], "+-~?") {
+			qualifier, term = term[:1], term[1:]
+		}
+		mechanism, value, _ := strings.Cut(term, ":")
+		if m, _, found := strings.Cut(mechanism, "="); found {
+			mechanism, value = m, term[len(m)+1:]
+		}
+		mechanism, _, _ = strings.Cut(mechanism, "/")
+
+		if spfLookupMechanisms[mechanism] {
+			lookups++
+		}
+		switch mechanism {
+		case "all":
+			all = qualifier + "all"
+		case "include", "redirect":
+			includes = append(includes, value)
+		}
+	}
+	return all, includes, lookups
+}
+
+// parseTagList splits a "tag=value; tag=value" record such as DMARC into a map
+// with lower-cased tags
+func parseTagList(text string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(text, ";") {
+		tag, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		value = strings.TrimSpace(value)
+		if tag == "p" || tag == "sp" {
+			value = strings.ToLower(value)
+		}
+		tags[tag] = value
+	}
+	return tags
+}
+
+// unquoteTXT joins the character strings of a TXT record given in
+// presentation form ("part one" "part two")
+func unquoteTXT(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, `"`) {
+		return text
+	}
+	var b strings.Builder
+	for _, part := range strings.Split(text, `" "`) {
+		b.WriteString(strings.Trim(part, `"`))
+	}
+	return b.String()
+}
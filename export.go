@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// defaultExportColumns are the columns exports write unless told otherwise
+const defaultExportColumns = "dataset,date,query_name,query_type,response_type,response_ttl,value,ip4_address,ip6_address,cname_name,ns_address,mx_address,txt_text"
+
+// exportColumn is a record column an export can write
+type exportColumn struct {
+	Name string
+	Kind string // "text", "bigint" or "date"
+	get  func(r *record) any
+}
+
+// exportColumns lists every exportable column: the record fields under their
+// JSON names, plus "value", the record data in presentation form
+var exportColumns = func() map[string]exportColumn {
+	columns := map[string]exportColumn{
+		"value": {Name: "value", Kind: "text", get: func(r *record) any { return r.Value() }},
+	}
+	t := reflect.TypeOf(record{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		kind := "text"
+		switch {
+		case name == "date":
+			kind = "date"
+		case field.Type.Kind() != reflect.String:
+			kind = "bigint"
+		}
+		index := i
+		columns[name] = exportColumn{Name: name, Kind: kind, get: func(r *record) any {
+			v := reflect.ValueOf(r).Elem().Field(index)
+			if v.CanInt() {
+				return v.Int()
+			}
+			if v.CanUint() {
+				return int64(v.Uint())
+			}
+			return v.String()
+		}}
+	}
+	return columns
+}()
+
+// exportSelection picks the records and columns an export writes
+type exportSelection struct {
+	Columns     string
+	Types       string
+	DomainsFile string
+	Suffix      bool
+
+	columns []exportColumn
+	types   map[string]bool
+	domains map[string]bool
+}
+
+// addExportFlags registers the flags shared by the export commands
+func addExportFlags(flags *flag.FlagSet) *exportSelection {
+	s := &exportSelection{}
+	flags.StringVar(&s.Columns, "columns", defaultExportColumns, "Comma-separated columns to export")
+	flags.StringVar(&s.Types, "types", "", "Comma-separated record types to export (default all)")
+	flags.StringVar(&s.DomainsFile, "domains", "", "File with the domains to export, one per line (default all)")
+	flags.BoolVar(&s.Suffix, "suffix", false, "Also export the subdomains of --domains")
+	return s
+}
+
+// prepare resolves the column names and loads the domain list; the required
+// columns are added in front when missing
+func (s *exportSelection) prepare(required ...string) error {
+	names := strings.Split(s.Columns, ",")
+	seen := make(map[string]bool)
+	for _, name := range required {
+		seen[name] = true
+		s.columns = append(s.columns, exportColumns[name])
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		column, ok := exportColumns[name]
+		if !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		seen[name] = true
+		s.columns = append(s.columns, column)
+	}
+
+	s.types = make(map[string]bool)
+	for _, t := range strings.Split(s.Types, ",") {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			s.types[t] = true
+		}
+	}
+
+	if s.DomainsFile == "" {
+		return nil
+	}
+	f, err := os.Open(s.DomainsFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s.domains = make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			s.domains[normalizeDomain(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// includes reports whether a record passes the type and domain filters
+func (s *exportSelection) includes(r *record) bool {
+	if len(s.types) > 0 && !s.types[r.ResponseType] {
+		return false
+	}
+	if s.domains == nil {
+		return true
+	}
+	name := strings.ToLower(r.QueryName)
+	if s.domains[name] {
+		return true
+	}
+	for s.Suffix {
+		_, parent, found := strings.Cut(name, ".")
+		if !found || parent == "" {
+			return false
+		}
+		if s.domains[parent] {
+			return true
+		}
+		name = parent
+	}
+	return false
+}
+
+// names returns the selected column names
+func (s *exportSelection) names() []string {
+	names := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// values returns the selected columns of a record
+func (s *exportSelection) values(r *record) []any {
+	values := make([]any, len(s.columns))
+	for i, c := range s.columns {
+		values[i] = c.get(r)
+	}
+	return values
+}
+
+// document returns the selected columns of a record keyed by column name,
+// the form the JSON-based sinks send records in; empty text columns are left out
+func (s *exportSelection) document(r *record) map[string]any {
+	doc := make(map[string]any, len(s.columns))
+	for _, c := range s.columns {
+		if v := c.get(r); v != "" {
+			doc[c.Name] = v
+		}
+	}
+	return doc
+}
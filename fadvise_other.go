@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// adviseSequential is a no-op where posix_fadvise is not available
+func adviseSequential(f *os.File) {}
+
+// dropCache is a no-op where posix_fadvise is not available
+func dropCache(f *os.File) {}
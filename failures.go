@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRecordedFailures bounds the failures kept for reports; later ones are
+// counted only
+const maxRecordedFailures = 10000
+
+// crawlFailure is a listing page or file the crawl gave up on
+type crawlFailure struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"` // listing or file
+	URL      string    `json:"url"`
+	Class    string    `json:"class"` // see errorClass
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+}
+
+// failureLog keeps the failures of the run for the reports sent at its end
+var failureLog struct {
+	sync.Mutex
+	failures []crawlFailure
+	dropped  int
+}
+
+// recordFailure notes a listing page or file that failed after attempts
+// tries, and posts it to the -failure-hook URLs
+func recordFailure(kind, url string, attempts int, err error) {
+	failure := crawlFailure{Time: time.Now().UTC(), Kind: kind, URL: url, Class: errorClass(err), Attempts: attempts, Error: err.Error()}
+	if failureHooks != nil {
+		failureHooks.failed(failure)
+	}
+	failureLog.Lock()
+	defer failureLog.Unlock()
+	if len(failureLog.failures) >= maxRecordedFailures {
+		failureLog.dropped++
+		return
+	}
+	failureLog.failures = append(failureLog.failures, failure)
+}
+
+// recordedFailures returns the failures of the run so far, and how many
+// more were not kept
+func recordedFailures() ([]crawlFailure, int) {
+	failureLog.Lock()
+	defer failureLog.Unlock()
+	return append([]crawlFailure(nil), failureLog.failures...), failureLog.dropped
+}
+
+// writeFailuresCSV writes failures as CSV with a header
+func writeFailuresCSV(w io.Writer, failures []crawlFailure) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"time", "kind", "url", "class", "attempts", "error"})
+	for _, f := range failures {
+		out.Write([]string{f.Time.Format(time.RFC3339), f.Kind, f.URL, f.Class, strconv.Itoa(f.Attempts), f.Error})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// errorClass names the kind of a failure, so that the systems receiving
+// failure webhooks can tell what to do without parsing error messages:
+// not_found, forbidden, rate_limited and server_error come from the HTTP
+// status; html_response, invalid_file and stalled from the checks of the
+// downloads; timeout and network from the connection, bodies cut short
+// included, and local from the disk
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNotFound):
+		return "not_found"
+	case errors.Is(err, errForbidden):
+		return "forbidden"
+	case errors.Is(err, errRateLimited):
+		return "rate_limited"
+	case errors.Is(err, errServerError):
+		return "server_error"
+	case errors.Is(err, errHTMLResponse):
+		return "html_response"
+	case errors.Is(err, errInvalidFile):
+		return "invalid_file"
+	case errors.Is(err, errStalled):
+		return "stalled"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF):
+		return "network"
+	case errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission):
+		return "local"
+	default:
+		return "other"
+	}
+}
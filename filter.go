@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// filesFilter selects the files of every listing with -include and
+// -exclude; nil without either
+var filesFilter *fileFilter
+
+// fileFilter keeps the files whose names match one of its include patterns,
+// or any name without them, unless they match one of its exclude patterns
+type fileFilter struct {
+	include, exclude []namePattern
+	spec             string // the options, recorded in the manifests of filtered days
+}
+
+// namePattern is a glob, or a regular expression for patterns written as
+// re:<expression>
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// newFileFilter parses the -include and -exclude options
+func newFileFilter(include, exclude string) (*fileFilter, error) {
+	f := &fileFilter{}
+	var err error
+	if f.include, err = parseNamePatterns("-include", include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = parseNamePatterns("-exclude", exclude); err != nil {
+		return nil, err
+	}
+	var spec []string
+	if include != "" {
+		spec = append(spec, "-include "+include)
+	}
+	if exclude != "" {
+		spec = append(spec, "-exclude "+exclude)
+	}
+	f.spec = strings.Join(spec, " ")
+	return f, nil
+}
+
+// parseNamePatterns parses comma-separated globs, or a single regular
+// expression after re:, which may hold commas of its own
+func parseNamePatterns(option, list string) ([]namePattern, error) {
+	if expr, ok := strings.CutPrefix(list, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", option, err)
+		}
+		return []namePattern{{re: re}}, nil
+	}
+	var patterns []namePattern
+	for _, glob := range strings.Split(list, ",") {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("%s %q: %w", option, glob, err)
+		}
+		patterns = append(patterns, namePattern{glob: glob})
+	}
+	return patterns, nil
+}
+
+// match reports whether a file name matches the pattern; globs match the
+// whole name, expressions any part of it unless anchored
+func (p namePattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// keeps reports whether the filter keeps a file name
+func (f *fileFilter) keeps(name string) bool {
+	included := len(f.include) == 0
+	for _, p := range f.include {
+		included = included || p.match(name)
+	}
+	if !included {
+		return false
+	}
+	for _, p := range f.exclude {
+		if p.match(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply drops the links of a listing the filter leaves out, matching the
+// names their files are saved as, and counts them
+func (f *fileFilter) apply(links []string) []string {
+	if f == nil {
+		return links
+	}
+	kept := links[:0:0]
+	for _, link := range links {
+		if f.keeps(localName(link)) {
+			kept = append(kept, link)
+		} else {
+			stats.filteredFiles.Add(1)
+		}
+	}
+	return kept
+}
+
+// describe returns the options of the filter, empty for none
+func (f *fileFilter) describe() string {
+	if f == nil {
+		return ""
+	}
+	return f.spec
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// datasetFreshness is the newest day of a dataset published upstream and
+// downloaded locally, as of the last check
+type datasetFreshness struct {
+	upstream time.Time // zero when no day was found within -lookback
+	local    time.Time // zero when no day was downloaded
+	ok       bool      // the last upstream check succeeded
+}
+
+// freshnessExporter checks the datasets periodically and exposes how far
+// the archive lags behind upstream as Prometheus metrics
+type freshnessExporter struct {
+	datasets  []string
+	lookback  int
+	mu        sync.Mutex
+	state     map[string]datasetFreshness
+	lastCheck time.Time
+}
+
+// runFreshness implements the freshness subcommand
+func runFreshness(args []string) int {
+	flags := flag.NewFlagSet("freshness", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:9108", "Address to serve the metrics on, at /metrics")
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	only := flags.String("dataset", "", "Comma-separated datasets to check (default all)")
+	interval := flags.Duration("interval", time.Hour, "Time between two checks")
+	lookback := flags.Int("lookback", 14, "Days before today to look for the newest published day")
+	addProxyFlags(flags)
+	addTLSFlags(flags)
+	addDNSFlags(flags)
+	addNetworkFlags(flags)
+	addTorFlags(flags)
+	addPolitenessFlags(flags)
+	addTimeoutFlags(flags)
+	flags.Parse(args)
+	if torMode {
+		torDefaults(flags)
+	}
+
+	selected := datasets
+	if *only != "" {
+		var err error
+		if selected, err = selectDatasets(*only); err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+	}
+	if *interval < time.Minute || *lookback < 1 {
+		fmt.Println("❌ Error: --interval must be at least 1m and --lookback positive")
+		return exitUsage
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Println("❌ Error configuring the HTTP client:", err)
+		return exitUsage
+	}
+
+	e := &freshnessExporter{datasets: selected, lookback: *lookback, state: make(map[string]datasetFreshness)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", e.metrics)
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			e.check()
+			select {
+			case <-ticker.C:
+			case <-stopped.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		<-stopped.Done()
+		fmt.Println("🛑 Stopping")
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	fmt.Printf("🌡️  Serving the freshness of %s on http://%s/metrics, checking every %s\n", downloadDir, *addr, *interval)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("❌ Error serving metrics:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// check looks up the newest published and downloaded day of every dataset
+func (e *freshnessExporter) check() {
+	for _, dataset := range e.datasets {
+		e.mu.Lock()
+		current := e.state[dataset]
+		e.mu.Unlock()
+
+		current.local = newestManifest(dataset)
+		upstream, err := e.newestPublished(dataset)
+		current.ok = err == nil
+		switch {
+		case err != nil:
+			// Keep the last known day; the check gauge tells it is stale
+			fmt.Printf("❌ Error checking %s upstream: %v\n", dataset, err)
+		case upstream.IsZero():
+			current.upstream = upstream
+			fmt.Printf("🌡️  %s: nothing published in the last %d days\n", dataset, e.lookback)
+		case current.local.IsZero():
+			current.upstream = upstream
+			fmt.Printf("🌡️  %s: upstream %s, nothing downloaded\n", dataset, upstream.Format(dateLayout))
+		default:
+			current.upstream = upstream
+			lag, _ := current.lag()
+			fmt.Printf("🌡️  %s: upstream %s, local %s, %d days behind\n", dataset, upstream.Format(dateLayout), current.local.Format(dateLayout), lag)
+		}
+
+		e.mu.Lock()
+		e.state[dataset] = current
+		e.mu.Unlock()
+	}
+	e.mu.Lock()
+	e.lastCheck = time.Now()
+	e.mu.Unlock()
+}
+
+// newestPublished looks back from today for the newest day of a dataset
+// with files upstream; it returns the zero time when none was found within
+// the lookback
+func (e *freshnessExporter) newestPublished(dataset string) (time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for back := range e.lookback + 1 {
+		day := today.AddDate(0, 0, -back)
+		page := listing{Dataset: dataset, Year: day.Year(), Month: int(day.Month()), Day: day.Day()}
+		links, err := getListing(page.URL(), nil)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(links) > 0 {
+			return day, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// newestManifest returns the newest day of a dataset with a manifest in
+// the archive, or the zero time
+func newestManifest(dataset string) time.Time {
+	paths, _ := filepath.Glob(filepath.Join(downloadDir, manifestDir, dataset, "*.json"))
+	var newest time.Time
+	for _, path := range paths {
+		day, err := time.Parse(dateLayout, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err == nil && day.After(newest) {
+			newest = day
+		}
+	}
+	return newest
+}
+
+// lag returns how many days the archive is behind upstream; it reports
+// false unless both days are known
+func (f datasetFreshness) lag() (int, bool) {
+	if f.upstream.IsZero() || f.local.IsZero() {
+		return 0, false
+	}
+	return max(0, int(f.upstream.Sub(f.local).Hours()/24)), true
+}
+
+// metrics writes the gauges in the Prometheus text format
+func (e *freshnessExporter) metrics(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b strings.Builder
+	gauge := func(name, help string, value func(datasetFreshness) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, dataset := range e.datasets {
+			f, checked := e.state[dataset]
+			if !checked {
+				continue
+			}
+			if v, ok := value(f); ok {
+				fmt.Fprintf(&b, "%s{dataset=%q} %s\n", name, dataset, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	gauge("gopenintel_upstream_latest_day_timestamp_seconds", "Start of the newest day published upstream, in Unix time.",
+		func(f datasetFreshness) (float64, bool) { return float64(f.upstream.Unix()), !f.upstream.IsZero() })
+	gauge("gopenintel_local_latest_day_timestamp_seconds", "Start of the newest day with a manifest in the archive, in Unix time.",
+		func(f datasetFreshness) (float64, bool) { return float64(f.local.Unix()), !f.local.IsZero() })
+	gauge("gopenintel_dataset_lag_days", "Days the archive is behind the newest day published upstream.",
+		func(f datasetFreshness) (float64, bool) {
+			lag, ok := f.lag()
+			return float64(lag), ok
+		})
+	gauge("gopenintel_freshness_check_success", "Whether the last upstream check of the dataset succeeded.",
+		func(f datasetFreshness) (float64, bool) {
+			if f.ok {
+				return 1, true
+			}
+			return 0, true
+		})
+	if !e.lastCheck.IsZero() {
+		fmt.Fprintf(&b, "# HELP gopenintel_freshness_last_check_timestamp_seconds End of the last check, in Unix time.\n")
+		fmt.Fprintf(&b, "# TYPE gopenintel_freshness_last_check_timestamp_seconds gauge\n")
+		fmt.Fprintf(&b, "gopenintel_freshness_last_check_timestamp_seconds %d\n", e.lastCheck.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// recordEnrichers add data from external databases to every scanned record;
+// they are called concurrently by the parse workers
+var recordEnrichers []func(r *record)
+
+// geoRecord is the part of a GeoLite2 City or Country entry we read
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// enableGeoIP attaches the country and city of a MaxMind GeoLite2 or GeoIP2
+// database to the A and AAAA records of every scan
+func enableGeoIP(path string) error {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening GeoIP database: %w", err)
+	}
+
+	recordEnrichers = append(recordEnrichers, func(r *record) {
+		ip := r.address()
+		if ip == nil {
+			return
+		}
+		var geo geoRecord
+		if err := db.Lookup(ip, &geo); err != nil {
+			return
+		}
+		r.GeoCountry = geo.Country.ISOCode
+		r.GeoCity = geo.City.Names["en"]
+	})
+	return nil
+}
+
+// address returns the address of an A or AAAA record
+func (r *record) address() net.IP {
+	switch r.ResponseType {
+	case "A":
+		return net.ParseIP(r.IP4Address)
+	case "AAAA":
+		return net.ParseIP(r.IP6Address)
+	}
+	return nil
+}
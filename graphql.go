@@ -0,0 +1,1195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gqlMaxDepth and gqlMaxFields bound the queries a schema executes, as a
+// short query over linked types can otherwise fan out over the whole index
+const (
+	gqlMaxDepth  = 15
+	gqlMaxFields = 500
+)
+
+// gqlResolver resolves a field of its parent value, given the coerced
+// arguments of the field
+type gqlResolver func(ctx context.Context, source any, args map[string]any) (any, error)
+
+// gqlField is a field of an object type; its type is written as in a
+// schema, e.g. [Record!]!
+type gqlField struct {
+	name, description, typ string
+	args                   []gqlArg
+	resolve                gqlResolver
+}
+
+// gqlArg is an argument of a field or directive; defaultValue is a GraphQL
+// literal, empty for none
+type gqlArg struct {
+	name, description, typ, defaultValue string
+}
+
+// gqlType is a named type of a schema
+type gqlType struct {
+	kind        string // SCALAR, OBJECT or ENUM
+	name        string
+	description string
+	fields      []*gqlField
+	enumValues  []string
+}
+
+// gqlDirective is a directive a schema supports
+type gqlDirective struct {
+	name, description string
+	locations         []string
+	args              []gqlArg
+}
+
+// gqlSchema is a set of types with the one of the query root; only queries
+// are supported, not mutations or subscriptions
+type gqlSchema struct {
+	query      string
+	types      map[string]*gqlType
+	directives []gqlDirective
+	meta       []*gqlField // __schema and __type, on the query root
+}
+
+// gqlTypeRef is a reference to a type as written in a schema, e.g. [Int!]
+type gqlTypeRef string
+
+// gqlRequest is the body of a GraphQL request
+type gqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// gqlResponse is the result of a request; data is absent when the request
+// failed before executing
+type gqlResponse struct {
+	Data   any        `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// gqlError is an error of a response, with the path of the field it
+// happened on
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// gqlObject is an object of a response, keeping the order its fields were
+// selected in
+type gqlObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// set sets a field of an object
+func (o *gqlObject) set(key string, value any) {
+	if o.values == nil {
+		o.values = make(map[string]any)
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON implements json.Marshaler
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// newGQLSchema returns a schema of the types, with the built-in scalars,
+// the skip and include directives, and introspection
+func newGQLSchema(query string, types ...*gqlType) *gqlSchema {
+	s := &gqlSchema{query: query, types: make(map[string]*gqlType)}
+	for _, name := range []string{"String", "Int", "Float", "Boolean", "ID"} {
+		s.types[name] = &gqlType{kind: "SCALAR", name: name}
+	}
+	for _, t := range types {
+		s.types[t.name] = t
+	}
+	condition := func(name, description string) gqlDirective {
+		return gqlDirective{
+			name:        name,
+			description: description,
+			locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+			args:        []gqlArg{{name: "if", typ: "Boolean!"}},
+		}
+	}
+	s.directives = []gqlDirective{
+		condition("include", "Include the selection only when the argument is true"),
+		condition("skip", "Skip the selection when the argument is true"),
+	}
+	s.addIntrospection()
+	return s
+}
+
+// gqlNull resolves a field that is always null
+func gqlNull(context.Context, any, map[string]any) (any, error) {
+	return nil, nil
+}
+
+// gqlFalse resolves a field that is always false
+func gqlFalse(context.Context, any, map[string]any) (any, error) {
+	return false, nil
+}
+
+// gqlProp resolves a field from its parent alone
+func gqlProp(get func(source any) any) gqlResolver {
+	return func(_ context.Context, source any, _ map[string]any) (any, error) {
+		return get(source), nil
+	}
+}
+
+// gqlOptional maps an empty string to null
+func gqlOptional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// addIntrospection adds the types and the root fields that describe the
+// schema, so that GraphQL clients can discover it
+func (s *gqlSchema) addIntrospection() {
+	deprecation := []*gqlField{
+		{name: "isDeprecated", typ: "Boolean!", resolve: gqlFalse},
+		{name: "deprecationReason", typ: "String", resolve: gqlNull},
+	}
+	includeDeprecated := []gqlArg{{name: "includeDeprecated", typ: "Boolean", defaultValue: "false"}}
+	inputValues := func(args []gqlArg) any {
+		if args == nil {
+			return []gqlArg{}
+		}
+		return args
+	}
+
+	types := []*gqlType{
+		{kind: "ENUM", name: "__TypeKind", enumValues: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}},
+		{kind: "ENUM", name: "__DirectiveLocation", enumValues: []string{
+			"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT",
+			"VARIABLE_DEFINITION", "SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE",
+			"UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION",
+		}},
+		{kind: "OBJECT", name: "__Schema", fields: []*gqlField{
+			{name: "description", typ: "String", resolve: gqlNull},
+			{name: "types", typ: "[__Type!]!", resolve: gqlProp(func(any) any {
+				names := make([]string, 0, len(s.types))
+				for name := range s.types {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				refs := make([]gqlTypeRef, len(names))
+				for i, name := range names {
+					refs[i] = gqlTypeRef(name)
+				}
+				return refs
+			})},
+			{name: "queryType", typ: "__Type!", resolve: gqlProp(func(any) any { return gqlTypeRef(s.query) })},
+			{name: "mutationType", typ: "__Type", resolve: gqlNull},
+			{name: "subscriptionType", typ: "__Type", resolve: gqlNull},
+			{name: "directives", typ: "[__Directive!]!", resolve: gqlProp(func(any) any { return s.directives })},
+		}},
+		{kind: "OBJECT", name: "__Type", fields: []*gqlField{
+			{name: "kind", typ: "__TypeKind!", resolve: gqlProp(func(source any) any {
+				ref := string(source.(gqlTypeRef))
+				switch {
+				case strings.HasSuffix(ref, "!"):
+					return "NON_NULL"
+				case strings.HasPrefix(ref, "["):
+					return "LIST"
+				}
+				return s.types[ref].kind
+			})},
+			{name: "name", typ: "String", resolve: gqlProp(func(source any) any {
+				if ref := string(source.(gqlTypeRef)); !strings.ContainsAny(ref, "[!") {
+					return ref
+				}
+				return nil
+			})},
+			{name: "description", typ: "String", resolve: gqlProp(func(source any) any {
+				if ref := string(source.(gqlTypeRef)); !strings.ContainsAny(ref, "[!") {
+					return gqlOptional(s.types[ref].description)
+				}
+				return nil
+			})},
+			{name: "specifiedByURL", typ: "String", resolve: gqlNull},
+			{name: "fields", typ: "[__Field!]", args: includeDeprecated, resolve: gqlProp(func(source any) any {
+				if ref := string(source.(gqlTypeRef)); !strings.ContainsAny(ref, "[!") && s.types[ref].kind == "OBJECT" {
+					return s.types[ref].fields
+				}
+				return nil
+			})},
+			{name: "interfaces", typ: "[__Type!]", resolve: gqlProp(func(source any) any {
+				if ref := string(source.(gqlTypeRef)); !strings.ContainsAny(ref, "[!") && s.types[ref].kind == "OBJECT" {
+					return []gqlTypeRef{}
+				}
+				return nil
+			})},
+			{name: "possibleTypes", typ: "[__Type!]", resolve: gqlNull},
+			{name: "enumValues", typ: "[__EnumValue!]", args: includeDeprecated, resolve: gqlProp(func(source any) any {
+				if ref := string(source.(gqlTypeRef)); !strings.ContainsAny(ref, "[!") && s.types[ref].kind == "ENUM" {
+					return s.types[ref].enumValues
+				}
+				return nil
+			})},
+			{name: "inputFields", typ: "[__InputValue!]", args: includeDeprecated, resolve: gqlNull},
+			{name: "ofType", typ: "__Type", resolve: gqlProp(func(source any) any {
+				ref := string(source.(gqlTypeRef))
+				if inner, ok := strings.CutSuffix(ref, "!"); ok {
+					return gqlTypeRef(inner)
+				}
+				if strings.HasPrefix(ref, "[") {
+					return gqlTypeRef(ref[1 : len(ref)-1])
+				}
+				return nil
+			})},
+			{name: "isOneOf", typ: "Boolean", resolve: gqlNull},
+		}},
+		{kind: "OBJECT", name: "__Field", fields: append([]*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source.(*gqlField).name })},
+			{name: "description", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(*gqlField).description) })},
+			{name: "args", typ: "[__InputValue!]!", args: includeDeprecated, resolve: gqlProp(func(source any) any { return inputValues(source.(*gqlField).args) })},
+			{name: "type", typ: "__Type!", resolve: gqlProp(func(source any) any { return gqlTypeRef(source.(*gqlField).typ) })},
+		}, deprecation...)},
+		{kind: "OBJECT", name: "__InputValue", fields: append([]*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source.(gqlArg).name })},
+			{name: "description", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(gqlArg).description) })},
+			{name: "type", typ: "__Type!", resolve: gqlProp(func(source any) any { return gqlTypeRef(source.(gqlArg).typ) })},
+			{name: "defaultValue", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(gqlArg).defaultValue) })},
+		}, deprecation...)},
+		{kind: "OBJECT", name: "__EnumValue", fields: append([]*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source })},
+			{name: "description", typ: "String", resolve: gqlNull},
+		}, deprecation...)},
+		{kind: "OBJECT", name: "__Directive", fields: []*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source.(gqlDirective).name })},
+			{name: "description", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(gqlDirective).description) })},
+			{name: "locations", typ: "[__DirectiveLocation!]!", resolve: gqlProp(func(source any) any { return source.(gqlDirective).locations })},
+			{name: "args", typ: "[__InputValue!]!", args: includeDeprecated, resolve: gqlProp(func(source any) any { return inputValues(source.(gqlDirective).args) })},
+			{name: "isRepeatable", typ: "Boolean!", resolve: gqlFalse},
+		}},
+	}
+	for _, t := range types {
+		s.types[t.name] = t
+	}
+
+	s.meta = []*gqlField{
+		{name: "__schema", typ: "__Schema!", resolve: gqlProp(func(any) any { return s })},
+		{name: "__type", typ: "__Type", args: []gqlArg{{name: "name", typ: "String!"}}, resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+			if name := args["name"].(string); s.types[name] != nil {
+				return gqlTypeRef(name), nil
+			}
+			return nil, nil
+		}},
+	}
+}
+
+// field returns a field of an object type, or nil
+func (t *gqlType) field(name string) *gqlField {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// sdl describes the types of a schema in the schema definition language
+func (s *gqlSchema) sdl() string {
+	var names []string
+	for name, t := range s.types {
+		if !strings.HasPrefix(name, "__") && !(t.kind == "SCALAR" && slices.Contains([]string{"String", "Int", "Float", "Boolean", "ID"}, name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		t := s.types[name]
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if t.description != "" {
+			fmt.Fprintf(&b, "%s\n", strconv.Quote(t.description))
+		}
+		switch t.kind {
+		case "SCALAR":
+			fmt.Fprintf(&b, "scalar %s\n", name)
+		case "ENUM":
+			fmt.Fprintf(&b, "enum %s {\n  %s\n}\n", name, strings.Join(t.enumValues, "\n  "))
+		case "OBJECT":
+			fmt.Fprintf(&b, "type %s {\n", name)
+			for _, f := range t.fields {
+				if f.description != "" {
+					fmt.Fprintf(&b, "  %s\n", strconv.Quote(f.description))
+				}
+				fmt.Fprintf(&b, "  %s", f.name)
+				if len(f.args) > 0 {
+					args := make([]string, len(f.args))
+					for i, arg := range f.args {
+						args[i] = arg.name + ": " + arg.typ
+						if arg.defaultValue != "" {
+							args[i] += " = " + arg.defaultValue
+						}
+					}
+					fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+				}
+				fmt.Fprintf(&b, ": %s\n", f.typ)
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+// execute runs the operation of a request; the response holds the errors
+// of the request or of the fields that failed, next to the data
+func (s *gqlSchema) execute(ctx context.Context, req gqlRequest) gqlResponse {
+	doc, err := parseGQL(req.Query)
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+	var op *gqlOperation
+	for _, candidate := range doc.operations {
+		if req.OperationName == "" && op != nil {
+			return gqlResponse{Errors: []gqlError{{Message: "operationName is required with several operations"}}}
+		}
+		if req.OperationName == "" || candidate.name == req.OperationName {
+			op = candidate
+		}
+	}
+	if op == nil {
+		return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("no operation named %q", req.OperationName)}}}
+	}
+	if op.kind != "query" {
+		return gqlResponse{Errors: []gqlError{{Message: "only queries are supported, not " + op.kind + "s"}}}
+	}
+	fields := 0
+	depth := doc.measure(op.selections, make(map[string]bool), &fields)
+	if fields > gqlMaxFields {
+		return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("the query selects more than %d fields", gqlMaxFields)}}}
+	}
+	if depth > gqlMaxDepth {
+		return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("the query nests fields %d deep, more than %d", depth, gqlMaxDepth)}}}
+	}
+
+	e := &gqlExecution{ctx: ctx, schema: s, fragments: doc.fragments, variables: make(map[string]any)}
+	for _, def := range op.variables {
+		value, given := req.Variables[def.name]
+		if !given && def.defaultValue != nil {
+			value, given = def.defaultValue, true
+		}
+		if !given {
+			if strings.HasSuffix(def.typ, "!") {
+				return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("variable $%s of type %s is required", def.name, def.typ)}}}
+			}
+			continue
+		}
+		coerced, err := s.coerce(def.typ, value)
+		if err != nil {
+			return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("variable $%s: %v", def.name, err)}}}
+		}
+		e.variables[def.name] = coerced
+	}
+
+	data, ok := e.selectFields(s.types[s.query], nil, op.selections, nil)
+	if !ok {
+		return gqlResponse{Data: (*gqlObject)(nil), Errors: e.errors}
+	}
+	return gqlResponse{Data: data, Errors: e.errors}
+}
+
+// gqlExecution is the state of one operation being executed
+type gqlExecution struct {
+	ctx       context.Context
+	schema    *gqlSchema
+	fragments map[string]*gqlFragment
+	variables map[string]any
+	errors    []gqlError
+}
+
+// fail records a field error
+func (e *gqlExecution) fail(path []any, format string, args ...any) {
+	e.errors = append(e.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+// selectFields resolves the selections of an object; it reports false,
+// having recorded why, when a non-null field of it is null
+func (e *gqlExecution) selectFields(t *gqlType, source any, selections []*gqlSelection, path []any) (*gqlObject, bool) {
+	fields := make(map[string][]*gqlSelection)
+	var keys []string
+	e.collect(t, selections, fields, &keys, make(map[string]bool), path)
+
+	obj := &gqlObject{}
+	for _, key := range keys {
+		group := fields[key]
+		fieldPath := append(slices.Clip(path), key)
+		if group[0].name == "__typename" {
+			obj.set(key, t.name)
+			continue
+		}
+		def := t.field(group[0].name)
+		if def == nil && t.name == e.schema.query {
+			for _, meta := range e.schema.meta {
+				if meta.name == group[0].name {
+					def = meta
+				}
+			}
+		}
+		if def == nil {
+			e.fail(fieldPath, "cannot query field %q on type %s", group[0].name, t.name)
+			obj.set(key, nil)
+			continue
+		}
+
+		value, ok := e.resolveField(def, source, group, fieldPath)
+		if !ok && strings.HasSuffix(def.typ, "!") {
+			return nil, false
+		}
+		obj.set(key, value)
+	}
+	return obj, true
+}
+
+// collect groups the fields of selections by response key, expanding the
+// fragments that apply to the type and honoring skip and include
+func (e *gqlExecution) collect(t *gqlType, selections []*gqlSelection, fields map[string][]*gqlSelection, keys *[]string, visited map[string]bool, path []any) {
+	for _, sel := range selections {
+		if !e.included(sel.directives, path) {
+			continue
+		}
+		switch {
+		case sel.fragment != "":
+			if visited[sel.fragment] {
+				continue
+			}
+			visited[sel.fragment] = true
+			frag := e.fragments[sel.fragment]
+			if frag == nil {
+				e.fail(path, "unknown fragment %q", sel.fragment)
+				continue
+			}
+			if frag.on == t.name && e.included(frag.directives, path) {
+				e.collect(t, frag.selections, fields, keys, visited, path)
+			}
+		case sel.inline:
+			if sel.on == "" || sel.on == t.name {
+				e.collect(t, sel.selections, fields, keys, visited, path)
+			}
+		default:
+			key := sel.name
+			if sel.alias != "" {
+				key = sel.alias
+			}
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], sel)
+		}
+	}
+}
+
+// included evaluates the skip and include directives of a selection
+func (e *gqlExecution) included(directives []gqlDirectiveUse, path []any) bool {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		value, err := e.schema.coerce("Boolean!", e.substitute(d.args["if"]))
+		if err != nil {
+			e.fail(path, "@%s: %v", d.name, err)
+			return false
+		}
+		if value.(bool) == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveField resolves a field and completes its value; it reports
+// false, having recorded why, when the field failed
+func (e *gqlExecution) resolveField(def *gqlField, source any, group []*gqlSelection, path []any) (any, bool) {
+	args := make(map[string]any)
+	for name := range group[0].args {
+		if !slices.ContainsFunc(def.args, func(arg gqlArg) bool { return arg.name == name }) {
+			e.fail(path, "unknown argument %q of field %q", name, def.name)
+			return nil, false
+		}
+	}
+	for _, arg := range def.args {
+		literal, given := group[0].args[arg.name]
+		if v, ok := literal.(gqlVariable); ok {
+			literal, given = e.variables[string(v)]
+		}
+		if !given && arg.defaultValue != "" {
+			literal, given = mustParseGQLValue(arg.defaultValue), true
+		}
+		if !given {
+			if strings.HasSuffix(arg.typ, "!") {
+				e.fail(path, "argument %q of type %s is required", arg.name, arg.typ)
+				return nil, false
+			}
+			continue
+		}
+		value, err := e.schema.coerce(arg.typ, e.substitute(literal))
+		if err != nil {
+			e.fail(path, "argument %q: %v", arg.name, err)
+			return nil, false
+		}
+		args[arg.name] = value
+	}
+
+	value, err := def.resolve(e.ctx, source, args)
+	if err != nil {
+		e.fail(path, "%v", err)
+		return nil, false
+	}
+	var selections []*gqlSelection
+	for _, sel := range group {
+		selections = append(selections, sel.selections...)
+	}
+	return e.complete(def.typ, value, selections, path)
+}
+
+// complete shapes a resolved value after its type, resolving the
+// selections of objects
+func (e *gqlExecution) complete(typ string, value any, selections []*gqlSelection, path []any) (any, bool) {
+	if inner, ok := strings.CutSuffix(typ, "!"); ok {
+		completed, ok := e.complete(inner, value, selections, path)
+		if ok && completed == nil {
+			e.fail(path, "null returned for non-null field")
+			return nil, false
+		}
+		return completed, ok
+	}
+	if value == nil {
+		return nil, true
+	}
+
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		list := reflect.ValueOf(value)
+		if list.Kind() != reflect.Slice {
+			e.fail(path, "expected a list")
+			return nil, false
+		}
+		items := make([]any, list.Len())
+		for i := range items {
+			item, ok := e.complete(inner, list.Index(i).Interface(), selections, append(slices.Clip(path), i))
+			if !ok && strings.HasSuffix(inner, "!") {
+				return nil, false
+			}
+			items[i] = item
+		}
+		return items, true
+	}
+
+	t := e.schema.types[typ]
+	if t.kind != "OBJECT" {
+		if len(selections) > 0 {
+			e.fail(path, "type %s has no fields to select", typ)
+			return nil, false
+		}
+		return value, true
+	}
+	if len(selections) == 0 {
+		e.fail(path, "fields of type %s must be selected", typ)
+		return nil, false
+	}
+	obj, ok := e.selectFields(t, value, selections, path)
+	if !ok {
+		return nil, false
+	}
+	return obj, true
+}
+
+// substitute replaces the variables of a literal with their values
+func (e *gqlExecution) substitute(literal any) any {
+	switch v := literal.(type) {
+	case gqlVariable:
+		return e.variables[string(v)]
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = e.substitute(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = e.substitute(item)
+		}
+		return out
+	}
+	return literal
+}
+
+// coerce converts an input value, a literal or a JSON variable, to the Go
+// value of its type: string, int, float64, bool or a list of them
+func (s *gqlSchema) coerce(typ string, value any) (any, error) {
+	if inner, ok := strings.CutSuffix(typ, "!"); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected a non-null %s", inner)
+		}
+		return s.coerce(inner, value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			coerced, err := s.coerce(inner, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = coerced
+		}
+		return out, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		if typ == "String" || typ == "ID" {
+			return v, nil
+		}
+	case int:
+		switch typ {
+		case "Int":
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return v, nil
+			}
+		case "Float":
+			return float64(v), nil
+		case "ID":
+			return strconv.Itoa(v), nil
+		}
+	case float64:
+		switch typ {
+		case "Int":
+			if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v), nil
+			}
+		case "Float":
+			return v, nil
+		}
+	case bool:
+		if typ == "Boolean" {
+			return v, nil
+		}
+	case gqlEnum:
+		if t := s.types[typ]; t != nil && t.kind == "ENUM" && slices.Contains(t.enumValues, string(v)) {
+			return string(v), nil
+		}
+	}
+	if t := s.types[typ]; t != nil && t.kind == "ENUM" {
+		if v, ok := value.(string); ok && slices.Contains(t.enumValues, v) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s", typ)
+}
+
+// gqlDocument is a parsed query document
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// measure returns how deep selections nest fields and adds the fields they
+// select, aliases included, to fields. Fragments count where they are
+// spread, so counting stops past gqlMaxFields instead of expanding spreads
+// of spreads without end.
+func (d *gqlDocument) measure(selections []*gqlSelection, spread map[string]bool, fields *int) int {
+	depth := 0
+	for _, sel := range selections {
+		if *fields > gqlMaxFields {
+			break
+		}
+		switch {
+		case sel.fragment != "":
+			frag := d.fragments[sel.fragment]
+			if frag == nil || spread[sel.fragment] {
+				continue
+			}
+			spread[sel.fragment] = true
+			depth = max(depth, d.measure(frag.selections, spread, fields))
+			delete(spread, sel.fragment)
+		case sel.inline:
+			depth = max(depth, d.measure(sel.selections, spread, fields))
+		default:
+			*fields++
+			depth = max(depth, 1+d.measure(sel.selections, spread, fields))
+		}
+	}
+	return depth
+}
+
+// gqlOperation is an operation of a document
+type gqlOperation struct {
+	kind, name string // query, mutation or subscription
+	variables  []gqlVariableDef
+	selections []*gqlSelection
+}
+
+// gqlVariableDef declares a variable of an operation
+type gqlVariableDef struct {
+	name, typ    string
+	defaultValue any
+}
+
+// gqlFragment is a named fragment of a document
+type gqlFragment struct {
+	on         string
+	directives []gqlDirectiveUse
+	selections []*gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment
+type gqlSelection struct {
+	alias, name string
+	args        map[string]any
+	fragment    string // name of a spread fragment
+	inline      bool   // an inline fragment, of the type on if set
+	on          string
+	directives  []gqlDirectiveUse
+	selections  []*gqlSelection
+}
+
+// gqlDirectiveUse is a directive applied to a selection
+type gqlDirectiveUse struct {
+	name string
+	args map[string]any
+}
+
+// gqlVariable is a variable in a literal; gqlEnum is an enum value
+type (
+	gqlVariable string
+	gqlEnum     string
+)
+
+// gqlToken is a token of a document: a name (n), an int (i), a float (f),
+// a string (s), a punctuator (p), or the end (0)
+type gqlToken struct {
+	kind  byte
+	value string
+	pos   int
+}
+
+// gqlSyntaxError reports where a document is malformed
+type gqlSyntaxError struct {
+	message string
+}
+
+// Error implements error
+func (e gqlSyntaxError) Error() string { return e.message }
+
+// gqlParser parses the tokens of a document, panicking with a
+// gqlSyntaxError when they are malformed
+type gqlParser struct {
+	src    string
+	tokens []gqlToken
+	i      int
+}
+
+// parseGQL parses a query document
+func parseGQL(src string) (doc *gqlDocument, err error) {
+	p := &gqlParser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			syntax, ok := r.(gqlSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = syntax
+		}
+	}()
+	p.tokenize()
+	return p.document(), nil
+}
+
+// mustParseGQLValue parses a literal of the schema
+func mustParseGQLValue(src string) any {
+	p := &gqlParser{src: src}
+	p.tokenize()
+	return p.value(true)
+}
+
+// fail panics with a syntax error at a position
+func (p *gqlParser) fail(pos int, format string, args ...any) {
+	line := 1 + strings.Count(p.src[:pos], "\n")
+	column := pos - strings.LastIndex(p.src[:pos], "\n")
+	panic(gqlSyntaxError{fmt.Sprintf("syntax error at line %d, column %d: %s", line, column, fmt.Sprintf(format, args...))})
+}
+
+// tokenize splits the source into tokens
+func (p *gqlParser) tokenize() {
+	src := p.src
+	isName := func(c byte, first bool) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\uFEFF"):
+			i += len("\uFEFF")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			p.tokens = append(p.tokens, gqlToken{'p', "...", i})
+			i += 3
+		case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+			p.tokens = append(p.tokens, gqlToken{'p', string(c), i})
+			i++
+		case isName(c, true):
+			j := i + 1
+			for j < len(src) && isName(src[j], false) {
+				j++
+			}
+			p.tokens = append(p.tokens, gqlToken{'n', src[i:j], i})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j, kind := i+1, byte('i')
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = 'f'
+				}
+				j++
+			}
+			p.tokens = append(p.tokens, gqlToken{kind, src[i:j], i})
+			i = j
+		case strings.HasPrefix(src[i:], `"""`):
+			j := i + 3
+			for j < len(src) && !strings.HasPrefix(src[j:], `"""`) {
+				if strings.HasPrefix(src[j:], `\"""`) {
+					j += 3
+				}
+				j++
+			}
+			if j >= len(src) {
+				p.fail(i, "unterminated block string")
+			}
+			raw := strings.ReplaceAll(src[i+3:j], `\"""`, `"""`)
+			p.tokens = append(p.tokens, gqlToken{'s', blockString(raw), i})
+			i = j + 3
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			var value string
+			if j >= len(src) || src[j] != '"' || json.Unmarshal([]byte(src[i:j+1]), &value) != nil {
+				p.fail(i, "invalid string")
+			}
+			p.tokens = append(p.tokens, gqlToken{'s', value, i})
+			i = j + 1
+		default:
+			p.fail(i, "unexpected character %q", c)
+		}
+	}
+	p.tokens = append(p.tokens, gqlToken{0, "", len(src)})
+}
+
+// blockString removes the common indentation and the blank first and last
+// lines of a block string
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		lines[i] = lines[i][min(indent, len(lines[i])):]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// peek returns the next token
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.i]
+}
+
+// next consumes the next token
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.i]
+	if t.kind != 0 {
+		p.i++
+	}
+	return t
+}
+
+// skip consumes the next token if it is a punctuator
+func (p *gqlParser) skip(punct string) bool {
+	if t := p.peek(); t.kind == 'p' && t.value == punct {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// expect consumes a punctuator
+func (p *gqlParser) expect(punct string) {
+	if !p.skip(punct) {
+		p.unexpected(punct)
+	}
+}
+
+// name consumes a name
+func (p *gqlParser) name() string {
+	t := p.peek()
+	if t.kind != 'n' {
+		p.unexpected("a name")
+	}
+	p.i++
+	return t.value
+}
+
+// unexpected fails on the next token
+func (p *gqlParser) unexpected(expected string) {
+	t := p.peek()
+	p.fail(t.pos, "expected %s, found %s", expected, t.describe())
+}
+
+// describe names a token in syntax errors
+func (t gqlToken) describe() string {
+	if t.kind == 0 {
+		return "the end of the document"
+	}
+	return strconv.Quote(t.value)
+}
+
+// document parses the definitions of a document
+func (p *gqlParser) document() *gqlDocument {
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.peek().kind != 0 {
+		t := p.peek()
+		switch {
+		case t.kind == 'p' && t.value == "{":
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: p.selectionSet()})
+		case t.kind == 'n' && (t.value == "query" || t.value == "mutation" || t.value == "subscription"):
+			p.next()
+			op := &gqlOperation{kind: t.value}
+			if p.peek().kind == 'n' {
+				op.name = p.name()
+			}
+			if p.skip("(") {
+				for !p.skip(")") {
+					p.expect("$")
+					def := gqlVariableDef{name: p.name()}
+					p.expect(":")
+					def.typ = p.typeRef()
+					if p.skip("=") {
+						def.defaultValue = p.value(true)
+					}
+					p.directives()
+					op.variables = append(op.variables, def)
+				}
+			}
+			p.directives()
+			op.selections = p.selectionSet()
+			doc.operations = append(doc.operations, op)
+		case t.kind == 'n' && t.value == "fragment":
+			p.next()
+			name := p.name()
+			if name == "on" {
+				p.fail(t.pos, "a fragment cannot be named on")
+			}
+			if p.name() != "on" {
+				p.fail(t.pos, "expected on after the fragment name")
+			}
+			frag := &gqlFragment{on: p.name(), directives: p.directives()}
+			frag.selections = p.selectionSet()
+			doc.fragments[name] = frag
+		default:
+			p.unexpected("an operation or a fragment")
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail(len(p.src), "no operation")
+	}
+	return doc
+}
+
+// typeRef parses a type
+func (p *gqlParser) typeRef() string {
+	var typ string
+	if p.skip("[") {
+		typ = "[" + p.typeRef() + "]"
+		p.expect("]")
+	} else {
+		typ = p.name()
+	}
+	if p.skip("!") {
+		typ += "!"
+	}
+	return typ
+}
+
+// selectionSet parses a selection set
+func (p *gqlParser) selectionSet() []*gqlSelection {
+	p.expect("{")
+	var selections []*gqlSelection
+	for !p.skip("}") {
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.fail(p.tokens[p.i-1].pos, "empty selection set")
+	}
+	return selections
+}
+
+// selection parses a field or a fragment
+func (p *gqlParser) selection() *gqlSelection {
+	if p.skip("...") {
+		if t := p.peek(); t.kind == 'n' && t.value != "on" {
+			return &gqlSelection{fragment: p.name(), directives: p.directives()}
+		}
+		sel := &gqlSelection{inline: true}
+		if t := p.peek(); t.kind == 'n' {
+			p.next()
+			sel.on = p.name()
+		}
+		sel.directives = p.directives()
+		sel.selections = p.selectionSet()
+		return sel
+	}
+
+	sel := &gqlSelection{name: p.name()}
+	if p.skip(":") {
+		sel.alias, sel.name = sel.name, p.name()
+	}
+	sel.args = p.arguments()
+	sel.directives = p.directives()
+	if t := p.peek(); t.kind == 'p' && t.value == "{" {
+		sel.selections = p.selectionSet()
+	}
+	return sel
+}
+
+// arguments parses the arguments of a field or directive, if any
+func (p *gqlParser) arguments() map[string]any {
+	args := make(map[string]any)
+	if p.skip("(") {
+		for !p.skip(")") {
+			name := p.name()
+			p.expect(":")
+			args[name] = p.value(false)
+		}
+	}
+	return args
+}
+
+// directives parses the directives of a definition or selection
+func (p *gqlParser) directives() []gqlDirectiveUse {
+	var directives []gqlDirectiveUse
+	for p.skip("@") {
+		directives = append(directives, gqlDirectiveUse{name: p.name(), args: p.arguments()})
+	}
+	return directives
+}
+
+// value parses a literal, without variables when constant
+func (p *gqlParser) value(constant bool) any {
+	t := p.next()
+	switch t.kind {
+	case 'i':
+		n, err := strconv.Atoi(t.value)
+		if err != nil {
+			p.fail(t.pos, "invalid int %s", t.value)
+		}
+		return n
+	case 'f':
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			p.fail(t.pos, "invalid float %s", t.value)
+		}
+		return f
+	case 's':
+		return t.value
+	case 'n':
+		switch t.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return gqlEnum(t.value)
+	case 'p':
+		switch t.value {
+		case "$":
+			if constant {
+				p.fail(t.pos, "variables are not allowed here")
+			}
+			return gqlVariable(p.name())
+		case "[":
+			list := []any{}
+			for !p.skip("]") {
+				list = append(list, p.value(constant))
+			}
+			return list
+		case "{":
+			obj := make(map[string]any)
+			for !p.skip("}") {
+				name := p.name()
+				p.expect(":")
+				obj[name] = p.value(constant)
+			}
+			return obj
+		}
+	}
+	p.fail(t.pos, "expected a value, found %s", t.describe())
+	return nil
+}
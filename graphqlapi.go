@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// graphQLPageSize is the page size of the connections of the GraphQL schema
+// unless a query asks for another, up to maxQueryLimit
+const graphQLPageSize = 100
+
+// gqlIndexKey is the context key of the index a GraphQL request reads
+type gqlIndexKey struct{}
+
+// gqlPage is one page of a connection of the GraphQL schema
+type gqlPage struct {
+	nodes     any
+	hasNext   bool
+	endCursor string
+}
+
+// gqlName is the domain name a Domain of the GraphQL schema is about
+type gqlName string
+
+// newArchiveSchema returns the GraphQL schema of serve-query, over the
+// passive-DNS index
+func newArchiveSchema() *gqlSchema {
+	dates := []gqlArg{
+		{name: "from", typ: "String", description: "Only what was seen on or after this day (YYYY-MM-DD)"},
+		{name: "to", typ: "String", description: "Only what was seen on or before this day (YYYY-MM-DD)"},
+	}
+	paging := []gqlArg{
+		{name: "first", typ: "Int", defaultValue: fmt.Sprint(graphQLPageSize), description: fmt.Sprintf("Size of the page, at most %d", maxQueryLimit)},
+		{name: "after", typ: "String", description: "endCursor of the previous page"},
+	}
+	args := func(lists ...[]gqlArg) []gqlArg {
+		var all []gqlArg
+		for _, list := range lists {
+			all = append(all, list...)
+		}
+		return all
+	}
+	page := func(name, node string) *gqlType {
+		return &gqlType{kind: "OBJECT", name: name, description: "A page of " + node + " nodes", fields: []*gqlField{
+			{name: "nodes", typ: "[" + node + "!]!", resolve: gqlProp(func(source any) any { return source.(gqlPage).nodes })},
+			{name: "pageInfo", typ: "PageInfo!", resolve: gqlProp(func(source any) any { return source })},
+		}}
+	}
+	recordType := gqlArg{name: "type", typ: "String", description: "Only records of this type, e.g. MX"}
+
+	return newGQLSchema("Query",
+		&gqlType{kind: "OBJECT", name: "Query", description: "Lookups over the passive-DNS index", fields: []*gqlField{
+			{name: "status", typ: "Status!", description: "The dataset/days the index holds", resolve: func(ctx context.Context, _ any, _ map[string]any) (any, error) {
+				return summarizeIndex(indexDB(ctx))
+			}},
+			{name: "domain", typ: "Domain", description: "A name, null when neither it nor a name below it is indexed",
+				args: []gqlArg{{name: "name", typ: "String!"}},
+				resolve: func(ctx context.Context, _ any, a map[string]any) (any, error) {
+					name := normalizeDomain(a["name"].(string))
+					found := false
+					err := scanNames(indexDB(ctx), name, true, "", nil, func([]byte, passiveRecord) bool {
+						found = true
+						return false
+					})
+					if err != nil || !found {
+						return nil, err
+					}
+					return gqlName(name), nil
+				}},
+			{name: "domains", typ: "DomainPage!", description: "The names at or below a suffix, e.g. example.com or com",
+				args: args([]gqlArg{{name: "suffix", typ: "String!"}}, dates, paging),
+				resolve: func(ctx context.Context, _ any, a map[string]any) (any, error) {
+					return domainPage(indexDB(ctx), a["suffix"].(string), true, a)
+				}},
+			{name: "records", typ: "RecordPage!", description: "The records of a name, and of the names below it with subdomains",
+				args: args([]gqlArg{{name: "name", typ: "String!"}, {name: "subdomains", typ: "Boolean", defaultValue: "false"}, recordType}, dates, paging),
+				resolve: func(ctx context.Context, _ any, a map[string]any) (any, error) {
+					subdomains, _ := a["subdomains"].(bool)
+					return recordPage(indexDB(ctx), a["name"].(string), subdomains, a)
+				}},
+			{name: "address", typ: "Address", description: "An IPv4 or IPv6 address, null when it is not indexed",
+				args: []gqlArg{{name: "ip", typ: "String!"}},
+				resolve: func(ctx context.Context, _ any, a map[string]any) (any, error) {
+					addr, err := netip.ParseAddr(a["ip"].(string))
+					if err != nil {
+						return nil, fmt.Errorf("invalid address %q", a["ip"])
+					}
+					return lookupAddress(indexDB(ctx), addr)
+				}},
+			{name: "addresses", typ: "AddressPage!", description: "The indexed addresses of a CIDR prefix, e.g. 192.0.2.0/24",
+				args: args([]gqlArg{{name: "prefix", typ: "String!"}}, paging),
+				resolve: func(ctx context.Context, _ any, a map[string]any) (any, error) {
+					return addressPage(indexDB(ctx), a["prefix"].(string), a)
+				}},
+		}},
+		&gqlType{kind: "OBJECT", name: "Status", fields: []*gqlField{
+			{name: "days", typ: "Int!", description: "Number of indexed dataset/days", resolve: gqlProp(func(source any) any { return source.(indexSummary).Days })},
+			{name: "datasets", typ: "[String!]!", resolve: gqlProp(func(source any) any { return source.(indexSummary).Datasets })},
+			{name: "firstDate", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(indexSummary).FirstDate) })},
+			{name: "lastDate", typ: "String", resolve: gqlProp(func(source any) any { return gqlOptional(source.(indexSummary).LastDate) })},
+		}},
+		&gqlType{kind: "OBJECT", name: "Domain", fields: []*gqlField{
+			{name: "name", typ: "String!", description: "Fully qualified, with the trailing dot", resolve: gqlProp(func(source any) any { return string(source.(gqlName)) })},
+			{name: "records", typ: "RecordPage!", args: args([]gqlArg{recordType}, dates, paging),
+				resolve: func(ctx context.Context, source any, a map[string]any) (any, error) {
+					return recordPage(indexDB(ctx), string(source.(gqlName)), false, a)
+				}},
+			{name: "subdomains", typ: "DomainPage!", description: "The names below this one",
+				args: args(dates, paging),
+				resolve: func(ctx context.Context, source any, a map[string]any) (any, error) {
+					return domainPage(indexDB(ctx), string(source.(gqlName)), false, a)
+				}},
+		}},
+		&gqlType{kind: "OBJECT", name: "Record", description: "A resource record and when it was seen", fields: []*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).Name })},
+			{name: "type", typ: "String!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).Type })},
+			{name: "value", typ: "String!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).Value })},
+			{name: "firstSeen", typ: "String!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).FirstSeen })},
+			{name: "lastSeen", typ: "String!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).LastSeen })},
+			{name: "datasets", typ: "[String!]!", resolve: gqlProp(func(source any) any { return source.(passiveRecord).Datasets })},
+			{name: "address", typ: "Address", description: "The address of an A or AAAA record, with the other names seen on it",
+				resolve: func(ctx context.Context, source any, _ map[string]any) (any, error) {
+					rec := source.(passiveRecord)
+					addr, err := netip.ParseAddr(rec.Value)
+					if (rec.Type != "A" && rec.Type != "AAAA") || err != nil {
+						return nil, nil
+					}
+					return lookupAddress(indexDB(ctx), addr)
+				}},
+		}},
+		&gqlType{kind: "OBJECT", name: "Address", fields: []*gqlField{
+			{name: "ip", typ: "String!", resolve: gqlProp(func(source any) any { return source.(addressSightings).IP })},
+			{name: "domains", typ: "[Sighting!]!", description: "The names seen resolving to the address",
+				args: dates,
+				resolve: func(_ context.Context, source any, a map[string]any) (any, error) {
+					from, to, err := gqlDates(a)
+					if err != nil {
+						return nil, err
+					}
+					sightings := []ipSighting{}
+					for _, s := range source.(addressSightings).Domains {
+						if seenBetween(s.FirstSeen, s.LastSeen, from, to) {
+							sightings = append(sightings, s)
+						}
+					}
+					return sightings, nil
+				}},
+		}},
+		&gqlType{kind: "OBJECT", name: "Sighting", description: "A name seen resolving to an address", fields: []*gqlField{
+			{name: "name", typ: "String!", resolve: gqlProp(func(source any) any { return source.(ipSighting).Domain })},
+			{name: "firstSeen", typ: "String!", resolve: gqlProp(func(source any) any { return source.(ipSighting).FirstSeen })},
+			{name: "lastSeen", typ: "String!", resolve: gqlProp(func(source any) any { return source.(ipSighting).LastSeen })},
+			{name: "domain", typ: "Domain!", resolve: gqlProp(func(source any) any { return gqlName(source.(ipSighting).Domain) })},
+		}},
+		&gqlType{kind: "OBJECT", name: "PageInfo", fields: []*gqlField{
+			{name: "hasNextPage", typ: "Boolean!", resolve: gqlProp(func(source any) any { return source.(gqlPage).hasNext })},
+			{name: "endCursor", typ: "String", description: "The after of the next page", resolve: gqlProp(func(source any) any { return gqlOptional(source.(gqlPage).endCursor) })},
+		}},
+		page("RecordPage", "Record"),
+		page("DomainPage", "Domain"),
+		page("AddressPage", "Address"),
+	)
+}
+
+// indexDB returns the index of a GraphQL request
+func indexDB(ctx context.Context) *bolt.DB {
+	return ctx.Value(gqlIndexKey{}).(*bolt.DB)
+}
+
+// gqlPaging returns the page size and the decoded after cursor of a field
+func gqlPaging(args map[string]any) (int, []byte, error) {
+	first := graphQLPageSize
+	if n, ok := args["first"].(int); ok {
+		first = n
+	}
+	if first < 1 || first > maxQueryLimit {
+		return 0, nil, fmt.Errorf("first must be between 1 and %d", maxQueryLimit)
+	}
+	after, _ := args["after"].(string)
+	if after == "" {
+		return first, nil, nil
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil {
+		return 0, nil, errors.New("invalid cursor")
+	}
+	return first, cursor, nil
+}
+
+// gqlDates returns the from and to days of a field, empty when not set
+func gqlDates(args map[string]any) (string, string, error) {
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(dateLayout, day); day != "" && err != nil {
+			return "", "", fmt.Errorf("invalid day %q, expected YYYY-MM-DD", day)
+		}
+	}
+	return from, to, nil
+}
+
+// seenBetween reports whether something seen from firstSeen to lastSeen
+// was seen between from and to, which are open when empty
+func seenBetween(firstSeen, lastSeen, from, to string) bool {
+	return (from == "" || lastSeen >= from) && (to == "" || firstSeen <= to)
+}
+
+// recordPage pages through the records of a name and, with subdomains,
+// of the names below it
+func recordPage(db *bolt.DB, name string, subdomains bool, args map[string]any) (any, error) {
+	first, after, err := gqlPaging(args)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := gqlDates(args)
+	if err != nil {
+		return nil, err
+	}
+	rrType, _ := args["type"].(string)
+
+	records := []passiveRecord{}
+	page := gqlPage{}
+	err = scanNames(db, normalizeDomain(name), subdomains, strings.ToUpper(rrType), after, func(key []byte, rec passiveRecord) bool {
+		if !seenBetween(rec.FirstSeen, rec.LastSeen, from, to) {
+			return true
+		}
+		if len(records) == first {
+			page.hasNext = true
+			return false
+		}
+		records = append(records, rec)
+		page.endCursor = base64.RawURLEncoding.EncodeToString(key)
+		return true
+	})
+	page.nodes = records
+	return page, err
+}
+
+// domainPage pages through the names below a suffix, and the suffix
+// itself with self set, that have records seen between the days of args
+func domainPage(db *bolt.DB, suffix string, self bool, args map[string]any) (any, error) {
+	first, after, err := gqlPaging(args)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := gqlDates(args)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix = normalizeDomain(suffix)
+	names := []gqlName{}
+	page := gqlPage{}
+	err = scanNames(db, suffix, true, "", after, func(_ []byte, rec passiveRecord) bool {
+		if !self && rec.Name == suffix || !seenBetween(rec.FirstSeen, rec.LastSeen, from, to) ||
+			len(names) > 0 && names[len(names)-1] == gqlName(rec.Name) {
+			return true
+		}
+		if len(names) == first {
+			page.hasNext = true
+			return false
+		}
+		names = append(names, gqlName(rec.Name))
+		// The keys of a name all start with its reversed form and a zero
+		// byte, so the next page starts after them
+		page.endCursor = base64.RawURLEncoding.EncodeToString([]byte(reverseName(rec.Name) + "\x01"))
+		return true
+	})
+	page.nodes = names
+	return page, err
+}
+
+// addressPage pages through the indexed addresses of a prefix
+func addressPage(db *bolt.DB, prefix string, args map[string]any) (any, error) {
+	first, after, err := gqlPaging(args)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := addressRange(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []addressSightings{}
+	page := gqlPage{}
+	err = scanAddresses(db, start, end, after, func(key []byte, a addressSightings) bool {
+		if len(addresses) == first {
+			page.hasNext = true
+			return false
+		}
+		addresses = append(addresses, a)
+		page.endCursor = base64.RawURLEncoding.EncodeToString(key)
+		return true
+	})
+	page.nodes = addresses
+	return page, err
+}
+
+// lookupAddress returns the sightings of an address, or nil when it is not
+// indexed
+func lookupAddress(db *bolt.DB, addr netip.Addr) (any, error) {
+	var found any
+	key := ipKey(addr)
+	err := scanAddresses(db, key, key, nil, func(_ []byte, a addressSightings) bool {
+		found = a
+		return false
+	})
+	return found, err
+}
+
+// graphQL answers GraphQL queries, sent as JSON with POST or as the query,
+// operationName and variables parameters of a GET
+func (q *queryServer) graphQL(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	if r.Method == http.MethodGet {
+		params := r.URL.Query()
+		req.Query, req.OperationName = params.Get("query"), params.Get("operationName")
+		if vars := params.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "missing query; GET /graphql/schema describes the schema")
+		return
+	}
+
+	db := q.open(w)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	resp := q.schema.execute(context.WithValue(r.Context(), gqlIndexKey{}, db), req)
+	code := http.StatusOK
+	if resp.Data == nil {
+		code = http.StatusBadRequest
+	}
+	writeJSON(w, code, resp)
+}
+
+// graphQLSchema describes the GraphQL schema in the schema definition
+// language
+func (q *queryServer) graphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, q.schema.sdl())
+}
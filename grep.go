@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runGrep searches the local archive for the records of a domain
+func runGrep(args []string) int {
+	flags := flag.NewFlagSet("grep", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	subdomains := flags.Bool("suffix", false, "Also match subdomains of the domain")
+	asJSON := flags.Bool("json", false, "Print matching records as JSON lines")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("❌ Error: usage is grep [options] <domain>")
+		return exitUsage
+	}
+	domain := normalizeDomain(flags.Arg(0))
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// Exact lookups can skip row groups whose statistics exclude the name;
+	// subdomains sort anywhere so suffix lookups read everything
+	var prune func(stats rowGroupStats) bool
+	if !*subdomains {
+		prune = func(stats rowGroupStats) bool { return !stats.mayContain("query_name", domain) }
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	matches := 0
+	err = scanRecords(files, prune, func(r *record) error {
+		if !matchesDomain(strings.ToLower(r.QueryName), domain, *subdomains) {
+			return nil
+		}
+		matches++
+		if *asJSON {
+			return encoder.Encode(r)
+		}
+		if filter.GeoIP != "" {
+			fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", r.Dataset, r.Date, r.QueryName, r.ResponseType, r.TTL, r.Value(), r.GeoCountry, r.GeoCity)
+			return nil
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", r.Dataset, r.Date, r.QueryName, r.ResponseType, r.TTL, r.Value())
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 %d matching records in %d files\n", matches, len(files))
+	if matches == 0 {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchInterval is how often WatchJob looks for changes of a job
+const watchInterval = time.Second
+
+// jobStates maps the states of jobs to their gRPC enum
+var jobStates = map[string]JobState{
+	jobQueued:    JobState_JOB_STATE_QUEUED,
+	jobRunning:   JobState_JOB_STATE_RUNNING,
+	jobSucceeded: JobState_JOB_STATE_SUCCEEDED,
+	jobFailed:    JobState_JOB_STATE_FAILED,
+	jobCanceled:  JobState_JOB_STATE_CANCELED,
+}
+
+// grpcJobService implements the JobService of jobs.proto on a jobServer
+type grpcJobService struct {
+	UnimplementedJobServiceServer
+	s *jobServer
+}
+
+// serveGRPC serves the job API over gRPC on addr until the server is
+// stopped
+func (s *jobServer) serveGRPC(addr string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorizeRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizeRPC(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	RegisterJobServiceServer(server, &grpcJobService{s: s})
+	go server.Serve(listener)
+	fmt.Println("🎛️  Serving the gRPC job API on", listener.Addr())
+	return server, nil
+}
+
+// authorizeRPC requires the --auth credentials when they are set, sent as
+// the basic authorization metadata of the call
+func (s *jobServer) authorizeRPC(ctx context.Context) error {
+	if s.auth == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := http.Request{Header: http.Header{"Authorization": md.Get("authorization")}}
+	if user, password, _ := r.BasicAuth(); !s.authorized(user, password) {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return nil
+}
+
+// SubmitJob implements JobServiceServer
+func (g *grpcJobService) SubmitJob(ctx context.Context, req *SubmitJobRequest) (*Job, error) {
+	job, err := g.s.newJob(jobRequest{Datasets: req.Datasets, From: req.From, To: req.To, Dir: req.Dir})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := g.s.enqueue(job); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return g.message(job), nil
+}
+
+// ListJobs implements JobServiceServer
+func (g *grpcJobService) ListJobs(ctx context.Context, req *ListJobsRequest) (*ListJobsResponse, error) {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	resp := &ListJobsResponse{}
+	for i := len(g.s.order) - 1; i >= 0; i-- {
+		resp.Jobs = append(resp.Jobs, jobMessage(g.s.order[i]))
+	}
+	return resp, nil
+}
+
+// GetJob implements JobServiceServer
+func (g *grpcJobService) GetJob(ctx context.Context, req *GetJobRequest) (*Job, error) {
+	job, err := g.lookup(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return g.message(job), nil
+}
+
+// WatchJob implements JobServiceServer, sending the job when the watch
+// starts and every time it changes, until it is finished or the server
+// stops
+func (g *grpcJobService) WatchJob(req *GetJobRequest, stream grpc.ServerStreamingServer[Job]) error {
+	job, err := g.lookup(req.Id)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var last *Job
+	for {
+		current := g.message(job)
+		if last == nil || current.State != last.State || !proto.Equal(current.Progress, last.Progress) ||
+			len(current.Summary) != len(last.Summary) {
+			if err := stream.Send(current); err != nil {
+				return err
+			}
+			last = current
+		}
+		if current.Finished != nil {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-g.s.stopped.Done():
+			return status.Error(codes.Unavailable, "server stopping")
+		}
+	}
+}
+
+// GetJobLog implements JobServiceServer
+func (g *grpcJobService) GetJobLog(ctx context.Context, req *GetJobRequest) (*JobLog, error) {
+	job, err := g.lookup(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	return &JobLog{Lines: append([]string(nil), job.log...)}, nil
+}
+
+// CancelJob implements JobServiceServer
+func (g *grpcJobService) CancelJob(ctx context.Context, req *GetJobRequest) (*Job, error) {
+	job, err := g.lookup(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.s.cancel(job); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return g.message(job), nil
+}
+
+// lookup returns a job by ID
+func (g *grpcJobService) lookup(id string) (*serveJob, error) {
+	g.s.mu.Lock()
+	job := g.s.jobs[id]
+	g.s.mu.Unlock()
+	if job == nil {
+		return nil, status.Error(codes.NotFound, "no such job")
+	}
+	return job, nil
+}
+
+// message converts a job under the lock
+func (g *grpcJobService) message(job *serveJob) *Job {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	return jobMessage(job)
+}
+
+// jobMessage converts a job to its gRPC message; the caller holds the lock
+func jobMessage(job *serveJob) *Job {
+	msg := &Job{
+		Id:       job.ID,
+		State:    jobStates[job.State],
+		Datasets: append([]string(nil), job.Datasets...),
+		From:     job.From,
+		To:       job.To,
+		Dir:      job.Dir,
+		Created:  timestamppb.New(job.Created),
+		Progress: &JobProgress{
+			Pages:      int32(job.Progress.Pages),
+			TotalPages: int32(job.Progress.TotalPages),
+			Files:      int32(job.Progress.Files),
+			Failures:   int32(job.Progress.Failures),
+			Bytes:      job.Progress.Bytes,
+		},
+		Summary:        append([]string(nil), job.Summary...),
+		RecentFailures: append([]string(nil), job.RecentFailures...),
+	}
+	if job.Started != nil {
+		msg.Started = timestamppb.New(*job.Started)
+	}
+	if job.Finished != nil {
+		msg.Finished = timestamppb.New(*job.Finished)
+	}
+	if job.ExitCode != nil {
+		msg.ExitCode = int32(*job.ExitCode)
+	}
+	return msg
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// recordHistory is the observation period of one record of a domain
+type recordHistory struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+	Days      int    `json:"days"`
+}
+
+// recordChange lists the records of one type that appeared or disappeared
+// compared to the previous day the domain was observed
+type recordChange struct {
+	Date    string   `json:"date"`
+	Type    string   `json:"type"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// domainTimeline is the reconstructed record history of a domain
+type domainTimeline struct {
+	Domain    string          `json:"domain"`
+	FirstSeen string          `json:"first_seen"`
+	LastSeen  string          `json:"last_seen"`
+	Days      int             `json:"days_observed"`
+	Records   []recordHistory `json:"records"`
+	Changes   []recordChange  `json:"changes"`
+}
+
+// runHistory reconstructs the record history of a domain from the archive
+func runHistory(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	types := flags.String("types", "A,AAAA,CNAME,NS,MX,TXT", "Comma-separated record types to track")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("❌ Error: usage is history [options] <domain>")
+		return exitUsage
+	}
+	domain := normalizeDomain(flags.Arg(0))
+
+	tracked := make(map[string]bool)
+	for _, t := range strings.Split(*types, ",") {
+		tracked[strings.ToUpper(strings.TrimSpace(t))] = true
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// Collect the records of the domain per day, all datasets merged
+	days := make(map[string]map[string]map[string]bool) // date -> type -> values
+	err = scanRecords(files, func(stats rowGroupStats) bool {
+		return !stats.mayContain("query_name", domain)
+	}, func(r *record) error {
+		if strings.ToLower(r.QueryName) != domain {
+			return nil
+		}
+		if days[r.Date] == nil {
+			days[r.Date] = make(map[string]map[string]bool)
+		}
+		if !tracked[r.ResponseType] || r.Value() == "" {
+			return nil
+		}
+		if days[r.Date][r.ResponseType] == nil {
+			days[r.Date][r.ResponseType] = make(map[string]bool)
+		}
+		days[r.Date][r.ResponseType][r.Value()] = true
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+	if len(days) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ No records found for", domain)
+		return exitFailed
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(buildTimeline(domain, days))
+	return exitOK
+}
+
+// buildTimeline turns per-day record sets into record periods and change events
+func buildTimeline(domain string, days map[string]map[string]map[string]bool) *domainTimeline {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	t := &domainTimeline{
+		Domain:    domain,
+		FirstSeen: dates[0],
+		LastSeen:  dates[len(dates)-1],
+		Days:      len(dates),
+		Records:   []recordHistory{},
+		Changes:   []recordChange{},
+	}
+
+	periods := make(map[string]*recordHistory)
+	previous := map[string]map[string]bool{}
+	for i, date := range dates {
+		current := days[date]
+
+		// Every type present on either day may have changed
+		typeSet := make(map[string]bool)
+		for rrType := range current {
+			typeSet[rrType] = true
+		}
+		for rrType := range previous {
+			typeSet[rrType] = true
+		}
+
+		for _, rrType := range sortedKeys(typeSet) {
+			for value := range current[rrType] {
+				key := rrType + " " + value
+				p, ok := periods[key]
+				if !ok {
+					p = &recordHistory{Type: rrType, Value: value, FirstSeen: date}
+					periods[key] = p
+				}
+				p.LastSeen = date
+				p.Days++
+			}
+
+			if i == 0 {
+				continue
+			}
+			change := recordChange{
+				Date:    date,
+				Type:    rrType,
+				Added:   nonEmpty(setDifference(current[rrType], previous[rrType])),
+				Removed: nonEmpty(setDifference(previous[rrType], current[rrType])),
+			}
+			if change.Added != nil || change.Removed != nil {
+				t.Changes = append(t.Changes, change)
+			}
+		}
+		previous = current
+	}
+
+	for _, p := range periods {
+		t.Records = append(t.Records, *p)
+	}
+	sort.Slice(t.Records, func(i, j int) bool {
+		if t.Records[i].Type != t.Records[j].Type {
+			return t.Records[i].Type < t.Records[j].Type
+		}
+		if t.Records[i].FirstSeen != t.Records[j].FirstSeen {
+			return t.Records[i].FirstSeen < t.Records[j].FirstSeen
+		}
+		return t.Records[i].Value < t.Records[j].Value
+	})
+	return t
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// nonEmpty maps an empty slice to nil so it is omitted from JSON
+func nonEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// confusables maps characters commonly used to imitate Latin letters to the
+// letter they resemble, after Unicode TR39 skeletons
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'һ': "h", 'і': "i", 'ї': "i", 'ј': "j", 'к': "k", 'м': "m",
+	'н': "h", 'о': "o", 'р': "p", 'с': "c", 'т': "t", 'у': "y", 'х': "x", 'ѕ': "s", 'ԁ': "d", 'ԛ': "q",
+	'ԝ': "w", 'ɡ': "g", 'ӏ': "l",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p", 'τ': "t",
+	'υ': "u", 'χ': "x", 'ω': "w",
+	// Latin look-alikes
+	'ı': "i", 'ł': "l", 'ø': "o", 'đ': "d", 'ß': "ss", 'à': "a", 'á': "a", 'â': "a", 'ä': "a", 'å': "a",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'ö': "o", 'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y",
+	// ASCII substitutions
+	'0': "o", '1': "l", 'i': "l", '3': "e", '5': "s", '|': "l",
+}
+
+// skeleton reduces a label to the letters it visually resembles
+func skeleton(label string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(label) {
+		if s, ok := confusables[r]; ok {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	for _, pair := range [][2]string{{"rn", "m"}, {"vv", "w"}, {"cl", "d"}} {
+		s = strings.ReplaceAll(s, pair[0], pair[1])
+	}
+	return s
+}
+
+// readBrands loads a brand list, one name or domain per line, keyed by the
+// skeleton of its first label
+func readBrands(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	brands := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, _, _ := strings.Cut(strings.ToLower(line), ".")
+		brands[skeleton(label)] = label
+	}
+	return brands, scanner.Err()
+}
+
+// lookalike is a suspicious name together with where it was observed
+type lookalike struct {
+	sighting
+	Unicode string
+	Brand   string
+	Kind    string
+}
+
+// runHomographs flags punycode names and lookalikes of a brand list
+func runHomographs(args []string) int {
+	flags := flag.NewFlagSet("homographs", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	brandsFile := flags.String("brands", "", "File with brand names or domains, one per line, to find lookalikes of")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	var brands map[string]string
+	if *brandsFile != "" {
+		var err error
+		if brands, err = readBrands(*brandsFile); err != nil {
+			fmt.Println("❌ Error reading brands:", err)
+			return exitUsage
+		}
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// Verdicts are cached per name, the archive repeats them for every record
+	verdicts := make(map[string]*lookalike)
+	err = scanRecords(files, nil, func(r *record) error {
+		name := strings.ToLower(r.QueryName)
+		l, known := verdicts[name]
+		if !known {
+			l = classifyName(name, brands)
+			verdicts[name] = l
+		}
+		if l != nil {
+			l.observe(r.Dataset, r.Date)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+
+	var found []*lookalike
+	for _, l := range verdicts {
+		if l != nil {
+			found = append(found, l)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+
+	rows := make([][]string, 0, len(found))
+	for _, l := range found {
+		rows = append(rows, []string{l.Name, l.Unicode, l.Kind, l.Brand, l.FirstSeen, l.LastSeen, strings.Join(l.Datasets, ",")})
+	}
+	headers := []string{"name", "unicode", "kind", "brand", "first_seen", "last_seen", "datasets"}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// classifyName returns the verdict for a query name, nil when it is neither
+// an internationalized name nor a lookalike of a brand
+func classifyName(name string, brands map[string]string) *lookalike {
+	unicode, err := idna.ToUnicode(strings.TrimSuffix(name, "."))
+	if err != nil {
+		unicode = strings.TrimSuffix(name, ".")
+	}
+	punycode := strings.HasPrefix(name, "xn--") || strings.Contains(name, ".xn--")
+
+	// Brands are matched against the label left of the public suffix
+	label, _, _ := strings.Cut(registrableDomain(unicode), ".")
+	if brand, ok := brands[skeleton(label)]; ok && label != brand {
+		return &lookalike{sighting: sighting{Name: name}, Unicode: unicode, Brand: brand, Kind: "homograph"}
+	}
+	if punycode {
+		return &lookalike{sighting: sighting{Name: name}, Unicode: unicode, Kind: "punycode"}
+	}
+	return nil
+}
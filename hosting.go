@@ -0,0 +1,240 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bundledFingerprints is the provider fingerprint set shipped with the binary
+//
+//go:embed fingerprints.json
+var bundledFingerprints []byte
+
+const unclassified = "unclassified"
+
+// fingerprint identifies a hosting provider by CNAME targets and address ranges
+type fingerprint struct {
+	Provider      string   `json:"provider"`
+	CNAMESuffixes []string `json:"cname_suffixes"`
+	Prefixes      []string `json:"prefixes"`
+
+	prefixes []netip.Prefix
+}
+
+// loadFingerprints returns the fingerprints of an optional user file, which
+// take precedence, followed by the bundled ones
+func loadFingerprints(path string) ([]fingerprint, error) {
+	var fingerprints []fingerprint
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &fingerprints); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	var bundled []fingerprint
+	if err := json.Unmarshal(bundledFingerprints, &bundled); err != nil {
+		return nil, fmt.Errorf("bundled fingerprints: %w", err)
+	}
+	fingerprints = append(fingerprints, bundled...)
+
+	for i := range fingerprints {
+		f := &fingerprints[i]
+		for j, suffix := range f.CNAMESuffixes {
+			f.CNAMESuffixes[j] = normalizeDomain(suffix)
+		}
+		for _, p := range f.Prefixes {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid prefix %q", f.Provider, p)
+			}
+			f.prefixes = append(f.prefixes, prefix.Masked())
+		}
+	}
+	return fingerprints, nil
+}
+
+// classifyCNAME returns the provider whose CNAME suffixes match a target
+func classifyCNAME(fingerprints []fingerprint, target string) string {
+	target = normalizeDomain(target)
+	for _, f := range fingerprints {
+		for _, suffix := range f.CNAMESuffixes {
+			if matchesDomain(target, suffix, true) {
+				return f.Provider
+			}
+		}
+	}
+	return ""
+}
+
+// classifyIP returns the provider whose ranges contain an address
+func classifyIP(fingerprints []fingerprint, value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, f := range fingerprints {
+		for _, prefix := range f.prefixes {
+			if prefix.Contains(addr) {
+				return f.Provider
+			}
+		}
+	}
+	return ""
+}
+
+// hostingEvidence records what attributed a domain to a provider
+type hostingEvidence struct {
+	providers map[string]string // provider -> first matching CNAME target or address
+	hosted    bool              // the domain has address or CNAME records
+}
+
+// runHosting attributes domains to CDN and cloud providers per day and dataset
+func runHosting(args []string) int {
+	flags := flag.NewFlagSet("hosting", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	fingerprintsFile := flags.String("fingerprints", "", "JSON file with additional provider fingerprints")
+	perDomain := flags.Bool("per-domain", false, "List the attribution of every domain instead of provider totals")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	fingerprints, err := loadFingerprints(*fingerprintsFile)
+	if err != nil {
+		fmt.Println("❌ Error loading fingerprints:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		domains := make(map[string]*hostingEvidence)
+		err := scanRecords(day, nil, func(r *record) error {
+			var provider, evidence string
+			switch r.ResponseType {
+			case "CNAME":
+				provider, evidence = classifyCNAME(fingerprints, r.CNAMEName), r.CNAMEName
+			case "A", "AAAA":
+				evidence = r.Value()
+				provider = classifyIP(fingerprints, evidence)
+			default:
+				return nil
+			}
+
+			name := strings.ToLower(r.QueryName)
+			e, ok := domains[name]
+			if !ok {
+				e = &hostingEvidence{providers: make(map[string]string)}
+				domains[name] = e
+			}
+			e.hosted = true
+			if _, seen := e.providers[provider]; provider != "" && !seen {
+				e.providers[provider] = evidence
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		date, dataset := day[0].Date, day[0].Dataset
+		if *perDomain {
+			rows = append(rows, hostingDomainRows(date, dataset, domains)...)
+		} else {
+			rows = append(rows, hostingTotalRows(date, dataset, domains)...)
+		}
+	}
+
+	headers := []string{"date", "dataset", "provider", "domains", "share"}
+	if *perDomain {
+		headers = []string{"date", "dataset", "domain", "provider", "evidence"}
+	}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// hostingTotalRows counts the domains attributed to each provider
+func hostingTotalRows(date, dataset string, domains map[string]*hostingEvidence) [][]string {
+	counts := make(map[string]int)
+	hosted := 0
+	for _, e := range domains {
+		if !e.hosted {
+			continue
+		}
+		hosted++
+		if len(e.providers) == 0 {
+			counts[unclassified]++
+		}
+		for provider := range e.providers {
+			counts[provider]++
+		}
+	}
+
+	providers := make([]string, 0, len(counts))
+	for provider := range counts {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		if counts[providers[i]] != counts[providers[j]] {
+			return counts[providers[i]] > counts[providers[j]]
+		}
+		return providers[i] < providers[j]
+	})
+
+	rows := make([][]string, 0, len(providers))
+	for _, provider := range providers {
+		rows = append(rows, []string{date, dataset, provider, strconv.Itoa(counts[provider]), percent(counts[provider], hosted)})
+	}
+	return rows
+}
+
+// hostingDomainRows lists the providers of each domain with their evidence
+func hostingDomainRows(date, dataset string, domains map[string]*hostingEvidence) [][]string {
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rows [][]string
+	for _, name := range names {
+		e := domains[name]
+		if len(e.providers) == 0 {
+			rows = append(rows, []string{date, dataset, name, unclassified, ""})
+			continue
+		}
+		providers := make([]string, 0, len(e.providers))
+		for provider := range e.providers {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+		for _, provider := range providers {
+			rows = append(rows, []string{date, dataset, name, provider, e.providers[provider]})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Classes of unsuccessful responses, each handled its own way by the crawler
+var (
+	// errNotFound reports a 404 or 410: there is no data there, which is expected
+	errNotFound = errors.New("not found")
+	// errForbidden reports a 401 or 403: the data agreement cookie was rejected
+	errForbidden = errors.New("access denied")
+	// errRateLimited reports a 429: the request is retried after the
+	// Retry-After delay, or a backoff, without using up its attempts
+	errRateLimited = errors.New("rate limited")
+	// errServerError reports a 5xx: the request is retried
+	errServerError = errors.New("server error")
+)
+
+const (
+	// maxListingAttempts bounds how often a listing page is requested
+	maxListingAttempts = 3
+	// retryBackoff is the wait before the first retry; it doubles every
+	// attempt, and rate limiting starts from twice as long
+	retryBackoff = 2 * time.Second
+	// maxRateLimitWaits bounds how often a request waits out rate limiting
+	maxRateLimitWaits = 10
+	// maxRetryAfter caps the waits asked for by Retry-After, and the backoff
+	maxRetryAfter = 15 * time.Minute
+)
+
+// retryAfterError is an unsuccessful response that said when to come back
+type retryAfterError struct {
+	class  error
+	status string
+	after  time.Duration
+}
+
+// Error implements error
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("%v (%s, retry after %s)", e.class, e.status, e.after)
+}
+
+// Unwrap returns the class of the response
+func (e *retryAfterError) Unwrap() error {
+	return e.class
+}
+
+// statusError classifies an unsuccessful response, draining a bounded part
+// of its body so the connection can be reused and the error page is never
+// taken for content
+func statusError(resp *http.Response) error {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	var class error
+	switch code := resp.StatusCode; {
+	case code == http.StatusNotFound || code == http.StatusGone:
+		class = errNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		class = errForbidden
+	case code == http.StatusTooManyRequests:
+		class = errRateLimited
+	case code >= 500:
+		class = errServerError
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if after := retryAfter(resp); after > 0 && class != errNotFound && class != errForbidden {
+		return &retryAfterError{class: class, status: resp.Status, after: after}
+	}
+	return fmt.Errorf("%w (%s)", class, resp.Status)
+}
+
+// retryAfter returns the wait asked for by the Retry-After header of a
+// response, given in seconds or as a date and capped at maxRetryAfter, or 0
+// when it asks for none
+func retryAfter(resp *http.Response) time.Duration {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+		return time.Duration(min(seconds, int64(maxRetryAfter/time.Second))) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return min(max(0, time.Until(date).Round(time.Second)), maxRetryAfter)
+	}
+	return 0
+}
+
+// retryable reports whether a request that failed with err is worth repeating
+func retryable(err error) bool {
+	return errors.Is(err, errRateLimited) || errors.Is(err, errServerError)
+}
+
+// transientNetworkError reports whether a download failed with err on the
+// way, by a timeout, a reset connection or a body cut short, so that a new
+// connection may well get through
+func transientNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryDelay returns the wait before retrying a request after its
+// attempt-th failure: the Retry-After delay if the server gave one, or a
+// backoff doubling every attempt
+func retryDelay(attempt int, err error) time.Duration {
+	var asked *retryAfterError
+	if errors.As(err, &asked) {
+		return asked.after
+	}
+	delay := retryBackoff << (attempt - 1)
+	if errors.Is(err, errRateLimited) {
+		delay *= 2
+	}
+	return min(delay, maxRetryAfter)
+}
+
+// waitRetry sleeps before retrying a request after its attempt-th failure;
+// it reports false if the crawl is stopped meanwhile
+func waitRetry(attempt int, err error) bool {
+	select {
+	case <-time.After(retryDelay(attempt, err)):
+		return true
+	case <-stopping.Done():
+		return false
+	}
+}
+
+// hostPauses holds back the requests to the hosts that asked for a pause
+// with Retry-After, across listings and downloads
+type hostPauses struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// pauses are the pauses of the archive client
+var pauses = hostPauses{until: make(map[string]time.Time)}
+
+// observe pauses the host of a rate-limited or unavailable response for as
+// long as its Retry-After asks, reporting and counting rate limiting
+func (p *hostPauses) observe(req *http.Request, resp *http.Response) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		stats.rateLimited.Add(1)
+	} else if resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	after := retryAfter(resp)
+	if after == 0 {
+		return
+	}
+	until := time.Now().Add(after)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Workers hit at once report the pause only once
+	if until.Sub(p.until[req.URL.Host]) < time.Second {
+		return
+	}
+	p.until[req.URL.Host] = until
+	fmt.Printf("⏸️  %s asked to slow down (%s): pausing its requests for %s\n", req.URL.Host, resp.Status, after)
+}
+
+// wait blocks while the host of the request is paused, or until the request
+// is canceled
+func (p *hostPauses) wait(req *http.Request) error {
+	p.mu.Lock()
+	until := p.until[req.URL.Host]
+	p.mu.Unlock()
+	delay := time.Until(until)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+var (
+	// accessDenied is set once the server refused the data agreement cookie
+	accessDenied atomic.Bool
+	denyOnce     sync.Once
+)
+
+// denyAccess stops the crawl after a 403: every other request would be
+// refused the same way, so there is no point in going on
+func denyAccess(url string) {
+	accessDenied.Store(true)
+	denyOnce.Do(func() {
+		fmt.Println("🚫 Access denied:", url)
+		fmt.Println("   The archive rejected the data agreement cookie. Open the page in a browser to")
+		fmt.Println("   check whether the terms of use or the cookie changed, or whether the address")
+		fmt.Println("   or -proxy in use is blocked; the crawl stops after the downloads in flight.")
+		stopCrawl()
+	})
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icebergTypes maps the neutral column types to Iceberg primitive types
+var icebergTypes = map[string]string{
+	"boolean": "boolean", "int": "int", "long": "long", "float": "float", "double": "double",
+	"string": "string", "binary": "binary", "date": "date", "timestamp": "timestamptz",
+}
+
+// icebergDaysKey is the snapshot summary property listing the dataset/days
+// a snapshot added, so reruns only append new days
+const icebergDaysKey = "gopenintel.days"
+
+// icebergManifestSchema is the Avro schema of the manifests written: the
+// required v2 fields of manifest_entry and data_file, partitioned by
+// dataset and date
+const icebergManifestSchema = `{"type":"record","name":"manifest_entry","fields":[` +
+	`{"name":"status","type":"int","field-id":0},` +
+	`{"name":"snapshot_id","type":["null","long"],"default":null,"field-id":1},` +
+	`{"name":"sequence_number","type":["null","long"],"default":null,"field-id":3},` +
+	`{"name":"file_sequence_number","type":["null","long"],"default":null,"field-id":4},` +
+	`{"name":"data_file","type":{"type":"record","name":"r2","fields":[` +
+	`{"name":"content","type":"int","field-id":134},` +
+	`{"name":"file_path","type":"string","field-id":100},` +
+	`{"name":"file_format","type":"string","field-id":101},` +
+	`{"name":"partition","type":{"type":"record","name":"r102","fields":[` +
+	`{"name":"dataset","type":["null","string"],"default":null,"field-id":1000},` +
+	`{"name":"date","type":["null",{"type":"int","logicalType":"date"}],"default":null,"field-id":1001}]},"field-id":102},` +
+	`{"name":"record_count","type":"long","field-id":103},` +
+	`{"name":"file_size_in_bytes","type":"long","field-id":104}]},"field-id":2}]}`
+
+// icebergManifestListSchema is the Avro schema of the manifest lists written
+const icebergManifestListSchema = `{"type":"record","name":"manifest_file","fields":[` +
+	`{"name":"manifest_path","type":"string","field-id":500},` +
+	`{"name":"manifest_length","type":"long","field-id":501},` +
+	`{"name":"partition_spec_id","type":"int","field-id":502},` +
+	`{"name":"content","type":"int","field-id":517},` +
+	`{"name":"sequence_number","type":"long","field-id":515},` +
+	`{"name":"min_sequence_number","type":"long","field-id":516},` +
+	`{"name":"added_snapshot_id","type":"long","field-id":503},` +
+	`{"name":"added_files_count","type":"int","field-id":504},` +
+	`{"name":"existing_files_count","type":"int","field-id":505},` +
+	`{"name":"deleted_files_count","type":"int","field-id":506},` +
+	`{"name":"added_rows_count","type":"long","field-id":512},` +
+	`{"name":"existing_rows_count","type":"long","field-id":513},` +
+	`{"name":"deleted_rows_count","type":"long","field-id":514}]}`
+
+// icebergField is a column of an Iceberg schema
+type icebergField struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Type     string `json:"type"`
+}
+
+// icebergSchema is one version of the table schema
+type icebergSchema struct {
+	Type     string         `json:"type"`
+	SchemaID int            `json:"schema-id"`
+	Fields   []icebergField `json:"fields"`
+}
+
+// icebergPartitionField is a field of the partition spec
+type icebergPartitionField struct {
+	Name      string `json:"name"`
+	Transform string `json:"transform"`
+	SourceID  int    `json:"source-id"`
+	FieldID   int    `json:"field-id"`
+}
+
+// icebergSpec is a partition spec
+type icebergSpec struct {
+	SpecID int                     `json:"spec-id"`
+	Fields []icebergPartitionField `json:"fields"`
+}
+
+// icebergSnapshot is a committed version of the table contents
+type icebergSnapshot struct {
+	SnapshotID       int64             `json:"snapshot-id"`
+	ParentSnapshotID int64             `json:"parent-snapshot-id,omitempty"`
+	SequenceNumber   int64             `json:"sequence-number"`
+	TimestampMS      int64             `json:"timestamp-ms"`
+	ManifestList     string            `json:"manifest-list"`
+	Summary          map[string]string `json:"summary"`
+	SchemaID         int               `json:"schema-id"`
+}
+
+// icebergLogEntry is an entry of the snapshot or metadata log
+type icebergLogEntry struct {
+	TimestampMS  int64  `json:"timestamp-ms"`
+	SnapshotID   int64  `json:"snapshot-id,omitempty"`
+	MetadataFile string `json:"metadata-file,omitempty"`
+}
+
+// icebergMetadata is the table metadata file, format version 2
+type icebergMetadata struct {
+	FormatVersion      int                       `json:"format-version"`
+	TableUUID          string                    `json:"table-uuid"`
+	Location           string                    `json:"location"`
+	LastSequenceNumber int64                     `json:"last-sequence-number"`
+	LastUpdatedMS      int64                     `json:"last-updated-ms"`
+	LastColumnID       int                       `json:"last-column-id"`
+	CurrentSchemaID    int                       `json:"current-schema-id"`
+	Schemas            []icebergSchema           `json:"schemas"`
+	DefaultSpecID      int                       `json:"default-spec-id"`
+	PartitionSpecs     []icebergSpec             `json:"partition-specs"`
+	LastPartitionID    int                       `json:"last-partition-id"`
+	DefaultSortOrderID int                       `json:"default-sort-order-id"`
+	SortOrders         []map[string]any          `json:"sort-orders"`
+	Properties         map[string]string         `json:"properties"`
+	CurrentSnapshotID  int64                     `json:"current-snapshot-id"`
+	Snapshots          []icebergSnapshot         `json:"snapshots"`
+	SnapshotLog        []icebergLogEntry         `json:"snapshot-log"`
+	MetadataLog        []icebergLogEntry         `json:"metadata-log"`
+	Refs               map[string]map[string]any `json:"refs"`
+}
+
+// icebergManifest is an entry of a manifest list
+type icebergManifest struct {
+	Path              string
+	Length            int64
+	SequenceNumber    int64
+	MinSequenceNumber int64
+	AddedSnapshotID   int64
+	AddedFiles        int64
+	ExistingFiles     int64
+	DeletedFiles      int64
+	AddedRows         int64
+	ExistingRows      int64
+	DeletedRows       int64
+}
+
+// runExportIceberg stages the selected days as an Iceberg table partitioned
+// by dataset and date, committing one append snapshot per run
+func runExportIceberg(args []string) int {
+	flags := flag.NewFlagSet("export-iceberg", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	output := flags.String("output", "", "Table directory to create or extend")
+	location := flags.String("location", "", "Table location recorded in the metadata, e.g. s3://bucket/openintel (default file://<output>)")
+	flags.Parse(args)
+
+	if *output == "" {
+		fmt.Println("❌ Error: --output is required")
+		return exitUsage
+	}
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	meta, version, err := readIcebergMetadata(*output)
+	if err != nil {
+		fmt.Println("❌ Error reading table metadata:", err)
+		return exitFailed
+	}
+	if meta == nil {
+		if *location == "" {
+			abs, err := filepath.Abs(*output)
+			if err != nil {
+				fmt.Println("❌ Error:", err)
+				return exitFailed
+			}
+			*location = "file://" + filepath.ToSlash(abs)
+		}
+		meta = newIcebergMetadata(strings.TrimSuffix(*location, "/"))
+	} else if *location != "" && strings.TrimSuffix(*location, "/") != meta.Location {
+		fmt.Printf("❌ Error: the table already lives at %s\n", meta.Location)
+		return exitUsage
+	}
+
+	committed := make(map[string]bool)
+	for _, s := range meta.Snapshots {
+		for _, day := range strings.Split(s.Summary[icebergDaysKey], ",") {
+			committed[day] = true
+		}
+	}
+
+	var staged []*lakeFile
+	var days []string
+	for _, day := range groupByDay(files) {
+		key := day[0].Dataset + "/" + day[0].Date
+		if committed[key] {
+			continue
+		}
+		for _, file := range day {
+			f, err := stageLakeFile(*output, file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "❌ Error staging file:", err)
+				return exitFailed
+			}
+			staged = append(staged, f)
+		}
+		days = append(days, key)
+		fmt.Fprintf(os.Stderr, "🧊 Staged %s %s: %d files\n", day[0].Dataset, day[0].Date, len(day))
+	}
+	if len(staged) == 0 {
+		fmt.Fprintln(os.Stderr, "📊 No new dataset/days to commit")
+		return exitOK
+	}
+
+	for _, warning := range evolveIcebergSchema(meta, staged) {
+		fmt.Fprintln(os.Stderr, "⚠️ ", warning)
+	}
+	if err := commitIcebergSnapshot(*output, meta, version, staged, days); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error committing snapshot:", err)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Committed %d dataset/days (%d files) as snapshot %d of %s\n",
+		len(days), len(staged), meta.CurrentSnapshotID, meta.Location)
+	return exitOK
+}
+
+// newIcebergMetadata describes an empty table partitioned by dataset and date
+func newIcebergMetadata(location string) *icebergMetadata {
+	return &icebergMetadata{
+		FormatVersion: 2,
+		TableUUID:     newUUID(),
+		Location:      location,
+		LastColumnID:  2,
+		Schemas: []icebergSchema{{Type: "struct", Fields: []icebergField{
+			{ID: 1, Name: "dataset", Type: "string"},
+			{ID: 2, Name: "date", Type: "date"},
+		}}},
+		PartitionSpecs: []icebergSpec{{Fields: []icebergPartitionField{
+			{Name: "dataset", Transform: "identity", SourceID: 1, FieldID: 1000},
+			{Name: "date", Transform: "identity", SourceID: 2, FieldID: 1001},
+		}}},
+		LastPartitionID:   1001,
+		SortOrders:        []map[string]any{{"order-id": 0, "fields": []any{}}},
+		Properties:        map[string]string{},
+		CurrentSnapshotID: -1,
+		Snapshots:         []icebergSnapshot{},
+		SnapshotLog:       []icebergLogEntry{},
+		MetadataLog:       []icebergLogEntry{},
+		Refs:              map[string]map[string]any{},
+	}
+}
+
+// readIcebergMetadata loads the current metadata of a table directory using
+// its version hint; it returns nil when the directory holds no table yet
+func readIcebergMetadata(dir string) (*icebergMetadata, int, error) {
+	hint, err := os.ReadFile(filepath.Join(dir, "metadata", "version-hint.text"))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(hint)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid version hint %q", hint)
+	}
+	data, err := os.ReadFile(icebergMetadataPath(dir, version))
+	if err != nil {
+		return nil, 0, err
+	}
+	var meta icebergMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, 0, err
+	}
+	return &meta, version, nil
+}
+
+// icebergMetadataPath returns the local path of a metadata version
+func icebergMetadataPath(dir string, version int) string {
+	return filepath.Join(dir, "metadata", fmt.Sprintf("v%d.metadata.json", version))
+}
+
+// currentIcebergSchema returns the schema new files are written against
+func currentIcebergSchema(meta *icebergMetadata) icebergSchema {
+	for _, s := range meta.Schemas {
+		if s.SchemaID == meta.CurrentSchemaID {
+			return s
+		}
+	}
+	return meta.Schemas[len(meta.Schemas)-1]
+}
+
+// evolveIcebergSchema adds the columns of the staged files that the table
+// does not have yet as a new schema version, and returns warnings about
+// columns whose type changed incompatibly
+func evolveIcebergSchema(meta *icebergMetadata, staged []*lakeFile) []string {
+	schema := currentIcebergSchema(meta)
+	fields := append([]icebergField(nil), schema.Fields...)
+	index := make(map[string]int, len(fields))
+	for i, f := range fields {
+		index[f.Name] = i
+	}
+
+	changed := false
+	warned := make(map[string]bool)
+	var warnings []string
+	for _, file := range staged {
+		for _, c := range file.Columns {
+			t := icebergTypes[c.Type]
+			i, ok := index[c.Name]
+			if !ok {
+				meta.LastColumnID++
+				index[c.Name] = len(fields)
+				fields = append(fields, icebergField{ID: meta.LastColumnID, Name: c.Name, Type: t})
+				changed = true
+				continue
+			}
+			switch {
+			case fields[i].Type == t:
+			case fields[i].Type == "int" && t == "long":
+				// int to long is an allowed promotion
+				fields[i].Type = "long"
+				changed = true
+			case fields[i].Type == "long" && t == "int":
+			case !warned[c.Name]:
+				warned[c.Name] = true
+				warnings = append(warnings, fmt.Sprintf("column %s is %s in %s but %s in the table", c.Name, t, file.Path, fields[i].Type))
+			}
+		}
+	}
+
+	switch {
+	case changed && len(meta.Snapshots) == 0:
+		// Nothing was written against the initial schema yet
+		meta.Schemas[0].Fields = fields
+	case changed:
+		next := 0
+		for _, s := range meta.Schemas {
+			if s.SchemaID >= next {
+				next = s.SchemaID + 1
+			}
+		}
+		meta.Schemas = append(meta.Schemas, icebergSchema{Type: "struct", SchemaID: next, Fields: fields})
+		meta.CurrentSchemaID = next
+	}
+
+	// The downloaded files carry no field IDs, so readers resolve columns by name
+	mapping := make([]map[string]any, len(fields))
+	for i, f := range fields {
+		mapping[i] = map[string]any{"field-id": f.ID, "names": []string{f.Name}}
+	}
+	data, _ := json.Marshal(mapping)
+	meta.Properties["schema.name-mapping.default"] = string(data)
+	return warnings
+}
+
+// commitIcebergSnapshot writes a manifest for the staged files, a manifest
+// list carrying the manifests of the previous snapshot forward, and the next
+// metadata version, which the version hint then points at
+func commitIcebergSnapshot(dir string, meta *icebergMetadata, version int, staged []*lakeFile, days []string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "metadata"), 0o755); err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	snapshotID := newSnapshotID()
+	sequence := meta.LastSequenceNumber + 1
+
+	var previous []icebergManifest
+	var parent int64
+	if meta.CurrentSnapshotID > 0 {
+		parent = meta.CurrentSnapshotID
+		for _, s := range meta.Snapshots {
+			if s.SnapshotID == parent {
+				var err error
+				if previous, err = readIcebergManifestList(dir, meta.Location, s.ManifestList); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Manifest of the added files
+	var body bytes.Buffer
+	var rows int64
+	for _, f := range staged {
+		date, err := time.Parse(dateLayout, f.Date)
+		if err != nil {
+			return err
+		}
+		avroLong(&body, 1) // ADDED
+		avroOptional(&body, true)
+		avroLong(&body, snapshotID)
+		avroOptional(&body, false) // sequence numbers are inherited
+		avroOptional(&body, false)
+		avroLong(&body, 0) // data
+		avroString(&body, meta.Location+"/"+f.Rel)
+		avroString(&body, "PARQUET")
+		avroOptional(&body, true)
+		avroString(&body, f.Dataset)
+		avroOptional(&body, true)
+		avroLong(&body, date.Unix()/86400)
+		avroLong(&body, f.Rows)
+		avroLong(&body, f.Size)
+		rows += f.Rows
+	}
+
+	schema, _ := json.Marshal(currentIcebergSchema(meta))
+	spec, _ := json.Marshal(meta.PartitionSpecs[0].Fields)
+	name := newUUID() + "-m0.avro"
+	length, err := writeAvroFile(filepath.Join(dir, "metadata", name), icebergManifestSchema, map[string]string{
+		"schema":            string(schema),
+		"schema-id":         strconv.Itoa(meta.CurrentSchemaID),
+		"partition-spec":    string(spec),
+		"partition-spec-id": "0",
+		"format-version":    "2",
+		"content":           "data",
+	}, len(staged), body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	manifests := append([]icebergManifest{{
+		Path:              meta.Location + "/metadata/" + name,
+		Length:            length,
+		SequenceNumber:    sequence,
+		MinSequenceNumber: sequence,
+		AddedSnapshotID:   snapshotID,
+		AddedFiles:        int64(len(staged)),
+		AddedRows:         rows,
+	}}, previous...)
+
+	// Manifest list of the new snapshot
+	body.Reset()
+	for _, m := range manifests {
+		avroString(&body, m.Path)
+		avroLong(&body, m.Length)
+		avroLong(&body, 0) // partition spec
+		avroLong(&body, 0) // data
+		avroLong(&body, m.SequenceNumber)
+		avroLong(&body, m.MinSequenceNumber)
+		avroLong(&body, m.AddedSnapshotID)
+		avroLong(&body, m.AddedFiles)
+		avroLong(&body, m.ExistingFiles)
+		avroLong(&body, m.DeletedFiles)
+		avroLong(&body, m.AddedRows)
+		avroLong(&body, m.ExistingRows)
+		avroLong(&body, m.DeletedRows)
+	}
+	list := fmt.Sprintf("snap-%d-1-%s.avro", snapshotID, newUUID())
+	listMeta := map[string]string{
+		"snapshot-id":     strconv.FormatInt(snapshotID, 10),
+		"sequence-number": strconv.FormatInt(sequence, 10),
+		"format-version":  "2",
+	}
+	if parent > 0 {
+		listMeta["parent-snapshot-id"] = strconv.FormatInt(parent, 10)
+	}
+	if _, err := writeAvroFile(filepath.Join(dir, "metadata", list), icebergManifestListSchema, listMeta, len(manifests), body.Bytes()); err != nil {
+		return err
+	}
+
+	// Next metadata version
+	if version > 0 {
+		meta.MetadataLog = append(meta.MetadataLog, icebergLogEntry{
+			TimestampMS:  meta.LastUpdatedMS,
+			MetadataFile: fmt.Sprintf("%s/metadata/v%d.metadata.json", meta.Location, version),
+		})
+	}
+	sort.Strings(days)
+	meta.Snapshots = append(meta.Snapshots, icebergSnapshot{
+		SnapshotID:       snapshotID,
+		ParentSnapshotID: parent,
+		SequenceNumber:   sequence,
+		TimestampMS:      now,
+		ManifestList:     meta.Location + "/metadata/" + list,
+		SchemaID:         meta.CurrentSchemaID,
+		Summary: map[string]string{
+			"operation":        "append",
+			"added-data-files": strconv.Itoa(len(staged)),
+			"added-records":    strconv.FormatInt(rows, 10),
+			icebergDaysKey:     strings.Join(days, ","),
+		},
+	})
+	meta.SnapshotLog = append(meta.SnapshotLog, icebergLogEntry{TimestampMS: now, SnapshotID: snapshotID})
+	meta.CurrentSnapshotID = snapshotID
+	meta.LastSequenceNumber = sequence
+	meta.LastUpdatedMS = now
+	meta.Refs["main"] = map[string]any{"snapshot-id": snapshotID, "type": "branch"}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := icebergMetadataPath(dir, version+1)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; another writer committed concurrently", path)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	hint := filepath.Join(dir, "metadata", "version-hint.text")
+	if err := os.WriteFile(hint+".tmp", []byte(strconv.Itoa(version+1)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(hint+".tmp", hint)
+}
+
+// readIcebergManifestList decodes a manifest list written by
+// commitIcebergSnapshot
+func readIcebergManifestList(dir, location, uri string) ([]icebergManifest, error) {
+	rel, ok := strings.CutPrefix(uri, location+"/")
+	if !ok {
+		return nil, fmt.Errorf("manifest list %s is outside the table location", uri)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	a, err := openAvro(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", uri, err)
+	}
+
+	var manifests []icebergManifest
+	for {
+		count, err := a.block()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return manifests, nil
+		}
+		for ; count > 0; count-- {
+			var m icebergManifest
+			if m.Path, err = a.string(); err != nil {
+				return nil, err
+			}
+			var spec, content int64
+			for _, v := range []*int64{&m.Length, &spec, &content, &m.SequenceNumber, &m.MinSequenceNumber, &m.AddedSnapshotID,
+				&m.AddedFiles, &m.ExistingFiles, &m.DeletedFiles, &m.AddedRows, &m.ExistingRows, &m.DeletedRows} {
+				if *v, err = a.long(); err != nil {
+					return nil, err
+				}
+			}
+			manifests = append(manifests, m)
+		}
+		if err := a.endBlock(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// newSnapshotID returns a random positive snapshot ID
+func newSnapshotID() int64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return int64(binary.BigEndian.Uint64(b[:]) >> 1)
+}
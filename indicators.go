@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indicatorNamespace is the UUID namespace of the identifiers derived for
+// shared events and indicators
+const indicatorNamespace = "6b0d1c3e-8f2a-4c55-9d0e-2f4b7a61c9e3"
+
+// indicator is a single observable taken from an analysis result
+type indicator struct {
+	Kind    string // "domain" or "hostname"
+	Value   string // lowercase, without the trailing dot
+	Target  string // CNAME target of takeover candidates
+	Comment string
+}
+
+// indicatorSet groups the indicators one analysis produced for one day
+type indicatorSet struct {
+	Source string // "nod" or "takeover"
+	Date   string
+	Title  string
+	Items  []indicator
+}
+
+// loadIndicators reads the NOD feeds in nodDir and a takeover report
+// written with --format csv or json; either may be empty
+func loadIndicators(nodDir, takeoverPath string) ([]indicatorSet, error) {
+	var sets []indicatorSet
+	if nodDir != "" {
+		feeds, err := filepath.Glob(filepath.Join(nodDir, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, feed := range feeds {
+			set, err := readNODFeed(feed)
+			if err != nil {
+				return nil, err
+			}
+			if len(set.Items) > 0 {
+				sets = append(sets, set)
+			}
+		}
+	}
+	if takeoverPath != "" {
+		takeover, err := readTakeoverReport(takeoverPath)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, takeover...)
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Date != sets[j].Date {
+			return sets[i].Date < sets[j].Date
+		}
+		return sets[i].Source < sets[j].Source
+	})
+	return sets, nil
+}
+
+// readNODFeed reads a <date>.txt feed written by the nod command
+func readNODFeed(path string) (indicatorSet, error) {
+	date := strings.TrimSuffix(filepath.Base(path), ".txt")
+	set := indicatorSet{Source: "nod", Date: date, Title: "Newly observed domains in the OpenINTEL toplists on " + date}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return set, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := indicatorValue(scanner.Text()); name != "" {
+			set.Items = append(set.Items, indicator{Kind: "domain", Value: name, Comment: "first observed " + date})
+		}
+	}
+	return set, scanner.Err()
+}
+
+// readTakeoverReport reads the output of the takeover command, one set per day
+func readTakeoverReport(path string) ([]indicatorSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		r := csv.NewReader(strings.NewReader(string(data)))
+		headers, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			row := make(map[string]string, len(headers))
+			for i, header := range headers {
+				if i < len(record) {
+					row[header] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	byDate := make(map[string]*indicatorSet)
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		name := indicatorValue(row["name"])
+		if name == "" || row["date"] == "" {
+			return nil, fmt.Errorf("%s: expected the date and name columns of the takeover report", path)
+		}
+		if seen[row["date"]+" "+name+" "+row["target"]] {
+			continue // the same candidate in several datasets
+		}
+		seen[row["date"]+" "+name+" "+row["target"]] = true
+
+		set := byDate[row["date"]]
+		if set == nil {
+			set = &indicatorSet{Source: "takeover", Date: row["date"], Title: "Subdomain takeover candidates in the OpenINTEL toplists on " + row["date"]}
+			byDate[row["date"]] = set
+		}
+		comment := fmt.Sprintf("CNAME to %s", strings.TrimSuffix(row["target"], "."))
+		if row["service"] != "" {
+			comment += " (" + row["service"] + ")"
+		}
+		comment += fmt.Sprintf(", evidence %s, confidence %s", row["evidence"], row["confidence"])
+		set.Items = append(set.Items, indicator{Kind: "hostname", Value: name, Target: indicatorValue(row["target"]), Comment: comment})
+	}
+
+	sets := make([]indicatorSet, 0, len(byDate))
+	for _, set := range byDate {
+		sets = append(sets, *set)
+	}
+	return sets, nil
+}
+
+// indicatorValue normalizes a name for sharing: lowercase, no trailing dot
+func indicatorValue(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// nameUUID returns the version 5 UUID of a name within a namespace, so
+// regenerated feeds keep the identifiers of what they shared before
+func nameUUID(namespace, name string) string {
+	ns, err := hex.DecodeString(strings.ReplaceAll(namespace, "-", ""))
+	if err != nil || len(ns) != 16 {
+		panic("invalid UUID namespace " + namespace)
+	}
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const ipIndexFile = "ip-index.db"
+
+var (
+	ipBucket      = []byte("ip")      // 16-byte address -> JSON []ipSighting
+	indexedBucket = []byte("indexed") // "date/dataset" markers of merged days
+)
+
+// ipSighting is a domain observed resolving to an address
+type ipSighting struct {
+	Domain    string `json:"domain"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// ipKey encodes an address so IPv4 and IPv6 keys sort numerically together
+func ipKey(addr netip.Addr) []byte {
+	b := addr.As16()
+	return b[:]
+}
+
+// runIPIndex builds or extends the IP-to-domain reverse index
+func runIPIndex(args []string) int {
+	flags := flag.NewFlagSet("ip-index", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	indexPath := flags.String("index", "", "Index file (default <dir>/"+ipIndexFile+")")
+	rebuild := flags.Bool("rebuild", false, "Re-index days that are already in the index")
+	flags.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = filepath.Join(downloadDir, ipIndexFile)
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	db, err := bolt.Open(*indexPath, 0o644, nil)
+	if err != nil {
+		fmt.Println("❌ Error opening index:", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	indexed, skipped := 0, 0
+	for _, day := range groupByDay(files) {
+		marker := []byte(day[0].Date + "/" + day[0].Dataset)
+		if !*rebuild && isMarked(db, indexedBucket, marker) {
+			skipped++
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "🗂️  Indexing %s %s\n", day[0].Dataset, day[0].Date)
+		if err := indexDay(db, day, marker); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error indexing:", err)
+			return exitFailed
+		}
+		indexed++
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Indexed %d dataset/days (%d already present) into %s\n", indexed, skipped, *indexPath)
+	return exitOK
+}
+
+// addressSet maps the addresses of one dataset/day to the names resolving to them
+type addressSet map[netip.Addr]map[string]bool
+
+// add records the address of an A or AAAA record
+func (a addressSet) add(r *record) {
+	var value string
+	switch r.ResponseType {
+	case "A":
+		value = r.IP4Address
+	case "AAAA":
+		value = r.IP6Address
+	default:
+		return
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return
+	}
+	if a[addr] == nil {
+		a[addr] = make(map[string]bool)
+	}
+	a[addr][strings.ToLower(r.QueryName)] = true
+}
+
+// indexDay collects the addresses of one dataset/day and merges them into the index
+func indexDay(db *bolt.DB, files []archiveFile, marker []byte) error {
+	addresses := make(addressSet)
+	err := scanRecords(files, nil, func(r *record) error {
+		addresses.add(r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := mergeAddresses(tx, addresses, files[0].Date); err != nil {
+			return err
+		}
+		done, err := tx.CreateBucketIfNotExists(indexedBucket)
+		if err != nil {
+			return err
+		}
+		return done.Put(marker, []byte{1})
+	})
+}
+
+// mergeAddresses extends the ip bucket with the addresses seen on date
+func mergeAddresses(tx *bolt.Tx, addresses addressSet, date string) error {
+	ips, err := tx.CreateBucketIfNotExists(ipBucket)
+	if err != nil {
+		return err
+	}
+	for addr, domains := range addresses {
+		key := ipKey(addr)
+		var sightings []ipSighting
+		if existing := ips.Get(key); existing != nil {
+			if err := json.Unmarshal(existing, &sightings); err != nil {
+				return err
+			}
+		}
+		if err := ips.Put(key, mergeSightings(sightings, domains, date)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeSightings extends the sightings of an address with the domains seen on date
+func mergeSightings(sightings []ipSighting, domains map[string]bool, date string) []byte {
+	known := make(map[string]int, len(sightings))
+	for i, s := range sightings {
+		known[s.Domain] = i
+	}
+
+	for domain := range domains {
+		i, ok := known[domain]
+		if !ok {
+			sightings = append(sightings, ipSighting{Domain: domain, FirstSeen: date, LastSeen: date})
+			continue
+		}
+		if date < sightings[i].FirstSeen {
+			sightings[i].FirstSeen = date
+		}
+		if date > sightings[i].LastSeen {
+			sightings[i].LastSeen = date
+		}
+	}
+
+	sort.Slice(sightings, func(i, j int) bool { return sightings[i].Domain < sightings[j].Domain })
+	data, _ := json.Marshal(sightings)
+	return data
+}
+
+// runLookupIP queries the reverse index for addresses or CIDR prefixes
+func runLookupIP(args []string) int {
+	flags := flag.NewFlagSet("lookup-ip", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	indexPath := flags.String("index", "", "Index file (default <dir>/"+ipIndexFile+")")
+	asJSON := flags.Bool("json", false, "Print results as JSON lines")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("❌ Error: usage is lookup-ip [options] <ip|cidr>...")
+		return exitUsage
+	}
+	if *indexPath == "" {
+		*indexPath = filepath.Join(downloadDir, ipIndexFile)
+	}
+
+	db, err := bolt.Open(*indexPath, 0o644, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		fmt.Println("❌ Error opening index:", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	encoder := json.NewEncoder(os.Stdout)
+	found := 0
+	for _, arg := range flags.Args() {
+		start, end, err := addressRange(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error:", err)
+			return exitUsage
+		}
+		n, err := lookupAddresses(db, start, end, *asJSON, encoder)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading index:", err)
+			return exitFailed
+		}
+		found += n
+	}
+
+	if found == 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// addressRange returns the first and last index keys covered by an address or prefix
+func addressRange(arg string) ([]byte, []byte, error) {
+	if !strings.Contains(arg, "/") {
+		addr, err := netip.ParseAddr(arg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid address %q", arg)
+		}
+		return ipKey(addr), ipKey(addr), nil
+	}
+
+	prefix, err := netip.ParsePrefix(arg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid prefix %q", arg)
+	}
+	prefix = prefix.Masked()
+
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96 // IPv4 addresses are stored IPv4-mapped
+	}
+	first := prefix.Addr().As16()
+	last := first
+	for i := bits; i < 128; i++ {
+		last[i/8] |= 1 << (7 - i%8)
+	}
+	return first[:], last[:], nil
+}
+
+// addressSightings is one indexed address and the domains seen on it
+type addressSightings struct {
+	IP      string       `json:"ip"`
+	Domains []ipSighting `json:"domains"`
+}
+
+// lookupAddresses prints the sightings of the indexed addresses between two
+// keys and returns how many addresses were found
+func lookupAddresses(db *bolt.DB, start, end []byte, asJSON bool, encoder *json.Encoder) (int, error) {
+	addresses, _, err := indexedAddresses(db, start, end, 0)
+	for _, a := range addresses {
+		if asJSON {
+			encoder.Encode(a)
+			continue
+		}
+		for _, s := range a.Domains {
+			fmt.Printf("%s\t%s\t%s\t%s\n", a.IP, s.Domain, s.FirstSeen, s.LastSeen)
+		}
+	}
+	return len(addresses), err
+}
+
+// indexedAddresses returns the sightings of the indexed addresses between
+// two keys; with a positive limit, it stops after that many addresses and
+// reports whether there were more
+func indexedAddresses(db *bolt.DB, start, end []byte, limit int) ([]addressSightings, bool, error) {
+	var addresses []addressSightings
+	truncated := false
+	err := scanAddresses(db, start, end, nil, func(_ []byte, a addressSightings) bool {
+		if limit > 0 && len(addresses) == limit {
+			truncated = true
+			return false
+		}
+		addresses = append(addresses, a)
+		return true
+	})
+	return addresses, truncated, err
+}
+
+// scanAddresses calls fn with the key and the sightings of the indexed
+// addresses between two keys, from the key following after if set, until
+// fn returns false
+func scanAddresses(db *bolt.DB, start, end, after []byte, fn func(key []byte, a addressSightings) bool) error {
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ipBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.Seek(start)
+		if after != nil && bytes.Compare(after, start) >= 0 {
+			if k, v = c.Seek(after); bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			a := addressSightings{IP: netip.AddrFrom16([16]byte(k)).Unmap().String()}
+			if err := json.Unmarshal(v, &a.Domains); err != nil {
+				return err
+			}
+			if !fn(k, a) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
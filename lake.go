@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// lakeColumn is a top-level column of the downloaded files in the neutral
+// type vocabulary the table format writers translate from
+type lakeColumn struct {
+	Name string
+	Type string // boolean, int, long, float, double, string, binary, date or timestamp
+}
+
+// lakeFile is a downloaded file staged into a table directory
+type lakeFile struct {
+	archiveFile
+	Rel     string // path relative to the table directory
+	Size    int64
+	Rows    int64
+	Columns []lakeColumn
+}
+
+// parquetColumns lists the primitive top-level columns of a parquet file and
+// its row count; nested and repeated columns are not exposed
+func parquetColumns(path string) ([]lakeColumn, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	pf, err := parquet.OpenFile(f, info.Size(), parquet.SkipPageIndex(true))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var columns []lakeColumn
+	for _, field := range pf.Schema().Fields() {
+		if !field.Leaf() || field.Repeated() {
+			continue
+		}
+		if t := lakeType(field.Type()); t != "" {
+			columns = append(columns, lakeColumn{Name: field.Name(), Type: t})
+		}
+	}
+	return columns, pf.NumRows(), nil
+}
+
+// lakeType maps a parquet leaf type to the neutral type vocabulary, or ""
+// for types the table writers do not map
+func lakeType(t parquet.Type) string {
+	logical := t.LogicalType()
+	switch t.Kind() {
+	case parquet.Boolean:
+		return "boolean"
+	case parquet.Int32:
+		if logical != nil && logical.Date != nil {
+			return "date"
+		}
+		return "int"
+	case parquet.Int64:
+		if logical != nil && logical.Timestamp != nil && logical.Timestamp.Unit.Micros != nil {
+			return "timestamp"
+		}
+		return "long"
+	case parquet.Float:
+		return "float"
+	case parquet.Double:
+		return "double"
+	case parquet.ByteArray:
+		if logical != nil && (logical.UTF8 != nil || logical.Enum != nil || logical.Json != nil) {
+			return "string"
+		}
+		return "binary"
+	}
+	return ""
+}
+
+// stageLakeFile places a downloaded file under data/dataset=<name>/date=<day>/
+// of a table directory, hard-linking it when possible and copying otherwise
+func stageLakeFile(tableDir string, file archiveFile) (*lakeFile, error) {
+	columns, rows, err := parquetColumns(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Path, err)
+	}
+
+	rel := filepath.ToSlash(filepath.Join("data", "dataset="+file.Dataset, "date="+file.Date, filepath.Base(file.Path)))
+	target := filepath.Join(tableDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Link(file.Path, target); err != nil && !os.IsExist(err) {
+		if err := copyFile(file.Path, target); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	return &lakeFile{archiveFile: file, Rel: rel, Size: info.Size(), Rows: rows, Columns: columns}, nil
+}
+
+// copyFile copies src to dst through a temporary file
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// unsafeNameChars matches what may not appear in a local file name
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._=-]`)
+
+// findLinks returns the file links of a listing page: the a.flex-container
+// anchors, plus any other anchor to a .parquet file so that a change of the
+// page layout does not go unnoticed or lose files
+func findLinks(doc *goquery.Document, pageURL string) []string {
+	var hrefs []string
+	seen := make(map[string]bool)
+	doc.Find("a.flex-container").Each(func(i int, s *goquery.Selection) {
+		if href, exists := s.Attr("href"); exists && !seen[href] {
+			seen[href] = true
+			hrefs = append(hrefs, href)
+		}
+	})
+	selected := len(hrefs)
+
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if seen[href] {
+			return
+		}
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil && strings.HasSuffix(u.Path, ".parquet") {
+			seen[href] = true
+			hrefs = append(hrefs, href)
+		}
+	})
+	if extra := len(hrefs) - selected; extra > 0 {
+		fmt.Printf("⚠️  Listing layout changed? %d .parquet links outside a.flex-container on %s\n", extra, pageURL)
+	}
+	return hrefs
+}
+
+// maxRedirects bounds the redirects followed by a request to the archive
+const maxRedirects = 10
+
+// archiveLinks resolves the links of a listing page against the address it
+// was served from and keeps the ones that point to parquet files of the
+// archive, reporting the others
+func archiveLinks(page *url.URL, hrefs []string) []string {
+	links := make([]string, 0, len(hrefs))
+	for _, href := range hrefs {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			fmt.Printf("⚠️  Ignoring link %q of %s: %v\n", href, page, err)
+			continue
+		}
+		link := page.ResolveReference(ref).String()
+		if err := validateLink(link, page); err != nil {
+			fmt.Printf("⚠️  Ignoring link %q of %s: %v\n", href, page, err)
+			continue
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// checkRedirect lets the archive clients follow redirects within the site
+// of the original request only, and never from https to http
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	first := via[0].URL
+	if !sameSite(req.URL.Hostname(), first.Hostname()) {
+		return fmt.Errorf("redirect to %s leaves %s", req.URL.Host, first.Host)
+	}
+	if first.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to %s downgrades to %s", req.URL, req.URL.Scheme)
+	}
+	return nil
+}
+
+// validateLink checks that a link is an http(s) URL on the site of the
+// listing page whose path names a .parquet file
+func validateLink(link string, page *url.URL) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("not an absolute URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if !sameSite(u.Hostname(), page.Hostname()) {
+		return fmt.Errorf("host %q is not part of %s", u.Hostname(), page.Hostname())
+	}
+	if name := path.Base(u.Path); !strings.HasSuffix(name, ".parquet") || name == ".parquet" {
+		return fmt.Errorf("not a parquet file")
+	}
+	return nil
+}
+
+// sameSite reports whether host belongs to the registrable domain of the
+// listing host, e.g. a storage subdomain; addresses must match exactly
+func sameSite(host, listingHost string) bool {
+	host, listingHost = strings.ToLower(host), strings.ToLower(listingHost)
+	if host == listingHost {
+		return true
+	}
+	if host == "" || net.ParseIP(host) != nil || net.ParseIP(listingHost) != nil {
+		return false
+	}
+	return registrableDomain(host) == registrableDomain(listingHost)
+}
+
+// localName derives the file name a download is saved as. Plain names are
+// kept; names with unsafe characters, or from URLs with a query, are cleaned
+// up and given a hash of the URL so that they cannot collide.
+func localName(fileURL string) string {
+	// The last segment is decoded on its own, so an escaped slash stays
+	// part of the name and is replaced below
+	var name string
+	u, err := url.Parse(fileURL)
+	if err == nil {
+		name, err = url.PathUnescape(path.Base(u.EscapedPath()))
+	}
+	safe := strings.TrimLeft(unsafeNameChars.ReplaceAllString(name, "_"), ".")
+	if err == nil && safe == name && u.RawQuery == "" && strings.HasSuffix(name, ".parquet") {
+		return name
+	}
+	return hashedName(safe, fileURL)
+}
+
+// hashedName appends a hash of the URL to a cleaned up file name
+func hashedName(safe, fileURL string) string {
+	stem := strings.TrimSuffix(safe, ".parquet")
+	if stem == "" {
+		stem = "file"
+	}
+	sum := sha256.Sum256([]byte(fileURL))
+	return stem + "-" + hex.EncodeToString(sum[:4]) + ".parquet"
+}
+
+// dayDir returns the directory holding the files of a dataset/day, so that
+// identically named parts of different datasets and days never collide
+func dayDir(page listing) string {
+	return filepath.Join(downloadDir, page.Dataset, page.Date())
+}
+
+// entryName returns the name a file is recorded under in manifests: its
+// path relative to the download directory, with forward slashes
+func entryName(path string) string {
+	rel, err := filepath.Rel(downloadDir, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// fileNames remembers the URL each local file was used for in this run
+var fileNames = struct {
+	sync.Mutex
+	urls map[string]string
+}{urls: make(map[string]string)}
+
+// claimPath returns the local path of a download in dir, switching to a
+// hashed name when another URL of the run already uses the plain one
+func claimPath(dir, fileURL string) string {
+	path := filepath.Join(dir, localName(fileURL))
+	fileNames.Lock()
+	defer fileNames.Unlock()
+	if other, used := fileNames.urls[path]; used && other != fileURL {
+		hashed := filepath.Join(dir, hashedName(filepath.Base(path), fileURL))
+		fmt.Printf("⚠️  %s is already used by %s, saving %s as %s\n", path, other, fileURL, hashed)
+		path = hashed
+	}
+	fileNames.urls[path] = fileURL
+	return path
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestValidateLink(t *testing.T) {
+	page, err := url.Parse("https://openintel.nl/download/forward-dns/basis=toplist/source=tranco/year=2024/month=01/day=01/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, link string
+		wantErr    bool
+	}{
+		{"same host", "https://openintel.nl/download/part-00000.gz.parquet", false},
+		{"plain http", "http://openintel.nl/download/part-00000.gz.parquet", false},
+		{"storage subdomain", "https://object.openintel.nl/part-00000.gz.parquet", false},
+		{"upper case host", "https://OpenIntel.NL/part-00000.gz.parquet", false},
+		{"query string", "https://openintel.nl/part-00000.gz.parquet?x-amz-signature=1", false},
+		{"relative", "part-00000.gz.parquet", true},
+		{"protocol relative", "//openintel.nl/part-00000.gz.parquet", true},
+		{"ftp", "ftp://openintel.nl/part-00000.gz.parquet", true},
+		{"javascript", "javascript:alert(1)//.parquet", true},
+		{"another site", "https://example.com/part-00000.gz.parquet", true},
+		{"lookalike suffix", "https://openintel.nl.example.com/part-00000.gz.parquet", true},
+		{"address", "https://192.0.2.1/part-00000.gz.parquet", true},
+		{"not parquet", "https://openintel.nl/download/index.html", true},
+		{"bare extension", "https://openintel.nl/.parquet", true},
+		{"unparsable", "https://openintel.nl/%zz.parquet", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLink(tt.link, page)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLink(%q) = %v, want error %v", tt.link, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	request := func(rawURL string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	chain := func(n int) []*http.Request {
+		via := make([]*http.Request, n)
+		for i := range via {
+			via[i] = request("https://openintel.nl/download/")
+		}
+		return via
+	}
+	tests := []struct {
+		name    string
+		target  string
+		via     []*http.Request
+		wantErr bool
+	}{
+		{"same host", "https://openintel.nl/other/", chain(1), false},
+		{"storage subdomain", "https://object.openintel.nl/part-00000.gz.parquet", chain(1), false},
+		{"http upgraded", "https://openintel.nl/", []*http.Request{request("http://openintel.nl/")}, false},
+		{"plain http kept", "http://openintel.nl/other/", []*http.Request{request("http://openintel.nl/")}, false},
+		{"last allowed", "https://openintel.nl/", chain(maxRedirects - 1), false},
+		{"another site", "https://example.com/part-00000.gz.parquet", chain(1), true},
+		{"address", "https://192.0.2.1/part-00000.gz.parquet", chain(1), true},
+		{"https downgraded", "http://openintel.nl/download/", chain(1), true},
+		{"too many", "https://openintel.nl/", chain(maxRedirects), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRedirect(request(tt.target), tt.via)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRedirect(%s) = %v, want error %v", tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const listingCacheFile = "listings.db"
+
+var listingBucket = []byte("listings")
+
+// listingCache is the on-disk cache of parsed listing pages, nil when disabled
+var listingCache *listingStore
+
+// listingStore keeps the links of listing pages keyed by URL
+type listingStore struct {
+	db  *bolt.DB
+	ttl time.Duration
+}
+
+// cachedListing is a listing page as stored in the cache, with the
+// validators used to revalidate it once it is stale
+type cachedListing struct {
+	Links        []string  `json:"links"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+// openListingCache enables the listing cache of the archive; entries older
+// than ttl are fetched again
+func openListingCache(ttl time.Duration) error {
+	path := filepath.Join(downloadDir, listingCacheFile)
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(listingBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	listingCache = &listingStore{db: db, ttl: ttl}
+	return nil
+}
+
+// lookup returns the cached entry of a listing page, if any, and whether it
+// is fresh enough to be used without asking the server
+func (s *listingStore) lookup(url string) (*cachedListing, bool) {
+	if s == nil {
+		return nil, false
+	}
+	var entry cachedListing
+	found := false
+	s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(listingBucket).Get([]byte(url)); data != nil {
+			found = json.Unmarshal(data, &entry) == nil
+		}
+		return nil
+	})
+	if !found {
+		return nil, false
+	}
+	return &entry, time.Since(entry.FetchedAt) <= s.ttl
+}
+
+// put stores a listing page that was just fetched or revalidated
+func (s *listingStore) put(url string, entry cachedListing) {
+	if s == nil {
+		return
+	}
+	entry.FetchedAt = time.Now().UTC()
+	data, _ := json.Marshal(entry)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(listingBucket).Put([]byte(url), data)
+	})
+	if err != nil {
+		fmt.Println("⚠️  Error caching listing:", err)
+	}
+}
+
+// close releases the cache file
+func (s *listingStore) close() {
+	if s != nil {
+		s.db.Close()
+	}
+}
@@ -1,38 +1,150 @@
 package main
 
 import (
-	"crypto/tls"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"sync"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 const (
-	baseURL     = "https://openintel.nl/download/forward-dns/basis=toplist/source=%s/year=%d/month=%02d/day=%02d/"
-	downloadDir = "parquet_files"
 	defaultYear = 2016
 	maxYear     = 2025
 )
 
+// baseURL is the listing page of a dataset/day; bench points it at a local server
+var baseURL = "https://openintel.nl/download/forward-dns/basis=toplist/source=%s/year=%d/month=%02d/day=%02d/"
+
 var datasets = []string{"alexa", "radar", "tranco", "umbrella"}
-var workerLimit = 10 // Maximum number of concurrent downloads
+var workerLimit = 10              // Maximum number of concurrent downloads
+var downloadDir = "parquet_files" // Local archive directory
+var probeListings bool            // Skip complete and missing days before fetching their listing
+var syncMode bool                 // Revalidate listings and downloaded files with conditional requests
+var orderedMode bool              // Crawl one listing and one file at a time, in a reproducible order
+
+// commands maps subcommand names to their entry points; each returns the process exit code
+var commands = map[string]func(args []string) int{
+	"verify":         runVerify,
+	"check":          runCheck,
+	"sign":           runSign,
+	"repair":         runRepair,
+	"grep":           runGrep,
+	"subdomains":     runSubdomains,
+	"diff":           runDiff,
+	"history":        runHistory,
+	"providers":      runProviders,
+	"ip-index":       runIPIndex,
+	"lookup-ip":      runLookupIP,
+	"hosting":        runHosting,
+	"top":            runTop,
+	"dnssec":         runDNSSEC,
+	"email-security": runEmailSecurity,
+	"caa":            runCAA,
+	"wildcards":      runWildcards,
+	"nod":            runNOD,
+	"takeover":       runTakeover,
+	"asn":            runASN,
+	"homographs":     runHomographs,
+	"ranks":          runRanks,
+	"bloom":          runBloom,
+	"index":          runIndex,
+	"serve-query":    runServeQuery,
+	"freshness":      runFreshness,
+	"serve-files":    runServeFiles,
+	"coverage":       runCoverage,
+	"ttl":            runTTL,
+	"psl":            runPSL,
+	"timeseries":     runTimeseries,
+	"anomalies":      runAnomalies,
+	"load-postgres":  runLoadPostgres,
+	"export-sqlite":  runExportSQLite,
+	"index-elastic":  runIndexElastic,
+	"publish-nats":   runPublishNATS,
+	"forward-splunk": runForwardSplunk,
+	"export-redis":   runExportRedis,
+	"build-db":       runBuildDB,
+	"export-iceberg": runExportIceberg,
+	"export-delta":   runExportDelta,
+	"export-neo4j":   runExportNeo4j,
+	"misp":           runMISP,
+	"stix":           runSTIX,
+	"bench":          runBench,
+	"serve":          runServe,
+	"enqueue":        runEnqueue,
+	"work":           runWork,
+}
 
-// Global HTTP client
-var httpClient *http.Client
+// Global HTTP clients sharing one transport, so the proxy, TLS and cookie
+// settings apply to listings and downloads alike
+var (
+	httpTransport  *http.Transport
+	httpClient     *http.Client
+	downloadClient *http.Client
+)
 
 func main() {
+	// Dispatch subcommands before parsing the download flags
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	os.Exit(crawl())
+}
+
+// crawl downloads the archive as selected by the command-line flags and
+// returns the process exit code
+func crawl() int {
 	// Define command-line arguments
 	startYear := flag.Int("start-year", defaultYear, "Start year (minimum 2016)")
 	endYear := flag.Int("end-year", maxYear, "End year (maximum 2025)")
-	proxyURL := flag.String("proxy", "", "HTTP proxy URL (optional)")
+	datesFile := flag.String("dates-file", "", "File with specific dates (YYYY-MM-DD, one per line) to download")
+	onlyDatasets := flag.String("dataset", "", "Comma-separated datasets to download (default all)")
+	include := flag.String("include", "", "Comma-separated globs of the file names to download, e.g. part-00000*, or re:<regexp> (default all)")
+	exclude := flag.String("exclude", "", "Comma-separated globs of the file names not to download, or re:<regexp> (optional)")
+	flag.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	flag.StringVar(&signKey, "sign-key", "", "GPG key ID used to sign manifests (optional)")
+	cacheTTL := flag.Duration("listing-cache", 0, "Reuse listing pages fetched within this long, e.g. 24h (default disabled)")
+	flag.IntVar(&workerLimit, "workers", workerLimit, "Number of concurrent file downloads")
+	flag.IntVar(&listingWorkers, "list-workers", listingWorkers, "Number of listing pages fetched concurrently")
+	flag.BoolVar(&syncMode, "sync", false, "Revalidate listings and downloaded files with conditional requests and fetch what changed")
+	flag.BoolVar(&orderedMode, "ordered", false, "Crawl days in chronological order, one listing page and one file at a time, so every run logs and writes manifests in the same order")
+	flag.BoolVar(&probeListings, "probe", false, "Skip days whose manifest is complete and probe listing pages with HEAD before fetching them")
+	minFree := flag.String("min-free", "1GiB", "Pause downloads while less than this much disk space is free (0 disables)")
+	checkSpace := flag.Bool("preflight", false, "Ask for the size of the files to download and stop if they do not fit on disk")
+	speed := flag.String("min-speed", "1KiB", "Abort and retry downloads slower than this many bytes per second over -stall-time (0 disables)")
+	flag.DurationVar(&stallWindow, "stall-time", stallWindow, "How long a download may stay below -min-speed")
+	maxFailures := flag.String("max-failures", "0", "Failed listings and files tolerated before exiting with code 1, as a count or a percentage like 5%")
+	lockSpec := flag.String("lock", "", "Lock every dataset/day while crawling it, with a redis:// URL or \"file\" for lock files in -dir, so instances sharing the directory never crawl the same day (optional)")
+	pprofAddr := flag.String("pprof-addr", "", "Serve runtime profiles on this address, e.g. 127.0.0.1:6060 (optional)")
+	addProxyFlags(flag.CommandLine)
+	addTLSFlags(flag.CommandLine)
+	addDNSFlags(flag.CommandLine)
+	addNetworkFlags(flag.CommandLine)
+	addTorFlags(flag.CommandLine)
+	addPolitenessFlags(flag.CommandLine)
+	addTimeoutFlags(flag.CommandLine)
+	events := &natsSink{}
+	addNATSFlags(flag.CommandLine, events)
+	notifier := &runNotifier{}
+	addNotifyFlags(flag.CommandLine, notifier)
+	report := &emailReport{}
+	addEmailFlags(flag.CommandLine, report)
+	failureWebhooks := flag.String("failure-hook", "", "Comma-separated URLs to post an event to for every listing page or file that fails (optional)")
+	failureSecret := flag.String("failure-secret", "", "Sign the failure webhook bodies with HMAC-SHA256 and this secret (optional)")
+	reportPath := flag.String("run-report", "", "Write the JSON report of the run to this file (default <dir>/"+runReportFile+")")
 	showHelp := flag.Bool("help", false, "Display help menu")
 
 	flag.Parse()
@@ -40,161 +152,804 @@ func main() {
 	// Display help and exit if --help is passed
 	if *showHelp {
 		showUsage()
-		return
+		return exitOK
+	}
+
+	if torMode {
+		torDefaults(flag.CommandLine)
+	}
+	if workerLimit < 1 || listingWorkers < 1 {
+		fmt.Println("❌ Error: -workers and -list-workers must be positive")
+		return exitUsage
+	}
+
+	if *onlyDatasets != "" {
+		selected, err := selectDatasets(*onlyDatasets)
+		if err != nil {
+			fmt.Println("❌ Error: -dataset:", err)
+			return exitUsage
+		}
+		datasets = selected
+	}
+
+	if *include != "" || *exclude != "" {
+		filter, err := newFileFilter(*include, *exclude)
+		if err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+		filesFilter = filter
+	}
+
+	threshold, err := parseFailureThreshold(*maxFailures)
+	if err != nil {
+		fmt.Println("❌ Error: -max-failures:", err)
+		return exitUsage
+	}
+	notify, err := notifier.setup()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	mail, err := report.setup()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if *failureWebhooks != "" {
+		hooks, err := newWebhooks(*failureWebhooks, *failureSecret, false)
+		if err != nil {
+			fmt.Println("❌ Error: -failure-hook:", err)
+			return exitUsage
+		}
+		hooks.slots = make(chan struct{}, failureWebhookSlots)
+		failureHooks = hooks
+		defer hooks.wait()
+	} else if *failureSecret != "" {
+		fmt.Println("❌ Error: -failure-secret requires -failure-hook")
+		return exitUsage
+	}
+
+	if *pprofAddr != "" {
+		if err := startPprof(*pprofAddr); err != nil {
+			fmt.Println("❌ Error starting pprof:", err)
+			return exitFailed
+		}
+	}
+
+	if *speed == "0" {
+		minSpeed = 0
+	} else {
+		speed, err := parseSize(*speed)
+		if err != nil {
+			fmt.Println("❌ Error: -min-speed:", err)
+			return exitUsage
+		}
+		minSpeed = speed
+	}
+	if stallWindow <= 0 {
+		fmt.Println("❌ Error: -stall-time must be positive")
+		return exitUsage
+	}
+
+	if *minFree != "0" {
+		floor, err := parseSize(*minFree)
+		if err != nil {
+			fmt.Println("❌ Error: -min-free:", err)
+			return exitUsage
+		}
+		disk.floor = floor
 	}
 
-	// Validate the year range
-	if *startYear < defaultYear || *endYear > maxYear || *startYear > *endYear {
-		fmt.Println("❌ Error: Year range must be between 2016 and 2025.")
+	// Validate the year range and load the explicit date list if provided
+	dates, err := selectDays(*startYear, *endYear, *datesFile)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
 		showUsage()
-		return
+		return exitUsage
+	}
+	if orderedMode {
+		// Dates files may list days in any order
+		slices.SortFunc(dates, time.Time.Compare)
 	}
 
-	// Configure proxy if provided
-	proxyFunc := http.ProxyFromEnvironment
-	if *proxyURL != "" {
-		proxy, err := url.Parse(*proxyURL)
-		if err == nil {
-			proxyFunc = http.ProxyURL(proxy)
-			fmt.Println("🛡️ Using proxy:", *proxyURL)
-		} else {
-			fmt.Println("❌ Error configuring proxy:", err)
-			return
+	// Announce completed dataset/days on NATS JetStream if requested
+	if events.URL != "" {
+		if err := events.connect(); err != nil {
+			fmt.Println("❌ Error connecting to NATS:", err)
+			return exitFailed
 		}
+		defer events.close()
+		downloadEvents = events
 	}
 
 	// Create HTTP client with proxy support
-	httpClient = &http.Client{
-		Transport: &http.Transport{
-			Proxy:           proxyFunc,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // Skip SSL certificate errors if needed
-		},
-		Timeout: 30 * time.Second, // Timeout to avoid blocking requests
+	if err := configureHTTPClient(); err != nil {
+		fmt.Println("❌ Error configuring the HTTP client:", err)
+		return exitUsage
 	}
 
 	// Create the download directory if it does not exist
 	os.MkdirAll(downloadDir, os.ModePerm)
 
+	// Coordinate with the other instances writing to the same directory
+	if *lockSpec != "" {
+		locks, err := openDayLocks(*lockSpec)
+		if err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+		defer locks.close()
+		dayLocks = locks
+	}
+
+	// Reuse recently parsed listing pages if requested; sync mode keeps
+	// their validators in the same cache
+	if *cacheTTL > 0 || syncMode {
+		if err := openListingCache(*cacheTTL); err != nil {
+			fmt.Println("❌ Error opening listing cache:", err)
+			return exitFailed
+		}
+		defer listingCache.close()
+	}
+
 	// Display download info
 	fmt.Println("📂 Download directory:", downloadDir)
-	fmt.Printf("📅 Downloading files from %d to %d\n", *startYear, *endYear)
-
-	// Concurrency control channel
-	sem := make(chan struct{}, workerLimit)
-	var wg sync.WaitGroup
-
-	// Loop through years, months, and days
-	for year := *startYear; year <= *endYear; year++ {
-		for month := 1; month <= 12; month++ {
-			for day := 1; day <= 31; day++ {
-				for _, dataset := range datasets {
-					url := fmt.Sprintf(baseURL, dataset, year, month, day)
-
-					// Add a worker goroutine
-					wg.Add(1)
-					sem <- struct{}{} // Limit concurrency
-
-					go func(url string) {
-						defer wg.Done()
-						defer func() { <-sem }() // Free slot
-						processPage(url)
-					}(url)
-				}
-			}
+	if dates != nil {
+		fmt.Printf("📅 Downloading files for %d dates from %s\n", len(dates), *datesFile)
+	} else {
+		fmt.Printf("📅 Downloading files from %d to %d\n", *startYear, *endYear)
+	}
+
+	// Listing pages and file downloads run in separate worker pools
+	days := func(fn func(year, month, day int)) {
+		forEachDay(*startYear, *endYear, dates, fn)
+	}
+	if *checkSpace {
+		if err := preflight(days); err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitFailed
 		}
 	}
+	handleSignals()
+	started := time.Now()
+	if notify {
+		notifier.start()
+	}
+	crawlPages(days)
+	code, reason := crawlOutcome(threshold)
+	if *reportPath == "" {
+		*reportPath = filepath.Join(downloadDir, runReportFile)
+	}
+	if err := writeRunReport(*reportPath, started, code, reason); err != nil {
+		fmt.Println("❌ Error writing run report:", err)
+	} else {
+		fmt.Println("🧾 Run report written:", *reportPath)
+	}
+	if notify {
+		notifier.finished(code, reason, time.Since(started))
+	}
+	if mail {
+		report.send(code, reason, time.Since(started))
+	}
+	return code
+}
+
+// crawlOutcome prints how the crawl ended and returns its exit code with
+// the line explaining it
+func crawlOutcome(threshold failureThreshold) (int, string) {
+	if accessDenied.Load() {
+		fmt.Println(stats.summary())
+		reason := "❌ Stopped: the archive denied access; see the message above"
+		fmt.Println(reason)
+		return exitFailed, reason
+	}
+	if stopped() {
+		reason := "🛑 Stopped: manifests list the files downloaded so far; run again to resume"
+		fmt.Println(reason)
+		return exitAborted, reason
+	}
+	fmt.Println(stats.summary())
+	if limit, failed := threshold.limit(stats.attempts()), stats.failures(); failed > limit {
+		reason := fmt.Sprintf("❌ %d failures, more than the %d allowed by -max-failures", failed, limit)
+		fmt.Println(reason)
+		return exitFailed, reason
+	}
+	if failed := stats.failures(); failed > 0 {
+		reason := fmt.Sprintf("⚠️  Completed with %d failures, within -max-failures", failed)
+		fmt.Println(reason)
+		return exitPartial, reason
+	}
+	reason := "✅ Process completed!"
+	fmt.Println(reason)
+	return exitOK, reason
+}
+
+// configureHTTPClient creates the global HTTP client, routed through the
+// proxies and verifying certificates as the proxy and TLS flags ask.
+// Listings and downloads share one transport so connections to the
+// archive are kept alive and reused.
+func configureHTTPClient() error {
+	if err := checkTimeouts(); err != nil {
+		return err
+	}
+	tlsClientConfig, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	// Connect over the -ipv4/-ipv6 family and from the -bind address
+	dialer, err := newDialer()
+	if err != nil {
+		return err
+	}
+	// Resolve host names with -dns-server or -doh if given; the resolver
+	// dials with a copy of the dialer that uses the system resolver
+	dialer.Resolver, err = dnsResolver(*dialer, tlsClientConfig)
+	if err != nil {
+		return err
+	}
+	// Configure proxies if provided; SOCKS proxies replace the dialer
+	proxyFunc, dial, err := proxySettings(dialer)
+	if err != nil {
+		return err
+	}
 
-	// Wait for all goroutines to finish
-	wg.Wait()
-	fmt.Println("✅ Process completed!")
+	httpTransport = &http.Transport{
+		Proxy:           proxyFunc,
+		DialContext:     dial,
+		TLSClientConfig: tlsClientConfig,
+		// A custom TLS config disables HTTP/2 unless it is asked for
+		ForceAttemptHTTP2: true,
+		// Every worker talks to the same host; keep a connection per worker
+		MaxIdleConns:          4 * workerLimit,
+		MaxIdleConnsPerHost:   2 * workerLimit,
+		IdleConnTimeout:       idleTimeout,
+		TLSHandshakeTimeout:   tlsTimeout,
+		ExpectContinueTimeout: time.Second,
+		// Listing pages are requested with gzip and decoded transparently
+		DisableCompression: false,
+	}
+	// With a proxy pool, each request goes through the next healthy proxy;
+	// over Tor, each request in flight through a circuit of its own
+	var next http.RoundTripper = httpTransport
+	if proxies != nil {
+		next = &poolTransport{next: httpTransport, pool: proxies}
+	} else if torMode {
+		next = newTorTransport(httpTransport, workerLimit+listingWorkers)
+	}
+	// Every request to the archive carries the agreement cookie
+	archive := &agreementTransport{next: next, host: archiveHost()}
+
+	// Back off when the server pushes back, and pace the requests to each
+	// host if asked, across listings and downloads
+	limiter := newAdaptiveLimiter(workerLimit + listingWorkers)
+	pacer := newHostPacer(requestDelay, requestJitter)
+	if pacer != nil {
+		fmt.Printf("🕰️  Pacing requests to each host: %s apart, plus up to %s of jitter\n", requestDelay, requestJitter)
+	}
+	// Listing pages must answer quickly; downloads have no deadline and are
+	// aborted by the stall check when they stop making progress
+	// Redirects are only followed within the archive
+	httpClient = &http.Client{
+		Transport: &adaptiveTransport{
+			next:    &headerTimeoutTransport{next: archive, timeout: listingTimeout},
+			limiter: limiter,
+			pacer:   pacer,
+		},
+		CheckRedirect: checkRedirect,
+	}
+	downloadClient = &http.Client{
+		Transport:     &adaptiveTransport{next: archive, limiter: limiter, pacer: pacer},
+		CheckRedirect: checkRedirect,
+	}
+	return nil
 }
 
 // showUsage displays the help menu
 func showUsage() {
-	fmt.Println(`
+	fmt.Print(`
 Usage:
   programa [options]
+  programa verify [--redownload [--proxy=URL] [--ca-cert=FILE] [--ca-dir=DIR] [--insecure] [--delay=D [--jitter=D]]] [--signatures] [--keyring=FILE] [path]
+  programa check [--dataset=LIST] [--proxy=URL] [--ca-cert=FILE] [--ca-dir=DIR] [--insecure] [--delay=D [--jitter=D]] [path]
+  programa check --date=DAY [--dataset=LIST] [--proxy=URL] [--ca-cert=FILE] [--ca-dir=DIR] [--insecure]
+  programa sign --key=ID [path]
+  programa repair [--start-year=N] [--end-year=N] [--dates-file=FILE] [--fetch] [--listing-cache=D] [--proxy=URL] [--ca-cert=FILE] [--ca-dir=DIR] [--insecure] [--delay=D [--jitter=D]] [path]
+  programa grep [--suffix] [--json] [--geoip=FILE] [--dataset=LIST] [--from=DATE] [--to=DATE] [--dir=PATH] <domain>
+  programa subdomains [--json] [--dataset=LIST] [--from=DATE] [--to=DATE] [--dir=PATH] <apex>
+  programa diff --dataset=NAME --from=DATE --to=DATE [--json] [--dir=PATH]
+  programa history [--types=LIST] [--dataset=LIST] [--from=DATE] [--to=DATE] [--dir=PATH] <domain>
+  programa providers [--by=ns|provider] [--top=N] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa ip-index [--index=FILE] [--rebuild] [--dataset=LIST] [--from=DATE] [--to=DATE] [--dir=PATH]
+  programa lookup-ip [--index=FILE] [--json] [--dir=PATH] <ip|cidr>...
+  programa hosting [--fingerprints=FILE] [--per-domain] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa top [--by=mx|mx-host|ns|ns-set|ip|cname] [--top=N] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa dnssec [--by=tld|dataset] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa email-security [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa caa [--top=N] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa wildcards [--min-names=N] [--min-share=F] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa nod [--store=FILE] [--feed-dir=PATH] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa takeover [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa asn [--asn-table=FILE [--as-names=FILE] | --cymru] [--top=N] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa homographs [--brands=FILE] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa ranks [--lists=PATH] [--wide] [--format=csv|text|json] [--dataset=LIST] [--from=DATE] [--to=DATE] <domain>...
+  programa bloom build [--output=FILE] [--fp-rate=F] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa bloom check [--filter=FILE] [name...]
+  programa index build [--index=FILE] [--rebuild] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa index query [--index=FILE] [--suffix] [--type=TYPE] [--json] <name|ip|cidr>...
+  programa serve-query [--addr=ADDR] [--index=FILE] [--auth=USER:PASSWORD] [--dir=PATH]
+  programa freshness [--addr=ADDR] [--interval=D] [--lookback=N] [--dataset=LIST] [--dir=PATH]
+  programa serve-files [--addr=ADDR] [--auth=USER:PASSWORD] [--dir=PATH]
+  programa coverage [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa ttl [--types=LIST] [--histogram] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa psl [--refresh] [--dir=PATH] [host...]
+  programa timeseries [--providers=LIST] [--format=csv|text|json|parquet] [--output=FILE] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa anomalies [--max-ns-churn=PCT] [--max-provider-shift=PP] [--max-record-churn=F] [--min-records=N] [--format=text|csv|json] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa load-postgres --dsn=URL [--table=NAME] [--reload] [--columns=LIST] [--types=LIST] [--domains=FILE [--suffix]] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa export-sqlite --output=FILE [--table=NAME] [--reload] [--columns=LIST] [--types=LIST] [--domains=FILE [--suffix]] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa index-elastic [--url=URL] [--user=USER:PASSWORD | --api-key=KEY] [--index-prefix=NAME] [--ilm-policy=NAME] [--batch=N] [--columns=LIST] [--types=LIST] [--domains=FILE [--suffix]] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa publish-nats --nats-url=URL [--nats-prefix=NAME] [--nats-stream=NAME] [--nats-creds=FILE] [--max-pending=N] [--columns=LIST] [--types=LIST] [--domains=FILE [--suffix]] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa forward-splunk --hec-url=URL --token=TOKEN [--index=NAME] [--sourcetype=NAME] [--batch=N] [--insecure] [--columns=LIST] [--types=LIST] [--domains=FILE [--suffix]] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa export-redis --redis-url=URL [--mode=domains|ips] [--prefix=NAME] [--ttl=DURATION] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa build-db [--output=FILE] [--table=NAME] [--duckdb=PATH] [--print-sql] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa export-iceberg --output=DIR [--location=URI] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa export-delta --output=DIR [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa export-neo4j --output=DIR | --bolt-url=URL [--user=USER] [--password=PASSWORD] [--database=NAME] [--batch=N] [--dataset=LIST] [--from=DATE] [--to=DATE]
+  programa misp [--output=DIR] [--nod-dir=PATH] [--takeover=FILE] [--org=NAME] [--org-uuid=UUID] [--tags=LIST] [--threat-level=N]
+  programa stix [--output=FILE] [--nod-dir=PATH] [--takeover=FILE] [--identity=NAME] [--tlp=white|green|amber|red] [--resolve] [--serve=ADDR [--auth=USER:PASSWORD]]
+  programa bench [--days=N] [--files=N] [--size=SIZE] [--latency=D] [--workers=N] [--list-workers=N] [--parse-workers=N] [--pprof-addr=ADDR] [--keep] [--verbose]
+  programa serve [--addr=ADDR] [--dir=PATH] [--auth=USER:PASSWORD] [--max-jobs=N] [--grpc-addr=ADDR] [--webhook=URLS [--webhook-secret=KEY] [--webhook-days]] [--pagerduty-key=KEY] [--opsgenie-key=KEY [--opsgenie-url=URL]] [--page-after=N] [-- crawler options]
+  programa enqueue --queue=URL [--queue-name=NAME] [--queue-creds=FILE] [--dataset=LIST] --from=DATE [--to=DATE]
+  programa work --queue=URL [--queue-name=NAME] [--queue-creds=FILE] [--concurrency=N] [--attempts=N] [--drain] [--pagerduty-key=KEY] [--opsgenie-key=KEY [--opsgenie-url=URL]] [--page-after=N] [-- crawler options]
 
 Options:
   --start-year=N    Define the start year (minimum 2016)
   --end-year=N      Define the end year (maximum 2025)
-  --proxy=URL       Use an HTTP proxy (optional)
+  --proxy=URL       Use an HTTP(S) or SOCKS5 proxy, e.g. socks5h://127.0.0.1:1080 (optional)
+  --http-proxy=URL  Use this proxy for http:// requests only (optional)
+  --https-proxy=URL Use this proxy for https:// requests only (optional)
+  --no-proxy=LIST   Reach these hosts, domains and CIDRs directly (default $NO_PROXY)
+  --proxy-auth=U:P  Credentials of proxy URLs without any (default $PROXY_AUTH)
+  --tor             Route every request through Tor, one circuit per worker
+  --tor-addr=ADDR   SOCKS address of the Tor client (default 127.0.0.1:9050)
+  --proxy-list=FILE Rotate requests across the proxies in FILE, one URL per line
+  --dns-server=ADDR Resolve host names with this DNS server instead of the system one
+  --doh=URL         Resolve host names over HTTPS, e.g. https://1.1.1.1/dns-query
+  --ipv4, --ipv6    Connect over IPv4 or IPv6 only
+  --bind=ADDR       Send from this local address or interface, e.g. eth1
+  --ca-cert=FILE    Also trust the CA certificates in FILE, e.g. of a corporate proxy
+  --ca-dir=DIR      Also trust the CA certificates of the PEM files in DIR
+  --client-cert=PEM Present this client certificate to servers requiring mutual TLS
+  --client-key=PEM  Private key of --client-cert, if not in the same file
+  --insecure        Skip TLS certificate verification (not recommended)
+  --dataset=LIST    Download only these comma-separated datasets (default all)
+  --include=GLOBS   Download only the files named like these comma-separated globs, or re:REGEXP
+  --exclude=GLOBS   Skip the files named like these comma-separated globs, or re:REGEXP
+  --dir=PATH        Local archive directory (default parquet_files)
+  --dates-file=FILE Download only the dates listed in FILE (YYYY-MM-DD, one per line)
+  --sign-key=ID     Sign manifests with this GPG key (optional)
+  --listing-cache=D Reuse listing pages fetched within duration D, e.g. 24h (optional)
+  --workers=N       Download N files concurrently (default 10)
+  --list-workers=N  Fetch N listing pages concurrently (default 4)
+  --ordered         Crawl in chronological order, one page and one file at a time
+  --delay=D         Wait at least D between two requests to the same host (optional)
+  --jitter=D        Add a random wait of up to D to every delay (optional)
+  --sync            Revalidate listings and downloaded files with conditional requests
+  --probe           Skip complete days and probe listings with HEAD before fetching them
+  --min-free=SIZE   Pause downloads while less than SIZE is free on disk (default 1GiB)
+  --preflight       Stop before downloading if the files of the run do not fit on disk
+  --min-speed=SIZE  Abort and retry downloads slower than SIZE per second (default 1KiB)
+  --stall-time=D    Time a download may stay below --min-speed (default 30s)
+  --list-timeout=D  Time listing pages may take to answer (default 15s)
+  --dial-timeout=D  Time connecting to a server or proxy may take (default 30s)
+  --tls-timeout=D   Time a TLS handshake may take (default 10s)
+  --idle-timeout=D  Time unused connections are kept for reuse (default 90s)
+  --max-failures=N  Exit with code 1 when more than N (or N%) listings and files fail (default 0)
+  --lock=SPEC       Lock every dataset/day while crawling it, via redis://… or file (optional)
+  --pprof-addr=ADDR Serve runtime profiles on ADDR, e.g. 127.0.0.1:6060 (optional)
+  --nats-url=URL    Publish an event to NATS JetStream for every completed dataset/day (optional)
+  --notify=URLS     Post the outcome to these Slack, Discord or Teams webhooks (optional)
+  --notify-on=WHEN  Notify at the end always, or on failure only (default always)
+  --notify-above=N  Also notify while crawling once more than N (or N%) fail (optional)
+  --email-to=LIST   Mail a report with the failures attached to these addresses (optional)
+  --email-from=ADDR Sender of the reports (default gopenintel@<host>)
+  --email-on=WHEN   Mail the report always, or on failure only (default always)
+  --smtp=URL        SMTP relay of the reports, smtp:// or smtps:// (default $SMTP_URL)
+  --failure-hook=URL Post an event to these URLs for every page or file that fails (optional)
+  --failure-secret=K Sign the failure events with HMAC-SHA256 and secret K (optional)
+  --run-report=FILE Write the JSON report of the run to FILE (default <dir>/run-report.json)
   --help            Show this help menu
 
+Commands:
+  verify            Re-hash local files against their manifests
+  check             Compare local files with upstream, or tell whether a day is published
+  sign              Sign existing manifests with a GPG key
+  repair            Validate an existing archive, rebuild its manifests and list missing files
+  grep              Search the local archive for the records of a domain
+  subdomains        List the observed subdomains of an apex with first/last-seen dates
+  diff              Compare the records of a dataset between two days
+  history           Reconstruct the record history of a domain as a JSON timeline
+  providers         Report DNS provider (or name server) market share per day and dataset
+  ip-index          Build a persistent IP-to-domain reverse index
+  lookup-ip         Query the reverse index for addresses or prefixes
+  hosting           Attribute domains to CDN and cloud providers per day and dataset
+  top               Report the most common MX providers, NS sets, shared IPs or CNAME targets
+  dnssec            Report DNSSEC deployment rates per TLD or toplist over time
+  email-security    Extract SPF, DMARC and DKIM posture per domain and day
+  caa               Report the certificate authorities domains authorize through CAA
+  wildcards         Flag domains whose subdomain responses indicate wildcard DNS
+  nod               Emit the daily feed of newly observed domains
+  takeover          List dangling CNAMEs that are subdomain-takeover candidates
+  asn               Report the origin networks hosting the domains per day and dataset
+  homographs        Flag punycode names and lookalikes of a brand list
+  ranks             Track the toplist rank of domains over time and across datasets
+  bloom             Export a bloom filter of the observed names, or check names against one
+  index             Build a passive-DNS index of the archive and query names and addresses
+  serve-query       Answer lookups from the passive-DNS index over REST and GraphQL
+  freshness         Export how many days the archive lags behind upstream as Prometheus metrics
+  serve-files       Serve the archive over HTTP with partition listings and range requests
+  coverage          Compare the overlap and unique coverage of the toplists per day
+  ttl               Report TTL percentiles or histograms per record type, day and dataset
+  psl               Refresh the public suffix list or show the registrable domain of hosts
+  timeseries        Export per-day metrics (counts, DNSSEC rate, provider shares) as CSV or Parquet
+  anomalies         Flag days where domains or whole datasets change abnormally
+  load-postgres     Bulk-load records into PostgreSQL with COPY, one transaction per day
+  export-sqlite     Export a filtered slice of records into a single indexed SQLite file
+  index-elastic     Bulk-index records into daily Elasticsearch/OpenSearch indices
+  publish-nats      Publish records as JSON messages to NATS JetStream subjects
+  forward-splunk    Forward records, e.g. of a domain watchlist, to a Splunk HTTP Event Collector
+  export-redis      Load the domains (or domain addresses) of each day into Redis sets or hashes
+  build-db          Ingest a date range into a single DuckDB file with a view per dataset
+  export-iceberg    Write the archive as an Iceberg table partitioned by dataset and date
+  export-delta      Write the archive as a Delta Lake table, one transaction per dataset/day
+  export-neo4j      Export the domain, address, name server and CNAME graph to Neo4j
+  misp              Publish NOD feeds and takeover candidates as a MISP feed directory
+  stix              Export NOD feeds and takeover candidates as a STIX 2.1 bundle or TAXII collection
+  bench             Crawl and scan a synthetic archive served locally and report the throughput
+  serve             Run download jobs submitted over a REST or gRPC API, with a web dashboard
+  enqueue           Queue dataset/day work items on Redis or NATS for work instances
+  work              Claim work items from a queue and download them
+
+Exit codes:
+  0                 Every listing and file was processed
+  1                 More failures than --max-failures, or the run could not start
+  2                 Invalid options
+  3                 Completed, with failures within --max-failures
+  130               Stopped by SIGINT or SIGTERM
+
 Example:
   programa --start-year=2020 --end-year=2022 --proxy=http://127.0.0.1:8080
+  programa --dates-file=quarters.txt
+  programa verify --redownload parquet_files
 `)
 }
 
-// processPage fetches the webpage and extracts .parquet file links
-func processPage(url string) {
-	fmt.Println("🌐 Checking:", url)
+// listing identifies the listing page of one dataset on one day
+type listing struct {
+	Dataset          string
+	Year, Month, Day int
+}
+
+// URL returns the address of the listing page
+func (l listing) URL() string {
+	return fmt.Sprintf(baseURL, l.Dataset, l.Year, l.Month, l.Day)
+}
 
-	// Create request with required cookie
-	req, err := http.NewRequest("GET", url, nil)
+// Date returns the listing day formatted as YYYY-MM-DD
+func (l listing) Date() string {
+	return fmt.Sprintf("%04d-%02d-%02d", l.Year, l.Month, l.Day)
+}
+
+// listingExists asks for the headers of a listing page so that days without
+// data are skipped without downloading and parsing their HTML; servers that
+// do not answer HEAD get the benefit of the doubt
+func listingExists(url string) bool {
+	req, err := http.NewRequestWithContext(aborting, "HEAD", url, nil)
 	if err != nil {
-		fmt.Println("❌ Error creating request:", url)
-		return
+		return true
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return true
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		fmt.Println("⏭️  No data:", url)
+		return false
+	}
+	return true
+}
+
+// fetchListing fetches a listing page and extracts its .parquet file links.
+// Days without data are not failures, rate limiting and server errors are
+// retried, and a rejected agreement cookie stops the crawl.
+func fetchListing(url string) ([]string, bool) {
+	cached, fresh := listingCache.lookup(url)
+	if fresh {
+		fmt.Println("💾 Cached listing:", url)
+		return cached.Links, true
+	}
+
+	rateLimits := 0
+	for attempt := 1; ; attempt++ {
+		fmt.Println("🌐 Checking:", url)
+		links, err := getListing(url, cached)
+		switch {
+		case err == nil:
+			return links, true
+		case errors.Is(err, errNotFound):
+			// Days without data are expected, not failures
+			fmt.Println("⏭️  No data:", url)
+			return nil, true
+		case errors.Is(err, errForbidden):
+			denyAccess(url)
+			recordFailure("listing", url, attempt, err)
+			return nil, false
+		case errors.Is(err, errRateLimited) && rateLimits < maxRateLimitWaits:
+			// Rate limiting says nothing about the page; it does not use up
+			// an attempt
+			rateLimits++
+			attempt--
+			fmt.Printf("⏸️  Rate limited, retrying listing in %s: %s\n", retryDelay(rateLimits, err), url)
+			if !waitRetry(rateLimits, err) {
+				return nil, false
+			}
+		case retryable(err) && attempt < maxListingAttempts:
+			fmt.Printf("🔁 Retrying listing (%d/%d) after %v: %s\n", attempt+1, maxListingAttempts, err, url)
+			if !waitRetry(attempt, err) {
+				return nil, false
+			}
+		default:
+			fmt.Printf("❌ Error accessing %s: %v\n", url, err)
+			recordFailure("listing", url, attempt, err)
+			return nil, false
+		}
+	}
+}
+
+// getListing requests a listing page once and parses its links, revalidating
+// the cached copy when there is one
+func getListing(url string, cached *cachedListing) ([]string, error) {
+	// The agreement cookie is added by the transport
+	req, err := http.NewRequestWithContext(aborting, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if cached != nil {
+		setValidators(req, cached.ETag, cached.LastModified)
 	}
-	req.Header.Set("Cookie", "openintel-data-agreement-accepted=true")
 
 	// Execute HTTP request
 	resp, err := httpClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		fmt.Println("❌ Error accessing:", url)
-		return
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		fmt.Println("💾 Listing not modified:", url)
+		listingCache.put(url, *cached)
+		return cached.Links, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
 
 	// Parse HTML with goquery
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		fmt.Println("❌ Error processing HTML:", url)
-		return
+		return nil, fmt.Errorf("processing HTML: %w", err)
 	}
 
-	// Find links inside "flex-container" class
-	doc.Find("a.flex-container").Each(func(i int, s *goquery.Selection) {
-		link, exists := s.Attr("href")
-		if exists {
-			downloadFile(link)
-		}
-	})
+	// Relative links are relative to where the page was served from
+	links := archiveLinks(resp.Request.URL, findLinks(doc, url))
+	if len(links) == 0 {
+		// A day without data is a 404; an empty page means the layout changed
+		stats.emptyPages.Add(1)
+		fmt.Println("🚨 No files found on a listing page that loaded fine (has the page layout changed?):", url)
+	}
+	listingCache.put(url, cachedListing{Links: links, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")})
+	return links, nil
 }
 
-// downloadFile downloads a file
-func downloadFile(fileURL string) {
-	fileName := filepath.Join(downloadDir, filepath.Base(fileURL))
+// setValidators makes a request conditional on the validators of a previous
+// response, so an unchanged resource costs a 304 instead of a transfer
+func setValidators(req *http.Request, etag, lastModified string) {
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
 
-	// Check if the file already exists
-	if _, err := os.Stat(fileName); err == nil {
+// downloadFile downloads a file to fileName and returns its manifest entry.
+// Files that fail validation are quarantined and downloaded again.
+func downloadFile(fileURL, fileName string, previous map[string]manifestEntry) (manifestEntry, bool) {
+	// Check if the file already exists; in sync mode known files are
+	// fetched again only if the server reports a change
+	var known *manifestEntry
+	entry, recorded := previousEntry(previous, fileURL, fileName)
+	if info, err := os.Stat(fileName); err == nil {
 		fmt.Println("✅ File already downloaded:", fileName)
-		return
+		if recorded && entry.Size == info.Size() {
+			if !syncMode || entry.ETag == "" && entry.LastModified == "" {
+				return entry, true
+			}
+			known = &entry
+		} else if err := validateFile(fileName, -1); err != nil {
+			// Files unknown to the manifest may come from an interrupted run
+			quarantine(fileName, fileURL, err)
+		} else {
+			entry, err := hashFile(fileName, fileURL)
+			if err != nil {
+				fmt.Println("❌ Error hashing file:", fileName)
+				recordFailure("file", fileURL, 0, err)
+				return manifestEntry{}, false
+			}
+			return entry, true
+		}
 	}
 
+	rateLimits := 0
+	var lastErr error
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		if !disk.wait() {
+			return manifestEntry{}, false
+		}
+		entry, expectedSize, err := fetchFile(fileURL, fileName, known)
+		if errors.Is(err, errNotModified) {
+			fmt.Println("✅ Not modified:", fileName)
+			return *known, true
+		} else if errors.Is(err, errHTMLResponse) {
+			// Agreement or redirect pages are transient, never data
+			fmt.Printf("🚫 Rejected %s: %v\n", fileURL, err)
+		} else if errors.Is(err, errStalled) {
+			// A stalled connection is dropped along with its partial file
+			fmt.Printf("🐌 Aborted %s: %v\n", fileURL, err)
+			known = nil
+		} else if errors.Is(err, errNotFound) {
+			// Listed but gone; the day stays incomplete and is retried next run
+			fmt.Println("⏭️  Not found:", fileURL)
+			recordFailure("file", fileURL, attempt, err)
+			return manifestEntry{}, false
+		} else if errors.Is(err, errForbidden) {
+			denyAccess(fileURL)
+			recordFailure("file", fileURL, attempt, err)
+			return manifestEntry{}, false
+		} else if errors.Is(err, errRateLimited) && rateLimits < maxRateLimitWaits {
+			// As for listings, rate limiting does not use up an attempt
+			rateLimits++
+			attempt--
+			fmt.Printf("⏸️  Rate limited, retrying download in %s: %s\n", retryDelay(rateLimits, err), fileURL)
+			if !waitRetry(rateLimits, err) {
+				return manifestEntry{}, false
+			}
+			continue
+		} else if retryable(err) || transientNetworkError(err) {
+			fmt.Println("⏳", err)
+			if attempt < maxDownloadAttempts && !waitRetry(attempt, err) {
+				return manifestEntry{}, false
+			}
+		} else if err != nil {
+			fmt.Println("❌ Error", err)
+			recordFailure("file", fileURL, attempt, err)
+			return manifestEntry{}, false
+		} else if err = validateFile(fileName+".tmp", expectedSize); err == nil {
+			// Never mark a file as downloaded, or replace the copy we
+			// have, before it passes validation
+			if err := os.Rename(fileName+".tmp", fileName); err != nil {
+				os.Remove(fileName + ".tmp")
+				fmt.Println("❌ Error saving file:", err)
+				recordFailure("file", fileURL, attempt, err)
+				return manifestEntry{}, false
+			}
+			fmt.Println("✅ Download completed:", fileName)
+			return entry, true
+		} else {
+			quarantine(fileName+".tmp", fileURL, err)
+			known = nil
+			err = fmt.Errorf("%w: %w", errInvalidFile, err)
+		}
+		lastErr = err
+
+		if stopped() {
+			return manifestEntry{}, false
+		}
+		if attempt < maxDownloadAttempts {
+			fmt.Printf("🔁 Retrying download (%d/%d): %s\n", attempt+1, maxDownloadAttempts, fileURL)
+		}
+	}
+
+	fmt.Println("❌ Giving up on invalid file:", fileURL)
+	recordFailure("file", fileURL, maxDownloadAttempts, lastErr)
+	return manifestEntry{}, false
+}
+
+// fetchFile saves a remote file to fileName.tmp, for downloadFile to move
+// into place once it is valid, and returns its manifest entry along
+// with the size announced by the server (-1 when unknown). Unsuccessful
+// statuses are classified by statusError and HTML responses rejected with
+// errHTMLResponse before anything is written. With a known
+// entry the request is conditional on its validators, and errNotModified
+// reports that the local copy is current.
+func fetchFile(fileURL, fileName string, known *manifestEntry) (manifestEntry, int64, error) {
 	fmt.Println("⬇️  Downloading:", fileURL)
 
-	// Execute file download
-	resp, err := http.Get(fileURL)
+	// Execute file download, conditional on the copy we already have
+	fetchedAt := time.Now().UTC()
+	ctx, cancel := context.WithCancel(aborting)
+	defer cancel()
+
+	// Abort the transfer, waiting for the headers included, if it stalls
+	watch, ctx := watchStalls(ctx, cancel)
+	defer watch.done()
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
 	if err != nil {
-		fmt.Println("❌ Error downloading:", fileURL)
-		return
+		return manifestEntry{}, 0, fmt.Errorf("downloading %s: %w", fileURL, err)
+	}
+	if known != nil {
+		setValidators(req, known.ETag, known.LastModified)
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return manifestEntry{}, 0, fmt.Errorf("downloading %s: %w", fileURL, watch.check(err))
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && known != nil {
+		return manifestEntry{}, 0, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return manifestEntry{}, 0, fmt.Errorf("downloading %s: %w", fileURL, statusError(resp))
+	}
+	watch.body = resp.Body
+
+	// Look at the first bytes before touching the disk
+	body := bufio.NewReader(watch)
+	head, _ := body.Peek(512)
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "text/html") {
+		return manifestEntry{}, 0, fmt.Errorf("%w (Content-Type %s)", errHTMLResponse, contentType)
+	}
+	if looksLikeHTML(head) {
+		return manifestEntry{}, 0, fmt.Errorf("%w (body starts with markup)", errHTMLResponse)
+	}
 
-	// Save the file to disk
-	out, err := os.Create(fileName)
+	// Save the file to disk; its announced size counts against the free
+	// space seen by the other workers until it is written
+	defer disk.reserve(resp.ContentLength)()
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return manifestEntry{}, 0, fmt.Errorf("creating directory of %s: %w", fileName, err)
+	}
+	// The download goes to a temporary file beside the destination, so the
+	// copy a sync run already has stays intact until the new one is valid
+	tmp := fileName + ".tmp"
+	out, err := os.Create(tmp)
 	if err != nil {
-		fmt.Println("❌ Error creating file:", fileName)
-		return
+		return manifestEntry{}, 0, fmt.Errorf("creating file %s: %w", tmp, err)
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	// Hash the content while it is written
+	hash := sha256.New()
+	size, err := copyBuffered(io.MultiWriter(out, hash), body)
 	if err != nil {
-		fmt.Println("❌ Error saving file:", fileName)
-		return
+		// Never leave a partial file that a later run could take for a download
+		out.Close()
+		os.Remove(tmp)
+		return manifestEntry{}, 0, fmt.Errorf("saving file %s: %w", fileName, watch.check(err))
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return manifestEntry{}, 0, fmt.Errorf("saving file %s: %w", fileName, err)
 	}
 
-	fmt.Println("✅ Download completed:", fileName)
+	return manifestEntry{
+		Name:         entryName(fileName),
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		SourceURL:    fileURL,
+		FetchedAt:    fetchedAt,
+		LastModified: resp.Header.Get("Last-Modified"),
+		ETag:         resp.Header.Get("ETag"),
+	}, resp.ContentLength, nil
 }
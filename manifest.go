@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const manifestDir = "manifests"
+
+// manifest describes the files downloaded for one dataset on one day
+type manifest struct {
+	Dataset   string          `json:"dataset"`
+	Date      string          `json:"date"`
+	SourceURL string          `json:"source_url"`
+	Files     []manifestEntry `json:"files"`
+	// Incomplete is set when some files of the listing failed or the run was stopped
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Filter holds the -include and -exclude options that selected the files
+	Filter string `json:"filter,omitempty"`
+
+	path string // Location the manifest was read from
+}
+
+// manifestEntry describes a single downloaded file
+type manifestEntry struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	SourceURL    string    `json:"source_url"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	LastModified string    `json:"last_modified,omitempty"` // Remote Last-Modified header, when known
+	ETag         string    `json:"etag,omitempty"`          // Remote ETag header, when known
+}
+
+// checkManifest rejects a manifest of an unknown dataset or date, stored
+// under another dataset/day than its own, or with an entry
+// checkManifestEntry rejects
+func checkManifest(m *manifest) error {
+	if !slices.Contains(datasets, m.Dataset) {
+		return fmt.Errorf("unknown dataset %q", m.Dataset)
+	}
+	if _, err := time.Parse(dateLayout, m.Date); err != nil {
+		return fmt.Errorf("invalid date %q", m.Date)
+	}
+	if m.path != "" && filepath.Clean(m.path) != filepath.Clean(manifestPath(m.Dataset, m.Date)) {
+		return fmt.Errorf("manifest of %s %s is stored as %s", m.Dataset, m.Date, m.path)
+	}
+	for _, entry := range m.Files {
+		if err := checkManifestEntry(m, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkManifestEntry rejects an entry whose file is outside the directory
+// of its dataset/day, or the download directory itself for the flat layout
+// of earlier versions, or whose source is not a parquet file of the
+// archive, as the manifests of a mirror copied from elsewhere may hold
+// anything
+func checkManifestEntry(m *manifest, entry manifestEntry) error {
+	name := filepath.FromSlash(entry.Name)
+	if dir := filepath.Dir(name); !filepath.IsLocal(name) || (dir != "." && dir != filepath.Join(m.Dataset, m.Date)) {
+		return fmt.Errorf("file %q is outside %s/%s", entry.Name, m.Dataset, m.Date)
+	}
+	archive, err := url.Parse(listing{Dataset: m.Dataset}.URL())
+	if err != nil {
+		return err
+	}
+	if err := validateLink(entry.SourceURL, archive); err != nil {
+		return fmt.Errorf("source %q: %w", entry.SourceURL, err)
+	}
+	return nil
+}
+
+// manifestPath returns the location of the manifest for a dataset/day
+func manifestPath(dataset, date string) string {
+	return filepath.Join(downloadDir, manifestDir, dataset, date+".json")
+}
+
+// writeManifest stores the manifest atomically so readers never see a partial file
+func writeManifest(m *manifest) error {
+	path := manifestPath(m.Dataset, m.Date)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	m.path = path
+
+	// Sign the new content so mirrors can prove its integrity
+	if signKey != "" {
+		return signManifest(path)
+	}
+	return nil
+}
+
+// readManifest loads a manifest from disk
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	m.path = path
+	return &m, nil
+}
+
+// loadManifestEntries returns the entries of an existing manifest keyed by
+// their name, the path of the file relative to the download directory
+func loadManifestEntries(page listing) map[string]manifestEntry {
+	entries := make(map[string]manifestEntry)
+	m, err := readManifest(manifestPath(page.Dataset, page.Date()))
+	if err != nil {
+		return entries
+	}
+	for _, entry := range m.Files {
+		entries[entry.Name] = entry
+	}
+	return entries
+}
+
+// previousEntry returns the manifest entry of the file a download is saved
+// as. A file recorded at another path, such as the flat layout of earlier
+// versions, is first moved to fileName.
+func previousEntry(previous map[string]manifestEntry, fileURL, fileName string) (manifestEntry, bool) {
+	name := entryName(fileName)
+	if entry, ok := previous[name]; ok {
+		return entry, true
+	}
+	for _, entry := range previous {
+		if entry.SourceURL != fileURL {
+			continue
+		}
+		old := filepath.Join(downloadDir, filepath.FromSlash(entry.Name))
+		if _, err := os.Stat(fileName); err == nil {
+			return manifestEntry{}, false
+		}
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			return manifestEntry{}, false
+		}
+		if err := os.Rename(old, fileName); err != nil {
+			return manifestEntry{}, false
+		}
+		fmt.Printf("📦 Moved %s to %s\n", old, fileName)
+		entry.Name = name
+		return entry, true
+	}
+	return manifestEntry{}, false
+}
+
+// manifestComplete reports whether a dataset/day has a manifest that lists
+// every file of its listing, all on disk with their recorded size. A day
+// downloaded through -include or -exclude is complete for the same options
+// only, while a full one is complete for any.
+func manifestComplete(page listing) bool {
+	m, err := readManifest(manifestPath(page.Dataset, page.Date()))
+	if err != nil || len(m.Files) == 0 || m.Incomplete || (m.Filter != "" && m.Filter != filesFilter.describe()) {
+		return false
+	}
+	for _, entry := range m.Files {
+		if checkManifestEntry(m, entry) != nil {
+			return false
+		}
+		info, err := os.Stat(filepath.Join(downloadDir, entry.Name))
+		if err != nil || info.Size() != entry.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// hashFile builds a manifest entry for a file that is already on disk
+func hashFile(path, sourceURL string) (manifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	adviseSequential(f)
+	defer dropCache(f)
+
+	hash := sha256.New()
+	size, err := copyBuffered(hash, f)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	return manifestEntry{
+		Name:      entryName(path),
+		Size:      size,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		SourceURL: sourceURL,
+		FetchedAt: info.ModTime().UTC(),
+	}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSource = "https://openintel.nl/download/forward-dns/basis=toplist/source=tranco/year=2024/month=01/day=01/part-00000.gz.parquet"
+
+func TestCheckManifest(t *testing.T) {
+	valid := manifestEntry{Name: "tranco/2024-01-01/part-00000.gz.parquet", SourceURL: testSource}
+	tests := []struct {
+		name    string
+		m       manifest
+		wantErr string // empty when the manifest is safe
+	}{
+		{"valid", manifest{Dataset: "tranco", Date: "2024-01-01", Files: []manifestEntry{valid}}, ""},
+		{"flat layout", manifest{Dataset: "tranco", Date: "2024-01-01", Files: []manifestEntry{{Name: "part-00000.gz.parquet", SourceURL: testSource}}}, ""},
+		{"stored in place", manifest{Dataset: "tranco", Date: "2024-01-01", path: manifestPath("tranco", "2024-01-01")}, ""},
+		{"unknown dataset", manifest{Dataset: "../../x", Date: "2024-01-01"}, "unknown dataset"},
+		{"empty dataset", manifest{Date: "2024-01-01"}, "unknown dataset"},
+		{"date with a slash", manifest{Dataset: "tranco", Date: "2024/01/01"}, "invalid date"},
+		{"date with dots", manifest{Dataset: "tranco", Date: "../2024-01-01"}, "invalid date"},
+		{"short date", manifest{Dataset: "tranco", Date: "2024-1-1"}, "invalid date"},
+		{"stored under another day", manifest{Dataset: "tranco", Date: "2024-01-01", path: manifestPath("tranco", "2024-01-02")}, "is stored as"},
+		{"stored under another dataset", manifest{Dataset: "tranco", Date: "2024-01-01", path: manifestPath("alexa", "2024-01-01")}, "is stored as"},
+		{"unsafe entry", manifest{Dataset: "tranco", Date: "2024-01-01", Files: []manifestEntry{valid, {Name: "../x.parquet", SourceURL: testSource}}}, "outside"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkManifest(&tt.m)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("checkManifest() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkManifest() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckManifestEntry(t *testing.T) {
+	m := &manifest{Dataset: "tranco", Date: "2024-01-01"}
+	tests := []struct {
+		name, file, source string
+		wantErr            bool
+	}{
+		{"day directory", "tranco/2024-01-01/part-00000.gz.parquet", testSource, false},
+		{"flat layout", "part-00000.gz.parquet", testSource, false},
+		{"storage subdomain", "part-00000.gz.parquet", "https://data.openintel.nl/part-00000.gz.parquet", false},
+		{"parent directory", "../part-00000.gz.parquet", testSource, true},
+		{"escapes the day", "tranco/2024-01-01/../../../etc/passwd", testSource, true},
+		{"absolute path", "/etc/cron.d/x.parquet", testSource, true},
+		{"another day", "tranco/2024-01-02/part-00000.gz.parquet", testSource, true},
+		{"another dataset", "alexa/2024-01-01/part-00000.gz.parquet", testSource, true},
+		{"nested below the day", "tranco/2024-01-01/sub/part-00000.gz.parquet", testSource, true},
+		{"empty name", "", testSource, true},
+		{"another host", "part-00000.gz.parquet", "https://attacker.example/part-00000.gz.parquet", true},
+		{"not parquet", "part-00000.gz.parquet", "https://openintel.nl/download/index.html", true},
+		{"file scheme", "part-00000.gz.parquet", "file:///etc/passwd.parquet", true},
+		{"relative source", "part-00000.gz.parquet", "part-00000.gz.parquet", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkManifestEntry(m, manifestEntry{Name: tt.file, SourceURL: tt.source})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkManifestEntry(%q, %q) = %v, want error %v", tt.file, tt.source, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+var (
+	scanReadBuffer = 64 << 10 // Bytes buffered per column chunk when reading parquet pages
+	scanBatchRows  = 256      // Rows decoded per batch of a row group
+)
+
+// sizeUnits maps the suffixes accepted by parseSize to their multiplier
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseSize parses a byte count such as 512MiB, 2G or 1500000
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	scale := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, scale = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MiB or 2GiB)", s)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// formatSize renders a byte count with a binary unit
+func formatSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, unit := float64(n)/(1<<10), 0
+	for value >= 1<<10 && unit < len(units)-1 {
+		value /= 1 << 10
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, units[unit])
+}
+
+// applyMemoryLimit makes the garbage collector keep the heap under limit and
+// sizes the parquet read buffers and row batches from it. Row groups are
+// always decoded page by page, so the budget bounds the working set of a
+// scan whatever the size of the files.
+func applyMemoryLimit(limit int64) {
+	debug.SetMemoryLimit(limit)
+
+	// A scan reads up to len(recordColumns) column chunks at once; give them
+	// a small fraction of the budget and leave the rest to the analysis
+	perColumn := limit / 64 / int64(len(recordColumns))
+	scanReadBuffer = int(min(max(perColumn, 4<<10), 1<<20))
+	scanBatchRows = int(min(max(limit/(1<<20), 16), 1024))
+}
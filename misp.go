@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mispTag is a tag attached to feed events
+type mispTag struct {
+	Name   string `json:"name"`
+	Colour string `json:"colour"`
+}
+
+// mispOrg identifies the organisation publishing the feed
+type mispOrg struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+// mispAttribute is an indicator of a feed event
+type mispAttribute struct {
+	UUID         string `json:"uuid"`
+	Type         string `json:"type"`
+	Category     string `json:"category"`
+	ToIDS        bool   `json:"to_ids"`
+	Value        string `json:"value"`
+	Comment      string `json:"comment"`
+	Timestamp    string `json:"timestamp"`
+	Distribution string `json:"distribution"`
+}
+
+// mispEvent is the content of an event file of the feed
+type mispEvent struct {
+	UUID             string          `json:"uuid"`
+	Info             string          `json:"info"`
+	Date             string          `json:"date"`
+	ThreatLevelID    string          `json:"threat_level_id"`
+	Analysis         string          `json:"analysis"`
+	Timestamp        string          `json:"timestamp"`
+	Published        bool            `json:"published"`
+	PublishTimestamp string          `json:"publish_timestamp"`
+	Orgc             mispOrg         `json:"Orgc"`
+	Tag              []mispTag       `json:"Tag"`
+	Attribute        []mispAttribute `json:"Attribute"`
+}
+
+// mispManifestEntry describes an event in manifest.json
+type mispManifestEntry struct {
+	Info          string    `json:"info"`
+	Date          string    `json:"date"`
+	ThreatLevelID string    `json:"threat_level_id"`
+	Analysis      string    `json:"analysis"`
+	Timestamp     string    `json:"timestamp"`
+	Orgc          mispOrg   `json:"Orgc"`
+	Tag           []mispTag `json:"Tag"`
+}
+
+// runMISP writes the NOD feeds and a takeover report as a MISP feed
+// directory: one event file per analysis and day, manifest.json and
+// hashes.csv, ready to be served over HTTP and added to MISP as a feed
+func runMISP(args []string) int {
+	flags := flag.NewFlagSet("misp", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	output := flags.String("output", "misp-feed", "Feed directory to write")
+	nodDirFlag := flags.String("nod-dir", "", "Directory of NOD feeds to include (default <dir>/"+nodDir+" unless --takeover is set)")
+	takeover := flags.String("takeover", "", "Report of the takeover command (--format csv or json) to include")
+	org := flags.String("org", "gopenintel", "Name of the organisation publishing the feed")
+	orgUUID := flags.String("org-uuid", "", "UUID of the organisation (default derived from --org)")
+	tags := flags.String("tags", "tlp:white", "Comma-separated tags attached to every event")
+	threatLevel := flags.Int("threat-level", 4, "MISP threat level of the events (1 high, 2 medium, 3 low, 4 undefined)")
+	flags.Parse(args)
+
+	if *threatLevel < 1 || *threatLevel > 4 {
+		fmt.Println("❌ Error: --threat-level must be between 1 and 4")
+		return exitUsage
+	}
+	if *nodDirFlag == "" && *takeover == "" {
+		*nodDirFlag = filepath.Join(downloadDir, nodDir)
+	}
+	if *orgUUID == "" {
+		*orgUUID = nameUUID(indicatorNamespace, "org:"+*org)
+	}
+
+	sets, err := loadIndicators(*nodDirFlag, *takeover)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+	if len(sets) == 0 {
+		fmt.Println("❌ Error: no indicators found")
+		return exitFailed
+	}
+	if err := os.MkdirAll(*output, 0o755); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+
+	var eventTags []mispTag
+	for _, name := range strings.Split(*tags, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			eventTags = append(eventTags, mispTag{Name: name, Colour: "#ffffff"})
+		}
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	owner := mispOrg{Name: *org, UUID: *orgUUID}
+
+	manifest := make(map[string]mispManifestEntry)
+	var hashes strings.Builder
+	attributes := 0
+	for _, set := range sets {
+		event := mispEvent{
+			UUID:             nameUUID(indicatorNamespace, fmt.Sprintf("misp:%s:%s:%s", *org, set.Source, set.Date)),
+			Info:             set.Title,
+			Date:             set.Date,
+			ThreatLevelID:    strconv.Itoa(*threatLevel),
+			Analysis:         "2", // completed
+			Timestamp:        now,
+			Published:        true,
+			PublishTimestamp: now,
+			Orgc:             owner,
+			Tag:              eventTags,
+		}
+		for _, item := range set.Items {
+			event.Attribute = append(event.Attribute, mispAttribute{
+				UUID:         nameUUID(event.UUID, item.Kind+":"+item.Value+":"+item.Target),
+				Type:         item.Kind,
+				Category:     "Network activity",
+				Value:        item.Value,
+				Comment:      item.Comment,
+				Timestamp:    now,
+				Distribution: "5", // inherit the event's distribution
+			})
+			sum := md5.Sum([]byte(item.Value))
+			fmt.Fprintf(&hashes, "%s,%s\n", hex.EncodeToString(sum[:]), event.UUID)
+		}
+
+		data, err := json.MarshalIndent(map[string]mispEvent{"Event": event}, "", "  ")
+		if err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitFailed
+		}
+		if err := os.WriteFile(filepath.Join(*output, event.UUID+".json"), data, 0o644); err != nil {
+			fmt.Println("❌ Error writing event:", err)
+			return exitFailed
+		}
+		manifest[event.UUID] = mispManifestEntry{
+			Info:          event.Info,
+			Date:          event.Date,
+			ThreatLevelID: event.ThreatLevelID,
+			Analysis:      event.Analysis,
+			Timestamp:     now,
+			Orgc:          owner,
+			Tag:           eventTags,
+		}
+		attributes += len(event.Attribute)
+	}
+
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := os.WriteFile(filepath.Join(*output, "manifest.json"), data, 0o644); err != nil {
+		fmt.Println("❌ Error writing manifest:", err)
+		return exitFailed
+	}
+	if err := os.WriteFile(filepath.Join(*output, "hashes.csv"), []byte(hashes.String()), 0o644); err != nil {
+		fmt.Println("❌ Error writing hashes:", err)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Wrote %d events with %d attributes to %s\n", len(sets), attributes, *output)
+	return exitOK
+}
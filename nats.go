@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsSink publishes messages to JetStream subjects under a common prefix
+type natsSink struct {
+	URL    string
+	Prefix string
+	Stream string
+	Creds  string
+
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	pending []jetstream.PubAckFuture
+}
+
+// downloadEvents announces completed dataset/days when the crawler is
+// started with --nats-url; events are disabled when nil
+var downloadEvents *natsSink
+
+// downloadEvent is published to <prefix>.downloads.<dataset> once the
+// manifest of a dataset/day has been written
+type downloadEvent struct {
+	Dataset  string   `json:"dataset"`
+	Date     string   `json:"date"`
+	Files    []string `json:"files"`
+	Bytes    int64    `json:"bytes"`
+	Manifest string   `json:"manifest"`
+	// Incomplete is set when some files of the day failed
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// addNATSFlags registers the connection flags of a JetStream sink
+func addNATSFlags(flags *flag.FlagSet, s *natsSink) {
+	flags.StringVar(&s.URL, "nats-url", "", "NATS server URL")
+	flags.StringVar(&s.Prefix, "nats-prefix", "openintel", "Prefix of the subjects messages are published to")
+	flags.StringVar(&s.Stream, "nats-stream", "", "Create or update this stream to capture <prefix>.> (default use existing streams)")
+	flags.StringVar(&s.Creds, "nats-creds", "", "NATS credentials file (optional)")
+}
+
+// connect opens the connection and creates the stream when one is named
+func (s *natsSink) connect() error {
+	var options []nats.Option
+	if s.Creds != "" {
+		options = append(options, nats.UserCredentials(s.Creds))
+	}
+	conn, err := nats.Connect(s.URL, options...)
+	if err != nil {
+		return err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn, s.js = conn, js
+
+	if s.Stream == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     s.Stream,
+		Subjects: []string{s.Prefix + ".>"},
+	})
+	return err
+}
+
+// close flushes and closes the connection
+func (s *natsSink) close() {
+	if s.conn != nil {
+		s.conn.Drain()
+	}
+}
+
+// publishAsync queues a message; the content hash is used as message ID so
+// the stream drops messages republished within its duplicate window
+func (s *natsSink) publishAsync(subject string, data []byte) error {
+	sum := sha1.Sum(append([]byte(subject+"\x00"), data...))
+	future, err := s.js.PublishAsync(subject, data, jetstream.WithMsgID(hex.EncodeToString(sum[:])))
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, future)
+	return nil
+}
+
+// wait blocks until every queued message has been acknowledged and returns
+// the first publish error
+func (s *natsSink) wait() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	pending := s.pending
+	s.pending = nil
+	select {
+	case <-s.js.PublishAsyncComplete():
+	case <-time.After(time.Minute):
+		return fmt.Errorf("timed out waiting for %d acknowledgements", s.js.PublishAsyncPending())
+	}
+	for _, future := range pending {
+		select {
+		case err := <-future.Err():
+			return err
+		default:
+		}
+	}
+	return nil
+}
+
+// newDownloadEvent describes the dataset/day of a manifest
+func newDownloadEvent(m *manifest) downloadEvent {
+	event := downloadEvent{Dataset: m.Dataset, Date: m.Date, Manifest: m.path, Incomplete: m.Incomplete}
+	for _, entry := range m.Files {
+		event.Files = append(event.Files, entry.Name)
+		event.Bytes += entry.Size
+	}
+	return event
+}
+
+// publishDownload announces a completed dataset/day
+func publishDownload(m *manifest) {
+	data, _ := json.Marshal(newDownloadEvent(m))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := downloadEvents.js.Publish(ctx, downloadEvents.Prefix+".downloads."+m.Dataset, data); err != nil {
+		fmt.Println("❌ Error publishing download event:", err)
+	}
+}
+
+// runPublishNATS publishes the selected records as JSON messages on
+// <prefix>.records.<dataset>
+func runPublishNATS(args []string) int {
+	flags := flag.NewFlagSet("publish-nats", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	selection := addExportFlags(flags)
+	sink := &natsSink{}
+	addNATSFlags(flags, sink)
+	window := flags.Int("max-pending", 4096, "Messages awaiting acknowledgement before publishing pauses")
+	flags.Parse(args)
+
+	if sink.URL == "" {
+		sink.URL = os.Getenv("NATS_URL")
+	}
+	if sink.URL == "" {
+		fmt.Println("❌ Error: --nats-url or NATS_URL is required")
+		return exitUsage
+	}
+	if *window < 1 {
+		fmt.Println("❌ Error: --max-pending must be at least 1")
+		return exitUsage
+	}
+	if err := selection.prepare("dataset", "date"); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	if err := sink.connect(); err != nil {
+		fmt.Println("❌ Error connecting to NATS:", err)
+		return exitFailed
+	}
+	defer sink.close()
+
+	total := 0
+	for _, day := range groupByDay(files) {
+		subject := sink.Prefix + ".records." + day[0].Dataset
+		n := 0
+		err := scanRecords(day, nil, func(r *record) error {
+			if !selection.includes(r) {
+				return nil
+			}
+			data, err := json.Marshal(selection.document(r))
+			if err != nil {
+				return err
+			}
+			if err := sink.publishAsync(subject, data); err != nil {
+				return err
+			}
+			n++
+			if len(sink.pending) >= *window {
+				return sink.wait()
+			}
+			return nil
+		})
+		if err == nil {
+			err = sink.wait()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error publishing %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "📨 Published %s %s to %s: %d messages\n", day[0].Dataset, day[0].Date, subject, n)
+		total += n
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Published %d messages\n", total)
+	return exitOK
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// graphRelation is a relationship type of the exported graph with the
+// labels of its end nodes and the file it is written to
+type graphRelation struct {
+	Type, From, To, File string
+}
+
+// graphRelations are the relationships derived from A/AAAA, NS and CNAME records
+var graphRelations = map[string]graphRelation{
+	"A":     {Type: "RESOLVES_TO", From: "Domain", To: "IP", File: "resolves_to.csv"},
+	"AAAA":  {Type: "RESOLVES_TO", From: "Domain", To: "IP", File: "resolves_to.csv"},
+	"NS":    {Type: "USES_NS", From: "Domain", To: "NameServer", File: "uses_ns.csv"},
+	"CNAME": {Type: "ALIAS_OF", From: "Domain", To: "Domain", File: "alias_of.csv"},
+}
+
+// graphEdge is a relationship with the toplists and days it was seen in
+type graphEdge struct {
+	Relation    graphRelation
+	From, To    string
+	Datasets    []string
+	First, Last string
+}
+
+// graphTable is an import CSV with its neo4j-admin header
+type graphTable struct {
+	file    string
+	headers []string
+	rows    [][]string
+}
+
+// graphData is the graph of the selected days
+type graphData struct {
+	Domains     map[string][]string // domain -> toplists it was queried in
+	NameServers map[string]bool
+	IPs         map[string]bool
+	Edges       map[string]*graphEdge
+}
+
+// runExportNeo4j builds the domain to IP, name server and CNAME target graph
+// of the selected days and writes it as neo4j-admin import CSVs or merges it
+// into a running database over Bolt
+func runExportNeo4j(args []string) int {
+	flags := flag.NewFlagSet("export-neo4j", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	output := flags.String("output", "", "Directory to write neo4j-admin import CSVs to")
+	boltURL := flags.String("bolt-url", os.Getenv("NEO4J_URL"), "Bolt URL of the database to merge into, e.g. neo4j://localhost:7687 (default $NEO4J_URL)")
+	user := flags.String("user", envOr("NEO4J_USER", "neo4j"), "Database user (default $NEO4J_USER or neo4j)")
+	password := flags.String("password", os.Getenv("NEO4J_PASSWORD"), "Database password (default $NEO4J_PASSWORD)")
+	database := flags.String("database", "", "Database to merge into (default the server default)")
+	batch := flags.Int("batch", 10000, "Rows per Bolt transaction")
+	flags.Parse(args)
+
+	if (*output == "") == (*boltURL == "") {
+		fmt.Println("❌ Error: exactly one of --output and --bolt-url is required")
+		return exitUsage
+	}
+	if *batch < 1 {
+		fmt.Println("❌ Error: --batch must be positive")
+		return exitUsage
+	}
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	var driver neo4j.DriverWithContext
+	if *boltURL != "" {
+		if driver, err = neo4j.NewDriverWithContext(*boltURL, neo4j.BasicAuth(*user, *password, "")); err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+		defer driver.Close(ctx)
+		if err := driver.VerifyConnectivity(ctx); err != nil {
+			fmt.Println("❌ Error connecting to Neo4j:", err)
+			return exitFailed
+		}
+	}
+
+	graph, err := buildGraph(files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "🕸️  Graph of %d domains, %d name servers, %d addresses and %d relationships\n",
+		len(graph.Domains), len(graph.NameServers), len(graph.IPs), len(graph.Edges))
+
+	if *output != "" {
+		if err := writeGraphCSV(*output, graph); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error writing CSVs:", err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "📊 Wrote the graph to %s; import it with:\n", *output)
+		fmt.Fprintln(os.Stderr, "  neo4j-admin database import full --nodes=domains.csv --nodes=nameservers.csv --nodes=ips.csv",
+			"--relationships=resolves_to.csv --relationships=uses_ns.csv --relationships=alias_of.csv <database>")
+		return exitOK
+	}
+
+	if err := mergeGraph(ctx, driver, *database, *batch, graph); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error merging graph:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "📊 Merged the graph into %s\n", *boltURL)
+	return exitOK
+}
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// buildGraph collects the nodes and relationships of the files; records
+// reached through a CNAME belong to the response name, not the query name
+func buildGraph(files []archiveFile) (*graphData, error) {
+	g := &graphData{
+		Domains:     make(map[string][]string),
+		NameServers: make(map[string]bool),
+		IPs:         make(map[string]bool),
+		Edges:       make(map[string]*graphEdge),
+	}
+	err := scanRecords(files, nil, func(r *record) error {
+		query := indicatorValue(r.QueryName)
+		if query == "" {
+			return nil
+		}
+		g.Domains[query] = appendDataset(g.Domains[query], r.Dataset)
+
+		relation, ok := graphRelations[r.ResponseType]
+		if !ok {
+			return nil
+		}
+		owner := indicatorValue(r.ResponseName)
+		if owner == "" {
+			owner = query
+		}
+		target := r.Value()
+		if r.ResponseType == "NS" || r.ResponseType == "CNAME" {
+			target = indicatorValue(target)
+		}
+		if target == "" {
+			return nil
+		}
+		switch r.ResponseType {
+		case "NS":
+			g.NameServers[target] = true
+		case "CNAME":
+			if _, ok := g.Domains[target]; !ok {
+				g.Domains[target] = nil
+			}
+		default:
+			g.IPs[target] = true
+		}
+		if _, ok := g.Domains[owner]; !ok {
+			g.Domains[owner] = nil
+		}
+
+		key := relation.Type + "\x00" + owner + "\x00" + target
+		edge := g.Edges[key]
+		if edge == nil {
+			edge = &graphEdge{Relation: relation, From: owner, To: target, First: r.Date}
+			g.Edges[key] = edge
+		}
+		edge.Datasets = appendDataset(edge.Datasets, r.Dataset)
+		if r.Date < edge.First {
+			edge.First = r.Date
+		}
+		if r.Date > edge.Last {
+			edge.Last = r.Date
+		}
+		return nil
+	})
+	return g, err
+}
+
+// appendDataset adds a dataset to a short list unless it is already in it
+func appendDataset(datasets []string, dataset string) []string {
+	for _, d := range datasets {
+		if d == dataset {
+			return datasets
+		}
+	}
+	return append(datasets, dataset)
+}
+
+// ipVersion returns 4 or 6 for an address
+func ipVersion(address string) int {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return 6
+	}
+	return 4
+}
+
+// writeGraphCSV writes the node and relationship files in the header format
+// of neo4j-admin database import, with one ID space per node label
+func writeGraphCSV(dir string, g *graphData) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	domains := make([][]string, 0, len(g.Domains))
+	for name, datasets := range g.Domains {
+		domains = append(domains, []string{name, strings.Join(datasets, ";"), "Domain"})
+	}
+	nameServers := make([][]string, 0, len(g.NameServers))
+	for name := range g.NameServers {
+		nameServers = append(nameServers, []string{name, "NameServer"})
+	}
+	ips := make([][]string, 0, len(g.IPs))
+	for address := range g.IPs {
+		ips = append(ips, []string{address, fmt.Sprint(ipVersion(address)), "IP"})
+	}
+	edges := make(map[string][][]string)
+	for _, e := range g.Edges {
+		edges[e.Relation.File] = append(edges[e.Relation.File], []string{e.From, e.To, e.Relation.Type, strings.Join(e.Datasets, ";"), e.First, e.Last})
+	}
+
+	tables := []graphTable{
+		{"domains.csv", []string{"name:ID(Domain)", "toplists:string[]", ":LABEL"}, domains},
+		{"nameservers.csv", []string{"name:ID(NameServer)", ":LABEL"}, nameServers},
+		{"ips.csv", []string{"address:ID(IP)", "version:int", ":LABEL"}, ips},
+	}
+	for _, r := range []graphRelation{graphRelations["A"], graphRelations["NS"], graphRelations["CNAME"]} {
+		tables = append(tables, graphTable{r.File, []string{":START_ID(" + r.From + ")", ":END_ID(" + r.To + ")", ":TYPE", "datasets:string[]", "first_seen:date", "last_seen:date"}, edges[r.File]})
+	}
+
+	for _, t := range tables {
+		sort.Slice(t.rows, func(i, j int) bool {
+			if t.rows[i][0] != t.rows[j][0] {
+				return t.rows[i][0] < t.rows[j][0]
+			}
+			return t.rows[i][1] < t.rows[j][1]
+		})
+		f, err := os.Create(filepath.Join(dir, t.file))
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(f)
+		w.Write(t.headers)
+		w.WriteAll(t.rows)
+		if err := w.Error(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeGraph merges the nodes and relationships into the database in
+// batches, widening the seen dates and toplists of what is already there
+func mergeGraph(ctx context.Context, driver neo4j.DriverWithContext, database string, batch int, g *graphData) error {
+	run := func(query string, params map[string]any) error {
+		_, err := neo4j.ExecuteQuery(ctx, driver, query, params, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(database))
+		return err
+	}
+	for _, label := range []string{"Domain", "NameServer", "IP"} {
+		key := "name"
+		if label == "IP" {
+			key = "address"
+		}
+		query := fmt.Sprintf("CREATE CONSTRAINT %s_%s IF NOT EXISTS FOR (n:%s) REQUIRE n.%s IS UNIQUE", strings.ToLower(label), key, label, key)
+		if err := run(query, nil); err != nil {
+			return err
+		}
+	}
+
+	inBatches := func(query string, rows []map[string]any) error {
+		for start := 0; start < len(rows); start += batch {
+			if err := run(query, map[string]any{"rows": rows[start:min(start+batch, len(rows))]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	const union = "reduce(s = coalesce(%s, []), x IN %s | CASE WHEN x IN s THEN s ELSE s + x END)"
+
+	var rows []map[string]any
+	for name, datasets := range g.Domains {
+		rows = append(rows, map[string]any{"name": name, "toplists": append([]string{}, datasets...)})
+	}
+	err := inBatches("UNWIND $rows AS row MERGE (d:Domain {name: row.name}) SET d.toplists = "+fmt.Sprintf(union, "d.toplists", "row.toplists"), rows)
+	if err != nil {
+		return err
+	}
+	rows = rows[:0]
+	for name := range g.NameServers {
+		rows = append(rows, map[string]any{"name": name})
+	}
+	if err := inBatches("UNWIND $rows AS row MERGE (:NameServer {name: row.name})", rows); err != nil {
+		return err
+	}
+	rows = rows[:0]
+	for address := range g.IPs {
+		rows = append(rows, map[string]any{"address": address, "version": ipVersion(address)})
+	}
+	if err := inBatches("UNWIND $rows AS row MERGE (i:IP {address: row.address}) SET i.version = row.version", rows); err != nil {
+		return err
+	}
+
+	for _, r := range []graphRelation{graphRelations["A"], graphRelations["NS"], graphRelations["CNAME"]} {
+		rows = rows[:0]
+		for _, e := range g.Edges {
+			if e.Relation.Type == r.Type {
+				rows = append(rows, map[string]any{"from": e.From, "to": e.To, "datasets": e.Datasets, "first": e.First, "last": e.Last})
+			}
+		}
+		toKey := "name"
+		if r.To == "IP" {
+			toKey = "address"
+		}
+		query := fmt.Sprintf(`UNWIND $rows AS row
+MATCH (a:%s {name: row.from}), (b:%s {%s: row.to})
+MERGE (a)-[r:%s]->(b)
+SET r.datasets = %s,
+    r.first_seen = CASE WHEN r.first_seen IS NULL OR date(row.first) < r.first_seen THEN date(row.first) ELSE r.first_seen END,
+    r.last_seen = CASE WHEN r.last_seen IS NULL OR date(row.last) > r.last_seen THEN date(row.last) ELSE r.last_seen END`,
+			r.From, r.To, toKey, r.Type, fmt.Sprintf(union, "r.datasets", "row.datasets"))
+		if err := inBatches(query, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
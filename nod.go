@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	seenStoreFile = "seen-domains.db"
+	nodDir        = "nod"
+)
+
+var (
+	seenBucket      = []byte("seen")      // domain -> JSON firstSighting
+	processedBucket = []byte("processed") // "date/dataset" markers of merged days
+)
+
+// firstSighting is where a domain was observed for the first time
+type firstSighting struct {
+	FirstSeen string `json:"first_seen"`
+	Dataset   string `json:"dataset"`
+}
+
+// runNOD merges new days into the seen-domains store and writes the daily
+// feed of newly observed domains
+func runNOD(args []string) int {
+	flags := flag.NewFlagSet("nod", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	storePath := flags.String("store", "", "Seen-domains store (default <dir>/"+seenStoreFile+")")
+	feedDir := flags.String("feed-dir", "", "Directory receiving one <date>.txt feed per day (default <dir>/"+nodDir+")")
+	flags.Parse(args)
+
+	if *storePath == "" {
+		*storePath = filepath.Join(downloadDir, seenStoreFile)
+	}
+	if *feedDir == "" {
+		*feedDir = filepath.Join(downloadDir, nodDir)
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if err := os.MkdirAll(*feedDir, 0o755); err != nil {
+		fmt.Println("❌ Error creating feed directory:", err)
+		return exitFailed
+	}
+
+	db, err := bolt.Open(*storePath, 0o644, nil)
+	if err != nil {
+		fmt.Println("❌ Error opening store:", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	latest := latestProcessed(db)
+	feeds := make(map[string][]string)
+	processed, skipped := 0, 0
+	for _, day := range groupByDay(files) {
+		date, dataset := day[0].Date, day[0].Dataset
+		marker := []byte(date + "/" + dataset)
+		if isMarked(db, processedBucket, marker) {
+			skipped++
+			continue
+		}
+		if date < latest {
+			fmt.Fprintf(os.Stderr, "⚠️  Backfilling %s before %s: later feeds may list domains seen earlier\n", date, latest)
+		}
+
+		fmt.Fprintf(os.Stderr, "🆕 Processing %s %s\n", dataset, date)
+		found, err := mergeSeenDomains(db, day, marker)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error updating store:", err)
+			return exitFailed
+		}
+		for _, domain := range found {
+			fmt.Printf("%s\t%s\t%s\n", date, domain, dataset)
+		}
+		feeds[date] = append(feeds[date], found...)
+		processed++
+	}
+
+	total := 0
+	for date, domains := range feeds {
+		n, err := writeFeed(filepath.Join(*feedDir, date+".txt"), domains)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error writing feed:", err)
+			return exitFailed
+		}
+		total += n
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Processed %d dataset/days (%d already in the store), %d newly observed domains\n", processed, skipped, total)
+	return exitOK
+}
+
+// isMarked reports whether a marker is present in a bucket
+func isMarked(db *bolt.DB, bucket, marker []byte) bool {
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucket); b != nil {
+			found = b.Get(marker) != nil
+		}
+		return nil
+	})
+	return found
+}
+
+// latestProcessed returns the most recent day merged into the store
+func latestProcessed(db *bolt.DB) string {
+	latest := ""
+	db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(processedBucket); b != nil {
+			if k, _ := b.Cursor().Last(); k != nil {
+				latest, _, _ = strings.Cut(string(k), "/")
+			}
+		}
+		return nil
+	})
+	return latest
+}
+
+// mergeSeenDomains adds the registrable domains of one dataset/day to the
+// store and returns the ones it had not seen before
+func mergeSeenDomains(db *bolt.DB, files []archiveFile, marker []byte) ([]string, error) {
+	date, dataset := files[0].Date, files[0].Dataset
+	domains := make(map[string]bool)
+	err := scanRecords(files, nil, func(r *record) error {
+		domains[registrableDomain(r.QueryName)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	err = db.Update(func(tx *bolt.Tx) error {
+		seen, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+		done, err := tx.CreateBucketIfNotExists(processedBucket)
+		if err != nil {
+			return err
+		}
+
+		for domain := range domains {
+			if existing := seen.Get([]byte(domain)); existing != nil {
+				var s firstSighting
+				if err := json.Unmarshal(existing, &s); err != nil {
+					return err
+				}
+				if s.FirstSeen <= date {
+					continue
+				}
+			}
+			data, _ := json.Marshal(firstSighting{FirstSeen: date, Dataset: dataset})
+			if err := seen.Put([]byte(domain), data); err != nil {
+				return err
+			}
+			found = append(found, domain)
+		}
+		return done.Put(marker, []byte{1})
+	})
+	sort.Strings(found)
+	return found, err
+}
+
+// writeFeed merges domains into a feed file, keeping it sorted and free of
+// duplicates, and returns how many domains were added
+func writeFeed(path string, domains []string) (int, error) {
+	feed := make(map[string]bool)
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				feed[line] = true
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	added := 0
+	for _, domain := range domains {
+		if !feed[domain] {
+			feed[domain] = true
+			added++
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(sortedKeys(feed), "\n")+"\n"), 0o644); err != nil {
+		return 0, err
+	}
+	return added, os.Rename(tmp, path)
+}
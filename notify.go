@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// notifyInterval is how often a running crawl compares its failures
+	// with -notify-above
+	notifyInterval = 30 * time.Second
+	// notifyMinAttempts is how many listing pages and files a crawl tries
+	// before a -notify-above percentage applies, so that a first
+	// failure is not a 100% failure rate
+	notifyMinAttempts = 20
+	// notifyMaxLength keeps messages within the limits of the chat
+	// services; Discord takes the fewest characters
+	notifyMaxLength = 1900
+)
+
+// runNotifier posts the outcome of a crawl to Slack, Discord or Microsoft
+// Teams webhooks, and alerts them while it runs once failures exceed a
+// threshold
+type runNotifier struct {
+	URLs     string
+	On       string
+	Failures string
+
+	targets   []chatTarget
+	threshold *failureThreshold // nil without -notify-above
+	hooks     *webhooks         // delivers with retries
+	done      chan struct{}
+	watching  sync.WaitGroup
+}
+
+// chatTarget is a webhook URL and the service whose message format it takes
+type chatTarget struct {
+	service string // slack, discord or teams
+	url     string
+}
+
+// addNotifyFlags registers the notification options of the crawler
+func addNotifyFlags(flags *flag.FlagSet, n *runNotifier) {
+	flags.StringVar(&n.URLs, "notify", "", "Comma-separated Slack, Discord or Teams webhook URLs to notify when the crawl ends; prefix slack:, discord: or teams: to URLs on other hosts (optional)")
+	flags.StringVar(&n.On, "notify-on", "always", "When to notify at the end of the crawl: always, or failure only")
+	flags.StringVar(&n.Failures, "notify-above", "", "Also notify while crawling once failures exceed this count or percentage, e.g. 10% (optional)")
+}
+
+// setup parses the notification options; it reports false when they ask
+// for no notification
+func (n *runNotifier) setup() (bool, error) {
+	if n.On != "always" && n.On != "failure" {
+		return false, fmt.Errorf("-notify-on %q: expected always or failure", n.On)
+	}
+	for _, raw := range strings.Split(n.URLs, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		target, err := parseChatTarget(raw)
+		if err != nil {
+			return false, err
+		}
+		n.targets = append(n.targets, target)
+	}
+	if n.Failures != "" {
+		threshold, err := parseFailureThreshold(n.Failures)
+		if err != nil {
+			return false, fmt.Errorf("-notify-above: %w", err)
+		}
+		n.threshold = &threshold
+	}
+	if len(n.targets) == 0 {
+		if n.threshold != nil {
+			return false, errors.New("-notify-above requires -notify")
+		}
+		return false, nil
+	}
+	n.hooks = &webhooks{client: &http.Client{Timeout: webhookTimeout}}
+	return true, nil
+}
+
+// parseChatTarget recognizes the service of a webhook URL by its host or by
+// a service prefix
+func parseChatTarget(raw string) (chatTarget, error) {
+	var target chatTarget
+	for _, service := range []string{"slack", "discord", "teams"} {
+		if rest, ok := strings.CutPrefix(raw, service+":"); ok && !strings.HasPrefix(rest, "//") {
+			target.service, raw = service, rest
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return target, fmt.Errorf("-notify %q: expected an http:// or https:// URL", raw)
+	}
+	if target.service == "" {
+		host := u.Hostname()
+		switch {
+		case host == "hooks.slack.com":
+			target.service = "slack"
+		case host == "discord.com" || host == "discordapp.com":
+			target.service = "discord"
+		case strings.HasSuffix(host, ".webhook.office.com") || strings.HasSuffix(host, ".logic.azure.com") || strings.HasSuffix(host, ".powerplatform.com"):
+			target.service = "teams"
+		default:
+			return target, fmt.Errorf("-notify: cannot tell which service %s is; prefix the URL with slack:, discord: or teams:", host)
+		}
+	}
+	target.url = u.String()
+	return target, nil
+}
+
+// start watches the failures of the crawl until it is finished
+func (n *runNotifier) start() {
+	n.done = make(chan struct{})
+	if n.threshold == nil {
+		return
+	}
+	n.watching.Add(1)
+	go func() {
+		defer n.watching.Done()
+		ticker := time.NewTicker(notifyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.done:
+				return
+			case <-ticker.C:
+				if n.checkFailures() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// checkFailures posts an alert the first time the failures exceed
+// -notify-above, and reports whether it did
+func (n *runNotifier) checkFailures() bool {
+	attempts, failed := stats.attempts(), stats.failures()
+	if n.threshold.percent > 0 && attempts < notifyMinAttempts {
+		return false
+	}
+	if failed <= n.threshold.limit(attempts) {
+		return false
+	}
+	text := fmt.Sprintf("🚨 %s: %d of %d listing pages and files failed so far, more than -notify-above %s\n%s",
+		runName(), failed, attempts, n.Failures, stats.summary())
+	n.post("crawl.failing", text)
+	return true
+}
+
+// finished posts the outcome of the crawl with its summary, ending with the
+// line that explained its exit code
+func (n *runNotifier) finished(code int, reason string, elapsed time.Duration) {
+	close(n.done)
+	n.watching.Wait()
+	if succeeded(code) && n.On == "failure" {
+		return
+	}
+	n.post("crawl.finished", crawlHeadline(code, elapsed)+"\n"+stats.summary()+"\n"+reason)
+}
+
+// crawlHeadline tells which crawl ended, how and after how long
+func crawlHeadline(code int, elapsed time.Duration) string {
+	outcome := map[int]string{exitOK: "✅ %s completed", exitPartial: "⚠️  %s completed with failures", exitAborted: "🛑 %s was stopped"}[code]
+	if outcome == "" {
+		outcome = "❌ %s failed"
+	}
+	return fmt.Sprintf(outcome+" after %s", runName(), elapsed.Round(time.Second))
+}
+
+// runName tells which crawl a message is about, as several may report to
+// the same channel
+func runName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("Crawl of %s on %s (%s)", downloadDir, host, strings.Join(datasets, ","))
+}
+
+// post delivers a message to every target, in the format of its service;
+// the crawl waits for the deliveries so that they are not lost on exit
+func (n *runNotifier) post(event, text string) {
+	if len(text) > notifyMaxLength {
+		cut := notifyMaxLength
+		for !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "…"
+	}
+	for _, target := range n.targets {
+		body, err := json.Marshal(chatMessage(target.service, text))
+		if err != nil {
+			fmt.Println("❌ Error encoding notification:", err)
+			continue
+		}
+		// Webhook URLs embed their token, so only the service is shown
+		if err := n.hooks.deliver(target.url, event, body); err != nil {
+			fmt.Printf("❌ Notification to %s failed: %v\n", target.service, err)
+		}
+	}
+}
+
+// chatMessage wraps a text in the payload of a chat service's incoming
+// webhooks; Teams takes an Adaptive Card, as Workflows webhooks require
+func chatMessage(service, text string) any {
+	switch service {
+	case "discord":
+		return map[string]string{"content": text}
+	case "teams":
+		return map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    []map[string]any{{"type": "TextBlock", "text": strings.ReplaceAll(text, "\n", "\n\n"), "wrap": true}},
+				},
+			}},
+		}
+	default:
+		return map[string]string{"text": text}
+	}
+}
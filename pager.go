@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// pagerDutyEvents is the Events API v2 endpoint of PagerDuty
+	pagerDutyEvents = "https://events.pagerduty.com/v2/enqueue"
+	// opsgenieMessageLength is the longest message Opsgenie keeps
+	opsgenieMessageLength = 130
+)
+
+// pager pages the operators of a mirror through PagerDuty or Opsgenie once
+// the syncs of a dataset fail -page-after times in a row, and resolves the
+// alert at the next sync of the dataset that succeeds
+type pager struct {
+	PagerDuty   string
+	Opsgenie    string
+	OpsgenieURL string
+	After       int
+
+	host      string
+	pagerDuty *webhooks // nil without -pagerduty-key
+	opsgenie  *webhooks // nil without -opsgenie-key, sends the API key
+	mu        sync.Mutex
+	failing   map[string]int         // consecutive failed syncs by dataset
+	paged     map[string]bool        // datasets with an open alert
+	datasets  map[string]*sync.Mutex // held while the alert of a dataset changes
+}
+
+// addPagerFlags registers the paging options of the daemons that sync
+func addPagerFlags(flags *flag.FlagSet, p *pager) {
+	flags.StringVar(&p.PagerDuty, "pagerduty-key", os.Getenv("PAGERDUTY_ROUTING_KEY"), "PagerDuty Events API v2 routing key to page when a dataset keeps failing (default $PAGERDUTY_ROUTING_KEY)")
+	flags.StringVar(&p.Opsgenie, "opsgenie-key", os.Getenv("OPSGENIE_API_KEY"), "Opsgenie API key to page when a dataset keeps failing (default $OPSGENIE_API_KEY)")
+	flags.StringVar(&p.OpsgenieURL, "opsgenie-url", "https://api.opsgenie.com", "Opsgenie API, https://api.eu.opsgenie.com for the EU instance")
+	flags.IntVar(&p.After, "page-after", 3, "Page once this many syncs of a dataset failed in a row")
+}
+
+// setup checks the paging options; without a key, nobody is paged
+func (p *pager) setup() error {
+	if p.After < 1 {
+		return errors.New("--page-after must be positive")
+	}
+	u, err := url.Parse(p.OpsgenieURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("--opsgenie-url %q: expected an http:// or https:// URL", p.OpsgenieURL)
+	}
+	p.OpsgenieURL = strings.TrimSuffix(u.String(), "/")
+	p.host, _ = os.Hostname()
+	p.failing = make(map[string]int)
+	p.paged = make(map[string]bool)
+	p.datasets = make(map[string]*sync.Mutex)
+	client := &http.Client{Timeout: webhookTimeout}
+	if p.PagerDuty != "" {
+		p.pagerDuty = &webhooks{client: client}
+	}
+	if p.Opsgenie != "" {
+		p.opsgenie = &webhooks{client: client, header: http.Header{"Authorization": {"GenieKey " + p.Opsgenie}}}
+	}
+	return nil
+}
+
+// synced records the outcome of a crawl of datasets, named by what for the
+// alerts. The outcomes of a dataset are recorded and delivered one at a
+// time, so that the resolution of an alert never overtakes its trigger
+// when crawls of the dataset end together.
+func (p *pager) synced(datasets []string, what string, code int, err error) {
+	if p.pagerDuty == nil && p.opsgenie == nil {
+		return
+	}
+	ok := err == nil && succeeded(code)
+	failure := fmt.Sprintf("%s failed with exit code %d", what, code)
+	if err != nil {
+		failure = fmt.Sprintf("%s failed: %v", what, err)
+	}
+	for _, dataset := range datasets {
+		p.mu.Lock()
+		serial, known := p.datasets[dataset]
+		if !known {
+			serial = &sync.Mutex{}
+			p.datasets[dataset] = serial
+		}
+		p.mu.Unlock()
+		serial.Lock()
+
+		p.mu.Lock()
+		trigger, resolve := false, false
+		if ok {
+			resolve = p.paged[dataset]
+			delete(p.failing, dataset)
+			delete(p.paged, dataset)
+		} else {
+			p.failing[dataset]++
+			trigger = p.failing[dataset] >= p.After && !p.paged[dataset]
+			p.paged[dataset] = p.paged[dataset] || trigger
+		}
+		failures := p.failing[dataset]
+		p.mu.Unlock()
+
+		switch {
+		case trigger:
+			p.trigger(dataset, failures, failure)
+		case resolve:
+			p.resolve(dataset, what)
+		}
+		serial.Unlock()
+	}
+}
+
+// alertKey identifies the alert of a dataset, so that the services merge
+// the pages of one host instead of opening an incident for each
+func (p *pager) alertKey(dataset string) string {
+	return "gopenintel-" + p.host + "-" + dataset
+}
+
+// trigger opens the alert of a dataset with the last failure as details
+func (p *pager) trigger(dataset string, failures int, lastFailure string) {
+	summary := fmt.Sprintf("gopenintel: %d syncs of %s failed in a row on %s", failures, dataset, p.host)
+	if p.pagerDuty != nil {
+		p.deliver("PagerDuty", p.pagerDuty, pagerDutyEvents, "alert.triggered", map[string]any{
+			"routing_key":  p.PagerDuty,
+			"event_action": "trigger",
+			"dedup_key":    p.alertKey(dataset),
+			"payload": map[string]any{
+				"summary":   summary,
+				"source":    p.host,
+				"severity":  "error",
+				"component": dataset,
+				"group":     "gopenintel",
+				"custom_details": map[string]any{
+					"dataset":      dataset,
+					"failed_syncs": failures,
+					"last_failure": lastFailure,
+				},
+			},
+		})
+	}
+	if p.opsgenie != nil {
+		message := summary
+		if len(message) > opsgenieMessageLength {
+			cut := opsgenieMessageLength - len("…")
+			for !utf8.RuneStart(message[cut]) {
+				cut--
+			}
+			message = message[:cut] + "…"
+		}
+		p.deliver("Opsgenie", p.opsgenie, p.OpsgenieURL+"/v2/alerts", "alert.triggered", map[string]any{
+			"message":     message,
+			"alias":       p.alertKey(dataset),
+			"description": summary + "\nLast failure: " + lastFailure,
+			"source":      p.host,
+			"tags":        []string{"gopenintel", dataset},
+			"details":     map[string]string{"dataset": dataset, "last_failure": lastFailure},
+			"priority":    "P2",
+		})
+	}
+	fmt.Printf("📟 Paged for %s: %s\n", dataset, summary)
+}
+
+// resolve closes the alert of a dataset once one of its syncs succeeded
+func (p *pager) resolve(dataset, what string) {
+	if p.pagerDuty != nil {
+		p.deliver("PagerDuty", p.pagerDuty, pagerDutyEvents, "alert.resolved", map[string]any{
+			"routing_key":  p.PagerDuty,
+			"event_action": "resolve",
+			"dedup_key":    p.alertKey(dataset),
+		})
+	}
+	if p.opsgenie != nil {
+		target := p.OpsgenieURL + "/v2/alerts/" + url.PathEscape(p.alertKey(dataset)) + "/close?identifierType=alias"
+		p.deliver("Opsgenie", p.opsgenie, target, "alert.resolved", map[string]any{
+			"source": p.host,
+			"note":   what + " succeeded",
+		})
+	}
+	fmt.Printf("📟 Resolved the alert of %s: %s succeeded\n", dataset, what)
+}
+
+// deliver posts a request to a paging service, with the retries of webhooks
+func (p *pager) deliver(service string, hooks *webhooks, target, event string, request any) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		fmt.Printf("❌ Error encoding the %s alert: %v\n", service, err)
+		return
+	}
+	if err := hooks.deliver(target, event, body); err != nil {
+		fmt.Printf("❌ Paging through %s failed: %v\n", service, err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const pdnsIndexFile = "pdns.db"
+
+// rrBucket maps "reversed name \x00 type \x00 value" keys to JSON rrSeen; names
+// are stored with their labels reversed so subdomains share a key prefix
+var rrBucket = []byte("rr")
+
+// rrSeen is when and where a resource record was observed
+type rrSeen struct {
+	FirstSeen string   `json:"first_seen"`
+	LastSeen  string   `json:"last_seen"`
+	Datasets  []string `json:"datasets"`
+}
+
+// passiveRecord is one answer of an index query
+type passiveRecord struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	rrSeen
+}
+
+// reverseName turns www.example.com. into com.example.www. so the
+// subdomains of a name sort under it
+func reverseName(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".") + "."
+}
+
+// rrKey encodes the key of a record in the rr bucket
+func rrKey(name, rrType, value string) []byte {
+	return []byte(reverseName(name) + "\x00" + rrType + "\x00" + value)
+}
+
+// runIndex dispatches the index build and index query commands
+func runIndex(args []string) int {
+	if len(args) > 0 && args[0] == "build" {
+		return runIndexBuild(args[1:])
+	}
+	if len(args) > 0 && args[0] == "query" {
+		return runIndexQuery(args[1:])
+	}
+	fmt.Println("❌ Error: usage is index build [options] | index query [options] <name|ip|cidr>...")
+	return exitUsage
+}
+
+// runIndexBuild builds or extends the passive-DNS index of names and addresses
+func runIndexBuild(args []string) int {
+	flags := flag.NewFlagSet("index build", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	indexPath := flags.String("index", "", "Index file (default <dir>/"+pdnsIndexFile+")")
+	rebuild := flags.Bool("rebuild", false, "Re-index days that are already in the index")
+	flags.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = filepath.Join(downloadDir, pdnsIndexFile)
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	db, err := bolt.Open(*indexPath, 0o644, nil)
+	if err != nil {
+		fmt.Println("❌ Error opening index:", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	indexed, skipped := 0, 0
+	for _, day := range groupByDay(files) {
+		marker := []byte(day[0].Date + "/" + day[0].Dataset)
+		if !*rebuild && isMarked(db, indexedBucket, marker) {
+			skipped++
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "🗂️  Indexing %s %s\n", day[0].Dataset, day[0].Date)
+		if err := indexPassiveDay(db, day, marker); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error indexing:", err)
+			return exitFailed
+		}
+		indexed++
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Indexed %d dataset/days (%d already present) into %s\n", indexed, skipped, *indexPath)
+	return exitOK
+}
+
+// indexPassiveDay merges the records and addresses of one dataset/day
+func indexPassiveDay(db *bolt.DB, files []archiveFile, marker []byte) error {
+	date, dataset := files[0].Date, files[0].Dataset
+	addresses := make(addressSet)
+	records := make(map[string]bool)
+	err := scanRecords(files, nil, func(r *record) error {
+		addresses.add(r)
+		if value := r.Value(); value != "" {
+			records[string(rrKey(strings.ToLower(r.QueryName), r.ResponseType, value))] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := mergeAddresses(tx, addresses, date); err != nil {
+			return err
+		}
+		rr, err := tx.CreateBucketIfNotExists(rrBucket)
+		if err != nil {
+			return err
+		}
+		for key := range records {
+			seen := rrSeen{FirstSeen: date, LastSeen: date}
+			if existing := rr.Get([]byte(key)); existing != nil {
+				if err := json.Unmarshal(existing, &seen); err != nil {
+					return err
+				}
+				seen.FirstSeen = min(seen.FirstSeen, date)
+				seen.LastSeen = max(seen.LastSeen, date)
+			}
+			if !containsString(seen.Datasets, dataset) {
+				seen.Datasets = append(seen.Datasets, dataset)
+				sort.Strings(seen.Datasets)
+			}
+			data, _ := json.Marshal(seen)
+			if err := rr.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+
+		done, err := tx.CreateBucketIfNotExists(indexedBucket)
+		if err != nil {
+			return err
+		}
+		return done.Put(marker, []byte{1})
+	})
+}
+
+// runIndexQuery answers name and address lookups from the passive-DNS index
+func runIndexQuery(args []string) int {
+	flags := flag.NewFlagSet("index query", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	indexPath := flags.String("index", "", "Index file (default <dir>/"+pdnsIndexFile+")")
+	subdomains := flags.Bool("suffix", false, "Also return the records of subdomains")
+	rrType := flags.String("type", "", "Only return records of this type")
+	asJSON := flags.Bool("json", false, "Print results as JSON lines")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("❌ Error: usage is index query [options] <name|ip|cidr>...")
+		return exitUsage
+	}
+	if *indexPath == "" {
+		*indexPath = filepath.Join(downloadDir, pdnsIndexFile)
+	}
+
+	db, err := bolt.Open(*indexPath, 0o644, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		fmt.Println("❌ Error opening index:", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	encoder := json.NewEncoder(os.Stdout)
+	found := 0
+	for _, arg := range flags.Args() {
+		// Anything that parses as an address or prefix is an address lookup
+		if start, end, err := addressRange(arg); err == nil {
+			n, err := lookupAddresses(db, start, end, *asJSON, encoder)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "❌ Error reading index:", err)
+				return exitFailed
+			}
+			found += n
+			continue
+		}
+
+		n, err := lookupNames(db, normalizeDomain(arg), *subdomains, strings.ToUpper(*rrType), *asJSON, encoder)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading index:", err)
+			return exitFailed
+		}
+		found += n
+	}
+
+	if found == 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// lookupNames prints the indexed records of a name and, with subdomains set,
+// of the names below it; it returns the number of records printed
+func lookupNames(db *bolt.DB, name string, subdomains bool, rrType string, asJSON bool, encoder *json.Encoder) (int, error) {
+	records, _, err := indexedNames(db, name, subdomains, rrType, 0)
+	for _, rec := range records {
+		if asJSON {
+			encoder.Encode(rec)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", rec.Name, rec.Type, rec.Value, rec.FirstSeen, rec.LastSeen, strings.Join(rec.Datasets, ","))
+	}
+	return len(records), err
+}
+
+// indexedNames returns the indexed records of a name and, with subdomains
+// set, of the names below it; with a positive limit, it stops after that
+// many and reports whether there were more
+func indexedNames(db *bolt.DB, name string, subdomains bool, rrType string, limit int) ([]passiveRecord, bool, error) {
+	var records []passiveRecord
+	truncated := false
+	err := scanNames(db, name, subdomains, rrType, nil, func(_ []byte, rec passiveRecord) bool {
+		if limit > 0 && len(records) == limit {
+			truncated = true
+			return false
+		}
+		records = append(records, rec)
+		return true
+	})
+	return records, truncated, err
+}
+
+// scanNames calls fn with the key and the content of the indexed records
+// of a name and, with subdomains set, of the names below it, in key order
+// and from the key following after if set, until fn returns false
+func scanNames(db *bolt.DB, name string, subdomains bool, rrType string, after []byte, fn func(key []byte, rec passiveRecord) bool) error {
+	reversed := reverseName(name)
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(rrBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		prefix := []byte(reversed)
+		k, v := c.Seek(prefix)
+		if after != nil && bytes.Compare(after, prefix) > 0 {
+			if k, v = c.Seek(after); bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			parts := strings.SplitN(string(k), "\x00", 3)
+			if len(parts) != 3 || !subdomains && parts[0] != reversed {
+				continue
+			}
+			if rrType != "" && parts[1] != rrType {
+				continue
+			}
+
+			rec := passiveRecord{Name: reverseName(parts[0]), Type: parts[1], Value: parts[2]}
+			if err := json.Unmarshal(v, &rec.rrSeen); err != nil {
+				return err
+			}
+			if !fn(k, rec) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// containsString reports whether a slice holds a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
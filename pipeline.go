@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var listingWorkers = 4 // Listing pages fetched concurrently, separately from downloads
+
+// dayDownload is a listing page whose files are being downloaded; the
+// worker finishing the last file writes the manifest
+type dayDownload struct {
+	page      listing
+	previous  map[string]manifestEntry
+	entries   []*manifestEntry // in listing order, nil for failed files
+	remaining atomic.Int32
+}
+
+// downloads coalesces the downloads of the run by file URL and local path
+var downloads = &downloadGroup{calls: make(map[downloadKey]*downloadCall)}
+
+// downloadGroup makes sure a file URL listed again for the same day is
+// downloaded once per run: later requests for it wait for the download in
+// flight, or reuse its result. A URL listed for several days is downloaded
+// into each day directory, so every manifest entry names a file of its own
+// day.
+type downloadGroup struct {
+	mu    sync.Mutex
+	calls map[downloadKey]*downloadCall
+}
+
+// downloadKey identifies a download by its URL and the path it is saved as
+type downloadKey struct {
+	url, path string
+}
+
+// downloadCall is the download of one URL and its result once done is closed
+type downloadCall struct {
+	done  chan struct{}
+	entry manifestEntry
+	ok    bool
+}
+
+// do downloads a file unless the run already did or is doing it
+func (g *downloadGroup) do(fileURL, fileName string, previous map[string]manifestEntry) (manifestEntry, bool) {
+	key := downloadKey{fileURL, fileName}
+	g.mu.Lock()
+	if call, found := g.calls[key]; found {
+		g.mu.Unlock()
+		fmt.Println("🔗 Already requested in this run:", fileURL)
+		<-call.done
+		return call.entry, call.ok
+	}
+	call := &downloadCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.entry, call.ok = downloadFile(fileURL, fileName, previous)
+	close(call.done)
+	return call.entry, call.ok
+}
+
+// fileJob is one file of a listing page waiting for a download worker
+type fileJob struct {
+	day   *dayDownload
+	index int
+	url   string
+}
+
+// crawlPages fetches the listing pages produced by forEach with a pool of
+// listing workers and downloads the linked files with a separate pool of
+// download workers. The bounded queue between them lets discovery run ahead
+// of slow transfers without holding every file URL of the run in memory.
+// Pages are listed day by day, every dataset in turn, and the queue hands
+// out files round-robin by dataset, so an interrupted run leaves the
+// datasets about equally far along.
+func crawlPages(forEach func(fn func(year, month, day int))) {
+	if orderedMode {
+		crawlOrdered(forEach)
+		return
+	}
+	pages := make(chan listing)
+	jobs := newFairQueue(2 * workerLimit)
+
+	go func() {
+		forEach(func(year, month, day int) {
+			for _, dataset := range datasets {
+				select {
+				case pages <- listing{Dataset: dataset, Year: year, Month: month, Day: day}:
+				case <-stopping.Done():
+					return
+				}
+			}
+		})
+		close(pages)
+	}()
+
+	var listers sync.WaitGroup
+	for i := 0; i < listingWorkers; i++ {
+		listers.Add(1)
+		go func() {
+			defer listers.Done()
+			for page := range pages {
+				discoverPage(page, jobs.push)
+			}
+		}()
+	}
+
+	var downloaders sync.WaitGroup
+	for i := 0; i < workerLimit; i++ {
+		downloaders.Add(1)
+		go func() {
+			defer downloaders.Done()
+			for {
+				job, ok := jobs.pop()
+				if !ok {
+					return
+				}
+				downloadJob(job)
+			}
+		}()
+	}
+
+	listers.Wait()
+	jobs.close()
+	downloaders.Wait()
+}
+
+// crawlOrdered is crawlPages for --ordered: one listing page at a time, day
+// by day and dataset by dataset, and its files one by one in URL order, so
+// every run over the same days logs and writes manifests in the same order
+func crawlOrdered(forEach func(fn func(year, month, day int))) {
+	forEach(func(year, month, day int) {
+		for _, dataset := range datasets {
+			if stopped() {
+				return
+			}
+			discoverPage(listing{Dataset: dataset, Year: year, Month: month, Day: day}, downloadJob)
+		}
+	})
+}
+
+// downloadJob downloads a file of a listing page and writes the manifest of
+// the day after its last file
+func downloadJob(job fileJob) {
+	// Once stopping, queued files are dropped so their days still get a
+	// manifest of what was downloaded
+	if !stopped() {
+		stats.files.Add(1)
+		fileName := claimPath(dayDir(job.day.page), job.url)
+		if entry, ok := downloads.do(job.url, fileName, job.day.previous); ok {
+			job.day.entries[job.index] = &entry
+		} else {
+			stats.failedFiles.Add(1)
+		}
+	}
+	if job.day.remaining.Add(-1) == 0 {
+		job.day.finish()
+	}
+}
+
+// discoverPage fetches a listing page and hands its files to queue
+func discoverPage(page listing, queue func(fileJob)) {
+	if stopped() {
+		return
+	}
+	if dayLocks != nil && !dayLocks.lock(page) {
+		return
+	}
+	links, ok := preflightLinks[page.URL()]
+	if !ok {
+		links, ok = listPage(page)
+	}
+	stats.pages.Add(1)
+	if !ok {
+		stats.failedPages.Add(1)
+	}
+	if !ok || len(links) == 0 || stopped() {
+		if dayLocks != nil {
+			dayLocks.unlock(page)
+		}
+		return
+	}
+	links = uniqueLinks(links)
+	if orderedMode {
+		links = slices.Clone(links)
+		slices.Sort(links)
+	}
+
+	// Previous manifest entries let us skip re-hashing existing files
+	day := &dayDownload{page: page, previous: loadManifestEntries(page), entries: make([]*manifestEntry, len(links))}
+	day.remaining.Store(int32(len(links)))
+	for i, link := range links {
+		queue(fileJob{day: day, index: i, url: link})
+	}
+}
+
+// uniqueLinks drops the links a listing page repeats, keeping their order
+func uniqueLinks(links []string) []string {
+	seen := make(map[string]bool, len(links))
+	unique := links[:0:0]
+	for _, link := range links {
+		if !seen[link] {
+			seen[link] = true
+			unique = append(unique, link)
+		}
+	}
+	return unique
+}
+
+// listPage returns the file links of a listing page that -include and
+// -exclude keep, skipping complete and missing days first when probing; it
+// reports false when the page failed
+func listPage(page listing) ([]string, bool) {
+	if probeListings {
+		if !syncMode && manifestComplete(page) {
+			fmt.Println("✅ Already complete:", page.Dataset, page.Date())
+			return nil, true
+		}
+		if !listingExists(page.URL()) {
+			return nil, true
+		}
+	}
+	links, ok := fetchListing(page.URL())
+	return filesFilter.apply(links), ok
+}
+
+// finish writes the manifest of a dataset/day once all its files are done
+func (d *dayDownload) finish() {
+	if dayLocks != nil {
+		defer dayLocks.unlock(d.page)
+	}
+	m := &manifest{Dataset: d.page.Dataset, Date: d.page.Date(), SourceURL: d.page.URL(), Filter: filesFilter.describe()}
+	for _, entry := range d.entries {
+		if entry != nil {
+			m.Files = append(m.Files, *entry)
+		}
+	}
+	m.Incomplete = len(m.Files) < len(d.entries)
+	if len(m.Files) == 0 {
+		return
+	}
+	if filesFilter != nil {
+		keepUnfiltered(m)
+	}
+
+	if err := writeManifest(m); err != nil {
+		fmt.Println("❌ Error writing manifest:", err)
+		return
+	}
+	fmt.Println("📒 Manifest written:", m.path)
+	recordDay(m)
+	if downloadEvents != nil {
+		publishDownload(m)
+	}
+}
+
+// keepUnfiltered carries the entries of the files -include and -exclude
+// left out over from a full manifest of the day, so that sampling a day
+// downloaded in full never drops its files from the manifest
+func keepUnfiltered(m *manifest) {
+	previous, err := readManifest(manifestPath(m.Dataset, m.Date))
+	if err != nil || previous.Filter != "" {
+		return
+	}
+	listed := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		listed[entry.Name] = true
+	}
+	for _, entry := range previous.Files {
+		if !listed[entry.Name] && !filesFilter.keeps(path.Base(entry.Name)) && checkManifestEntry(m, entry) == nil {
+			m.Files = append(m.Files, entry)
+		}
+	}
+	m.Filter = ""
+	m.Incomplete = m.Incomplete || previous.Incomplete
+}
+
+// fairQueue holds the files waiting for a download worker in one bounded
+// FIFO per dataset and hands them out taking each dataset in turn
+type fairQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queues   map[string][]fileJob
+	order    []string // datasets in the order they were first queued
+	next     int      // position in order of the dataset served next
+	queued   int
+	limit    int // files queued per dataset before push blocks
+	closed   bool
+}
+
+// newFairQueue creates a queue holding up to limit files per dataset
+func newFairQueue(limit int) *fairQueue {
+	q := &fairQueue{queues: make(map[string][]fileJob), limit: limit}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a file, waiting while its dataset already has limit files queued
+func (q *fairQueue) push(job fileJob) {
+	dataset := job.day.page.Dataset
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, known := q.queues[dataset]; !known {
+		q.order = append(q.order, dataset)
+	}
+	for len(q.queues[dataset]) >= q.limit {
+		q.notFull.Wait()
+	}
+	q.queues[dataset] = append(q.queues[dataset], job)
+	q.queued++
+	q.notEmpty.Signal()
+}
+
+// pop returns the next file of the next dataset that has one queued; it
+// reports false once the queue is closed and empty
+func (q *fairQueue) pop() (fileJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.queued == 0 {
+		if q.closed {
+			return fileJob{}, false
+		}
+		q.notEmpty.Wait()
+	}
+	for {
+		dataset := q.order[q.next%len(q.order)]
+		q.next = (q.next + 1) % len(q.order)
+		if pending := q.queues[dataset]; len(pending) > 0 {
+			job := pending[0]
+			pending[0] = fileJob{}
+			q.queues[dataset] = pending[1:]
+			q.queued--
+			q.notFull.Broadcast()
+			return job, true
+		}
+	}
+}
+
+// close wakes the workers waiting for files once no more will be queued
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.mu.Unlock()
+}
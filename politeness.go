@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	requestDelay  time.Duration // Minimum time between the requests sent to a host
+	requestJitter time.Duration // Random extra time added to every delay
+)
+
+// addPolitenessFlags registers the request pacing flags of the commands that
+// talk to the archive
+func addPolitenessFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&requestDelay, "delay", 0, "Minimum time between two requests to the same host, whatever the worker counts, e.g. 500ms")
+	flags.DurationVar(&requestJitter, "jitter", 0, "Random extra time of up to this long added to every -delay")
+}
+
+// hostPacer spaces the requests sent to each host by the delay plus a random
+// jitter. Every request reserves the next free slot of its host, so the
+// spacing holds however many workers are sending.
+type hostPacer struct {
+	delay, jitter time.Duration
+	mu            sync.Mutex
+	next          map[string]time.Time // first free slot per host
+}
+
+// newHostPacer returns a pacer, or nil when requests are not paced
+func newHostPacer(delay, jitter time.Duration) *hostPacer {
+	if delay <= 0 && jitter <= 0 {
+		return nil
+	}
+	return &hostPacer{delay: delay, jitter: jitter, next: make(map[string]time.Time)}
+}
+
+// wait blocks until the slot reserved for the request comes, or the request
+// is canceled
+func (p *hostPacer) wait(req *http.Request) error {
+	if p == nil {
+		return nil
+	}
+	gap := p.delay
+	if p.jitter > 0 {
+		gap += time.Duration(rand.Int63n(int64(p.jitter) + 1))
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.next[req.URL.Host]
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next[req.URL.Host] = slot.Add(gap)
+	p.mu.Unlock()
+
+	if slot == now {
+		return nil
+	}
+	timer := time.NewTimer(slot.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// postgresTypes maps export column kinds to PostgreSQL types
+var postgresTypes = map[string]string{"text": "text", "bigint": "bigint", "date": "date"}
+
+// runLoadPostgres bulk-loads the selected records into PostgreSQL, one
+// transaction per dataset/day so interrupted loads can simply be rerun
+func runLoadPostgres(args []string) int {
+	flags := flag.NewFlagSet("load-postgres", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	selection := addExportFlags(flags)
+	dsn := flags.String("dsn", os.Getenv("DATABASE_URL"), "PostgreSQL connection URL (default $DATABASE_URL)")
+	table := flags.String("table", "openintel_records", "Table receiving the records")
+	reload := flags.Bool("reload", false, "Replace days that were already loaded")
+	flags.Parse(args)
+
+	if *dsn == "" {
+		fmt.Println("❌ Error: --dsn or DATABASE_URL is required")
+		return exitUsage
+	}
+	if err := selection.prepare("dataset", "date"); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, *dsn)
+	if err != nil {
+		fmt.Println("❌ Error connecting to PostgreSQL:", err)
+		return exitFailed
+	}
+	defer conn.Close(ctx)
+
+	if err := createPostgresTables(ctx, conn, *table, selection); err != nil {
+		fmt.Println("❌ Error creating tables:", err)
+		return exitFailed
+	}
+
+	loaded, skipped, total := 0, 0, int64(0)
+	for _, day := range groupByDay(files) {
+		n, done, err := loadPostgresDay(ctx, conn, *table, selection, day, *reload)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error loading %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		if !done {
+			skipped++
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "🐘 Loaded %s %s: %d rows\n", day[0].Dataset, day[0].Date, n)
+		loaded++
+		total += n
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Loaded %d dataset/days (%d already loaded), %d rows into %s\n", loaded, skipped, total, *table)
+	return exitOK
+}
+
+// createPostgresTables creates the record table, its per-day index and the
+// table tracking loaded days
+func createPostgresTables(ctx context.Context, conn *pgx.Conn, table string, selection *exportSelection) error {
+	columns := make([]string, len(selection.columns))
+	for i, c := range selection.columns {
+		columns[i] = pgx.Identifier{c.Name}.Sanitize() + " " + postgresTypes[c.Kind]
+	}
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", pgx.Identifier{table}.Sanitize(), strings.Join(columns, ", ")),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (dataset, date)",
+			pgx.Identifier{table + "_day_idx"}.Sanitize(), pgx.Identifier{table}.Sanitize()),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (dataset text NOT NULL, date date NOT NULL, rows bigint NOT NULL, loaded_at timestamptz NOT NULL DEFAULT now(), PRIMARY KEY (dataset, date))",
+			pgx.Identifier{table + "_loads"}.Sanitize()),
+	}
+	for _, statement := range statements {
+		if _, err := conn.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPostgresDay copies one dataset/day inside a transaction together with
+// its entry in the loads table; it reports false when the day was already
+// loaded and reload is not set
+func loadPostgresDay(ctx context.Context, conn *pgx.Conn, table string, selection *exportSelection, files []archiveFile, reload bool) (int64, bool, error) {
+	dataset := files[0].Dataset
+	date, err := time.Parse(dateLayout, files[0].Date)
+	if err != nil {
+		return 0, false, err
+	}
+	loads := pgx.Identifier{table + "_loads"}.Sanitize()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+loads+" WHERE dataset = $1 AND date = $2)", dataset, date).Scan(&exists)
+	if err != nil {
+		return 0, false, err
+	}
+	if exists && !reload {
+		return 0, false, nil
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM "+pgx.Identifier{table}.Sanitize()+" WHERE dataset = $1 AND date = $2", dataset, date); err != nil {
+		return 0, false, err
+	}
+
+	// Records stream from the scan straight into COPY
+	rows := make(chan []any, 1024)
+	scanErr := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() {
+		defer close(rows)
+		scanErr <- scanRecords(files, nil, func(r *record) error {
+			if !selection.includes(r) {
+				return nil
+			}
+			values := selection.values(r)
+			for i, c := range selection.columns {
+				if c.Kind == "date" {
+					values[i] = date
+				}
+			}
+			select {
+			case rows <- values:
+				return nil
+			case <-stop:
+				return errStopScan
+			}
+		})
+	}()
+
+	n, err := tx.CopyFrom(ctx, pgx.Identifier{table}, selection.names(), pgx.CopyFromFunc(func() ([]any, error) {
+		values, ok := <-rows
+		if !ok {
+			return nil, nil
+		}
+		return values, nil
+	}))
+	close(stop)
+	for range rows {
+	}
+	if scanned := <-scanErr; err == nil && scanned != nil && !errors.Is(scanned, errStopScan) {
+		err = scanned
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO "+loads+" (dataset, date, rows) VALUES ($1, $2, $3) ON CONFLICT (dataset, date) DO UPDATE SET rows = EXCLUDED.rows, loaded_at = now()",
+		dataset, date, n)
+	if err != nil {
+		return 0, false, err
+	}
+	return n, true, tx.Commit(ctx)
+}
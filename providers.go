@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dnsProviders maps name server domains to the DNS provider operating them;
+// servers of any other domain are attributed to their registrable domain
+var dnsProviders = []struct {
+	suffix   string
+	provider string
+}{
+	{"cloudflare.com.", "Cloudflare"},
+	{"awsdns-", "Amazon Route 53"},
+	{"azure-dns.", "Azure DNS"},
+	{"googledomains.com.", "Google"},
+	{"google.com.", "Google"},
+	{"domaincontrol.com.", "GoDaddy"},
+	{"registrar-servers.com.", "Namecheap"},
+	{"nsone.net.", "NS1"},
+	{"dynect.net.", "Oracle Dyn"},
+	{"ultradns.", "UltraDNS"},
+	{"akam.net.", "Akamai"},
+	{"dnsmadeeasy.com.", "DNS Made Easy"},
+	{"hetzner.com.", "Hetzner"},
+	{"ovh.net.", "OVH"},
+}
+
+// nsProvider derives the DNS provider of a name server host name
+func nsProvider(ns string) string {
+	ns = strings.ToLower(ns)
+	for _, p := range dnsProviders {
+		if strings.HasSuffix(p.suffix, ".") {
+			if strings.HasSuffix(ns, "."+p.suffix) || ns == p.suffix {
+				return p.provider
+			}
+		} else if strings.Contains(ns, p.suffix) {
+			return p.provider
+		}
+	}
+
+	return registrableDomain(ns)
+}
+
+// runProviders reports the market share of name servers or DNS providers
+// per day and dataset
+func runProviders(args []string) int {
+	flags := flag.NewFlagSet("providers", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	by := flags.String("by", "provider", "Group domains by authoritative \"ns\" or derived \"provider\"")
+	limit := flags.Int("top", 10, "Entries reported per day and dataset (0 for all)")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if *by != "ns" && *by != "provider" {
+		fmt.Println("❌ Error: --by must be ns or provider")
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	// dataset/day -> group -> domains
+	groups := make(map[[2]string]map[string]map[string]bool)
+	err = scanRecords(files, nil, func(r *record) error {
+		if r.ResponseType != "NS" || r.NSAddress == "" {
+			return nil
+		}
+		key := [2]string{r.Date, r.Dataset}
+		if groups[key] == nil {
+			groups[key] = make(map[string]map[string]bool)
+		}
+
+		group := strings.ToLower(r.NSAddress)
+		if *by == "provider" {
+			group = nsProvider(group)
+		}
+		if groups[key][group] == nil {
+			groups[key][group] = make(map[string]bool)
+		}
+		groups[key][group][strings.ToLower(r.QueryName)] = true
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+
+	keys := make([][2]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	var rows [][]string
+	for _, key := range keys {
+		// Share is relative to every domain with NS records that day
+		domains := make(map[string]bool)
+		for _, members := range groups[key] {
+			for domain := range members {
+				domains[domain] = true
+			}
+		}
+
+		names := make([]string, 0, len(groups[key]))
+		for name := range groups[key] {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := len(groups[key][names[i]]), len(groups[key][names[j]])
+			if a != b {
+				return a > b
+			}
+			return names[i] < names[j]
+		})
+		if *limit > 0 && len(names) > *limit {
+			names = names[:*limit]
+		}
+
+		for _, name := range names {
+			count := len(groups[key][name])
+			rows = append(rows, []string{key[0], key[1], name, strconv.Itoa(count), percent(count, len(domains))})
+		}
+	}
+
+	if err := writeTable(*format, []string{"date", "dataset", *by, "domains", "share"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	proxyURL   string // Proxy of every request, HTTP(S) or SOCKS5
+	httpProxy  string // Proxy of http:// requests, overriding proxyURL
+	httpsProxy string // Proxy of https:// requests, overriding proxyURL
+	noProxy    string // Hosts reached without proxy, as in NO_PROXY
+	proxyAuth  string // USER:PASSWORD for proxy URLs without credentials
+	proxyList  string // File of proxies to rotate requests across
+)
+
+// addProxyFlags registers the proxy flags of the commands that talk to the
+// archive
+func addProxyFlags(flags *flag.FlagSet) {
+	flags.StringVar(&proxyURL, "proxy", "", "Proxy URL, http://, https://, socks5:// or socks5h:// (optional)")
+	flags.StringVar(&httpProxy, "http-proxy", "", "Proxy of http:// requests, overriding -proxy and $HTTP_PROXY (optional)")
+	flags.StringVar(&httpsProxy, "https-proxy", "", "Proxy of https:// requests, overriding -proxy and $HTTPS_PROXY (optional)")
+	flags.StringVar(&noProxy, "no-proxy", "", "Comma-separated hosts, domains and CIDRs reached without proxy (default $NO_PROXY)")
+	flags.StringVar(&proxyAuth, "proxy-auth", "", "Proxy credentials as USER:PASSWORD, for proxy URLs without any (default $PROXY_AUTH)")
+	flags.StringVar(&proxyList, "proxy-list", "", "File of proxy URLs, one per line, to rotate requests across (optional)")
+}
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// proxySettings returns the proxy function and the dialer of the transport.
+// The flags override the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables; a
+// SOCKS5 -proxy replaces the dialer so it tunnels every connection except
+// those to no-proxy hosts. A -proxy-list replaces all of them with the pool,
+// and -tor with Tor, environment included.
+func proxySettings(dialer *familyDialer) (func(*http.Request) (*url.URL, error), dialFunc, error) {
+	if torMode {
+		proxyFunc, err := torSettings(dialer)
+		return proxyFunc, dialer.DialContext, err
+	}
+	if proxyAuth == "" {
+		proxyAuth = os.Getenv("PROXY_AUTH")
+	}
+	config := httpproxy.FromEnvironment()
+	if noProxy != "" {
+		config.NoProxy = noProxy
+	}
+
+	if proxyList != "" {
+		if proxyURL != "" || httpProxy != "" || httpsProxy != "" {
+			return nil, nil, errors.New("-proxy-list cannot be combined with -proxy, -http-proxy or -https-proxy")
+		}
+		pool, err := loadProxyPool(proxyList)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool.bypass = (&httpproxy.Config{HTTPProxy: "pool", HTTPSProxy: "pool", NoProxy: config.NoProxy}).ProxyFunc()
+		proxies = pool
+		fmt.Printf("🛡️ Rotating requests across %d proxies from %s\n", len(pool.proxies), proxyList)
+		return pool.proxyFor, dialer.DialContext, nil
+	}
+
+	var socks *url.URL
+	if proxyURL != "" {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if u.Scheme == "socks5" || u.Scheme == "socks5h" {
+			socks = u
+			config.HTTPProxy, config.HTTPSProxy = "", ""
+		} else {
+			config.HTTPProxy, config.HTTPSProxy = u.String(), u.String()
+		}
+		fmt.Println("🛡️ Using proxy:", u.Redacted())
+	}
+	for _, p := range []struct {
+		flag, value string
+		field       *string
+	}{{"http", httpProxy, &config.HTTPProxy}, {"https", httpsProxy, &config.HTTPSProxy}} {
+		if p.value == "" {
+			continue
+		}
+		u, err := parseProxyURL(p.value)
+		if err != nil {
+			return nil, nil, err
+		}
+		*p.field = u.String()
+		fmt.Printf("🛡️ Using proxy for %s:// requests: %s\n", p.flag, u.Redacted())
+	}
+	// Credentials also apply to proxies taken from the environment
+	for _, field := range []*string{&config.HTTPProxy, &config.HTTPSProxy} {
+		if *field == "" {
+			continue
+		}
+		u, err := parseProxyURL(*field)
+		if err != nil {
+			return nil, nil, err
+		}
+		*field = u.String()
+	}
+
+	forURL := config.ProxyFunc()
+	proxyFunc := func(req *http.Request) (*url.URL, error) {
+		return forURL(req.URL)
+	}
+	if socks == nil {
+		return proxyFunc, dialer.DialContext, nil
+	}
+
+	tunnel, err := socksDialer(socks, dialer)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Ask the proxy function of a config that proxies everything whether
+	// an address is exempted by NO_PROXY
+	bypass := (&httpproxy.Config{HTTPProxy: "socks", NoProxy: config.NoProxy}).ProxyFunc()
+	return nil, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if via, err := bypass(&url.URL{Scheme: "http", Host: addr}); err == nil && via == nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return tunnel(ctx, network, addr)
+	}, nil
+}
+
+// parseProxyURL parses a proxy URL, checking its scheme and adding the
+// -proxy-auth credentials when it has none
+func parseProxyURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		// As with HTTP_PROXY, a bare host:port is an HTTP proxy
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected http, https, socks5 or socks5h)", u.Scheme)
+	}
+	if u.User == nil && proxyAuth != "" {
+		user, password, hasPassword := strings.Cut(proxyAuth, ":")
+		if hasPassword {
+			u.User = url.UserPassword(user, password)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+	return u, nil
+}
+
+// socksDialer returns a dial function tunneling every connection through a
+// SOCKS5 proxy. With socks5:// host names are resolved locally and the proxy
+// gets addresses; with socks5h:// the proxy resolves them, so no DNS query
+// leaves the machine.
+func socksDialer(proxyURL *url.URL, forward *familyDialer) (dialFunc, error) {
+	dialer, err := proxy.FromURL(proxyURL, forward)
+	if err != nil {
+		return nil, err
+	}
+	socks, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("%s: SOCKS dialer does not support contexts", proxyURL.Redacted())
+	}
+	if proxyURL.Scheme == "socks5h" {
+		return socks.DialContext, nil
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := forward.lookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return socks.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+	}, nil
+}
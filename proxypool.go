@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyFailures is the number of consecutive failures that eject a proxy
+	proxyFailures = 3
+	// proxyCooldown is how long a proxy is first ejected for; it doubles
+	// every time the proxy fails again after coming back, up to
+	// proxyMaxCooldown
+	proxyCooldown    = time.Minute
+	proxyMaxCooldown = 15 * time.Minute
+)
+
+// proxies is the pool loaded from -proxy-list, nil without one
+var proxies *proxyPool
+
+// poolProxy is one proxy of the pool and its health
+type poolProxy struct {
+	url          *url.URL
+	failures     int // consecutive failures
+	cooldown     time.Duration
+	ejectedUntil time.Time
+}
+
+// proxyPool hands out its proxies in turn, skipping the ones ejected after
+// failing repeatedly. An ejected proxy gets one request again once its
+// cooldown is over: a success puts it back in rotation, a failure ejects it
+// for twice as long.
+type proxyPool struct {
+	mu      sync.Mutex
+	proxies []*poolProxy
+	next    int
+	bypass  func(*url.URL) (*url.URL, error) // reports nil for no-proxy hosts
+}
+
+// loadProxyPool reads one proxy URL per line; blank lines and lines
+// starting with '#' are ignored
+func loadProxyPool(path string) (*proxyPool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pool := &proxyPool{}
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := parseProxyURL(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d: %w", path, lineNum, err)
+		}
+		pool.proxies = append(pool.proxies, &poolProxy{url: u})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pool.proxies) == 0 {
+		return nil, errors.New("no proxies found in " + path)
+	}
+	return pool, nil
+}
+
+// pick returns the next proxy in rotation that the request has not tried
+// yet; when every such proxy is ejected, the one due back first is tried
+// rather than stalling the crawl
+func (p *proxyPool) pick(tried map[*poolProxy]bool) *poolProxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for i := range p.proxies {
+		candidate := p.proxies[(p.next+i)%len(p.proxies)]
+		if !tried[candidate] && !now.Before(candidate.ejectedUntil) {
+			p.next = (p.next + i + 1) % len(p.proxies)
+			return candidate
+		}
+	}
+	var soonest *poolProxy
+	for _, candidate := range p.proxies {
+		if !tried[candidate] && (soonest == nil || candidate.ejectedUntil.Before(soonest.ejectedUntil)) {
+			soonest = candidate
+		}
+	}
+	return soonest
+}
+
+// report records the outcome of a request sent through a proxy: a
+// transport error or a refused authentication counts as a failure
+func (p *proxyPool) report(proxy *poolProxy, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		if proxy.failures >= proxyFailures {
+			fmt.Println("🔌 Proxy back in rotation:", proxy.url.Redacted())
+		}
+		proxy.failures, proxy.cooldown = 0, 0
+		return
+	}
+
+	proxy.failures++
+	if proxy.failures >= proxyFailures && !time.Now().Before(proxy.ejectedUntil) {
+		proxy.cooldown = min(max(proxyCooldown, 2*proxy.cooldown), proxyMaxCooldown)
+		proxy.ejectedUntil = time.Now().Add(proxy.cooldown)
+		fmt.Printf("🔌 Ejected proxy %s after %d failures (%v), retrying it in %s\n",
+			proxy.url.Redacted(), proxy.failures, err, proxy.cooldown)
+	}
+}
+
+// poolProxyKey is the context key of the proxy chosen for a request
+type poolProxyKey struct{}
+
+// proxyFor implements http.Transport.Proxy for the proxy chosen by
+// poolTransport
+func (p *proxyPool) proxyFor(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(poolProxyKey{}).(*poolProxy); ok {
+		return proxy.url, nil
+	}
+	return nil, nil
+}
+
+// poolTransport sends every request through the next proxy of the pool and
+// reports how it went; no-proxy hosts are reached directly. A request that
+// fails to get through is tried again through the next proxy, once per
+// proxy of the pool.
+type poolTransport struct {
+	next http.RoundTripper
+	pool *proxyPool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if via, err := t.pool.bypass(req.URL); err == nil && via == nil {
+		return t.next.RoundTrip(req)
+	}
+	// Only requests without a body can be sent again as they are; the
+	// crawler sends nothing else
+	attempts := 1
+	if req.Body == nil || req.Body == http.NoBody {
+		attempts = len(t.pool.proxies)
+	}
+	tried := make(map[*poolProxy]bool)
+	for attempt := 1; ; attempt++ {
+		proxy := t.pool.pick(tried)
+		tried[proxy] = true
+		resp, err := t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), poolProxyKey{}, proxy)))
+		// Requests canceled by the crawl say nothing about the proxy
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		failure := err
+		if err == nil && resp.StatusCode == http.StatusProxyAuthRequired {
+			failure = errors.New(resp.Status)
+		}
+		t.pool.report(proxy, failure)
+		if err == nil || attempt >= attempts {
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	pslURL  = "https://publicsuffix.org/list/public_suffix_list.dat"
+	pslFile = "public_suffix_list.dat"
+)
+
+// suffixList holds the rules of a Public Suffix List file; nil means the
+// list compiled into golang.org/x/net/publicsuffix is used
+var suffixList *publicSuffixList
+
+// publicSuffixList is a parsed Public Suffix List
+type publicSuffixList struct {
+	rules      map[string]bool // "co.uk", "*.ck"
+	exceptions map[string]bool // "www.ck" for "!www.ck"
+}
+
+// loadSuffixList reads a Public Suffix List in the publicsuffix.org format
+func loadSuffixList(path string) (*publicSuffixList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &publicSuffixList{rules: make(map[string]bool), exceptions: make(map[string]bool)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		// Rules end at the first whitespace
+		line = strings.ToLower(strings.Fields(line)[0])
+		if rule, ok := strings.CutPrefix(line, "!"); ok {
+			list.exceptions[rule] = true
+			continue
+		}
+		list.rules[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(list.rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules found", path)
+	}
+	return list, nil
+}
+
+// registrable returns the public suffix plus one label of a host, following
+// the publicsuffix.org algorithm with its implicit "*" rule
+func (l *publicSuffixList) registrable(host string) (string, bool) {
+	labels := strings.Split(host, ".")
+	suffix := len(labels) - 1 // labels[suffix:] is the public suffix
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if l.exceptions[candidate] {
+			suffix = i + 1
+			break
+		}
+		wildcard := i+1 < len(labels) && l.rules["*."+strings.Join(labels[i+1:], ".")]
+		if l.rules[candidate] || wildcard {
+			suffix = i
+			break
+		}
+	}
+	if suffix == 0 {
+		return "", false
+	}
+	return strings.Join(labels[suffix-1:], "."), true
+}
+
+// registrableDomain returns the registrable domain of a host name, or the
+// host itself when it has none. It uses the list loaded by useSuffixList,
+// or the bundled one.
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if suffixList != nil {
+		if apex, ok := suffixList.registrable(host); ok {
+			return apex
+		}
+		return host
+	}
+	if apex, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return apex
+	}
+	return host
+}
+
+// useSuffixList makes analyses use <dir>/public_suffix_list.dat when it
+// exists, downloading a fresh copy first when refresh is set
+func useSuffixList(refresh bool) error {
+	path := filepath.Join(downloadDir, pslFile)
+	if refresh {
+		if err := downloadSuffixList(path); err != nil {
+			return fmt.Errorf("refreshing the public suffix list: %w", err)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil // keep the bundled list
+	}
+
+	list, err := loadSuffixList(path)
+	if err != nil {
+		return err
+	}
+	suffixList = list
+	return nil
+}
+
+// downloadSuffixList fetches the current list from publicsuffix.org
+func downloadSuffixList(path string) error {
+	if httpClient == nil {
+		if err := configureHTTPClient(); err != nil {
+			return err
+		}
+	}
+	resp, err := httpClient.Get(pslURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if _, err := loadSuffixList(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "🔄 Public suffix list updated:", path)
+	return os.Rename(tmp, path)
+}
+
+// runPSL refreshes the cached public suffix list or shows the registrable
+// domain of host names
+func runPSL(args []string) int {
+	flags := flag.NewFlagSet("psl", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	refresh := flags.Bool("refresh", false, "Download the current list from publicsuffix.org")
+	flags.Parse(args)
+
+	if err := useSuffixList(*refresh); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+	if suffixList == nil {
+		fmt.Fprintln(os.Stderr, "📦 Using the bundled public suffix list")
+	}
+	for _, host := range flags.Args() {
+		fmt.Printf("%s\t%s\n", host, registrableDomain(host))
+	}
+	return exitOK
+}
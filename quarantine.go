@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const quarantineDir = "quarantine"
+
+// quarantine moves a file that failed validation out of the archive and
+// writes a reason file next to it
+func quarantine(path, sourceURL string, reason error) {
+	fmt.Printf("🚫 Quarantining %s: %v\n", path, reason)
+
+	dir := filepath.Join(downloadDir, quarantineDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		fmt.Println("❌ Error creating quarantine directory:", err)
+		os.Remove(path)
+		return
+	}
+
+	// Prefix with a timestamp so repeated failures of one file are all kept
+	now := time.Now().UTC()
+	dest := filepath.Join(dir, now.Format("20060102T150405.000000000Z")+"-"+filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		fmt.Println("❌ Error quarantining file:", err)
+		os.Remove(path)
+		return
+	}
+
+	note := fmt.Sprintf("file: %s\nsource: %s\nreason: %v\ntime: %s\n",
+		path, sourceURL, reason, now.Format(time.RFC3339))
+	if err := os.WriteFile(dest+".reason", []byte(note), 0o644); err != nil {
+		fmt.Println("❌ Error writing quarantine reason:", err)
+	}
+}
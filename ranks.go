@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rankKey identifies the rank of a domain in one toplist on one day
+type rankKey struct {
+	Domain, Date, Dataset string
+}
+
+// runRanks tracks the toplist rank of domains over time and across datasets
+func runRanks(args []string) int {
+	flags := flag.NewFlagSet("ranks", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	listsDir := flags.String("lists", "", "Directory of <dataset>/<YYYY-MM-DD>.csv toplists in rank,domain format")
+	wide := flags.Bool("wide", false, "One column per dataset instead of one row per dataset")
+	format := flags.String("format", "csv", "Output format: "+strings.Join(reportFormats, ", "))
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("❌ Error: usage is ranks [options] <domain>...")
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+	wanted := make(map[string]bool)
+	for _, arg := range flags.Args() {
+		wanted[normalizeDomain(arg)] = true
+	}
+
+	ranks := make(map[rankKey]int64)
+	observe := func(key rankKey, rank int64) {
+		if current, ok := ranks[key]; !ok || rank < current {
+			ranks[key] = rank
+		}
+	}
+
+	if *listsDir != "" {
+		if err := filter.validate(); err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+		if err := readRankLists(*listsDir, filter, wanted, observe); err != nil {
+			fmt.Println("❌ Error reading toplists:", err)
+			return exitFailed
+		}
+	} else {
+		files, err := filter.files()
+		if err != nil {
+			fmt.Println("❌ Error:", err)
+			return exitUsage
+		}
+		err = scanRecords(files, nil, func(r *record) error {
+			if name := strings.ToLower(r.QueryName); wanted[name] && r.Rank > 0 {
+				observe(rankKey{name, r.Date, r.Dataset}, r.Rank)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+	}
+	if len(ranks) == 0 {
+		fmt.Fprintln(os.Stderr, "⚠️  No rank information found; the files may not carry a rank column, try --lists")
+		return exitFailed
+	}
+
+	keys := make([]rankKey, 0, len(ranks))
+	for key := range ranks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Dataset < b.Dataset
+	})
+
+	var headers []string
+	var rows [][]string
+	if *wide {
+		headers = append([]string{"domain", "date"}, datasets...)
+		for _, key := range keys {
+			if len(rows) > 0 && rows[len(rows)-1][0] == key.Domain && rows[len(rows)-1][1] == key.Date {
+				continue
+			}
+			row := []string{key.Domain, key.Date}
+			for _, dataset := range datasets {
+				rank := ""
+				if r, ok := ranks[rankKey{key.Domain, key.Date, dataset}]; ok {
+					rank = strconv.FormatInt(r, 10)
+				}
+				row = append(row, rank)
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		// change is positive when the domain climbed since its previous
+		// observation in the same dataset
+		headers = []string{"domain", "date", "dataset", "rank", "change"}
+		previous := make(map[[2]string]int64)
+		for _, key := range keys {
+			rank := ranks[key]
+			change := ""
+			if before, ok := previous[[2]string{key.Domain, key.Dataset}]; ok {
+				change = strconv.FormatInt(before-rank, 10)
+			}
+			previous[[2]string{key.Domain, key.Dataset}] = rank
+			rows = append(rows, []string{key.Domain, key.Date, key.Dataset, strconv.FormatInt(rank, 10), change})
+		}
+	}
+
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// readRankLists reads the ranks of the wanted domains from toplist CSV files
+// named <dir>/<dataset>/<YYYY-MM-DD>.csv, as published by Tranco, Umbrella and Alexa
+func readRankLists(dir string, filter *archiveFilter, wanted map[string]bool, observe func(rankKey, int64)) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.csv"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		dataset := filepath.Base(filepath.Dir(path))
+		date := strings.TrimSuffix(filepath.Base(path), ".csv")
+		if !filter.includes(dataset, date) {
+			continue
+		}
+		if err := readRankList(path, func(rank int64, domain string) {
+			if name := normalizeDomain(domain); wanted[name] {
+				observe(rankKey{name, date, dataset}, rank)
+			}
+		}); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// readRankList streams the rank,domain lines of one toplist file
+func readRankList(path string, fn func(rank int64, domain string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		rank, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			continue // header line
+		}
+		fn(rank, fields[1])
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// record is one resource record of an OpenIntel measurement, tagged with
+// the dataset and day of the file it was read from
+type record struct {
+	Dataset      string `json:"dataset"`
+	Date         string `json:"date"`
+	QueryName    string `json:"query_name"`
+	QueryType    string `json:"query_type,omitempty"`
+	ResponseName string `json:"response_name,omitempty"`
+	ResponseType string `json:"response_type,omitempty"`
+	TTL          int64  `json:"response_ttl,omitempty"`
+	Timestamp    int64  `json:"timestamp,omitempty"`
+	StatusCode   int64  `json:"status_code,omitempty"`
+	IP4Address   string `json:"ip4_address,omitempty"`
+	IP6Address   string `json:"ip6_address,omitempty"`
+	CNAMEName    string `json:"cname_name,omitempty"`
+	DNAMEName    string `json:"dname_name,omitempty"`
+	MXAddress    string `json:"mx_address,omitempty"`
+	MXPreference int64  `json:"mx_preference,omitempty"`
+	NSAddress    string `json:"ns_address,omitempty"`
+	TXTText      string `json:"txt_text,omitempty"`
+	Country      string `json:"country,omitempty"`
+	AS           string `json:"as,omitempty"`
+	ASFull       string `json:"as_full,omitempty"`
+	Rank         int64  `json:"rank,omitempty"`
+
+	DSKeyTag         int64  `json:"ds_key_tag,omitempty"`
+	DSAlgorithm      int64  `json:"ds_algorithm,omitempty"`
+	DSDigestType     int64  `json:"ds_digest_type,omitempty"`
+	DNSKEYFlags      int64  `json:"dnskey_flags,omitempty"`
+	DNSKEYAlgorithm  int64  `json:"dnskey_algorithm,omitempty"`
+	RRSIGTypeCovered string `json:"rrsig_type_covered,omitempty"`
+	RRSIGAlgorithm   int64  `json:"rrsig_algorithm,omitempty"`
+	RRSIGKeyTag      int64  `json:"rrsig_key_tag,omitempty"`
+	RRSIGSignerName  string `json:"rrsig_signer_name,omitempty"`
+	RRSIGExpiration  int64  `json:"rrsig_signature_expiration,omitempty"`
+
+	CAAFlags int64  `json:"caa_flags,omitempty"`
+	CAATag   string `json:"caa_tag,omitempty"`
+	CAAValue string `json:"caa_value,omitempty"`
+
+	// Filled by the enrichment databases given on the command line
+	GeoCountry   string `json:"geo_country,omitempty"`
+	GeoCity      string `json:"geo_city,omitempty"`
+	OriginASN    uint32 `json:"origin_asn,omitempty"`
+	OriginASName string `json:"origin_as_name,omitempty"`
+}
+
+// recordColumns maps the OpenIntel columns we read to the record fields they fill
+var recordColumns = map[string]func(r *record, v parquet.Value){
+	"query_name":    func(r *record, v parquet.Value) { r.QueryName = valueString(v) },
+	"query_type":    func(r *record, v parquet.Value) { r.QueryType = valueString(v) },
+	"response_name": func(r *record, v parquet.Value) { r.ResponseName = valueString(v) },
+	"response_type": func(r *record, v parquet.Value) { r.ResponseType = valueString(v) },
+	"response_ttl":  func(r *record, v parquet.Value) { r.TTL = valueInt(v) },
+	"timestamp":     func(r *record, v parquet.Value) { r.Timestamp = valueInt(v) },
+	"status_code":   func(r *record, v parquet.Value) { r.StatusCode = valueInt(v) },
+	"ip4_address":   func(r *record, v parquet.Value) { r.IP4Address = valueString(v) },
+	"ip6_address":   func(r *record, v parquet.Value) { r.IP6Address = valueString(v) },
+	"cname_name":    func(r *record, v parquet.Value) { r.CNAMEName = valueString(v) },
+	"dname_name":    func(r *record, v parquet.Value) { r.DNAMEName = valueString(v) },
+	"mx_address":    func(r *record, v parquet.Value) { r.MXAddress = valueString(v) },
+	"mx_preference": func(r *record, v parquet.Value) { r.MXPreference = valueInt(v) },
+	"ns_address":    func(r *record, v parquet.Value) { r.NSAddress = valueString(v) },
+	"txt_text":      func(r *record, v parquet.Value) { r.TXTText = valueString(v) },
+	"country":       func(r *record, v parquet.Value) { r.Country = valueString(v) },
+	"as":            func(r *record, v parquet.Value) { r.AS = valueString(v) },
+	"as_full":       func(r *record, v parquet.Value) { r.ASFull = valueString(v) },
+	"rank":          func(r *record, v parquet.Value) { r.Rank = valueInt(v) },
+
+	"ds_key_tag":                 func(r *record, v parquet.Value) { r.DSKeyTag = valueInt(v) },
+	"ds_algorithm":               func(r *record, v parquet.Value) { r.DSAlgorithm = valueInt(v) },
+	"ds_digest_type":             func(r *record, v parquet.Value) { r.DSDigestType = valueInt(v) },
+	"dnskey_flags":               func(r *record, v parquet.Value) { r.DNSKEYFlags = valueInt(v) },
+	"dnskey_algorithm":           func(r *record, v parquet.Value) { r.DNSKEYAlgorithm = valueInt(v) },
+	"rrsig_type_covered":         func(r *record, v parquet.Value) { r.RRSIGTypeCovered = valueString(v) },
+	"rrsig_algorithm":            func(r *record, v parquet.Value) { r.RRSIGAlgorithm = valueInt(v) },
+	"rrsig_key_tag":              func(r *record, v parquet.Value) { r.RRSIGKeyTag = valueInt(v) },
+	"rrsig_signer_name":          func(r *record, v parquet.Value) { r.RRSIGSignerName = valueString(v) },
+	"rrsig_signature_expiration": func(r *record, v parquet.Value) { r.RRSIGExpiration = valueInt(v) },
+
+	"caa_flags": func(r *record, v parquet.Value) { r.CAAFlags = valueInt(v) },
+	"caa_tag":   func(r *record, v parquet.Value) { r.CAATag = valueString(v) },
+	"caa_value": func(r *record, v parquet.Value) { r.CAAValue = valueString(v) },
+}
+
+// errStopScan can be returned by a scan callback to end the scan early
+var errStopScan = errors.New("stop scan")
+
+// rowGroupStats exposes the footer statistics of one row group so scans can
+// skip row groups that cannot contain what they look for
+type rowGroupStats struct {
+	schema   *parquet.Schema
+	rowGroup parquet.RowGroup
+	meta     *format.RowGroup
+}
+
+// bounds returns the minimum and maximum value of a column, when recorded
+func (s rowGroupStats) bounds(column string) (min, max string, ok bool) {
+	leaf, found := s.schema.Lookup(column)
+	if !found || leaf.ColumnIndex >= len(s.meta.Columns) {
+		return "", "", false
+	}
+	stats := s.meta.Columns[leaf.ColumnIndex].MetaData.Statistics
+	if stats.MinValue == nil || stats.MaxValue == nil {
+		return "", "", false
+	}
+	return string(stats.MinValue), string(stats.MaxValue), true
+}
+
+// mayContain reports whether a column can hold the value, using the column
+// bounds and bloom filter when the file has them
+func (s rowGroupStats) mayContain(column, value string) bool {
+	if min, max, ok := s.bounds(column); ok && (value < min || value > max) {
+		return false
+	}
+
+	leaf, found := s.schema.Lookup(column)
+	if !found {
+		return false
+	}
+	chunks := s.rowGroup.ColumnChunks()
+	if leaf.ColumnIndex < len(chunks) {
+		if filter := chunks[leaf.ColumnIndex].BloomFilter(); filter != nil {
+			if present, err := filter.Check(parquet.ValueOf(value)); err == nil && !present {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// scanRecords streams the records of the given files to fn, one row group at
+// a time. When prune is not nil, row groups for which it returns true are
+// skipped without being read. With several parse workers the row groups are
+// decoded in parallel, and fn still sees the records in file order.
+func scanRecords(files []archiveFile, prune func(stats rowGroupStats) bool, fn func(r *record) error) error {
+	if parseWorkers > 1 {
+		return scanParallel(files, prune, fn)
+	}
+	for _, file := range files {
+		err := scanFile(file, prune, fn)
+		if errors.Is(err, errStopScan) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// scanFile reads the known OpenIntel columns of a single parquet file
+func scanFile(file archiveFile, prune func(stats rowGroupStats) bool, fn func(r *record) error) error {
+	src, err := openScanSource(file)
+	if err != nil {
+		return err
+	}
+	defer src.f.Close()
+
+	for _, rowGroup := range src.rowGroups(prune) {
+		if err := scanRowGroup(rowGroup, file, src.setters, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSource is a parquet file opened for scanning, with the conversion to
+// the known OpenIntel columns
+type scanSource struct {
+	f       *os.File
+	pf      *parquet.File
+	conv    parquet.Conversion
+	setters []func(*record, parquet.Value)
+}
+
+// openScanSource opens a parquet file and projects its schema
+func openScanSource(file archiveFile) (src *scanSource, err error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	pf, err := parquet.OpenFile(f, info.Size(), parquet.SkipPageIndex(true), parquet.ReadBufferSize(scanReadBuffer))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the columns we know are read; the others are never loaded
+	target, setters, err := projectSchema(pf.Schema())
+	if err != nil {
+		return nil, err
+	}
+	conv, err := parquet.Convert(target, pf.Schema())
+	if err != nil {
+		return nil, err
+	}
+	return &scanSource{f: f, pf: pf, conv: conv, setters: setters}, nil
+}
+
+// rowGroups returns the converted row groups of the file that prune keeps
+func (s *scanSource) rowGroups(prune func(stats rowGroupStats) bool) []parquet.RowGroup {
+	var kept []parquet.RowGroup
+	metadata := s.pf.Metadata()
+	for i, rowGroup := range s.pf.RowGroups() {
+		if prune != nil && prune(rowGroupStats{schema: s.pf.Schema(), rowGroup: rowGroup, meta: &metadata.RowGroups[i]}) {
+			continue
+		}
+		kept = append(kept, parquet.ConvertRowGroup(rowGroup, s.conv))
+	}
+	return kept
+}
+
+// scanRowGroup decodes the rows of one row group into records
+func scanRowGroup(rowGroup parquet.RowGroup, file archiveFile, setters []func(*record, parquet.Value), fn func(r *record) error) error {
+	rows := rowGroup.Rows()
+	defer rows.Close()
+
+	buf := make([]parquet.Row, scanBatchRows)
+	for {
+		n, err := rows.ReadRows(buf)
+		for _, row := range buf[:n] {
+			rec := record{Dataset: file.Dataset, Date: file.Date}
+			for _, v := range row {
+				if column := v.Column(); column >= 0 && column < len(setters) && !v.IsNull() {
+					setters[column](&rec, v)
+				}
+			}
+			for _, enrich := range recordEnrichers {
+				enrich(&rec)
+			}
+			if err := fn(&rec); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// projectSchema builds a schema holding only the known columns of a file
+// and the setters indexed by their column index in that schema
+func projectSchema(schema *parquet.Schema) (*parquet.Schema, []func(*record, parquet.Value), error) {
+	group := parquet.Group{}
+	for _, field := range schema.Fields() {
+		if _, known := recordColumns[field.Name()]; known && field.Leaf() {
+			group[field.Name()] = field
+		}
+	}
+	if len(group) == 0 {
+		return nil, nil, errors.New("no OpenIntel columns found")
+	}
+
+	target := parquet.NewSchema("record", group)
+	setters := make([]func(*record, parquet.Value), len(group))
+	for name := range group {
+		leaf, _ := target.Lookup(name)
+		setters[leaf.ColumnIndex] = recordColumns[name]
+	}
+	return target, setters, nil
+}
+
+// valueString converts a parquet value to its string form
+func valueString(v parquet.Value) string {
+	switch v.Kind() {
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	case parquet.Int32:
+		return strconv.FormatInt(int64(v.Int32()), 10)
+	case parquet.Int64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case parquet.Boolean:
+		return strconv.FormatBool(v.Boolean())
+	case parquet.Float:
+		return strconv.FormatFloat(float64(v.Float()), 'g', -1, 32)
+	case parquet.Double:
+		return strconv.FormatFloat(v.Double(), 'g', -1, 64)
+	}
+	return v.String()
+}
+
+// valueInt converts a parquet value to an integer, zero when it has none
+func valueInt(v parquet.Value) int64 {
+	switch v.Kind() {
+	case parquet.Int32:
+		return int64(v.Int32())
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return int64(v.Float())
+	case parquet.Double:
+		return int64(v.Double())
+	case parquet.Boolean:
+		if v.Boolean() {
+			return 1
+		}
+		return 0
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		n, _ := strconv.ParseInt(string(v.ByteArray()), 10, 64)
+		return n
+	}
+	return 0
+}
+
+// Value returns the record data in presentation form, based on the response type
+func (r *record) Value() string {
+	switch r.ResponseType {
+	case "A":
+		return r.IP4Address
+	case "AAAA":
+		return r.IP6Address
+	case "CNAME":
+		return r.CNAMEName
+	case "DNAME":
+		return r.DNAMEName
+	case "MX":
+		return fmt.Sprintf("%d %s", r.MXPreference, r.MXAddress)
+	case "NS":
+		return r.NSAddress
+	case "TXT":
+		return r.TXTText
+	case "DS":
+		return fmt.Sprintf("%d %d %d", r.DSKeyTag, r.DSAlgorithm, r.DSDigestType)
+	case "DNSKEY":
+		return fmt.Sprintf("%d %d", r.DNSKEYFlags, r.DNSKEYAlgorithm)
+	case "RRSIG":
+		return fmt.Sprintf("%s %d %d %s", r.RRSIGTypeCovered, r.RRSIGAlgorithm, r.RRSIGKeyTag, r.RRSIGSignerName)
+	case "CAA":
+		return fmt.Sprintf("%d %s %q", r.CAAFlags, r.CAATag, r.CAAValue)
+	}
+	return ""
+}
+
+// normalizeDomain lower-cases a domain and gives it the trailing dot used by
+// OpenIntel query names
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), ".")) + "."
+}
+
+// matchesDomain reports whether a query name is the domain or, with
+// subdomains set, one of its subdomains; both must be normalized
+func matchesDomain(name, domain string, subdomains bool) bool {
+	if name == domain {
+		return true
+	}
+	return subdomains && strings.HasSuffix(name, "."+domain)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBatch is the number of arguments sent per pipelined SADD or HSET
+const redisBatch = 1000
+
+// runExportRedis loads the domains of each dataset/day into a Redis set, or
+// their addresses into a hash, for sub-millisecond membership checks:
+//
+//	<prefix>:<dataset>:<date>:domains  SET   domain
+//	<prefix>:<dataset>:<date>:ips      HASH  domain -> space-separated addresses
+//	<prefix>:<dataset>:latest          STRING newest exported date
+func runExportRedis(args []string) int {
+	flags := flag.NewFlagSet("export-redis", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	redisURL := flags.String("redis-url", os.Getenv("REDIS_URL"), "Redis URL, e.g. redis://localhost:6379/0 (default $REDIS_URL)")
+	prefix := flags.String("prefix", "openintel", "Prefix of the key names")
+	mode := flags.String("mode", "domains", "Export \"domains\" as sets or \"ips\" as domain-to-address hashes")
+	ttl := flags.Duration("ttl", 0, "Expire the exported keys after this long (default never)")
+	flags.Parse(args)
+
+	if *redisURL == "" {
+		fmt.Println("❌ Error: --redis-url or REDIS_URL is required")
+		return exitUsage
+	}
+	if *mode != "domains" && *mode != "ips" {
+		fmt.Println("❌ Error: --mode must be domains or ips")
+		return exitUsage
+	}
+	options, err := redis.ParseURL(*redisURL)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	client := redis.NewClient(options)
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err != nil {
+		fmt.Println("❌ Error connecting to Redis:", err)
+		return exitFailed
+	}
+
+	for _, day := range groupByDay(files) {
+		key := fmt.Sprintf("%s:%s:%s:%s", *prefix, day[0].Dataset, day[0].Date, *mode)
+
+		// domain -> addresses; only the keys are used for sets
+		domains := make(map[string]map[string]bool)
+		err := scanRecords(day, nil, func(r *record) error {
+			name := strings.TrimSuffix(strings.ToLower(r.QueryName), ".")
+			if name == "" {
+				return nil
+			}
+			if domains[name] == nil {
+				domains[name] = make(map[string]bool)
+			}
+			if address := r.IP4Address + r.IP6Address; address != "" {
+				domains[name][address] = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		if err := writeRedisDay(ctx, client, key, domains, *mode == "ips", *ttl); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error exporting %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		if err := advanceLatest(ctx, client, *prefix+":"+day[0].Dataset+":latest", day[0].Date); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error updating latest date:", err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "🧰 Exported %s %s: %d domains into %s\n", day[0].Dataset, day[0].Date, len(domains), key)
+	}
+	return exitOK
+}
+
+// writeRedisDay fills a temporary key and renames it over key, so readers
+// never see a partially written day
+func writeRedisDay(ctx context.Context, client *redis.Client, key string, domains map[string]map[string]bool, asHash bool, ttl time.Duration) error {
+	tmp := key + ":loading"
+	if err := client.Del(ctx, tmp).Err(); err != nil {
+		return err
+	}
+
+	pipe := client.Pipeline()
+	batch := make([]any, 0, redisBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if asHash {
+			pipe.HSet(ctx, tmp, batch...)
+		} else {
+			pipe.SAdd(ctx, tmp, batch...)
+		}
+		batch = make([]any, 0, redisBatch)
+	}
+	for name, addresses := range domains {
+		if !asHash {
+			batch = append(batch, name)
+		} else if len(addresses) > 0 {
+			batch = append(batch, name, strings.Join(sortedKeys(addresses), " "))
+		}
+		if len(batch) >= redisBatch {
+			flush()
+		}
+	}
+	flush()
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	exists, err := client.Exists(ctx, tmp).Result()
+	if err != nil || exists == 0 {
+		// Nothing to publish for this day; drop any stale content
+		if err == nil {
+			err = client.Del(ctx, key).Err()
+		}
+		return err
+	}
+	if err := client.Rename(ctx, tmp, key).Err(); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return client.Expire(ctx, key, ttl).Err()
+	}
+	return nil
+}
+
+// advanceLatest stores date under key unless a newer date is already there
+func advanceLatest(ctx context.Context, client *redis.Client, key, date string) error {
+	current, err := client.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if current >= date {
+		return nil
+	}
+	return client.Set(ctx, key, date, 0).Err()
+}
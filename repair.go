@@ -0,0 +1,268 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// remoteListing is a listing page together with the files it links to
+type remoteListing struct {
+	Page  listing
+	Links []string
+}
+
+// runRepair validates every file of an existing archive, rebuilds the
+// manifests from the remote index and writes a worklist of the files that
+// are broken or missing locally
+func runRepair(args []string) int {
+	flags := flag.NewFlagSet("repair", flag.ExitOnError)
+	startYear := flags.Int("start-year", defaultYear, "Start year of the remote index to compare (minimum 2016)")
+	endYear := flags.Int("end-year", maxYear, "End year of the remote index to compare (maximum 2025)")
+	datesFile := flags.String("dates-file", "", "File with specific dates (YYYY-MM-DD, one per line) to compare")
+	addProxyFlags(flags)
+	addTLSFlags(flags)
+	addDNSFlags(flags)
+	addNetworkFlags(flags)
+	addTorFlags(flags)
+	addPolitenessFlags(flags)
+	addTimeoutFlags(flags)
+	worklist := flags.String("worklist", "", "File receiving the URLs to re-download (default <path>/redownload.txt)")
+	fetch := flags.Bool("fetch", false, "Download missing files right away instead of only listing them")
+	cacheTTL := flags.Duration("listing-cache", 0, "Reuse listing pages fetched within this long, e.g. 24h (default disabled)")
+	flags.Parse(args)
+	if torMode {
+		torDefaults(flags)
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Println("❌ Error: repair accepts at most one path.")
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		downloadDir = flags.Arg(0)
+	}
+	if *worklist == "" {
+		*worklist = filepath.Join(downloadDir, "redownload.txt")
+	}
+
+	dates, err := selectDays(*startYear, *endYear, *datesFile)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Println("❌ Error configuring the HTTP client:", err)
+		return exitUsage
+	}
+	if *cacheTTL > 0 {
+		if err := openListingCache(*cacheTTL); err != nil {
+			fmt.Println("❌ Error opening listing cache:", err)
+			return exitFailed
+		}
+		defer listingCache.close()
+	}
+
+	// Validate every local file, quarantining the broken ones
+	fmt.Println("🔍 Validating archive:", downloadDir)
+	local, broken, err := scanLocalFiles()
+	if err != nil {
+		fmt.Println("❌ Error scanning archive:", err)
+		return exitFailed
+	}
+	fmt.Printf("📊 Found %d valid and %d broken files\n", len(local), broken)
+
+	// Map the remote index back to datasets and days
+	listings := scanRemoteIndex(*startYear, *endYear, dates)
+
+	var missing []string
+	unmatched := make(map[string]string, len(local))
+	for name, path := range local {
+		unmatched[name] = path
+	}
+
+	rebuilt := 0
+	for _, l := range listings {
+		previous := loadManifestEntries(l.Page)
+		m := &manifest{Dataset: l.Page.Dataset, Date: l.Page.Date(), SourceURL: l.Page.URL()}
+
+		for _, link := range l.Links {
+			// Files are looked up in their day directory, then in the flat
+			// layout of earlier versions
+			name := entryName(filepath.Join(dayDir(l.Page), localName(link)))
+			path, ok := local[name]
+			if !ok {
+				name = localName(link)
+				path, ok = local[name]
+			}
+			if !ok {
+				if *fetch {
+					if entry, ok := downloadFile(link, claimPath(dayDir(l.Page), link), previous); ok {
+						m.Files = append(m.Files, entry)
+						continue
+					}
+				}
+				missing = append(missing, link)
+				m.Incomplete = true
+				continue
+			}
+			delete(unmatched, name)
+
+			entry, err := repairEntry(path, link, previous[name])
+			if err != nil {
+				fmt.Println("❌ Error hashing file:", path)
+				m.Incomplete = true
+				continue
+			}
+			m.Files = append(m.Files, entry)
+		}
+
+		// A day with files left to re-download stays incomplete, so the
+		// next crawl fetches them instead of skipping it
+		if len(m.Files) > 0 {
+			if err := writeManifest(m); err != nil {
+				fmt.Println("❌ Error writing manifest:", err)
+				continue
+			}
+			rebuilt++
+		}
+	}
+
+	for _, path := range sortedValues(unmatched) {
+		fmt.Println("❓ Not found in the remote index:", path)
+	}
+
+	if err := writeWorklist(*worklist, missing); err != nil {
+		fmt.Println("❌ Error writing worklist:", err)
+		return exitFailed
+	}
+
+	fmt.Printf("📊 Rebuilt %d manifests, %d files to re-download, %d local files of unknown origin\n",
+		rebuilt, len(missing), len(unmatched))
+	if len(missing) > 0 {
+		fmt.Println("📝 Re-download worklist:", *worklist)
+	}
+
+	if broken > 0 || len(missing) > 0 {
+		return exitFailed
+	}
+	fmt.Println("✅ Archive repaired")
+	return exitOK
+}
+
+// scanLocalFiles validates all files below the download directory. Valid
+// files are returned keyed by their manifest name; broken ones are
+// quarantined.
+func scanLocalFiles() (map[string]string, int, error) {
+	local := make(map[string]string)
+	broken := 0
+
+	err := filepath.WalkDir(downloadDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == filepath.Join(downloadDir, manifestDir) || path == filepath.Join(downloadDir, quarantineDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".parquet") {
+			return nil
+		}
+
+		if err := validateFile(path, -1); err != nil {
+			quarantine(path, "", err)
+			broken++
+			return nil
+		}
+
+		local[entryName(path)] = path
+		return nil
+	})
+	return local, broken, err
+}
+
+// scanRemoteIndex fetches the listing pages of every dataset and day
+// to compare and returns the ones that link to files
+func scanRemoteIndex(startYear, endYear int, dates []time.Time) []remoteListing {
+	var listings []remoteListing
+	var mu sync.Mutex
+
+	sem := make(chan struct{}, workerLimit)
+	var wg sync.WaitGroup
+
+	forEachDay(startYear, endYear, dates, func(year, month, day int) {
+		for _, dataset := range datasets {
+			page := listing{Dataset: dataset, Year: year, Month: month, Day: day}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(page listing) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				links, ok := fetchListing(page.URL())
+				if !ok || len(links) == 0 {
+					return
+				}
+				mu.Lock()
+				listings = append(listings, remoteListing{Page: page, Links: links})
+				mu.Unlock()
+			}(page)
+		}
+	})
+	wg.Wait()
+
+	// Keep manifests and the worklist in a reproducible order
+	sort.Slice(listings, func(i, j int) bool {
+		if listings[i].Page.Date() != listings[j].Page.Date() {
+			return listings[i].Page.Date() < listings[j].Page.Date()
+		}
+		return listings[i].Page.Dataset < listings[j].Page.Dataset
+	})
+	return listings
+}
+
+// repairEntry builds the manifest entry of a valid local file, reusing the
+// previous entry when the file did not change size
+func repairEntry(path, sourceURL string, previous manifestEntry) (manifestEntry, error) {
+	rel := entryName(path)
+	if info, err := os.Stat(path); err == nil && previous.Name == rel && previous.Size == info.Size() {
+		return previous, nil
+	}
+
+	entry, err := hashFile(path, sourceURL)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	entry.Name = rel
+	return entry, nil
+}
+
+// writeWorklist stores one URL per line; an empty list removes a stale worklist
+func writeWorklist(path string, urls []string) error {
+	if len(urls) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(strings.Join(urls, "\n")+"\n"), 0o644)
+}
+
+// sortedValues returns the values of a map in sorted order
+func sortedValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// reportFormats lists the output formats of the tabular reports
+var reportFormats = []string{"text", "csv", "json"}
+
+// addFormatFlag registers the --format flag of a report command
+func addFormatFlag(flags *flag.FlagSet) *string {
+	return flags.String("format", "text", "Output format: "+strings.Join(reportFormats, ", "))
+}
+
+// validFormat reports whether format is one of reportFormats
+func validFormat(format string) bool {
+	for _, f := range reportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTable prints rows under the given headers to stdout as an aligned
+// table, CSV, or a JSON array of objects keyed by header
+func writeTable(format string, headers []string, rows [][]string) error {
+	return writeTableTo(os.Stdout, format, headers, rows)
+}
+
+// writeTableFile writes a table to a file instead of stdout
+func writeTableFile(path, format string, headers []string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeTableTo(f, format, headers, rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeTableTo writes a table in the given format to w
+func writeTableTo(out io.Writer, format string, headers []string, rows [][]string) error {
+	switch format {
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(headers)
+		w.WriteAll(rows)
+		return w.Error()
+
+	case "json":
+		objects := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			object := make(map[string]string, len(headers))
+			for i, header := range headers {
+				if i < len(row) {
+					object[header] = row[i]
+				}
+			}
+			objects = append(objects, object)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(objects)
+
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(headers, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// percent formats a share of a total with two decimals
+func percent(part, total int) string {
+	if total == 0 {
+		return "0.00"
+	}
+	return fmt.Sprintf("%.2f", 100*float64(part)/float64(total))
+}
+
+// writeParquetTable stores rows in a parquet file with one optional column per
+// header; columns whose values all parse as numbers are stored as doubles
+func writeParquetTable(path string, headers []string, rows [][]string) error {
+	numeric := make([]bool, len(headers))
+	group := parquet.Group{}
+	for i, header := range headers {
+		numeric[i] = true
+		for _, row := range rows {
+			if _, err := strconv.ParseFloat(row[i], 64); row[i] != "" && err != nil {
+				numeric[i] = false
+				break
+			}
+		}
+		if numeric[i] {
+			group[header] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		} else {
+			group[header] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("report", group)
+
+	columns := make([]int, len(headers))
+	for i, header := range headers {
+		leaf, _ := schema.Lookup(header)
+		columns[i] = leaf.ColumnIndex
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := parquet.NewWriter(f, schema)
+	for _, row := range rows {
+		values := make(parquet.Row, len(headers))
+		for i, cell := range row {
+			switch {
+			case cell == "":
+				values[columns[i]] = parquet.NullValue().Level(0, 0, columns[i])
+			case numeric[i]:
+				n, _ := strconv.ParseFloat(cell, 64)
+				values[columns[i]] = parquet.DoubleValue(n).Level(0, 1, columns[i])
+			default:
+				values[columns[i]] = parquet.ByteArrayValue([]byte(cell)).Level(0, 1, columns[i])
+			}
+		}
+		if _, err := w.WriteRows([]parquet.Row{values}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
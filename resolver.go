@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	dnsServer string // DNS server resolving host names instead of the system one
+	dohURL    string // DNS-over-HTTPS endpoint resolving host names
+)
+
+// dohTimeout bounds a DNS-over-HTTPS query
+const dohTimeout = 10 * time.Second
+
+// addDNSFlags registers the name resolution flags of the commands that talk
+// to the archive
+func addDNSFlags(flags *flag.FlagSet) {
+	flags.StringVar(&dnsServer, "dns-server", "", "DNS server resolving host names, as HOST or HOST:PORT, instead of the system resolver (optional)")
+	flags.StringVar(&dohURL, "doh", "", "DNS-over-HTTPS endpoint resolving host names, e.g. https://1.1.1.1/dns-query (optional)")
+}
+
+// dnsResolver returns the resolver of the dialer as -dns-server or -doh
+// ask, or nil for the system resolver. Queries leave through the dialer,
+// not the proxies, and DoH trusts the same certificates as the archive.
+func dnsResolver(dialer familyDialer, tlsClientConfig *tls.Config) (*net.Resolver, error) {
+	switch {
+	case dnsServer != "" && dohURL != "":
+		return nil, errors.New("-dns-server and -doh cannot be combined")
+
+	case dnsServer != "":
+		server := dnsServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		fmt.Println("🧭 Resolving host names with", server)
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}, nil
+
+	case dohURL != "":
+		u, err := url.Parse(dohURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("-doh %q: expected an https:// URL", dohURL)
+		}
+		fmt.Println("🧭 Resolving host names over HTTPS with", u.Redacted())
+		client := &http.Client{
+			Timeout: dohTimeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSClientConfig:     tlsClientConfig.Clone(),
+				ForceAttemptHTTP2:   true,
+				IdleConnTimeout:     idleTimeout,
+				TLSHandshakeTimeout: tlsTimeout,
+			},
+		}
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, client: client, endpoint: u.String()}, nil
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+// dohConn carries the DNS queries of the Go resolver to a DoH endpoint
+// (RFC 8484). The resolver talks to connections that are not packet
+// connections as it would over TCP, each message preceded by its length,
+// so the conn posts every query it is written and answers with the reply.
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	pending  bytes.Buffer // queries written, not answered yet
+	replies  bytes.Buffer // replies not read yet
+	deadline time.Time
+}
+
+// Write implements net.Conn, posting every complete query
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.pending.Write(b)
+	for c.pending.Len() >= 2 {
+		head := c.pending.Bytes()
+		size := int(head[0])<<8 | int(head[1])
+		if c.pending.Len() < 2+size {
+			break
+		}
+		c.pending.Next(2)
+		reply, err := c.query(c.pending.Next(size))
+		if err != nil {
+			return 0, err
+		}
+		c.replies.Write([]byte{byte(len(reply) >> 8), byte(len(reply))})
+		c.replies.Write(reply)
+	}
+	return len(b), nil
+}
+
+// query posts one DNS message to the endpoint and returns the reply
+func (c *dohConn) query(msg []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH endpoint answered %s", resp.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, 65535+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) > 65535 {
+		return nil, errors.New("DoH reply too large")
+	}
+	return reply, nil
+}
+
+// Read implements net.Conn
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.replies.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.replies.Read(b)
+}
+
+// SetDeadline implements net.Conn; the deadline bounds the queries
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+// SetReadDeadline implements net.Conn
+func (c *dohConn) SetReadDeadline(t time.Time) error { return nil }
+
+// SetWriteDeadline implements net.Conn
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// Close implements net.Conn
+func (c *dohConn) Close() error { return nil }
+
+// LocalAddr implements net.Conn
+func (c *dohConn) LocalAddr() net.Addr { return dohAddr{} }
+
+// RemoteAddr implements net.Conn
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr{} }
+
+// dohAddr is the address of a DoH conn
+type dohAddr struct{}
+
+// Network implements net.Addr
+func (dohAddr) Network() string { return "doh" }
+
+// String implements net.Addr
+func (dohAddr) String() string { return dohURL }
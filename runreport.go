@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runReportFile is where the crawler writes the report of its last run,
+// in the download directory unless -run-report says otherwise
+const runReportFile = "run-report.json"
+
+// redactedFlags hold secrets, or webhook URLs embedding them, and are left
+// out of the configuration of run reports
+var redactedFlags = []string{"proxy-auth", "notify", "failure-hook", "failure-secret", "smtp"}
+
+// runReport is the machine-readable account of a crawl, written at its end
+type runReport struct {
+	Started         time.Time         `json:"started"`
+	Finished        time.Time         `json:"finished"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Host            string            `json:"host"`
+	Dir             string            `json:"dir"`
+	ExitCode        int               `json:"exit_code"`
+	Reason          string            `json:"reason"`
+	Datasets        []datasetReport   `json:"datasets"`
+	Totals          runTotals         `json:"totals"`
+	Failures        []crawlFailure    `json:"failures"`
+	FailuresDropped int               `json:"failures_dropped,omitempty"`
+	Config          map[string]string `json:"config"`
+}
+
+// datasetReport is what a crawl wrote for one dataset
+type datasetReport struct {
+	Dataset        string   `json:"dataset"`
+	Days           int      `json:"days"`
+	IncompleteDays int      `json:"incomplete_days"`
+	FirstDate      string   `json:"first_date,omitempty"`
+	LastDate       string   `json:"last_date,omitempty"`
+	Dates          []string `json:"dates"`
+	Files          int      `json:"files"`
+	Bytes          int64    `json:"bytes"`
+}
+
+// runTotals are the counters of the crawl
+type runTotals struct {
+	ListingPages       int64 `json:"listing_pages"`
+	FailedListingPages int64 `json:"failed_listing_pages"`
+	EmptyListingPages  int64 `json:"empty_listing_pages"`
+	Files              int64 `json:"files"`
+	FailedFiles        int64 `json:"failed_files"`
+	Bytes              int64 `json:"bytes"`
+	RateLimited        int64 `json:"rate_limited"`
+	LockedDays         int64 `json:"locked_days"`
+	FilteredFiles      int64 `json:"filtered_files"`
+}
+
+// writtenDays collects the manifests the crawl writes, by dataset, for the
+// run report
+var writtenDays = struct {
+	sync.Mutex
+	byDataset map[string][]*manifest
+}{byDataset: make(map[string][]*manifest)}
+
+// recordDay notes a manifest the crawl wrote
+func recordDay(m *manifest) {
+	writtenDays.Lock()
+	defer writtenDays.Unlock()
+	writtenDays.byDataset[m.Dataset] = append(writtenDays.byDataset[m.Dataset], m)
+}
+
+// writeRunReport writes the report of a crawl that ended with code
+// atomically, so that pipelines never read a partial one
+func writeRunReport(path string, started time.Time, code int, reason string) error {
+	host, _ := os.Hostname()
+	finished := time.Now()
+	report := runReport{
+		Started:         started.UTC(),
+		Finished:        finished.UTC(),
+		DurationSeconds: finished.Sub(started).Round(time.Millisecond).Seconds(),
+		Host:            host,
+		Dir:             downloadDir,
+		ExitCode:        code,
+		Reason:          reason,
+		Datasets:        []datasetReport{},
+		Totals: runTotals{
+			ListingPages:       stats.pages.Load(),
+			FailedListingPages: stats.failedPages.Load(),
+			EmptyListingPages:  stats.emptyPages.Load(),
+			Files:              stats.files.Load(),
+			FailedFiles:        stats.failedFiles.Load(),
+			RateLimited:        stats.rateLimited.Load(),
+			LockedDays:         stats.lockedPages.Load(),
+			FilteredFiles:      stats.filteredFiles.Load(),
+		},
+		Config: flagSnapshot(flag.CommandLine),
+	}
+	report.Failures, report.FailuresDropped = recordedFailures()
+	if report.Failures == nil {
+		report.Failures = []crawlFailure{}
+	}
+
+	writtenDays.Lock()
+	for _, dataset := range datasets {
+		days := writtenDays.byDataset[dataset]
+		if len(days) == 0 {
+			continue
+		}
+		d := datasetReport{Dataset: dataset, Days: len(days)}
+		for _, m := range days {
+			d.Dates = append(d.Dates, m.Date)
+			if m.Incomplete {
+				d.IncompleteDays++
+			}
+			for _, entry := range m.Files {
+				d.Files++
+				d.Bytes += entry.Size
+			}
+		}
+		slices.Sort(d.Dates)
+		d.FirstDate, d.LastDate = d.Dates[0], d.Dates[len(d.Dates)-1]
+		report.Totals.Bytes += d.Bytes
+		report.Datasets = append(report.Datasets, d)
+	}
+	writtenDays.Unlock()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// flagSnapshot returns the value of every flag of a run, with secrets and
+// the credentials of URLs redacted; the user name goes too, since tokens
+// are often passed as one
+func flagSnapshot(flags *flag.FlagSet) map[string]string {
+	config := make(map[string]string)
+	flags.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if slices.Contains(redactedFlags, f.Name) && value != "" {
+			value = "[redacted]"
+		} else if u, err := url.Parse(value); err == nil && strings.Contains(value, "://") && u.User != nil {
+			u.User = url.User("redacted")
+			value = u.String()
+		}
+		config[f.Name] = value
+	})
+	return config
+}
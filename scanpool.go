@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var parseWorkers = runtime.NumCPU() // Row groups decoded concurrently by scans
+
+// scanTask is one row group waiting for a parse worker; its records are
+// passed back in batches, in order, through out
+type scanTask struct {
+	file     archiveFile
+	rowGroup parquet.RowGroup
+	setters  []func(*record, parquet.Value)
+	out      chan []record
+	err      error
+	last     *os.File // set on the last task of a file, which closes it
+}
+
+// run decodes the row group of the task until it is done or the scan stops
+func (t *scanTask) run(done <-chan struct{}) {
+	defer close(t.out)
+
+	batch := make([]record, 0, scanBatchRows)
+	send := func() error {
+		select {
+		case t.out <- batch:
+			batch = make([]record, 0, scanBatchRows)
+			return nil
+		case <-done:
+			return errStopScan
+		}
+	}
+	err := scanRowGroup(t.rowGroup, t.file, t.setters, func(r *record) error {
+		if batch = append(batch, *r); len(batch) == cap(batch) {
+			return send()
+		}
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = send()
+	}
+	if !errors.Is(err, errStopScan) {
+		t.err = err
+	}
+}
+
+// scanParallel is scanRecords with a pool of parse workers. Row groups are
+// queued in file order and handed out to the workers, which decode ahead of
+// fn by a few batches at most, so memory stays bounded by the worker count.
+func scanParallel(files []archiveFile, prune func(stats rowGroupStats) bool, fn func(r *record) error) error {
+	done := make(chan struct{})
+	ordered := make(chan *scanTask, parseWorkers)
+	tasks := make(chan *scanTask)
+
+	// Files stay open until their last row group is consumed; the ones
+	// still open when the scan stops early are closed at the end
+	var mu sync.Mutex
+	open := make(map[*os.File]bool)
+	closeFile := func(f *os.File) {
+		mu.Lock()
+		delete(open, f)
+		mu.Unlock()
+		f.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ordered)
+		defer close(tasks)
+		for _, file := range files {
+			src, err := openScanSource(file)
+			if err != nil {
+				failed := &scanTask{file: file, err: err, out: make(chan []record)}
+				close(failed.out)
+				select {
+				case ordered <- failed:
+				case <-done:
+				}
+				return
+			}
+			groups := src.rowGroups(prune)
+			if len(groups) == 0 {
+				src.f.Close()
+				continue
+			}
+			mu.Lock()
+			open[src.f] = true
+			mu.Unlock()
+
+			for i, rowGroup := range groups {
+				t := &scanTask{file: file, rowGroup: rowGroup, setters: src.setters, out: make(chan []record, 2)}
+				if i == len(groups)-1 {
+					t.last = src.f
+				}
+				select {
+				case ordered <- t:
+				case <-done:
+					return
+				}
+				select {
+				case tasks <- t:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < parseWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				t.run(done)
+			}
+		}()
+	}
+
+	var err error
+consume:
+	for t := range ordered {
+		for batch := range t.out {
+			for i := range batch {
+				if err = fn(&batch[i]); err != nil {
+					err = fmt.Errorf("%s: %w", t.file.Path, err)
+					break consume
+				}
+			}
+		}
+		if t.err != nil {
+			err = fmt.Errorf("%s: %w", t.file.Path, t.err)
+			break
+		}
+		if t.last != nil {
+			closeFile(t.last)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+	for f := range open {
+		f.Close()
+	}
+	if errors.Is(err, errStopScan) {
+		return nil
+	}
+	return err
+}
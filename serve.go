@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// jobLogLines is how many lines of crawler output a job keeps
+	jobLogLines = 500
+	// jobFailureLines is how many failure lines a job reports
+	jobFailureLines = 20
+	// jobStopGrace is how long a canceled crawl may take to finish the
+	// downloads in flight before it is killed
+	jobStopGrace = 30 * time.Second
+)
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// jobRequest is the body of a job submission
+type jobRequest struct {
+	Datasets []string `json:"datasets"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Dir      string   `json:"dir"`
+}
+
+// jobProgress counts what the crawl of a job did so far
+type jobProgress struct {
+	Pages      int   `json:"pages"`
+	TotalPages int   `json:"total_pages"`
+	Files      int   `json:"files"`
+	Failures   int   `json:"failures"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// serveJob is a download job: one crawl, run as a child process so that
+// jobs never share the state of the crawler
+type serveJob struct {
+	ID             string      `json:"id"`
+	State          string      `json:"state"`
+	Datasets       []string    `json:"datasets"`
+	From           string      `json:"from"`
+	To             string      `json:"to"`
+	Dir            string      `json:"dir"`
+	Created        time.Time   `json:"created"`
+	Started        *time.Time  `json:"started,omitempty"`
+	Finished       *time.Time  `json:"finished,omitempty"`
+	ExitCode       *int        `json:"exit_code,omitempty"`
+	Progress       jobProgress `json:"progress"`
+	Summary        []string    `json:"summary,omitempty"`
+	RecentFailures []string    `json:"recent_failures,omitempty"`
+
+	pages  map[string]bool
+	log    []string
+	cancel context.CancelFunc
+}
+
+// jobServer runs the submitted jobs, at most maxJobs at a time
+type jobServer struct {
+	root    string   // directory the job destinations are relative to
+	args    []string // crawler flags given to every job
+	auth    string
+	mu      sync.Mutex
+	jobs    map[string]*serveJob
+	order   []*serveJob // in submission order
+	queue   chan *serveJob
+	stopped context.Context
+	samples []throughputSample // throughput of the last hour, for the dashboard
+	hooks   *webhooks
+	pages   *pager
+}
+
+// runServe implements the serve subcommand
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "Address to serve the API on")
+	root := flags.String("dir", downloadDir, "Directory the destinations of jobs are relative to")
+	auth := flags.String("auth", "", "Require HTTP basic authentication with these USER:PASSWORD credentials (optional)")
+	maxJobs := flags.Int("max-jobs", 1, "Number of jobs run at the same time")
+	grpcAddr := flags.String("grpc-addr", "", "Address to also serve the API over gRPC on, see jobs.proto (optional)")
+	webhookURLs := flags.String("webhook", "", "Comma-separated URLs to post an event to when a job finishes (optional)")
+	webhookSecret := flags.String("webhook-secret", "", "Sign the webhook bodies with HMAC-SHA256 and this secret (optional)")
+	webhookDays := flags.Bool("webhook-days", false, "Also post a webhook event for every day a job downloads")
+	pages := &pager{}
+	addPagerFlags(flags, pages)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gopenintel serve [options] [-- crawler options]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *maxJobs < 1 {
+		fmt.Println("❌ Error: --max-jobs must be positive")
+		return exitUsage
+	}
+	// Check the crawler flags once instead of failing every job
+	crawlerFlags := flags.Args()
+	for _, arg := range crawlerFlags {
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if strings.HasPrefix(arg, "-") && slices.Contains([]string{"dates-file", "start-year", "end-year", "dataset", "dir", "help"}, name) {
+			fmt.Printf("❌ Error: -%s is set per job, not for the server\n", name)
+			return exitUsage
+		}
+	}
+	hooks, err := newWebhooks(*webhookURLs, *webhookSecret, *webhookDays)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if err := pages.setup(); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	if err := os.MkdirAll(*root, 0o755); err != nil {
+		fmt.Println("❌ Error creating the download directory:", err)
+		return exitFailed
+	}
+
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s := &jobServer{
+		root:    *root,
+		args:    crawlerFlags,
+		auth:    *auth,
+		hooks:   hooks,
+		pages:   pages,
+		jobs:    make(map[string]*serveJob),
+		queue:   make(chan *serveJob, 1024),
+		stopped: stopped,
+	}
+	go s.sampleThroughput(stopped)
+	var running sync.WaitGroup
+	for range *maxJobs {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			for job := range s.queue {
+				s.run(job)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: *addr, Handler: s.authenticate(s.routes()), ReadHeaderTimeout: 10 * time.Second}
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		var err error
+		if grpcServer, err = s.serveGRPC(*grpcAddr); err != nil {
+			fmt.Println("❌ Error serving the gRPC API:", err)
+			return exitFailed
+		}
+	}
+	go func() {
+		<-stopped.Done()
+		fmt.Println("🛑 Stopping: canceling the running jobs")
+		s.cancelAll()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+	}()
+	fmt.Printf("🎛️  Serving the job API and dashboard on http://%s/, downloading under %s\n", *addr, *root)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("❌ Error serving the API:", err)
+		return exitFailed
+	}
+	close(s.queue)
+	running.Wait()
+	s.hooks.wait()
+	return exitOK
+}
+
+// routes returns the handler of the API and the dashboard
+func (s *jobServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.dashboard)
+	mux.HandleFunc("GET /api/coverage", s.coverage)
+	mux.HandleFunc("GET /api/throughput", s.throughput)
+	mux.HandleFunc("POST /api/jobs", s.submit)
+	mux.HandleFunc("GET /api/jobs", s.list)
+	mux.HandleFunc("GET /api/jobs/{id}", s.status)
+	mux.HandleFunc("GET /api/jobs/{id}/log", s.jobLog)
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", s.cancelJob)
+	return mux
+}
+
+// authenticate requires the --auth credentials when they are set
+func (s *jobServer) authenticate(next http.Handler) http.Handler {
+	return requireAuth(s.auth, next)
+}
+
+// authorized reports whether the credentials are the --auth ones
+func (s *jobServer) authorized(user, password string) bool {
+	return matchesAuth(s.auth, user, password)
+}
+
+// matchesAuth reports whether credentials are the USER:PASSWORD ones of auth
+func matchesAuth(auth, user, password string) bool {
+	return subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(auth)) == 1
+}
+
+// requireAuth requires HTTP basic authentication with USER:PASSWORD
+// credentials, unless auth is empty
+func requireAuth(auth string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth != "" {
+			if user, password, _ := r.BasicAuth(); !matchesAuth(auth, user, password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gopenintel"`)
+				writeError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// submit queues a job
+func (s *jobServer) submit(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job: "+err.Error())
+		return
+	}
+	job, err := s.newJob(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.enqueue(job); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	s.writeJob(w, http.StatusCreated, job)
+}
+
+// errQueueFull is returned when a job is submitted while the queue is full
+var errQueueFull = errors.New("too many queued jobs")
+
+// enqueue queues a validated job
+func (s *jobServer) enqueue(job *serveJob) error {
+	s.mu.Lock()
+	select {
+	case s.queue <- job:
+	default:
+		s.mu.Unlock()
+		return errQueueFull
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job)
+	s.mu.Unlock()
+
+	fmt.Printf("📥 Queued job %s: %s from %s to %s into %s\n", job.ID, strings.Join(job.Datasets, ","), job.From, job.To, job.Dir)
+	return nil
+}
+
+// newJob validates a job request
+func (s *jobServer) newJob(req jobRequest) (*serveJob, error) {
+	from, err := time.Parse(dateLayout, req.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: expected a YYYY-MM-DD date")
+	}
+	to := from
+	if req.To != "" {
+		if to, err = time.Parse(dateLayout, req.To); err != nil {
+			return nil, fmt.Errorf("to: expected a YYYY-MM-DD date")
+		}
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to is before from")
+	}
+	if from.Year() < defaultYear || to.Year() > maxYear {
+		return nil, fmt.Errorf("dates must be between %d and %d", defaultYear, maxYear)
+	}
+	selected := datasets
+	if len(req.Datasets) > 0 {
+		if selected, err = selectDatasets(strings.Join(req.Datasets, ",")); err != nil {
+			return nil, err
+		}
+	}
+	// Destinations stay under the root, whatever the client sends
+	dir := filepath.Clean(req.Dir)
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("dir must be a relative path under the download directory")
+	}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	days := int(to.Sub(from).Hours()/24) + 1
+	return &serveJob{
+		ID:       hex.EncodeToString(id),
+		State:    jobQueued,
+		Datasets: selected,
+		From:     from.Format(dateLayout),
+		To:       to.Format(dateLayout),
+		Dir:      filepath.ToSlash(dir),
+		Created:  time.Now().UTC(),
+		Progress: jobProgress{TotalPages: days * len(selected)},
+		pages:    make(map[string]bool),
+	}, nil
+}
+
+// run crawls a job and records its outcome
+func (s *jobServer) run(job *serveJob) {
+	s.mu.Lock()
+	if job.State != jobQueued {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(s.stopped)
+	defer cancel()
+	job.cancel = cancel
+	job.State = jobRunning
+	now := time.Now().UTC()
+	job.Started = &now
+	s.mu.Unlock()
+	fmt.Println("🚚 Running job", job.ID)
+
+	code, err := s.crawl(ctx, job)
+
+	s.mu.Lock()
+	now = time.Now().UTC()
+	job.Finished = &now
+	job.ExitCode = &code
+	switch {
+	case err != nil:
+		job.State = jobFailed
+		job.appendLog("❌ Error running the crawler: " + err.Error())
+	case succeeded(code):
+		job.State = jobSucceeded
+	case code == exitAborted || ctx.Err() != nil:
+		job.State = jobCanceled
+	default:
+		job.State = jobFailed
+	}
+	finished := job.snapshot()
+	s.mu.Unlock()
+	fmt.Printf("🏁 Job %s %s (exit code %d)\n", job.ID, job.State, code)
+	s.hooks.jobFinished(finished)
+	if finished.State != jobCanceled {
+		s.pages.synced(finished.Datasets, "job "+job.ID, code, err)
+	}
+}
+
+// crawl runs the crawler of a job and follows its output
+func (s *jobServer) crawl(ctx context.Context, job *serveJob) (int, error) {
+	datesFile, err := writeDatesFile("job-"+job.ID, job.From, job.To)
+	if err != nil {
+		return exitFailed, err
+	}
+	defer os.Remove(datesFile)
+
+	args := append(slices.Clone(s.args),
+		"-dates-file", datesFile,
+		"-dataset", strings.Join(job.Datasets, ","),
+		"-dir", filepath.Join(s.root, filepath.FromSlash(job.Dir)))
+	return runCrawler(ctx, args, func(line string) {
+		s.mu.Lock()
+		job.observe(line)
+		s.mu.Unlock()
+		if path, ok := strings.CutPrefix(line, "📒 Manifest written: "); ok {
+			s.hooks.dayDownloaded(job.ID, path)
+		}
+	})
+}
+
+// runCrawler runs the crawler in a child process, so that crawls never
+// share its global state, and passes every line of its output to observe.
+// Canceling ctx interrupts the crawl, like Ctrl-C, and kills it if it does
+// not stop gracefully within jobStopGrace.
+func runCrawler(ctx context.Context, args []string, observe func(line string)) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return exitFailed, err
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = jobStopGrace
+	reader, writer := io.Pipe()
+	cmd.Stdout, cmd.Stderr = writer, writer
+	if err := cmd.Start(); err != nil {
+		return exitFailed, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			observe(scanner.Text())
+		}
+		io.Copy(io.Discard, reader)
+	}()
+	err = cmd.Wait()
+	writer.Close()
+	<-done
+
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return exitFailed, err
+	}
+	return exitOK, nil
+}
+
+// writeDatesFile writes the days from one date to another to a temporary
+// dates file for the crawler
+func writeDatesFile(name, fromDate, toDate string) (string, error) {
+	f, err := os.CreateTemp("", "gopenintel-"+name+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	from, _ := time.Parse(dateLayout, fromDate)
+	to, _ := time.Parse(dateLayout, toDate)
+	w := bufio.NewWriter(f)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		fmt.Fprintln(w, day.Format(dateLayout))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// observe updates the progress of a job from a line of crawler output
+func (j *serveJob) observe(line string) {
+	j.appendLog(line)
+	switch {
+	case strings.HasPrefix(line, "🌐 Checking: "):
+		j.pages[strings.TrimPrefix(line, "🌐 Checking: ")] = true
+		j.Progress.Pages = len(j.pages)
+	case strings.HasPrefix(line, "💾 Cached listing: "):
+		j.pages[strings.TrimPrefix(line, "💾 Cached listing: ")] = true
+		j.Progress.Pages = len(j.pages)
+	case strings.HasPrefix(line, "✅ Download completed: "):
+		j.Progress.Files++
+		j.Progress.Bytes += fileSize(strings.TrimPrefix(line, "✅ Download completed: "))
+	case strings.HasPrefix(line, "✅ Not modified:"),
+		strings.HasPrefix(line, "✅ File already downloaded:"), strings.HasPrefix(line, "🔗 Already requested"):
+		j.Progress.Files++
+	case strings.HasPrefix(line, "❌"):
+		j.Progress.Failures++
+		j.RecentFailures = append(j.RecentFailures, line)
+		if len(j.RecentFailures) > jobFailureLines {
+			j.RecentFailures = j.RecentFailures[1:]
+		}
+	case strings.HasPrefix(line, "📊"):
+		j.Summary = []string{line}
+	case strings.HasPrefix(line, "⏸️  ") && j.Summary != nil, strings.HasPrefix(line, "🔒 ") && j.Summary != nil,
+		strings.HasPrefix(line, "🚨") && j.Summary != nil:
+		j.Summary = append(j.Summary, line)
+	}
+}
+
+// appendLog keeps the last jobLogLines lines of output
+func (j *serveJob) appendLog(line string) {
+	j.log = append(j.log, line)
+	if len(j.log) > jobLogLines {
+		j.log = slices.Delete(j.log, 0, len(j.log)-jobLogLines)
+	}
+}
+
+// list returns every job, most recent first
+func (s *jobServer) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]serveJob, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.order[i].snapshot())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+}
+
+// status returns a job
+func (s *jobServer) status(w http.ResponseWriter, r *http.Request) {
+	job := s.lookup(w, r)
+	if job == nil {
+		return
+	}
+	s.writeJob(w, http.StatusOK, job)
+}
+
+// jobLog returns the last lines of output of a job as text
+func (s *jobServer) jobLog(w http.ResponseWriter, r *http.Request) {
+	job := s.lookup(w, r)
+	if job == nil {
+		return
+	}
+	s.mu.Lock()
+	text := strings.Join(job.log, "\n")
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text+"\n")
+}
+
+// cancelJob cancels a queued or running job
+func (s *jobServer) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job := s.lookup(w, r)
+	if job == nil {
+		return
+	}
+	if err := s.cancel(job); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.writeJob(w, http.StatusAccepted, job)
+}
+
+// cancel drops a queued job or interrupts a running one; finished jobs
+// cannot be canceled
+func (s *jobServer) cancel(job *serveJob) error {
+	s.mu.Lock()
+	switch job.State {
+	case jobQueued:
+		job.State = jobCanceled
+		now := time.Now().UTC()
+		job.Finished = &now
+		dropped := job.snapshot()
+		s.mu.Unlock()
+		fmt.Println("✋ Canceling job", job.ID)
+		s.hooks.jobFinished(dropped)
+		return nil
+	case jobRunning:
+		job.cancel()
+	default:
+		s.mu.Unlock()
+		return errors.New("job already " + job.State)
+	}
+	s.mu.Unlock()
+	fmt.Println("✋ Canceling job", job.ID)
+	return nil
+}
+
+// cancelAll cancels every queued and running job
+func (s *jobServer) cancelAll() {
+	s.mu.Lock()
+	var dropped []serveJob
+	for _, job := range s.order {
+		if job.State == jobQueued {
+			job.State = jobCanceled
+			now := time.Now().UTC()
+			job.Finished = &now
+			dropped = append(dropped, job.snapshot())
+		}
+	}
+	s.mu.Unlock()
+	for _, job := range dropped {
+		s.hooks.jobFinished(job)
+	}
+}
+
+// lookup returns the job of the request, answering 404 when there is none
+func (s *jobServer) lookup(w http.ResponseWriter, r *http.Request) *serveJob {
+	s.mu.Lock()
+	job := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if job == nil {
+		writeError(w, http.StatusNotFound, "no such job")
+	}
+	return job
+}
+
+// snapshot copies a job for encoding outside the lock
+func (j *serveJob) snapshot() serveJob {
+	copied := *j
+	copied.Summary = slices.Clone(j.Summary)
+	copied.RecentFailures = slices.Clone(j.RecentFailures)
+	return copied
+}
+
+// writeJob encodes a job
+func (s *jobServer) writeJob(w http.ResponseWriter, code int, job *serveJob) {
+	s.mu.Lock()
+	copied := job.snapshot()
+	s.mu.Unlock()
+	writeJSON(w, code, copied)
+}
+
+// writeJSON encodes a response body
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeError encodes an error response
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
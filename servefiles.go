@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// mirrorEntry is a file or directory of a mirror listing; partitions carry
+// their dataset and date, with what their day directories and manifests hold
+type mirrorEntry struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`
+	Dir       bool              `json:"dir,omitempty"`
+	Size      int64             `json:"size"`
+	Modified  time.Time         `json:"modified"`
+	Partition map[string]string `json:"partition,omitempty"`
+	Days      int               `json:"days,omitempty"`     // days of a dataset
+	Files     int               `json:"files,omitempty"`    // parquet files of a day
+	Manifest  string            `json:"manifest,omitempty"` // complete, incomplete or missing, for days
+	SHA256    string            `json:"sha256,omitempty"`   // of files recorded by their manifest
+}
+
+// mirrorListing is the listing of one directory of the mirror
+type mirrorListing struct {
+	Path      string            `json:"path"`
+	Partition map[string]string `json:"partition,omitempty"`
+	Entries   []mirrorEntry     `json:"entries"`
+}
+
+// mirrorPage renders a listing for browsers
+var mirrorPage = template.Must(template.New("listing").Funcs(template.FuncMap{"size": formatSize}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}}</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{padding:.2em 1em;text-align:left}td.n{text-align:right}</style>
+</head><body>
+<h1>{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>Days</th><th>Files</th><th>Manifest</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Path}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td class="n">{{if .Size}}{{size .Size}}{{end}}</td><td>{{.Modified.UTC.Format "2006-01-02 15:04"}}</td><td class="n">{{if .Days}}{{.Days}}{{end}}</td><td class="n">{{if .Files}}{{.Files}}{{end}}</td><td>{{.Manifest}}</td></tr>
+{{end}}</table>
+<p><a href="?format=json">JSON</a></p>
+</body></html>
+`))
+
+// runServeFiles implements the serve-files subcommand
+func runServeFiles(args []string) int {
+	flags := flag.NewFlagSet("serve-files", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8082", "Address to serve the mirror on")
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory to serve")
+	auth := flags.String("auth", "", "Require HTTP basic authentication with these USER:PASSWORD credentials (optional)")
+	flags.Parse(args)
+
+	if info, err := os.Stat(downloadDir); err != nil || !info.IsDir() {
+		fmt.Println("❌ Error: nothing to serve in", downloadDir)
+		return exitUsage
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", serveMirror)
+	server := &http.Server{Addr: *addr, Handler: requireAuth(*auth, mux), ReadHeaderTimeout: 10 * time.Second}
+
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-stopped.Done()
+		fmt.Println("🛑 Stopping")
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	fmt.Printf("📂 Serving %s on http://%s/\n", downloadDir, *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("❌ Error serving the mirror:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// mirrorPath maps the URL path of a request to its segments under the
+// download directory. The Hive-style dataset=<name>/date=<day> partitions
+// that Spark reads columns from are accepted alongside the plain layout;
+// hive reports whether the request used them.
+func mirrorPath(urlPath string) (segments []string, hive bool) {
+	cleaned := strings.Trim(path.Clean("/"+urlPath), "/")
+	if cleaned == "" {
+		return nil, false
+	}
+	segments = strings.Split(cleaned, "/")
+	if name, ok := strings.CutPrefix(segments[0], "dataset="); ok {
+		segments[0], hive = name, true
+		if len(segments) > 1 {
+			if date, ok := strings.CutPrefix(segments[1], "date="); ok {
+				segments[1] = date
+			}
+		}
+	}
+	return segments, hive
+}
+
+// hiddenEntry reports whether a file of the download directory is kept
+// out of the mirror: partial writes, dotfiles and the lock files of -lock
+func hiddenEntry(segments []string, name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") || (len(segments) == 0 && name == lockDir)
+}
+
+// isDatasetDay reports whether segments name a dataset, and a day of it
+// when there are two
+func isDatasetDay(segments []string) bool {
+	if len(segments) == 0 || len(segments) > 2 || !slices.Contains(datasets, segments[0]) {
+		return false
+	}
+	if len(segments) == 2 {
+		_, err := time.Parse(dateLayout, segments[1])
+		return err == nil
+	}
+	return true
+}
+
+// serveMirror answers a file, with range requests, or the listing of a
+// directory
+func serveMirror(w http.ResponseWriter, r *http.Request) {
+	segments, hive := mirrorPath(r.URL.Path)
+	for i, segment := range segments {
+		if hiddenEntry(segments[:i], segment) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	local := filepath.Join(downloadDir, filepath.FromSlash(strings.Join(segments, "/")))
+	info, err := os.Stat(local)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !info.IsDir() {
+		serveMirrorFile(w, r, segments, local, info)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return
+	}
+	listing, err := listMirror(segments, hive, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, listing)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	mirrorPage.Execute(w, listing)
+}
+
+// serveMirrorFile answers a file; parquet files recorded by a manifest get
+// their SHA-256 as a strong ETag, so that range requests can use If-Range
+func serveMirrorFile(w http.ResponseWriter, r *http.Request, segments []string, local string, info fs.FileInfo) {
+	f, err := os.Open(local)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	if len(segments) == 3 && isDatasetDay(segments[:2]) {
+		// A file replaced by -sync keeps its old entry until the manifest
+		// is rewritten; the size tells most of them apart
+		if entry, ok := manifestEntries(segments[0], segments[1])[strings.Join(segments, "/")]; ok && entry.Size == info.Size() && entry.SHA256 != "" {
+			w.Header().Set("ETag", `"`+entry.SHA256+`"`)
+		}
+	}
+	if strings.HasSuffix(local, ".parquet") {
+		w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// manifestEntries returns the files a day's manifest records, by entry
+// name; a missing manifest means the day is in the making or was never
+// downloaded
+func manifestEntries(dataset, date string) map[string]manifestEntry {
+	m, err := readManifest(manifestPath(dataset, date))
+	if err != nil {
+		return nil
+	}
+	entries := make(map[string]manifestEntry, len(m.Files))
+	for _, entry := range m.Files {
+		entries[entry.Name] = entry
+	}
+	return entries
+}
+
+// listMirror lists a directory of the mirror; datasets and their days are
+// described as partitions, and days are linked as date=<day> when the
+// request used the Hive-style layout
+func listMirror(segments []string, hive bool, urlPath string) (mirrorListing, error) {
+	listing := mirrorListing{Path: urlPath, Entries: []mirrorEntry{}}
+	partition := isDatasetDay(segments)
+	if partition {
+		listing.Partition = map[string]string{"dataset": segments[0]}
+		if len(segments) == 2 {
+			listing.Partition["date"] = segments[1]
+		}
+	}
+	var recorded map[string]manifestEntry
+	if partition && len(segments) == 2 {
+		recorded = manifestEntries(segments[0], segments[1])
+	}
+
+	dir := filepath.Join(downloadDir, filepath.FromSlash(strings.Join(segments, "/")))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return listing, err
+	}
+	for _, dirEntry := range entries {
+		name := dirEntry.Name()
+		if hiddenEntry(segments, name) {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue // removed while listing
+		}
+		entry := mirrorEntry{Name: name, Dir: info.IsDir(), Modified: info.ModTime().UTC()}
+		if !entry.Dir {
+			entry.Size = info.Size()
+		}
+		child := append(slices.Clone(segments), name)
+		segment := name
+		if entry.Dir && isDatasetDay(child) {
+			entry.Partition = map[string]string{"dataset": child[0]}
+			if len(child) == 1 {
+				entry.Days = countDays(filepath.Join(dir, name))
+			} else {
+				entry.Partition["date"] = name
+				entry.Files, entry.Size = dayFiles(filepath.Join(dir, name))
+				entry.Manifest = manifestState(child[0], name)
+				if hive {
+					segment = "date=" + name
+				}
+			}
+		}
+		if m, ok := recorded[strings.Join(child, "/")]; ok && m.Size == entry.Size {
+			entry.SHA256 = m.SHA256
+		}
+		entry.Path = urlPath + segment
+		if entry.Dir {
+			entry.Path += "/"
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing, nil
+}
+
+// countDays counts the day directories of a dataset
+func countDays(dir string) int {
+	entries, _ := os.ReadDir(dir)
+	days := 0
+	for _, entry := range entries {
+		if _, err := time.Parse(dateLayout, entry.Name()); err == nil && entry.IsDir() {
+			days++
+		}
+	}
+	return days
+}
+
+// dayFiles counts the parquet files of a day directory and their bytes
+func dayFiles(dir string) (int, int64) {
+	entries, _ := os.ReadDir(dir)
+	files, size := 0, int64(0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".parquet") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files++
+			size += info.Size()
+		}
+	}
+	return files, size
+}
+
+// manifestState tells whether a day has a manifest, and whether it is
+// complete
+func manifestState(dataset, date string) string {
+	m, err := readManifest(manifestPath(dataset, date))
+	switch {
+	case err != nil:
+		return "missing"
+	case m.Incomplete:
+		return "incomplete"
+	default:
+		return "complete"
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// queryLimit is how many records or addresses a lookup returns unless
+	// it asks for another limit, up to maxQueryLimit
+	queryLimit    = 1000
+	maxQueryLimit = 100000
+	// indexOpenTimeout is how long a lookup waits for an index build
+	// holding the index
+	indexOpenTimeout = time.Second
+)
+
+// queryServer answers lookups over HTTP from the passive-DNS index
+type queryServer struct {
+	index  string
+	schema *gqlSchema
+}
+
+// runServeQuery implements the serve-query subcommand
+func runServeQuery(args []string) int {
+	flags := flag.NewFlagSet("serve-query", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8081", "Address to serve the lookups on")
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	indexPath := flags.String("index", "", "Index file built with index build (default <dir>/"+pdnsIndexFile+")")
+	auth := flags.String("auth", "", "Require HTTP basic authentication with these USER:PASSWORD credentials (optional)")
+	flags.Parse(args)
+
+	if *indexPath == "" {
+		*indexPath = filepath.Join(downloadDir, pdnsIndexFile)
+	}
+	if _, err := os.Stat(*indexPath); err != nil {
+		fmt.Println("❌ Error opening index:", err)
+		fmt.Println("💡 Build it first with: gopenintel index build -dir", downloadDir)
+		return exitFailed
+	}
+
+	q := &queryServer{index: *indexPath, schema: newArchiveSchema()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /domain/{name}", q.domain)
+	mux.HandleFunc("GET /ip/{addr...}", q.ip)
+	mux.HandleFunc("GET /status", q.status)
+	mux.HandleFunc("GET /graphql", q.graphQL)
+	mux.HandleFunc("POST /graphql", q.graphQL)
+	mux.HandleFunc("GET /graphql/schema", q.graphQLSchema)
+	server := &http.Server{Addr: *addr, Handler: requireAuth(*auth, mux), ReadHeaderTimeout: 10 * time.Second}
+
+	stopped, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-stopped.Done()
+		fmt.Println("🛑 Stopping")
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	fmt.Printf("🔎 Serving lookups of %s on http://%s/\n", *indexPath, *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("❌ Error serving lookups:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// open opens the index for one lookup, so that index build can extend it
+// between lookups; it answers the request itself when the index is busy
+func (q *queryServer) open(w http.ResponseWriter) *bolt.DB {
+	db, err := bolt.Open(q.index, 0o644, &bolt.Options{ReadOnly: true, Timeout: indexOpenTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "the index is being updated")
+		return nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "opening index: "+err.Error())
+		return nil
+	}
+	return db
+}
+
+// lookupLimit returns the ?limit of a lookup, or 0 after answering a bad one
+func lookupLimit(w http.ResponseWriter, r *http.Request) int {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return queryLimit
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > maxQueryLimit {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxQueryLimit))
+		return 0
+	}
+	return n
+}
+
+// domain answers the records of a name, and of its subdomains with
+// ?subdomains=true, optionally of one ?type only
+func (q *queryServer) domain(w http.ResponseWriter, r *http.Request) {
+	n := lookupLimit(w, r)
+	if n == 0 {
+		return
+	}
+	subdomains, _ := strconv.ParseBool(r.URL.Query().Get("subdomains"))
+	name := normalizeDomain(r.PathValue("name"))
+	if name == "." {
+		writeError(w, http.StatusBadRequest, "missing domain name")
+		return
+	}
+	db := q.open(w)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	records, truncated, err := indexedNames(db, name, subdomains, strings.ToUpper(r.URL.Query().Get("type")), n)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "reading index: "+err.Error())
+		return
+	}
+	if len(records) == 0 {
+		writeError(w, http.StatusNotFound, name+" is not in the index")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "records": records, "truncated": truncated})
+}
+
+// ip answers the domains seen on an address, or on the addresses of a
+// prefix such as /ip/192.0.2.0/24
+func (q *queryServer) ip(w http.ResponseWriter, r *http.Request) {
+	n := lookupLimit(w, r)
+	if n == 0 {
+		return
+	}
+	query := r.PathValue("addr")
+	start, end, err := addressRange(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	db := q.open(w)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	addresses, truncated, err := indexedAddresses(db, start, end, n)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "reading index: "+err.Error())
+		return
+	}
+	if len(addresses) == 0 {
+		writeError(w, http.StatusNotFound, query+" is not in the index")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"query": query, "addresses": addresses, "truncated": truncated})
+}
+
+// status answers which dataset/days the index holds, so clients can tell
+// how fresh its answers are
+func (q *queryServer) status(w http.ResponseWriter, r *http.Request) {
+	db := q.open(w)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	summary, err := summarizeIndex(db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "reading index: "+err.Error())
+		return
+	}
+	summary.Index = q.index
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// indexSummary describes the dataset/days an index holds
+type indexSummary struct {
+	Index     string   `json:"index"`
+	Days      int      `json:"days"`
+	Datasets  []string `json:"datasets"`
+	FirstDate string   `json:"first_date"`
+	LastDate  string   `json:"last_date"`
+}
+
+// summarizeIndex reads the markers of the indexed dataset/days
+func summarizeIndex(db *bolt.DB) (indexSummary, error) {
+	var summary indexSummary
+	datasets := make(map[string]bool)
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexedBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			date, dataset, _ := strings.Cut(string(k), "/")
+			if summary.FirstDate == "" || date < summary.FirstDate {
+				summary.FirstDate = date
+			}
+			summary.LastDate = max(summary.LastDate, date)
+			datasets[dataset] = true
+			summary.Days++
+			return nil
+		})
+	})
+	summary.Datasets = sortedKeys(datasets)
+	return summary, err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	// stopping is done once the crawl was asked to stop taking new work
+	stopping, stopCrawl = context.WithCancel(context.Background())
+	// aborting is done once a second signal asked to cancel the transfers in flight
+	aborting, abortCrawl = context.WithCancel(context.Background())
+)
+
+// handleSignals makes the first SIGINT or SIGTERM stop the crawl after the
+// downloads in flight and the second one abort them as well
+func handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("🛑 Stopping: finishing the downloads in flight (interrupt again to abort them)")
+		stopCrawl()
+		<-signals
+		fmt.Println("🛑 Aborting the downloads in flight")
+		abortCrawl()
+		signal.Stop(signals)
+	}()
+}
+
+// stopped reports whether the crawl was asked to stop
+func stopped() bool {
+	return stopping.Err() != nil
+}
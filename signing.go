@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const signatureSuffix = ".asc"
+
+// signKey is the GPG key used to sign manifests; signing is disabled when empty
+var signKey string
+
+// signManifest writes an armored detached GPG signature next to a manifest
+func signManifest(path string) error {
+	cmd := exec.Command("gpg", "--batch", "--yes", "--armor",
+		"--local-user", signKey,
+		"--output", path+signatureSuffix,
+		"--detach-sign", path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("gpg sign %s: %v: %s", path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// verifyManifestSignature checks the detached signature of a manifest. With
+// a keyring (as exported by "gpg --export") only its keys are trusted,
+// otherwise the user's default keyring is used.
+func verifyManifestSignature(path, keyring string) error {
+	var cmd *exec.Cmd
+	if keyring != "" {
+		cmd = exec.Command("gpgv", "--keyring", keyring, path+signatureSuffix, path)
+	} else {
+		cmd = exec.Command("gpg", "--batch", "--verify", path+signatureSuffix, path)
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		// gpg prints the verdict on its last line
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		return fmt.Errorf("%v: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
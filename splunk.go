@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// splunkSink sends events in batches to a Splunk HTTP Event Collector
+type splunkSink struct {
+	URL        string
+	Token      string
+	Index      string
+	Sourcetype string
+	client     *http.Client
+
+	body    bytes.Buffer
+	pending int
+}
+
+// splunkEvent is the HEC envelope of one record
+type splunkEvent struct {
+	Time       int64          `json:"time"`
+	Source     string         `json:"source"`
+	Sourcetype string         `json:"sourcetype"`
+	Index      string         `json:"index,omitempty"`
+	Event      map[string]any `json:"event"`
+}
+
+// runForwardSplunk forwards the selected records to a Splunk HTTP Event
+// Collector, typically restricted to a watchlist with --domains
+func runForwardSplunk(args []string) int {
+	flags := flag.NewFlagSet("forward-splunk", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	selection := addExportFlags(flags)
+	sink := &splunkSink{}
+	flags.StringVar(&sink.URL, "hec-url", os.Getenv("SPLUNK_HEC_URL"), "HTTP Event Collector URL, e.g. https://splunk:8088 (default $SPLUNK_HEC_URL)")
+	flags.StringVar(&sink.Token, "token", os.Getenv("SPLUNK_HEC_TOKEN"), "HEC token (default $SPLUNK_HEC_TOKEN)")
+	flags.StringVar(&sink.Index, "index", "", "Splunk index receiving the events (default the token's index)")
+	flags.StringVar(&sink.Sourcetype, "sourcetype", "openintel:dns", "Sourcetype of the events")
+	batch := flags.Int("batch", 500, "Events sent per request")
+	insecure := flags.Bool("insecure", false, "Accept self-signed HEC certificates")
+	flags.Parse(args)
+
+	if sink.URL == "" || sink.Token == "" {
+		fmt.Println("❌ Error: --hec-url and --token (or SPLUNK_HEC_URL and SPLUNK_HEC_TOKEN) are required")
+		return exitUsage
+	}
+	if *batch < 1 {
+		fmt.Println("❌ Error: --batch must be at least 1")
+		return exitUsage
+	}
+	if err := selection.prepare("dataset", "date"); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	sink.URL = strings.TrimSuffix(sink.URL, "/")
+	if !strings.Contains(sink.URL, "/services/collector") {
+		sink.URL += "/services/collector/event"
+	}
+	sink.client = &http.Client{Timeout: time.Minute}
+	if *insecure {
+		sink.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	total := 0
+	for _, day := range groupByDay(files) {
+		// Events are timestamped with the measurement day
+		date, err := time.Parse(dateLayout, day[0].Date)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error:", err)
+			return exitFailed
+		}
+		source := "openintel:" + day[0].Dataset
+
+		n := 0
+		err = scanRecords(day, nil, func(r *record) error {
+			if !selection.includes(r) {
+				return nil
+			}
+			err := sink.add(splunkEvent{
+				Time:       date.Unix(),
+				Source:     source,
+				Sourcetype: sink.Sourcetype,
+				Index:      sink.Index,
+				Event:      selection.document(r),
+			})
+			if err != nil {
+				return err
+			}
+			n++
+			if sink.pending >= *batch {
+				return sink.flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = sink.flush()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error forwarding %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "📡 Forwarded %s %s: %d events\n", day[0].Dataset, day[0].Date, n)
+		total += n
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Forwarded %d events to %s\n", total, sink.URL)
+	return exitOK
+}
+
+// add queues an event for the next request
+func (s *splunkSink) add(event splunkEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.body.Write(data)
+	s.body.WriteByte('\n')
+	s.pending++
+	return nil
+}
+
+// flush sends the queued events in one request
+func (s *splunkSink) flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(s.body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HEC returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	s.body.Reset()
+	s.pending = 0
+	return nil
+}
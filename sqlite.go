@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTypes maps export column kinds to SQLite column types
+var sqliteTypes = map[string]string{"text": "TEXT", "bigint": "INTEGER", "date": "TEXT"}
+
+// sqliteIndexes are the columns indexed in the exported database when selected
+var sqliteIndexes = []string{"query_name", "response_type", "value", "ip4_address", "ip6_address", "cname_name", "ns_address", "mx_address"}
+
+// runExportSQLite writes the selected records into a single SQLite file;
+// existing files are extended, skipping the dataset/days they already hold
+func runExportSQLite(args []string) int {
+	flags := flag.NewFlagSet("export-sqlite", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	selection := addExportFlags(flags)
+	output := flags.String("output", "", "SQLite database to write")
+	table := flags.String("table", "records", "Table receiving the records")
+	reload := flags.Bool("reload", false, "Replace days the database already holds")
+	flags.Parse(args)
+
+	if *output == "" {
+		fmt.Println("❌ Error: --output is required")
+		return exitUsage
+	}
+	if err := selection.prepare("dataset", "date"); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	db, err := sql.Open("sqlite", *output)
+	if err != nil {
+		fmt.Println("❌ Error opening database:", err)
+		return exitFailed
+	}
+	defer db.Close()
+	// SQLite allows a single writer, so one connection avoids lock contention
+	db.SetMaxOpenConns(1)
+
+	if err := createSQLiteTables(db, *table, selection); err != nil {
+		fmt.Println("❌ Error creating tables:", err)
+		return exitFailed
+	}
+
+	loaded, skipped, total := 0, 0, int64(0)
+	for _, day := range groupByDay(files) {
+		n, done, err := loadSQLiteDay(db, *table, selection, day, *reload)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error exporting %s %s: %v\n", day[0].Dataset, day[0].Date, err)
+			return exitFailed
+		}
+		if !done {
+			skipped++
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "🗃️  Exported %s %s: %d rows\n", day[0].Dataset, day[0].Date, n)
+		loaded++
+		total += n
+	}
+
+	// Indexes are built once after loading, which is much faster than
+	// maintaining them row by row
+	fmt.Fprintln(os.Stderr, "🗂️  Building indexes")
+	if err := createSQLiteIndexes(db, *table, selection); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error creating indexes:", err)
+		return exitFailed
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 Exported %d dataset/days (%d already present), %d rows into %s\n", loaded, skipped, total, *output)
+	return exitOK
+}
+
+// sqlIdentifier quotes a table, column or index name for SQLite and DuckDB
+func sqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// createSQLiteTables creates the record table and the table tracking
+// exported days
+func createSQLiteTables(db *sql.DB, table string, selection *exportSelection) error {
+	columns := make([]string, len(selection.columns))
+	for i, c := range selection.columns {
+		columns[i] = sqlIdentifier(c.Name) + " " + sqliteTypes[c.Kind]
+	}
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", sqlIdentifier(table), strings.Join(columns, ", ")),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (dataset TEXT NOT NULL, date TEXT NOT NULL, rows INTEGER NOT NULL, loaded_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (dataset, date))",
+			sqlIdentifier(table+"_loads")),
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSQLiteIndexes indexes the record table by day and by the selected
+// lookup columns
+func createSQLiteIndexes(db *sql.DB, table string, selection *exportSelection) error {
+	statements := []string{
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (dataset, date)", sqlIdentifier(table+"_day_idx"), sqlIdentifier(table)),
+	}
+	selected := make(map[string]bool)
+	for _, name := range selection.names() {
+		selected[name] = true
+	}
+	for _, name := range sqliteIndexes {
+		if selected[name] {
+			statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+				sqlIdentifier(table+"_"+name+"_idx"), sqlIdentifier(table), sqlIdentifier(name)))
+		}
+	}
+	statements = append(statements, "ANALYZE")
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSQLiteDay inserts one dataset/day inside a transaction together with
+// its entry in the loads table; it reports false when the day was already
+// exported and reload is not set
+func loadSQLiteDay(db *sql.DB, table string, selection *exportSelection, files []archiveFile, reload bool) (int64, bool, error) {
+	dataset, date := files[0].Dataset, files[0].Date
+	loads := sqlIdentifier(table + "_loads")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM "+loads+" WHERE dataset = ? AND date = ?)", dataset, date).Scan(&exists)
+	if err != nil {
+		return 0, false, err
+	}
+	if exists && !reload {
+		return 0, false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM "+sqlIdentifier(table)+" WHERE dataset = ? AND date = ?", dataset, date); err != nil {
+		return 0, false, err
+	}
+
+	names := selection.names()
+	for i, name := range names {
+		names[i] = sqlIdentifier(name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	insert, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqlIdentifier(table), strings.Join(names, ", "), placeholders))
+	if err != nil {
+		return 0, false, err
+	}
+	defer insert.Close()
+
+	var n int64
+	err = scanRecords(files, nil, func(r *record) error {
+		if !selection.includes(r) {
+			return nil
+		}
+		if _, err := insert.Exec(selection.values(r)...); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec("INSERT INTO "+loads+" (dataset, date, rows) VALUES (?, ?, ?) ON CONFLICT (dataset, date) DO UPDATE SET rows = excluded.rows, loaded_at = CURRENT_TIMESTAMP",
+		dataset, date, n)
+	if err != nil {
+		return 0, false, err
+	}
+	return n, true, tx.Commit()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	minSpeed    int64 = 1 << 10          // Bytes per second below which a transfer is stalled, 0 disables
+	stallWindow       = 30 * time.Second // How long a transfer may stay below minSpeed
+)
+
+// errStalled reports a transfer aborted for staying below the minimum speed
+var errStalled = errors.New("transfer stalled")
+
+// stallWatch cancels a request whose response does not progress by at least
+// minSpeed*stallWindow bytes in any window, waiting for the headers included.
+// The clock starts when the request is sent, not while it waits for its turn.
+type stallWatch struct {
+	body    io.Reader
+	read    atomic.Int64
+	stalled atomic.Bool
+	begin   chan struct{}
+	once    sync.Once
+	stop    chan struct{}
+}
+
+// watchStalls prepares watching a request; cancel aborts it. The returned
+// context traces the request to start the watch when it is sent.
+func watchStalls(ctx context.Context, cancel context.CancelFunc) (*stallWatch, context.Context) {
+	w := &stallWatch{begin: make(chan struct{}), stop: make(chan struct{})}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { w.once.Do(func() { close(w.begin) }) },
+	})
+	if minSpeed <= 0 {
+		return w, ctx
+	}
+	go func() {
+		select {
+		case <-w.begin:
+		case <-w.stop:
+			return
+		}
+		ticker := time.NewTicker(stallWindow)
+		defer ticker.Stop()
+		last := int64(0)
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				read := w.read.Load()
+				if float64(read-last) < float64(minSpeed)*stallWindow.Seconds() {
+					w.stalled.Store(true)
+					cancel()
+					return
+				}
+				last = read
+			}
+		}
+	}()
+	return w, ctx
+}
+
+// Read implements io.Reader over the watched body
+func (w *stallWatch) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	w.read.Add(int64(n))
+	return n, err
+}
+
+// done stops watching
+func (w *stallWatch) done() {
+	close(w.stop)
+}
+
+// check turns the error of an aborted request into errStalled
+func (w *stallWatch) check(err error) error {
+	if err != nil && w.stalled.Load() {
+		return fmt.Errorf("%w: less than %s/s for %s", errStalled, formatSize(minSpeed), stallWindow)
+	}
+	return err
+}
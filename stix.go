@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stixNamespace is the namespace the STIX 2.1 specification defines for the
+// deterministic identifiers of cyber observables
+const stixNamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+
+// stixTLP are the TLP marking definitions of the STIX 2.1 specification
+var stixTLP = map[string]string{
+	"white": "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9",
+	"green": "marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da",
+	"amber": "marking-definition--f88d31f6-486f-44da-b317-01333bde0b82",
+	"red":   "marking-definition--5e57c739-391a-4eb3-b6be-7d15ca92d5ed",
+}
+
+// stixEntry is an object of the bundle with the day it was first added
+type stixEntry struct {
+	ID     string
+	Type   string
+	Added  string // RFC 3339 timestamp, also the created time of SDOs and SROs
+	Object map[string]any
+}
+
+// stixBuilder collects the objects of a bundle, each one once
+type stixBuilder struct {
+	identity string
+	marking  string
+	entries  []*stixEntry
+	byID     map[string]*stixEntry
+}
+
+// runSTIX converts the NOD feeds and a takeover report into a STIX 2.1
+// bundle of indicators, observables and relationships, and optionally
+// serves it as a read-only TAXII 2.1 collection
+func runSTIX(args []string) int {
+	flags := flag.NewFlagSet("stix", flag.ExitOnError)
+	flags.StringVar(&downloadDir, "dir", downloadDir, "Local archive directory")
+	output := flags.String("output", "", "Bundle file to write (default standard output unless --serve is set)")
+	nodDirFlag := flags.String("nod-dir", "", "Directory of NOD feeds to include (default <dir>/"+nodDir+" unless --takeover is set)")
+	takeover := flags.String("takeover", "", "Report of the takeover command (--format csv or json) to include")
+	identity := flags.String("identity", "gopenintel", "Name of the identity producing the objects")
+	tlp := flags.String("tlp", "white", "TLP marking of the objects: white, green, amber or red")
+	resolve := flags.Bool("resolve", false, "Add the addresses the archive recorded for each domain on its day as resolves-to relationships")
+	serve := flags.String("serve", "", "Serve the bundle as a TAXII 2.1 collection on this address (e.g. :9500)")
+	auth := flags.String("auth", "", "USER:PASSWORD required from TAXII clients (HTTP basic authentication)")
+	flags.Parse(args)
+
+	marking, ok := stixTLP[strings.ToLower(*tlp)]
+	if !ok {
+		fmt.Println("❌ Error: unknown TLP marking", *tlp)
+		return exitUsage
+	}
+	if *auth != "" && !strings.Contains(*auth, ":") {
+		fmt.Println("❌ Error: --auth must be USER:PASSWORD")
+		return exitUsage
+	}
+	if *nodDirFlag == "" && *takeover == "" {
+		*nodDirFlag = filepath.Join(downloadDir, nodDir)
+	}
+
+	sets, err := loadIndicators(*nodDirFlag, *takeover)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitFailed
+	}
+	if len(sets) == 0 {
+		fmt.Println("❌ Error: no indicators found")
+		return exitFailed
+	}
+
+	var addresses map[string][]string
+	if *resolve {
+		if addresses, err = resolveIndicators(sets); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+	}
+
+	b := newSTIXBuilder(*identity, strings.ToLower(*tlp), marking, sets[0].Date)
+	for _, set := range sets {
+		b.addSet(set, addresses)
+	}
+
+	if *output != "" || *serve == "" {
+		data, _ := json.MarshalIndent(b.bundle(b.entries), "", "  ")
+		data = append(data, '\n')
+		if *output == "" || *output == "-" {
+			os.Stdout.Write(data)
+		} else if err := os.WriteFile(*output, data, 0o644); err != nil {
+			fmt.Println("❌ Error writing bundle:", err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "📊 Wrote %d STIX objects from %d indicator sets\n", len(b.entries), len(sets))
+	}
+	if *serve != "" {
+		if err := serveTAXII(*serve, *auth, *identity, b); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error:", err)
+			return exitFailed
+		}
+	}
+	return exitOK
+}
+
+// resolveIndicators looks up the A and AAAA records the archive holds for
+// the indicator names on the day of their set, keyed by "date name"; sets
+// are in date order
+func resolveIndicators(sets []indicatorSet) (map[string][]string, error) {
+	wanted := make(map[string]bool)
+	for _, set := range sets {
+		for _, item := range set.Items {
+			wanted[set.Date+" "+item.Value] = true
+		}
+	}
+	filter := &archiveFilter{From: sets[0].Date, To: sets[len(sets)-1].Date}
+	files, err := filter.files()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]map[string]bool)
+	err = scanRecords(files, nil, func(r *record) error {
+		if r.ResponseType != "A" && r.ResponseType != "AAAA" {
+			return nil
+		}
+		key := r.Date + " " + indicatorValue(r.QueryName)
+		if !wanted[key] || r.Value() == "" {
+			return nil
+		}
+		if found[key] == nil {
+			found[key] = make(map[string]bool)
+		}
+		found[key][r.Value()] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make(map[string][]string, len(found))
+	for key, set := range found {
+		addresses[key] = sortedKeys(set)
+	}
+	return addresses, nil
+}
+
+// newSTIXBuilder starts a bundle with the producing identity and the TLP
+// marking definition every object refers to
+func newSTIXBuilder(name, tlp, marking, since string) *stixBuilder {
+	b := &stixBuilder{
+		identity: "identity--" + nameUUID(indicatorNamespace, "identity:"+name),
+		marking:  marking,
+		byID:     make(map[string]*stixEntry),
+	}
+	b.add(&stixEntry{ID: marking, Type: "marking-definition", Added: "2017-01-20T00:00:00.000Z", Object: map[string]any{
+		"type":            "marking-definition",
+		"spec_version":    "2.1",
+		"id":              marking,
+		"created":         "2017-01-20T00:00:00.000Z",
+		"definition_type": "tlp",
+		"name":            "TLP:" + strings.ToUpper(tlp),
+		"definition":      map[string]string{"tlp": tlp},
+	}})
+	created := stixTime(since)
+	b.add(&stixEntry{ID: b.identity, Type: "identity", Added: created, Object: map[string]any{
+		"type":                "identity",
+		"spec_version":        "2.1",
+		"id":                  b.identity,
+		"created":             created,
+		"modified":            created,
+		"name":                name,
+		"identity_class":      "organization",
+		"object_marking_refs": []string{marking},
+	}})
+	return b
+}
+
+// addSet adds an indicator per item, based on its domain-name observable,
+// and the relationships to its CNAME target and recorded addresses
+func (b *stixBuilder) addSet(set indicatorSet, addresses map[string][]string) {
+	created := stixTime(set.Date)
+	for _, item := range set.Items {
+		domain := b.observable("domain-name", item.Value, created)
+		id := "indicator--" + nameUUID(indicatorNamespace, fmt.Sprintf("stix:%s:%s:%s:%s", set.Source, set.Date, item.Value, item.Target))
+		b.add(&stixEntry{ID: id, Type: "indicator", Added: created, Object: map[string]any{
+			"type":                "indicator",
+			"spec_version":        "2.1",
+			"id":                  id,
+			"created":             created,
+			"modified":            created,
+			"created_by_ref":      b.identity,
+			"name":                item.Value,
+			"description":         item.Comment,
+			"indicator_types":     []string{"anomalous-activity"},
+			"pattern":             fmt.Sprintf("[domain-name:value = '%s']", stixEscape(item.Value)),
+			"pattern_type":        "stix",
+			"valid_from":          created,
+			"labels":              []string{set.Source},
+			"object_marking_refs": []string{b.marking},
+		}})
+		b.relationship("based-on", id, domain, created)
+
+		if item.Target != "" {
+			b.relationship("resolves-to", domain, b.observable("domain-name", item.Target, created), created)
+		}
+		for _, address := range addresses[set.Date+" "+item.Value] {
+			kind := "ipv4-addr"
+			if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+				kind = "ipv6-addr"
+			}
+			b.relationship("resolves-to", domain, b.observable(kind, address, created), created)
+		}
+	}
+}
+
+// observable adds a domain-name or address observable and returns its ID,
+// derived from its value as the specification requires
+func (b *stixBuilder) observable(kind, value, added string) string {
+	contributing, _ := json.Marshal(map[string]string{"value": value})
+	id := kind + "--" + nameUUID(stixNamespace, string(contributing))
+	b.add(&stixEntry{ID: id, Type: kind, Added: added, Object: map[string]any{
+		"type":                kind,
+		"spec_version":        "2.1",
+		"id":                  id,
+		"value":               value,
+		"object_marking_refs": []string{b.marking},
+	}})
+	return id
+}
+
+// relationship adds a relationship between two objects
+func (b *stixBuilder) relationship(kind, source, target, created string) {
+	id := "relationship--" + nameUUID(indicatorNamespace, kind+":"+source+":"+target)
+	b.add(&stixEntry{ID: id, Type: "relationship", Added: created, Object: map[string]any{
+		"type":                "relationship",
+		"spec_version":        "2.1",
+		"id":                  id,
+		"created":             created,
+		"modified":            created,
+		"created_by_ref":      b.identity,
+		"relationship_type":   kind,
+		"source_ref":          source,
+		"target_ref":          target,
+		"object_marking_refs": []string{b.marking},
+	}})
+}
+
+// add keeps the first version of an object; sets arrive in date order, so
+// that is the day the object was first observed
+func (b *stixBuilder) add(e *stixEntry) {
+	if _, ok := b.byID[e.ID]; ok {
+		return
+	}
+	b.byID[e.ID] = e
+	b.entries = append(b.entries, e)
+}
+
+// bundle wraps entries into a STIX bundle
+func (b *stixBuilder) bundle(entries []*stixEntry) map[string]any {
+	objects := make([]map[string]any, len(entries))
+	for i, e := range entries {
+		objects[i] = e.Object
+	}
+	return map[string]any{"type": "bundle", "id": "bundle--" + newUUID(), "objects": objects}
+}
+
+// sorted returns the entries ordered by the time they were added, as TAXII
+// pagination requires
+func (b *stixBuilder) sorted() []*stixEntry {
+	entries := append([]*stixEntry(nil), b.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Added < entries[j].Added })
+	return entries
+}
+
+// stixTime returns midnight UTC of a YYYY-MM-DD day in STIX timestamp form
+func stixTime(date string) string {
+	return date + "T00:00:00.000Z"
+}
+
+// stixEscape quotes a value for a string literal of a STIX pattern
+func stixEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sighting tracks when and where a name was observed
+type sighting struct {
+	Name      string   `json:"name"`
+	FirstSeen string   `json:"first_seen"`
+	LastSeen  string   `json:"last_seen"`
+	Datasets  []string `json:"datasets"`
+	Wildcard  bool     `json:"wildcard,omitempty"` // only ever resolved to the apex's wildcard data
+}
+
+// observe extends the sighting with one more dataset/day
+func (s *sighting) observe(dataset, date string) {
+	if s.FirstSeen == "" || date < s.FirstSeen {
+		s.FirstSeen = date
+	}
+	if date > s.LastSeen {
+		s.LastSeen = date
+	}
+	for _, known := range s.Datasets {
+		if known == dataset {
+			return
+		}
+	}
+	s.Datasets = append(s.Datasets, dataset)
+	sort.Strings(s.Datasets)
+}
+
+// runSubdomains lists every observed subdomain of an apex domain
+func runSubdomains(args []string) int {
+	flags := flag.NewFlagSet("subdomains", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	asJSON := flags.Bool("json", false, "Print the subdomains as JSON lines")
+	excludeWildcards := flags.Bool("exclude-wildcards", false, "Leave out names that only matched a wildcard of the apex")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("❌ Error: usage is subdomains [options] <apex>")
+		return exitUsage
+	}
+	apex := normalizeDomain(flags.Arg(0))
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	seen := make(map[string]*sighting)
+	days := make(map[[2]string]rdataSets)
+	err = scanRecords(files, nil, func(r *record) error {
+		name := strings.ToLower(r.QueryName)
+		if name == apex || !matchesDomain(name, apex, true) {
+			return nil
+		}
+		s, ok := seen[name]
+		if !ok {
+			s = &sighting{Name: name}
+			seen[name] = s
+		}
+		s.observe(r.Dataset, r.Date)
+
+		key := [2]string{r.Date, r.Dataset}
+		if days[key] == nil {
+			days[key] = make(rdataSets)
+		}
+		days[key].add(r)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+		return exitFailed
+	}
+	markWildcards(seen, days)
+
+	names := make([]string, 0, len(seen))
+	for name, s := range seen {
+		if *excludeWildcards && s.Wildcard {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, name := range names {
+		s := seen[name]
+		if *asJSON {
+			encoder.Encode(s)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", s.Name, s.FirstSeen, s.LastSeen, strings.Join(s.Datasets, ","))
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 %d subdomains of %s in %d files\n", len(names), apex, len(files))
+	return exitOK
+}
+
+// markWildcards flags the names that matched the wildcard of the apex on
+// every dataset/day they resolved
+func markWildcards(seen map[string]*sighting, days map[[2]string]rdataSets) {
+	resolved := make(map[string]int)
+	matched := make(map[string]int)
+	for _, sets := range days {
+		names := make([]string, 0, len(sets))
+		for name := range sets {
+			names = append(names, name)
+			resolved[name]++
+		}
+		w, ok := detectWildcard(sets, names, wildcardMinNames, wildcardMinShare)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if sets.signature(name) == w.Signature {
+				matched[name]++
+			}
+		}
+	}
+
+	for name, count := range matched {
+		seen[name].Wildcard = count == resolved[name]
+	}
+}
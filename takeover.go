@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rcodeNXDomain is the DNS response code of a name that does not exist
+const rcodeNXDomain = 3
+
+// takeoverServices lists hosting services where a CNAME to an unclaimed
+// resource can be claimed by anyone. Services marked claimable keep resolving
+// when the resource is gone, so their CNAMEs stay candidates even when they
+// resolve. Suffixes follow the dnsProviders convention.
+var takeoverServices = []struct {
+	suffix    string
+	service   string
+	claimable bool
+}{
+	{"s3.amazonaws.com.", "AWS S3", false},
+	{"s3-website", "AWS S3", false},
+	{"elasticbeanstalk.com.", "AWS Elastic Beanstalk", false},
+	{"cloudapp.net.", "Azure", false},
+	{"cloudapp.azure.com.", "Azure", false},
+	{"azurewebsites.net.", "Azure App Service", false},
+	{"trafficmanager.net.", "Azure Traffic Manager", false},
+	{"blob.core.windows.net.", "Azure Storage", false},
+	{"azureedge.net.", "Azure CDN", false},
+	{"herokuapp.com.", "Heroku", true},
+	{"herokudns.com.", "Heroku", true},
+	{"github.io.", "GitHub Pages", true},
+	{"bitbucket.io.", "Bitbucket", false},
+	{"netlify.app.", "Netlify", true},
+	{"vercel.app.", "Vercel", true},
+	{"surge.sh.", "Surge", true},
+	{"ghost.io.", "Ghost", true},
+	{"myshopify.com.", "Shopify", true},
+	{"wordpress.com.", "WordPress.com", true},
+	{"pantheonsite.io.", "Pantheon", true},
+	{"zendesk.com.", "Zendesk", true},
+	{"readme.io.", "ReadMe", true},
+	{"helpscoutdocs.com.", "Help Scout", true},
+	{"fly.dev.", "Fly.io", false},
+}
+
+// takeoverService returns the service a CNAME target belongs to; like
+// dnsProviders, suffixes without a trailing dot match anywhere in the name
+func takeoverService(target string) (service string, claimable bool) {
+	target = normalizeDomain(target)
+	for _, s := range takeoverServices {
+		if strings.HasSuffix(s.suffix, ".") {
+			if matchesDomain(target, s.suffix, true) {
+				return s.service, s.claimable
+			}
+		} else if strings.Contains(target, s.suffix) {
+			return s.service, s.claimable
+		}
+	}
+	return "", false
+}
+
+// aliasState collects what the measurement returned for a name with a CNAME
+type aliasState struct {
+	targets  map[string]bool
+	resolved bool
+	nxdomain bool
+}
+
+// runTakeover lists CNAMEs that point at unclaimed cloud resources or at
+// names that no longer resolve
+func runTakeover(args []string) int {
+	flags := flag.NewFlagSet("takeover", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		names := make(map[string]*aliasState)
+		state := func(name string) *aliasState {
+			s, ok := names[name]
+			if !ok {
+				s = &aliasState{targets: make(map[string]bool)}
+				names[name] = s
+			}
+			return s
+		}
+
+		err := scanRecords(day, nil, func(r *record) error {
+			name := strings.ToLower(r.QueryName)
+			switch {
+			case r.ResponseType == "CNAME" && r.CNAMEName != "":
+				state(name).targets[normalizeDomain(r.CNAMEName)] = true
+			case r.ResponseType == "A" || r.ResponseType == "AAAA":
+				state(name).resolved = true
+			}
+			if r.StatusCode == rcodeNXDomain {
+				state(name).nxdomain = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+
+		for _, name := range sorted {
+			s := names[name]
+			for _, target := range sortedKeys(s.targets) {
+				service, claimable := takeoverService(target)
+
+				var evidence []string
+				switch {
+				case s.nxdomain:
+					evidence = append(evidence, "nxdomain")
+				case !s.resolved:
+					evidence = append(evidence, "no-address")
+				case !claimable || service == "":
+					continue // resolving CNAMEs are only suspicious for claimable services
+				}
+				confidence := "low"
+				if service != "" {
+					evidence = append(evidence, "service")
+					confidence = "medium"
+					if len(evidence) > 1 {
+						confidence = "high"
+					}
+				}
+				rows = append(rows, []string{day[0].Date, day[0].Dataset, name, target, service,
+					strings.Join(evidence, "+"), confidence})
+			}
+		}
+	}
+
+	headers := []string{"date", "dataset", "name", "target", "service", "evidence", "confidence"}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "📊 %d takeover candidates\n", len(rows))
+	return exitOK
+}
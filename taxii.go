@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	taxiiMediaType = "application/taxii+json;version=2.1"
+	stixMediaType  = "application/stix+json;version=2.1"
+	taxiiPageSize  = 1000
+)
+
+// taxiiServer serves one read-only collection of STIX objects over the
+// subset of TAXII 2.1 that TIPs poll: discovery, API root, collections,
+// objects and manifest
+type taxiiServer struct {
+	title      string
+	collection string
+	auth       string
+	entries    []*stixEntry // ordered by date added
+}
+
+// serveTAXII serves the objects of a bundle on addr until the server fails
+func serveTAXII(addr, auth, title string, b *stixBuilder) error {
+	s := &taxiiServer{
+		title:      title,
+		collection: nameUUID(indicatorNamespace, "collection:"+title),
+		auth:       auth,
+		entries:    b.sorted(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /taxii2/{$}", s.discovery)
+	mux.HandleFunc("GET /api/{$}", s.apiRoot)
+	mux.HandleFunc("GET /api/collections/{$}", s.collections)
+	mux.HandleFunc("GET /api/collections/{id}/{$}", s.collectionInfo)
+	mux.HandleFunc("GET /api/collections/{id}/objects/{$}", s.objects)
+	mux.HandleFunc("GET /api/collections/{id}/objects/{object}/{$}", s.objects)
+	mux.HandleFunc("GET /api/collections/{id}/manifest/{$}", s.manifest)
+
+	fmt.Fprintf(os.Stderr, "🛰️  Serving %d STIX objects as TAXII collection %s on %s/taxii2/\n", len(s.entries), s.collection, addr)
+	server := &http.Server{Addr: addr, Handler: s.authenticate(mux), ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
+
+// authenticate requires the --auth credentials when they are set
+func (s *taxiiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth != "" {
+			user, password, _ := r.BasicAuth()
+			if subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(s.auth)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="taxii"`)
+				s.fail(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// discovery lists the single API root
+func (s *taxiiServer) discovery(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	root := scheme + "://" + r.Host + "/api/"
+	s.reply(w, map[string]any{"title": s.title, "default": root, "api_roots": []string{root}})
+}
+
+// apiRoot describes the API root
+func (s *taxiiServer) apiRoot(w http.ResponseWriter, r *http.Request) {
+	s.reply(w, map[string]any{"title": s.title, "versions": []string{taxiiMediaType}, "max_content_length": 0})
+}
+
+// collections lists the single collection
+func (s *taxiiServer) collections(w http.ResponseWriter, r *http.Request) {
+	s.reply(w, map[string]any{"collections": []any{s.info()}})
+}
+
+// collectionInfo describes the collection
+func (s *taxiiServer) collectionInfo(w http.ResponseWriter, r *http.Request) {
+	if s.found(w, r) {
+		s.reply(w, s.info())
+	}
+}
+
+// objects returns a page of the objects matching the request filters
+func (s *taxiiServer) objects(w http.ResponseWriter, r *http.Request) {
+	if !s.found(w, r) {
+		return
+	}
+	page, more, next, ok := s.page(w, r)
+	if !ok {
+		return
+	}
+	objects := make([]map[string]any, len(page))
+	for i, e := range page {
+		objects[i] = e.Object
+	}
+	s.replyPage(w, page, map[string]any{"more": more, "next": next, "objects": objects})
+}
+
+// manifest returns the manifest records of the objects matching the filters
+func (s *taxiiServer) manifest(w http.ResponseWriter, r *http.Request) {
+	if !s.found(w, r) {
+		return
+	}
+	page, more, next, ok := s.page(w, r)
+	if !ok {
+		return
+	}
+	records := make([]map[string]any, len(page))
+	for i, e := range page {
+		version, _ := e.Object["modified"].(string)
+		if version == "" {
+			version = e.Added
+		}
+		records[i] = map[string]any{"id": e.ID, "date_added": e.Added, "version": version, "media_type": stixMediaType}
+	}
+	s.replyPage(w, page, map[string]any{"more": more, "next": next, "objects": records})
+}
+
+// page applies added_after, match[id], match[type], limit and next to the
+// objects of the collection
+func (s *taxiiServer) page(w http.ResponseWriter, r *http.Request) ([]*stixEntry, bool, string, bool) {
+	query := r.URL.Query()
+	var after time.Time
+	if v := query.Get("added_after"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			s.fail(w, http.StatusBadRequest, "invalid added_after")
+			return nil, false, "", false
+		}
+		after = t
+	}
+	limit := taxiiPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			s.fail(w, http.StatusBadRequest, "invalid limit")
+			return nil, false, "", false
+		}
+		limit = min(n, taxiiPageSize)
+	}
+	offset := 0
+	if v := query.Get("next"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			s.fail(w, http.StatusBadRequest, "invalid next")
+			return nil, false, "", false
+		}
+		offset = n
+	}
+	ids := splitMatch(query.Get("match[id]"))
+	if object := r.PathValue("object"); object != "" {
+		ids = map[string]bool{object: true}
+	}
+	types := splitMatch(query.Get("match[type]"))
+
+	var matched []*stixEntry
+	for _, e := range s.entries {
+		if ids != nil && !ids[e.ID] || types != nil && !types[e.Type] {
+			continue
+		}
+		if !after.IsZero() {
+			if added, _ := time.Parse(time.RFC3339Nano, e.Added); !added.After(after) {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+	if r.PathValue("object") != "" && len(matched) == 0 {
+		s.fail(w, http.StatusNotFound, "object not found")
+		return nil, false, "", false
+	}
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := min(offset+limit, len(matched))
+	if end < len(matched) {
+		return matched[offset:end], true, strconv.Itoa(end), true
+	}
+	return matched[offset:end], false, "", true
+}
+
+// splitMatch parses a comma-separated match filter, nil when absent
+func splitMatch(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, v := range strings.Split(value, ",") {
+		set[strings.TrimSpace(v)] = true
+	}
+	return set
+}
+
+// found reports whether the request names the collection, failing it otherwise
+func (s *taxiiServer) found(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("id") != s.collection {
+		s.fail(w, http.StatusNotFound, "collection not found")
+		return false
+	}
+	return true
+}
+
+// info is the collection resource
+func (s *taxiiServer) info() map[string]any {
+	return map[string]any{
+		"id":          s.collection,
+		"title":       s.title + " indicators",
+		"description": "Newly observed domains and takeover candidates derived from the OpenINTEL toplists",
+		"can_read":    true,
+		"can_write":   false,
+		"media_types": []string{stixMediaType},
+	}
+}
+
+// replyPage writes an envelope or manifest with its date-added headers
+func (s *taxiiServer) replyPage(w http.ResponseWriter, page []*stixEntry, body map[string]any) {
+	if len(page) > 0 {
+		w.Header().Set("X-TAXII-Date-Added-First", page[0].Added)
+		w.Header().Set("X-TAXII-Date-Added-Last", page[len(page)-1].Added)
+	}
+	if body["next"] == "" {
+		delete(body, "next")
+	}
+	s.reply(w, body)
+}
+
+// reply writes a TAXII resource
+func (s *taxiiServer) reply(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", taxiiMediaType)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail writes a TAXII error message
+func (s *taxiiServer) fail(w http.ResponseWriter, status int, title string) {
+	w.Header().Set("Content-Type", taxiiMediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"title": title, "http_status": strconv.Itoa(status)})
+}
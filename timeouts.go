@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	// listingTimeout bounds the wait for the response headers of listing
+	// pages and other small requests; downloads are bounded by the stall
+	// check instead
+	listingTimeout = 15 * time.Second
+	// dialTimeout bounds the TCP connection to a server or proxy
+	dialTimeout = 30 * time.Second
+	// tlsTimeout bounds the TLS handshake
+	tlsTimeout = 10 * time.Second
+	// idleTimeout is how long an unused connection is kept for reuse
+	idleTimeout = 90 * time.Second
+)
+
+// addTimeoutFlags registers the connection timeout flags of the commands
+// that talk to the archive
+func addTimeoutFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&listingTimeout, "list-timeout", listingTimeout, "How long listing pages and other small requests may take to send their response headers")
+	flags.DurationVar(&dialTimeout, "dial-timeout", dialTimeout, "How long connecting to a server or proxy may take")
+	flags.DurationVar(&tlsTimeout, "tls-timeout", tlsTimeout, "How long a TLS handshake may take")
+	flags.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "How long an unused connection is kept open for reuse (0 keeps it indefinitely)")
+}
+
+// checkTimeouts validates the timeout flags
+func checkTimeouts() error {
+	if listingTimeout <= 0 || dialTimeout <= 0 || tlsTimeout <= 0 {
+		return errors.New("-list-timeout, -dial-timeout and -tls-timeout must be positive")
+	}
+	if idleTimeout < 0 {
+		return errors.New("-idle-timeout must not be negative")
+	}
+	return nil
+}
+
+// headerTimeoutTransport fails requests whose response headers do not arrive
+// in time, without bounding how long the body then takes to read
+type headerTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// The timer fired, whether or not the headers made it in time
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("no response from %s within %s", req.URL.Host, t.timeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelingBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelingBody releases the context of a request when its body is closed
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
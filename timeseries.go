@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// dayMetrics accumulates the longitudinal metrics of one dataset/day
+type dayMetrics struct {
+	records int
+	names   map[string]bool
+	domains map[string]*dnssecState
+	ips     map[netip.Addr]bool
+	ns      map[string]map[string]bool // provider -> domains
+	withNS  map[string]bool
+}
+
+// add accounts for one record
+func (m *dayMetrics) add(r *record) {
+	m.records++
+	name := strings.ToLower(r.QueryName)
+	m.names[name] = true
+
+	domain := registrableDomain(name)
+	state, ok := m.domains[domain]
+	if !ok {
+		state = &dnssecState{}
+		m.domains[domain] = state
+	}
+
+	switch r.ResponseType {
+	case "A", "AAAA":
+		if addr, err := netip.ParseAddr(r.IP4Address + r.IP6Address); err == nil {
+			m.ips[addr] = true
+		}
+	case "DS":
+		state.ds = true
+	case "DNSKEY":
+		state.dnskey = true
+	case "NS":
+		provider := nsProvider(r.NSAddress)
+		if m.ns[provider] == nil {
+			m.ns[provider] = make(map[string]bool)
+		}
+		m.ns[provider][name] = true
+		m.withNS[name] = true
+	}
+}
+
+// metricColumn turns a provider name into a column name
+func metricColumn(provider string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(provider) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return "ns_share_" + b.String()
+}
+
+// runTimeseries emits one row of metrics per day and dataset for charting
+// longitudinal trends
+func runTimeseries(args []string) int {
+	flags := flag.NewFlagSet("timeseries", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	providers := flags.String("providers", "Cloudflare,Amazon Route 53,GoDaddy,Google", "Comma-separated DNS providers to report name server shares of")
+	format := flags.String("format", "csv", "Output format: "+strings.Join(reportFormats, ", ")+", parquet")
+	output := flags.String("output", "", "File receiving the series (required for parquet)")
+	flags.Parse(args)
+
+	if *format == "parquet" && *output == "" {
+		fmt.Println("❌ Error: --format parquet needs --output")
+		return exitUsage
+	}
+	if *format != "parquet" && !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	var tracked []string
+	for _, p := range strings.Split(*providers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			tracked = append(tracked, p)
+		}
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	headers := []string{"date", "dataset", "records", "names", "domains", "ips", "dnssec_share"}
+	for _, provider := range tracked {
+		headers = append(headers, metricColumn(provider))
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		m := &dayMetrics{
+			names:   make(map[string]bool),
+			domains: make(map[string]*dnssecState),
+			ips:     make(map[netip.Addr]bool),
+			ns:      make(map[string]map[string]bool),
+			withNS:  make(map[string]bool),
+		}
+		if err := scanRecords(day, nil, func(r *record) error { m.add(r); return nil }); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		signed := 0
+		for _, state := range m.domains {
+			if state.signed() {
+				signed++
+			}
+		}
+		row := []string{day[0].Date, day[0].Dataset, strconv.Itoa(m.records), strconv.Itoa(len(m.names)),
+			strconv.Itoa(len(m.domains)), strconv.Itoa(len(m.ips)), percent(signed, len(m.domains))}
+		for _, provider := range tracked {
+			row = append(row, percent(len(m.ns[provider]), len(m.withNS)))
+		}
+		rows = append(rows, row)
+	}
+
+	if *format == "parquet" {
+		err = writeParquetTable(*output, headers, rows)
+	} else if *output != "" {
+		err = writeTableFile(*output, *format, headers, rows)
+	} else {
+		err = writeTable(*format, headers, rows)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing series:", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	tlsInsecure bool   // Skip the verification of server certificates
+	tlsCACert   string // PEM file of extra certificate authorities to trust
+	tlsCADir    string // Directory of PEM files of extra certificate authorities
+	clientCert  string // PEM file of the client certificate presented for mutual TLS
+	clientKey   string // PEM file of its private key, if not in clientCert
+)
+
+// addTLSFlags registers the certificate verification flags of the commands
+// that talk to the archive
+func addTLSFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&tlsInsecure, "insecure", false, "Skip TLS certificate verification (not recommended)")
+	flags.StringVar(&tlsCACert, "ca-cert", "", "PEM file of extra CA certificates to trust, e.g. a corporate proxy CA (optional)")
+	flags.StringVar(&tlsCADir, "ca-dir", "", "Directory of PEM files (*.pem, *.crt, *.cer) of extra CA certificates to trust (optional)")
+	flags.StringVar(&clientCert, "client-cert", "", "PEM file of a client certificate for gateways and mirrors requiring mutual TLS (optional)")
+	flags.StringVar(&clientKey, "client-key", "", "PEM file of the private key of -client-cert (default: read from -client-cert)")
+}
+
+// tlsConfig builds the TLS configuration of the archive client: the system
+// roots, plus the --ca-cert and --ca-dir authorities, unless verification is
+// disabled, and the --client-cert certificate if the servers ask for one
+func tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	var files []string
+	if tlsCACert != "" {
+		files = append(files, tlsCACert)
+	}
+	if tlsCADir != "" {
+		found, err := caDirFiles(tlsCADir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	if len(files) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		for _, file := range files {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, errors.New(file + ": no PEM certificates found")
+			}
+		}
+		config.RootCAs = roots
+		fmt.Printf("🔐 Trusting the system CAs plus the certificates of %d file(s)\n", len(files))
+	}
+	if clientKey != "" && clientCert == "" {
+		return nil, errors.New("-client-key requires -client-cert")
+	}
+	if clientCert != "" {
+		keyFile := clientKey
+		if keyFile == "" {
+			keyFile = clientCert
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+		fmt.Println("🪪 Presenting client certificate", clientCert)
+	}
+	if tlsInsecure {
+		fmt.Println("⚠️  TLS certificate verification is disabled")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// caDirFiles lists the certificate files of a --ca-dir directory
+func caDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".pem", ".crt", ".cer":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New(dir + ": no .pem, .crt or .cer files found")
+	}
+	return files, nil
+}
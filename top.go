@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// topAggregations maps the --by values of the top command to the response
+// type they read and the key a record value is counted under
+var topAggregations = map[string]struct {
+	responseType string
+	key          func(r *record) string
+}{
+	"mx":      {"MX", func(r *record) string { return registrableDomain(r.MXAddress) }},
+	"mx-host": {"MX", func(r *record) string { return strings.ToLower(r.MXAddress) }},
+	"ns":      {"NS", func(r *record) string { return strings.ToLower(r.NSAddress) }},
+	"ns-set":  {"NS", func(r *record) string { return strings.ToLower(r.NSAddress) }},
+	"ip":      {"", func(r *record) string { return r.IP4Address + r.IP6Address }},
+	"cname":   {"CNAME", func(r *record) string { return strings.ToLower(r.CNAMEName) }},
+}
+
+// runTop reports the most common MX providers, NS sets, shared addresses or
+// CNAME targets per day and dataset
+func runTop(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	by := flags.String("by", "mx", "Aggregate by "+strings.Join(topKinds(), ", "))
+	limit := flags.Int("top", 10, "Entries reported per day and dataset (0 for all)")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	aggregation, ok := topAggregations[*by]
+	if !ok {
+		fmt.Println("❌ Error: --by must be one of", strings.Join(topKinds(), ", "))
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		// domain -> values of the aggregated record type
+		values := make(map[string]map[string]bool)
+		err := scanRecords(day, nil, func(r *record) error {
+			if aggregation.responseType == "" {
+				if r.ResponseType != "A" && r.ResponseType != "AAAA" {
+					return nil
+				}
+			} else if r.ResponseType != aggregation.responseType {
+				return nil
+			}
+			value := aggregation.key(r)
+			if value == "" {
+				return nil
+			}
+
+			name := strings.ToLower(r.QueryName)
+			if values[name] == nil {
+				values[name] = make(map[string]bool)
+			}
+			values[name][value] = true
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		// key -> number of domains counted under it
+		counts := make(map[string]int)
+		for _, set := range values {
+			if *by == "ns-set" {
+				counts[strings.Join(sortedKeys(set), " ")]++
+				continue
+			}
+			for value := range set {
+				counts[value]++
+			}
+		}
+
+		for _, key := range topKeys(counts, *limit) {
+			rows = append(rows, []string{day[0].Date, day[0].Dataset, key, strconv.Itoa(counts[key]), percent(counts[key], len(values))})
+		}
+	}
+
+	if err := writeTable(*format, []string{"date", "dataset", *by, "domains", "share"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// topKinds lists the supported aggregations in sorted order
+func topKinds() []string {
+	kinds := make([]string, 0, len(topAggregations))
+	for kind := range topAggregations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// topKeys returns the limit keys with the highest counts, ties broken by name
+func topKeys(counts map[string]int, limit int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
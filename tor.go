@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var (
+	torMode bool   // Route every request through Tor
+	torAddr string // SOCKS port of the local Tor client
+)
+
+const (
+	// torWorkers and torListWorkers replace the default worker counts over
+	// Tor: circuits are slow, and the network is shared
+	torWorkers     = 3
+	torListWorkers = 2
+)
+
+// addTorFlags registers the Tor flags of the commands that talk to the
+// archive
+func addTorFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&torMode, "tor", false, "Route every request through Tor, one circuit per worker")
+	flags.StringVar(&torAddr, "tor-addr", "127.0.0.1:9050", "SOCKS address of the local Tor client")
+}
+
+// torDefaults lowers the worker counts and raises the listing timeout for
+// Tor, unless they were set on the command line; every command with
+// addTorFlags calls it once its flags are parsed
+func torDefaults(flags *flag.FlagSet) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["workers"] {
+		workerLimit = torWorkers
+	}
+	if !set["list-workers"] {
+		listingWorkers = torListWorkers
+	}
+	if !set["list-timeout"] {
+		listingTimeout = 4 * listingTimeout
+	}
+}
+
+// torLaneKey is the context key of the lane a request goes through Tor on
+type torLaneKey struct{}
+
+// torSettings returns the proxy function of Tor mode, after checking that
+// the Tor client answers. Tor isolates streams opened with different SOCKS
+// credentials on different circuits, so every lane, one per request in
+// flight, gets credentials of its own; the names of the archive are
+// resolved by the exit, never locally.
+func torSettings(dialer *familyDialer) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL != "" || httpProxy != "" || httpsProxy != "" || proxyList != "" {
+		return nil, errors.New("-tor cannot be combined with -proxy, -http-proxy, -https-proxy or -proxy-list")
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", torAddr)
+	if err != nil {
+		return nil, fmt.Errorf("tor: %w (is the Tor client running?)", err)
+	}
+	conn.Close()
+	fmt.Println("🧅 Routing every request through Tor at", torAddr)
+
+	host, port, err := net.SplitHostPort(torAddr)
+	if err != nil {
+		return nil, err
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		lane, _ := req.Context().Value(torLaneKey{}).(int)
+		return &url.URL{
+			Scheme: "socks5h",
+			User:   url.UserPassword("gopenintel-"+strconv.Itoa(lane), "isolate"),
+			Host:   net.JoinHostPort(host, port),
+		}, nil
+	}, nil
+}
+
+// torTransport gives every request in flight a lane of its own, held until
+// its body is closed. Connections are pooled per lane, so a worker keeps
+// its circuit while other workers use theirs.
+type torTransport struct {
+	next  http.RoundTripper
+	lanes chan int
+}
+
+// newTorTransport returns a transport with one lane per request the client
+// may have in flight
+func newTorTransport(next http.RoundTripper, lanes int) *torTransport {
+	t := &torTransport{next: next, lanes: make(chan int, lanes)}
+	for lane := range lanes {
+		t.lanes <- lane
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *torTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var lane int
+	select {
+	case lane = <-t.lanes:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { t.lanes <- lane }
+	resp, err := t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), torLaneKey{}, lane)))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ttlBuckets are the upper bounds, in seconds, of the histogram buckets
+var ttlBuckets = []int64{0, 60, 300, 900, 3600, 14400, 86400}
+
+// ttlCounts counts how often each TTL occurred; TTLs take few distinct
+// values, so this stays small however many records are read
+type ttlCounts map[int64]int
+
+// quantiles returns the TTL at each quantile q of the distribution
+func (c ttlCounts) quantiles(qs ...float64) []int64 {
+	ttls := make([]int64, 0, len(c))
+	total := 0
+	for ttl, n := range c {
+		ttls = append(ttls, ttl)
+		total += n
+	}
+	sort.Slice(ttls, func(i, j int) bool { return ttls[i] < ttls[j] })
+
+	result := make([]int64, len(qs))
+	for i, q := range qs {
+		rank := int(q*float64(total-1)) + 1 // nearest rank, 1-based
+		seen := 0
+		for _, ttl := range ttls {
+			seen += c[ttl]
+			if seen >= rank {
+				result[i] = ttl
+				break
+			}
+		}
+	}
+	return result
+}
+
+// runTTL reports the TTL distribution per record type, day and dataset
+func runTTL(args []string) int {
+	flags := flag.NewFlagSet("ttl", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	types := flags.String("types", "", "Comma-separated record types to report (default all)")
+	histogram := flags.Bool("histogram", false, "Report bucket counts instead of percentiles")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+	wanted := make(map[string]bool)
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			wanted[t] = true
+		}
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		counts := make(map[string]ttlCounts)
+		err := scanRecords(day, nil, func(r *record) error {
+			if r.ResponseType == "" || len(wanted) > 0 && !wanted[r.ResponseType] {
+				return nil
+			}
+			if counts[r.ResponseType] == nil {
+				counts[r.ResponseType] = make(ttlCounts)
+			}
+			counts[r.ResponseType][r.TTL]++
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		rrTypes := make([]string, 0, len(counts))
+		for rrType := range counts {
+			rrTypes = append(rrTypes, rrType)
+		}
+		sort.Strings(rrTypes)
+
+		for _, rrType := range rrTypes {
+			c := counts[rrType]
+			prefix := []string{day[0].Date, day[0].Dataset, rrType}
+			if *histogram {
+				rows = append(rows, ttlHistogramRows(prefix, c)...)
+				continue
+			}
+
+			total, sum := 0, int64(0)
+			for ttl, n := range c {
+				total += n
+				sum += ttl * int64(n)
+			}
+			row := append(prefix, strconv.Itoa(total))
+			for _, q := range c.quantiles(0, 0.25, 0.5, 0.75, 0.9, 0.99, 1) {
+				row = append(row, strconv.FormatInt(q, 10))
+			}
+			rows = append(rows, append(row, strconv.FormatFloat(float64(sum)/float64(total), 'f', 1, 64)))
+		}
+	}
+
+	headers := []string{"date", "dataset", "type", "records", "min", "p25", "p50", "p75", "p90", "p99", "max", "mean"}
+	if *histogram {
+		headers = []string{"date", "dataset", "type", "bucket", "records", "share"}
+	}
+	if err := writeTable(*format, headers, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// ttlHistogramRows counts the TTLs falling in each of ttlBuckets
+func ttlHistogramRows(prefix []string, c ttlCounts) [][]string {
+	buckets := make([]int, len(ttlBuckets)+1)
+	total := 0
+	for ttl, n := range c {
+		i := sort.Search(len(ttlBuckets), func(i int) bool { return ttl <= ttlBuckets[i] })
+		buckets[i] += n
+		total += n
+	}
+
+	rows := make([][]string, 0, len(buckets))
+	for i, n := range buckets {
+		var label string
+		switch {
+		case i == 0:
+			label = "0"
+		case i == len(ttlBuckets):
+			label = ">" + strconv.FormatInt(ttlBuckets[i-1], 10)
+		default:
+			label = strconv.FormatInt(ttlBuckets[i-1]+1, 10) + "-" + strconv.FormatInt(ttlBuckets[i], 10)
+		}
+		row := append(append([]string(nil), prefix...), label, strconv.Itoa(n), percent(n, total))
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetMagic opens and closes every parquet file
+var parquetMagic = []byte("PAR1")
+
+// errHTMLResponse reports a web page (agreement, login or redirect page)
+// served where a parquet file was expected
+var errHTMLResponse = errors.New("server returned an HTML page instead of parquet data")
+
+// errInvalidFile reports a downloaded file that failed validation
+var errInvalidFile = errors.New("invalid file")
+
+// errNotModified reports that a conditional download found the local copy current
+var errNotModified = errors.New("not modified")
+
+// maxDownloadAttempts bounds how often an invalid file is downloaded again
+const maxDownloadAttempts = 3
+
+// validateFile checks that a downloaded file is a complete parquet file: magic
+// bytes, a parseable footer and column chunks that fit inside the file. When
+// expectedSize is not negative the file must also have exactly that size.
+func validateFile(path string, expectedSize int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	if expectedSize >= 0 && size != expectedSize {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", expectedSize, size)
+	}
+
+	// Header magic + footer length + trailing magic
+	if size < 12 {
+		return fmt.Errorf("file too small to be parquet (%d bytes)", size)
+	}
+
+	header := make([]byte, 4)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("unreadable header: %w", err)
+	}
+	if !bytes.Equal(header, parquetMagic) {
+		if looksLikeHTML(header) {
+			return errHTMLResponse
+		}
+		return fmt.Errorf("bad magic bytes %q at start of file", header)
+	}
+
+	trailer := make([]byte, 8)
+	if _, err := f.ReadAt(trailer, size-8); err != nil {
+		return fmt.Errorf("unreadable footer: %w", err)
+	}
+	if !bytes.Equal(trailer[4:], parquetMagic) {
+		return fmt.Errorf("bad magic bytes %q at end of file", trailer[4:])
+	}
+
+	footerLen := int64(binary.LittleEndian.Uint32(trailer[:4]))
+	if footerLen == 0 || footerLen > size-12 {
+		return fmt.Errorf("unreadable footer: invalid length %d", footerLen)
+	}
+
+	// Parse the file metadata so garbled footers are caught now rather than
+	// by whoever reads the file later
+	file, err := parquet.OpenFile(f, size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return fmt.Errorf("unreadable footer: %w", err)
+	}
+	if len(file.Schema().Fields()) == 0 {
+		return fmt.Errorf("file metadata has no columns")
+	}
+
+	dataEnd := size - 8 - footerLen
+	for _, rowGroup := range file.Metadata().RowGroups {
+		for _, chunk := range rowGroup.Columns {
+			start := chunk.MetaData.DataPageOffset
+			if offset := chunk.MetaData.DictionaryPageOffset; offset > 0 && offset < start {
+				start = offset
+			}
+			if start < int64(len(parquetMagic)) || start+chunk.MetaData.TotalCompressedSize > dataEnd {
+				return fmt.Errorf("column chunk %s lies outside the data section",
+					strings.Join(chunk.MetaData.PathInSchema, "."))
+			}
+		}
+	}
+	return nil
+}
+
+// looksLikeHTML reports whether the first bytes of a body are markup
+func looksLikeHTML(head []byte) bool {
+	trimmed := bytes.TrimLeft(head, "\xef\xbb\xbf \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '<' {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(head), "text/html")
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifyProblem is a manifest entry whose local file is missing or corrupt
+type verifyProblem struct {
+	Manifest *manifest
+	Index    int
+	Reason   string
+}
+
+// runVerify re-hashes local files against the stored manifests
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	redownload := flags.Bool("redownload", false, "Re-download missing and corrupt files")
+	signatures := flags.Bool("signatures", false, "Require a valid GPG signature on every manifest")
+	keyring := flags.String("keyring", "", "Keyring file (from gpg --export) trusted for signatures")
+	addProxyFlags(flags)
+	addTLSFlags(flags)
+	addDNSFlags(flags)
+	addNetworkFlags(flags)
+	addTorFlags(flags)
+	addPolitenessFlags(flags)
+	addTimeoutFlags(flags)
+	flags.Parse(args)
+	if torMode {
+		torDefaults(flags)
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Println("❌ Error: verify accepts at most one path.")
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		downloadDir = flags.Arg(0)
+	}
+	if *redownload {
+		if err := configureHTTPClient(); err != nil {
+			fmt.Println("❌ Error configuring the HTTP client:", err)
+			return exitUsage
+		}
+	}
+
+	manifests, err := loadManifests()
+	if err != nil {
+		fmt.Println("❌ Error reading manifests:", err)
+		return exitFailed
+	}
+	if len(manifests) == 0 {
+		fmt.Println("❌ No manifests found in", filepath.Join(downloadDir, manifestDir))
+		return exitFailed
+	}
+
+	fmt.Println("🔍 Verifying archive:", downloadDir)
+
+	// Check manifest signatures before trusting their content
+	badSignatures := 0
+	if *signatures || *keyring != "" {
+		for _, m := range manifests {
+			if err := verifyManifestSignature(m.path, *keyring); err != nil {
+				fmt.Printf("❌ Bad signature: %s (%v)\n", m.path, err)
+				badSignatures++
+			}
+		}
+		fmt.Printf("🔏 Checked %d manifest signatures: %d invalid\n", len(manifests), badSignatures)
+		if badSignatures > 0 {
+			return exitFailed
+		}
+	}
+
+	// Check every file referenced by a manifest
+	var problems []verifyProblem
+	referenced := make(map[string]bool)
+	checked := 0
+	for _, m := range manifests {
+		for i, entry := range m.Files {
+			checked++
+			path := filepath.Join(downloadDir, entry.Name)
+			referenced[filepath.Clean(path)] = true
+
+			if reason := checkEntry(path, entry); reason != "" {
+				fmt.Printf("❌ %s: %s (%s %s)\n", reason, path, m.Dataset, m.Date)
+				problems = append(problems, verifyProblem{Manifest: m, Index: i, Reason: reason})
+			}
+		}
+	}
+
+	// Report files on disk that no manifest knows about
+	extra := 0
+	err = filepath.WalkDir(downloadDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == filepath.Join(downloadDir, manifestDir) || path == filepath.Join(downloadDir, quarantineDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".parquet") || referenced[filepath.Clean(path)] {
+			return nil
+		}
+		fmt.Println("➕ Extra file:", path)
+		extra++
+		return nil
+	})
+	if err != nil {
+		fmt.Println("❌ Error scanning archive:", err)
+		return exitFailed
+	}
+
+	missing, corrupt := 0, 0
+	for _, p := range problems {
+		if p.Reason == "Missing" {
+			missing++
+		} else {
+			corrupt++
+		}
+	}
+	fmt.Printf("📊 Verified %d files: %d ok, %d missing, %d corrupt, %d extra\n",
+		checked, checked-len(problems), missing, corrupt, extra)
+
+	if *redownload && len(problems) > 0 {
+		if failed := redownloadProblems(problems); failed > 0 {
+			fmt.Printf("❌ %d files could not be re-downloaded\n", failed)
+			return exitFailed
+		}
+		fmt.Println("✅ All missing and corrupt files were re-downloaded")
+		return exitOK
+	}
+
+	if len(problems) > 0 {
+		return exitFailed
+	}
+	fmt.Println("✅ Archive is consistent with its manifests")
+	return exitOK
+}
+
+// runSign signs every manifest of an archive with a GPG key
+func runSign(args []string) int {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	flags.StringVar(&signKey, "key", "", "GPG key ID used to sign manifests")
+	flags.Parse(args)
+
+	if signKey == "" || flags.NArg() > 1 {
+		fmt.Println("❌ Error: usage is sign --key=ID [path]")
+		return exitUsage
+	}
+	if flags.NArg() == 1 {
+		downloadDir = flags.Arg(0)
+	}
+
+	manifests, err := loadManifests()
+	if err != nil {
+		fmt.Println("❌ Error reading manifests:", err)
+		return exitFailed
+	}
+
+	failed := 0
+	for _, m := range manifests {
+		if err := signManifest(m.path); err != nil {
+			fmt.Println("❌ Error signing manifest:", err)
+			failed++
+		}
+	}
+	fmt.Printf("🔏 Signed %d of %d manifests\n", len(manifests)-failed, len(manifests))
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// loadManifests reads every manifest stored in the archive
+func loadManifests() ([]*manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(downloadDir, manifestDir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*manifest
+	for _, path := range paths {
+		m, err := readManifest(path)
+		if err == nil {
+			err = checkManifest(m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// checkEntry compares a local file with its manifest entry and returns
+// a non-empty reason when they differ
+func checkEntry(path string, entry manifestEntry) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "Missing"
+	}
+	if info.Size() != entry.Size {
+		return "Size mismatch"
+	}
+
+	actual, err := hashFile(path, entry.SourceURL)
+	if err != nil {
+		return "Unreadable"
+	}
+	if actual.SHA256 != entry.SHA256 {
+		return "Checksum mismatch"
+	}
+	return ""
+}
+
+// redownloadProblems quarantines broken files, fetches them again and
+// updates their manifests; it returns the number of files that failed
+func redownloadProblems(problems []verifyProblem) int {
+	failed := 0
+	updated := make(map[*manifest]bool)
+
+	for _, p := range problems {
+		entry := p.Manifest.Files[p.Index]
+		path := filepath.Join(downloadDir, entry.Name)
+
+		if p.Reason != "Missing" {
+			quarantine(path, entry.SourceURL, errors.New(strings.ToLower(p.Reason)))
+			if _, err := os.Stat(path); err == nil {
+				failed++
+				continue
+			}
+		}
+
+		fresh, ok := downloadFile(entry.SourceURL, path, nil)
+		if !ok {
+			failed++
+			continue
+		}
+		p.Manifest.Files[p.Index] = fresh
+		updated[p.Manifest] = true
+	}
+
+	for m := range updated {
+		if err := writeManifest(m); err != nil {
+			fmt.Println("❌ Error writing manifest:", err)
+		}
+	}
+	return failed
+}
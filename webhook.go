@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookTimeout bounds one delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts is how many times a delivery is tried before it is
+	// given up, waiting twice as long after every failure
+	webhookAttempts = 4
+	// failureWebhookSlots bounds the failure events delivered at once, as
+	// an outage fails many files in a burst
+	failureWebhookSlots = 4
+)
+
+// webhookEvent is the body posted to the webhooks
+type webhookEvent struct {
+	Event   string         `json:"event"` // job.succeeded, job.failed, job.canceled, day.downloaded, listing.failed or file.failed
+	Time    time.Time      `json:"time"`
+	Job     *serveJob      `json:"job,omitempty"`
+	JobID   string         `json:"job_id,omitempty"` // job that downloaded the day
+	Day     *downloadEvent `json:"day,omitempty"`
+	Failure *crawlFailure  `json:"failure,omitempty"`
+}
+
+// failureHooks posts an event for every listing page or file the crawl
+// gives up on when it is started with -failure-hook; nil without
+var failureHooks *webhooks
+
+// webhooks posts the events of the jobs to the --webhook URLs
+type webhooks struct {
+	urls    []*url.URL
+	secret  string // signs the bodies when set
+	days    bool   // also post an event for every downloaded day
+	client  *http.Client
+	slots   chan struct{} // bounds the deliveries in flight when set
+	header  http.Header   // added to every delivery, such as an API key
+	pending sync.WaitGroup
+}
+
+// newWebhooks parses a comma-separated list of webhook URLs
+func newWebhooks(list, secret string, days bool) (*webhooks, error) {
+	hooks := &webhooks{secret: secret, days: days, client: &http.Client{Timeout: webhookTimeout}}
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: expected an http:// or https:// URL", raw)
+		}
+		hooks.urls = append(hooks.urls, u)
+	}
+	if len(hooks.urls) == 0 && (secret != "" || days) {
+		return nil, errors.New("-webhook-secret and -webhook-days require -webhook")
+	}
+	return hooks, nil
+}
+
+// jobFinished posts the outcome of a job, its summary included
+func (h *webhooks) jobFinished(job serveJob) {
+	h.send(webhookEvent{Event: "job." + job.State, Time: time.Now().UTC(), Job: &job})
+}
+
+// dayDownloaded posts the content of a day a job wrote the manifest of
+func (h *webhooks) dayDownloaded(jobID, manifestPath string) {
+	if !h.days || len(h.urls) == 0 {
+		return
+	}
+	m, err := readManifest(manifestPath)
+	if err != nil {
+		fmt.Println("❌ Error reading manifest for webhook:", err)
+		return
+	}
+	day := newDownloadEvent(m)
+	h.send(webhookEvent{Event: "day.downloaded", Time: time.Now().UTC(), JobID: jobID, Day: &day})
+}
+
+// failed posts a listing page or file the crawl gave up on
+func (h *webhooks) failed(failure crawlFailure) {
+	h.send(webhookEvent{Event: failure.Kind + ".failed", Time: failure.Time, Failure: &failure})
+}
+
+// send delivers an event to every webhook in the background
+func (h *webhooks) send(event webhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("❌ Error encoding webhook event:", err)
+		return
+	}
+	for _, target := range h.urls {
+		h.pending.Add(1)
+		go func() {
+			defer h.pending.Done()
+			if h.slots != nil {
+				h.slots <- struct{}{}
+				defer func() { <-h.slots }()
+			}
+			// Webhook URLs often embed their token, so only the host is shown
+			if err := h.deliver(target.String(), event.Event, body); err != nil {
+				fmt.Printf("❌ Webhook to %s failed for %s: %v\n", target.Host, event.Event, err)
+			}
+		}()
+	}
+}
+
+// deliver posts a body, retrying transport errors, rate limits and server
+// errors
+func (h *webhooks) deliver(target, event string, body []byte) error {
+	var err error
+	for attempt := range webhookAttempts {
+		if attempt > 0 {
+			time.Sleep(time.Second << (attempt - 1))
+		}
+		var retry bool
+		if retry, err = h.post(target, event, body); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying
+func (h *webhooks) post(target, event string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gopenintel-Event", event)
+	for name, values := range h.header {
+		req.Header[name] = values
+	}
+	if h.secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		mac.Write(body)
+		req.Header.Set("X-Gopenintel-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// Not the *url.Error itself, which would print the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("answered %s", resp.Status)
+	}
+	return false, nil
+}
+
+// wait blocks until the deliveries in flight are done
+func (h *webhooks) wait() {
+	h.pending.Wait()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the wildcard heuristic: a domain is considered wildcarded when
+// at least wildcardMinNames of its subdomains, and wildcardMinShare of all of
+// them, resolve to exactly the same data
+const (
+	wildcardMinNames = 5
+	wildcardMinShare = 0.8
+)
+
+// rdataSets collects the address and alias data each name resolved to
+type rdataSets map[string]map[string]bool
+
+// add records the data of an A, AAAA or CNAME record
+func (s rdataSets) add(r *record) {
+	switch r.ResponseType {
+	case "A", "AAAA", "CNAME":
+	default:
+		return
+	}
+	name := strings.ToLower(r.QueryName)
+	if s[name] == nil {
+		s[name] = make(map[string]bool)
+	}
+	s[name][r.ResponseType+" "+strings.ToLower(r.Value())] = true
+}
+
+// signature returns the sorted data of a name as a single comparable string
+func (s rdataSets) signature(name string) string {
+	return strings.Join(sortedKeys(s[name]), ", ")
+}
+
+// wildcard is the data shared by the subdomains of a wildcarded domain
+type wildcard struct {
+	Signature string
+	Names     int // subdomains with address or alias data
+	Matching  int // subdomains resolving to the signature
+}
+
+// detectWildcard applies the heuristic to the subdomains of one domain
+func detectWildcard(sets rdataSets, subdomains []string, minNames int, minShare float64) (wildcard, bool) {
+	counts := make(map[string]int)
+	for _, name := range subdomains {
+		if len(sets[name]) > 0 {
+			counts[sets.signature(name)]++
+		}
+	}
+
+	w := wildcard{}
+	for signature, count := range counts {
+		w.Names += count
+		if count > w.Matching || count == w.Matching && signature < w.Signature {
+			w.Signature, w.Matching = signature, count
+		}
+	}
+	return w, w.Matching >= minNames && float64(w.Matching) >= minShare*float64(w.Names)
+}
+
+// runWildcards flags the domains whose subdomain responses indicate wildcard DNS
+func runWildcards(args []string) int {
+	flags := flag.NewFlagSet("wildcards", flag.ExitOnError)
+	filter := addArchiveFlags(flags)
+	minNames := flags.Int("min-names", wildcardMinNames, "Subdomains that must share the same data")
+	minShare := flags.Float64("min-share", wildcardMinShare, "Fraction of the subdomains that must share the same data")
+	format := addFormatFlag(flags)
+	flags.Parse(args)
+
+	if !validFormat(*format) {
+		fmt.Println("❌ Error: unknown format", *format)
+		return exitUsage
+	}
+
+	files, err := filter.files()
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+
+	var rows [][]string
+	for _, day := range groupByDay(files) {
+		sets := make(rdataSets)
+		if err := scanRecords(day, nil, func(r *record) error { sets.add(r); return nil }); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Error reading archive:", err)
+			return exitFailed
+		}
+
+		// Subdomains grouped under their registrable domain
+		subdomains := make(map[string][]string)
+		for name := range sets {
+			if apex := normalizeDomain(registrableDomain(name)); apex != name {
+				subdomains[apex] = append(subdomains[apex], name)
+			}
+		}
+
+		apexes := make([]string, 0, len(subdomains))
+		for apex := range subdomains {
+			apexes = append(apexes, apex)
+		}
+		sort.Strings(apexes)
+
+		for _, apex := range apexes {
+			w, ok := detectWildcard(sets, subdomains[apex], *minNames, *minShare)
+			if !ok {
+				continue
+			}
+			rows = append(rows, []string{day[0].Date, day[0].Dataset, apex, strconv.Itoa(w.Names),
+				strconv.Itoa(w.Matching), percent(w.Matching, w.Names), w.Signature})
+		}
+	}
+
+	if err := writeTable(*format, []string{"date", "dataset", "domain", "subdomains", "matching", "share", "rdata"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error writing report:", err)
+		return exitFailed
+	}
+	return exitOK
+}
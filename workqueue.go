@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// workLease is how long a claimed item stays with its worker without
+	// news; the worker extends it every third of that while it downloads,
+	// so the items of a worker that died go back to the queue
+	workLease = 5 * time.Minute
+	// workPoll is how long a worker waits for an item before asking again
+	workPoll = 5 * time.Second
+)
+
+// workItem is one dataset/day to download
+type workItem struct {
+	Dataset string `json:"dataset"`
+	Date    string `json:"date"`
+	Attempt int    `json:"attempt"` // failed attempts so far
+	// ID tells identical items of a Redis queue apart, as their leases are
+	// keyed by the stored item
+	ID string `json:"id,omitempty"`
+}
+
+// workQueue holds the work items shared by the workers of a backfill
+type workQueue interface {
+	// push queues items at the end of the queue
+	push(ctx context.Context, items []workItem) error
+	// claim leases the next item to the worker, nil when the queue stays
+	// empty for workPoll
+	claim(ctx context.Context) (workClaim, error)
+	close()
+}
+
+// workClaim is an item leased to a worker
+type workClaim interface {
+	item() workItem
+	// extend keeps the lease while the item is downloaded
+	extend(ctx context.Context) error
+	// done removes the downloaded item from the queue
+	done(ctx context.Context) error
+	// fail queues the item for another attempt, or moves it to the
+	// dead-letter queue after its last one; it reports whether it retries
+	fail(ctx context.Context, attempts int) (bool, error)
+	// release gives the item back untouched, for a worker that stops
+	release(ctx context.Context) error
+}
+
+// addQueueFlags registers the connection flags of the work queue
+func addQueueFlags(flags *flag.FlagSet) (queueURL, name, creds *string) {
+	queueURL = flags.String("queue", "", "Work queue URL: redis://HOST:PORT/DB or nats://HOST:PORT")
+	name = flags.String("queue-name", "openintel", "Name of the work queue, prefix of its Redis keys or name of its JetStream stream")
+	creds = flags.String("queue-creds", "", "NATS credentials file (optional)")
+	return queueURL, name, creds
+}
+
+// openWorkQueue connects to the queue of a URL
+func openWorkQueue(queueURL, name, creds string) (workQueue, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || queueURL == "" {
+		return nil, errors.New("--queue must be a redis:// or nats:// URL")
+	}
+	if name == "" || strings.ContainsAny(name, ".*> \t") {
+		return nil, fmt.Errorf("--queue-name %q: expected a name without dots, spaces or wildcards", name)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return openRedisQueue(queueURL, name)
+	case "nats", "tls":
+		return openNATSQueue(queueURL, name, creds)
+	}
+	return nil, fmt.Errorf("--queue %s: unsupported scheme %q, expected redis:// or nats://", u.Redacted(), u.Scheme)
+}
+
+// runEnqueue implements the enqueue subcommand: it queues one work item per
+// dataset and day of a range for the workers
+func runEnqueue(args []string) int {
+	flags := flag.NewFlagSet("enqueue", flag.ExitOnError)
+	queueURL, name, creds := addQueueFlags(flags)
+	only := flags.String("dataset", "", "Comma-separated datasets to queue (default all)")
+	fromDate := flags.String("from", "", "First day to queue, YYYY-MM-DD")
+	toDate := flags.String("to", "", "Last day to queue, YYYY-MM-DD (default --from)")
+	flags.Parse(args)
+
+	selected := datasets
+	if *only != "" {
+		var err error
+		if selected, err = selectDatasets(*only); err != nil {
+			fmt.Println("❌ Error: --dataset:", err)
+			return exitUsage
+		}
+	}
+	from, err := time.Parse(dateLayout, *fromDate)
+	if err != nil {
+		fmt.Println("❌ Error: --from must be a YYYY-MM-DD date")
+		return exitUsage
+	}
+	to := from
+	if *toDate != "" {
+		if to, err = time.Parse(dateLayout, *toDate); err != nil || to.Before(from) {
+			fmt.Println("❌ Error: --to must be a YYYY-MM-DD date after --from")
+			return exitUsage
+		}
+	}
+
+	queue, err := openWorkQueue(*queueURL, *name, *creds)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	defer queue.close()
+
+	// Day by day, every dataset in turn, like a crawl
+	var items []workItem
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, dataset := range selected {
+			items = append(items, workItem{Dataset: dataset, Date: day.Format(dateLayout)})
+		}
+	}
+	if err := queue.push(context.Background(), items); err != nil {
+		fmt.Println("❌ Error queueing work items:", err)
+		return exitFailed
+	}
+	fmt.Printf("📬 Queued %d work items on %s\n", len(items), *name)
+	return exitOK
+}
+
+// runWork implements the work subcommand: it claims items from the queue
+// and downloads each with a crawler process of its own, until stopped or,
+// with --drain, until the queue is empty
+func runWork(args []string) int {
+	flags := flag.NewFlagSet("work", flag.ExitOnError)
+	queueURL, name, creds := addQueueFlags(flags)
+	concurrency := flags.Int("concurrency", 1, "Number of items downloaded at the same time")
+	attempts := flags.Int("attempts", 3, "Attempts at an item before it is moved to the dead-letter queue")
+	drain := flags.Bool("drain", false, "Exit once the queue is empty instead of waiting for more items")
+	pages := &pager{}
+	addPagerFlags(flags, pages)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gopenintel work --queue=URL [options] [-- crawler options]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *concurrency < 1 || *attempts < 1 {
+		fmt.Println("❌ Error: --concurrency and --attempts must be positive")
+		return exitUsage
+	}
+	if err := pages.setup(); err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	crawlerFlags := flags.Args()
+	for _, arg := range crawlerFlags {
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if strings.HasPrefix(arg, "-") && slices.Contains([]string{"dates-file", "start-year", "end-year", "dataset", "help"}, name) {
+			fmt.Printf("❌ Error: -%s is set by the work items, not for the worker\n", name)
+			return exitUsage
+		}
+	}
+	queue, err := openWorkQueue(*queueURL, *name, *creds)
+	if err != nil {
+		fmt.Println("❌ Error:", err)
+		return exitUsage
+	}
+	defer queue.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("🏗️  Claiming work items from %s, %d at a time\n", *name, *concurrency)
+
+	var workers sync.WaitGroup
+	var mu sync.Mutex
+	var dead int
+	for range *concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for ctx.Err() == nil {
+				claim, err := queue.claim(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						fmt.Println("❌ Error claiming a work item:", err)
+						time.Sleep(workPoll)
+					}
+					continue
+				}
+				if claim == nil {
+					if *drain {
+						return
+					}
+					continue
+				}
+				if !workOn(ctx, claim, crawlerFlags, *attempts, pages) {
+					mu.Lock()
+					dead++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	workers.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		fmt.Println("🛑 Stopped: the items in progress went back to the queue")
+		return exitAborted
+	case dead > 0:
+		fmt.Printf("📭 Queue empty; %d item(s) failed %d times and were moved to the dead-letter queue\n", dead, *attempts)
+		return exitFailed
+	}
+	fmt.Println("📭 Queue empty, every item claimed by this worker downloaded")
+	return exitOK
+}
+
+// workOn downloads a claimed item, settles it and tells the pager how it
+// went; it reports false when the item ran out of attempts
+func workOn(ctx context.Context, claim workClaim, crawlerFlags []string, attempts int, pages *pager) bool {
+	item := claim.item()
+	label := item.Dataset + " " + item.Date
+	fmt.Printf("🛠️  Working on %s (attempt %d/%d)\n", label, item.Attempt+1, attempts)
+
+	// Settling must get through even once the worker is stopping
+	settle, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+
+	datesFile, err := writeDatesFile("work", item.Date, item.Date)
+	if err != nil {
+		fmt.Println("❌ Error writing dates file:", err)
+		claim.release(settle)
+		return true
+	}
+	defer os.Remove(datesFile)
+
+	leased, stopLease := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(workLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := claim.extend(leased); err != nil && leased.Err() == nil {
+					fmt.Printf("❌ Error extending the lease of %s: %v\n", label, err)
+				}
+			case <-leased.Done():
+				return
+			}
+		}
+	}()
+	args := append(slices.Clone(crawlerFlags), "-dates-file", datesFile, "-dataset", item.Dataset)
+	code, err := runCrawler(ctx, args, func(line string) {
+		fmt.Printf("[%s] %s\n", label, line)
+	})
+	stopLease()
+
+	switch {
+	case ctx.Err() != nil:
+		if err := claim.release(settle); err != nil {
+			fmt.Printf("❌ Error giving %s back to the queue: %v\n", label, err)
+		}
+		return true
+	case err == nil && succeeded(code):
+		if err := claim.done(settle); err != nil {
+			fmt.Printf("❌ Error removing %s from the queue: %v\n", label, err)
+		}
+		fmt.Println("✅ Done:", label)
+		pages.synced([]string{item.Dataset}, label, code, err)
+		return true
+	}
+	if err != nil {
+		fmt.Println("❌ Error running the crawler:", err)
+	}
+	pages.synced([]string{item.Dataset}, label, code, err)
+	retried, err := claim.fail(settle, attempts)
+	if err != nil {
+		fmt.Printf("❌ Error requeueing %s: %v\n", label, err)
+		return true
+	}
+	if retried {
+		fmt.Printf("🔁 %s failed (exit code %d), queued for attempt %d/%d\n", label, code, item.Attempt+2, attempts)
+		return true
+	}
+	fmt.Printf("❌ %s failed %d times, moved to the dead-letter queue\n", label, attempts)
+	return false
+}
+
+// redisClaimScript moves the items of expired leases back to the head of
+// the queue, then leases the first item until ARGV[2]
+var redisClaimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, item in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], item)
+	redis.call('LPUSH', KEYS[1], item)
+end
+local item = redis.call('LPOP', KEYS[1])
+if item then
+	redis.call('ZADD', KEYS[2], ARGV[2], item)
+end
+return item
+`)
+
+// redisQueue is a work queue in Redis:
+//
+//	<name>:queue   LIST  items waiting for a worker
+//	<name>:leases  ZSET  claimed items, scored by the end of their lease
+//	<name>:dead    LIST  items that failed every attempt
+type redisQueue struct {
+	client *redis.Client
+	name   string
+}
+
+// openRedisQueue connects to a Redis work queue
+func openRedisQueue(queueURL, name string) (*redisQueue, error) {
+	options, err := redis.ParseURL(queueURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+	return &redisQueue{client: client, name: name}, nil
+}
+
+// push implements workQueue; every item gets an ID of its own, so that an
+// item queued twice holds two leases instead of sharing one
+func (q *redisQueue) push(ctx context.Context, items []workItem) error {
+	for batch := range slices.Chunk(items, redisBatch) {
+		values := make([]any, len(batch))
+		for i, item := range batch {
+			id := make([]byte, 8)
+			rand.Read(id)
+			item.ID = hex.EncodeToString(id)
+			data, _ := json.Marshal(item)
+			values[i] = data
+		}
+		if err := q.client.RPush(ctx, q.name+":queue", values...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claim implements workQueue, polling the queue every second for workPoll
+func (q *redisQueue) claim(ctx context.Context) (workClaim, error) {
+	deadline := time.Now().Add(workPoll)
+	for {
+		now := time.Now()
+		data, err := redisClaimScript.Run(ctx, q.client, []string{q.name + ":queue", q.name + ":leases"},
+			now.Unix(), now.Add(workLease).Unix()).Text()
+		if err == nil {
+			claim := &redisClaim{queue: q, member: data}
+			if err := json.Unmarshal([]byte(data), &claim.work); err != nil {
+				return nil, fmt.Errorf("invalid work item %q: %w", data, err)
+			}
+			return claim, nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		if now.After(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// close implements workQueue
+func (q *redisQueue) close() {
+	q.client.Close()
+}
+
+// redisClaim is an item leased from a redisQueue
+type redisClaim struct {
+	queue  *redisQueue
+	member string // the item as stored in the queue
+	work   workItem
+}
+
+// item implements workClaim
+func (c *redisClaim) item() workItem { return c.work }
+
+// extend implements workClaim
+func (c *redisClaim) extend(ctx context.Context) error {
+	return c.queue.client.ZAddXX(ctx, c.queue.name+":leases",
+		redis.Z{Score: float64(time.Now().Add(workLease).Unix()), Member: c.member}).Err()
+}
+
+// done implements workClaim
+func (c *redisClaim) done(ctx context.Context) error {
+	return c.queue.client.ZRem(ctx, c.queue.name+":leases", c.member).Err()
+}
+
+// fail implements workClaim
+func (c *redisClaim) fail(ctx context.Context, attempts int) (bool, error) {
+	next := c.work
+	next.Attempt++
+	retry := next.Attempt < attempts
+	data, _ := json.Marshal(next)
+	_, err := c.queue.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, c.queue.name+":leases", c.member)
+		if retry {
+			pipe.RPush(ctx, c.queue.name+":queue", data)
+		} else {
+			pipe.RPush(ctx, c.queue.name+":dead", data)
+		}
+		return nil
+	})
+	return retry, err
+}
+
+// release implements workClaim
+func (c *redisClaim) release(ctx context.Context) error {
+	_, err := c.queue.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, c.queue.name+":leases", c.member)
+		pipe.LPush(ctx, c.queue.name+":queue", c.member)
+		return nil
+	})
+	return err
+}
+
+// natsQueue is a work queue in a JetStream stream named after the queue,
+// with work-queue retention: items are published to <name>.work and
+// claimed through the durable <name>-workers consumer, whose ack wait is the
+// lease; items that failed every attempt go to <name>.dead
+type natsQueue struct {
+	sink     *natsSink
+	name     string
+	consumer jetstream.Consumer
+}
+
+// openNATSQueue connects to a JetStream work queue, creating its stream
+// and consumer if needed
+func openNATSQueue(queueURL, name, creds string) (*natsQueue, error) {
+	sink := &natsSink{URL: queueURL, Creds: creds}
+	if err := sink.connect(); err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stream, err := sink.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      name,
+		Subjects:  []string{name + ".work", name + ".dead"},
+		Retention: jetstream.WorkQueuePolicy,
+	})
+	if err != nil {
+		sink.close()
+		return nil, err
+	}
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       name + "-workers",
+		FilterSubject: name + ".work",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       workLease,
+	})
+	if err != nil {
+		sink.close()
+		return nil, err
+	}
+	return &natsQueue{sink: sink, name: name, consumer: consumer}, nil
+}
+
+// push implements workQueue; the stream drops items queued twice within
+// its duplicate window, as when enqueue is run again by mistake
+func (q *natsQueue) push(ctx context.Context, items []workItem) error {
+	for _, item := range items {
+		data, _ := json.Marshal(item)
+		if err := q.sink.publishAsync(q.name+".work", data); err != nil {
+			return err
+		}
+	}
+	return q.sink.wait()
+}
+
+// claim implements workQueue
+func (q *natsQueue) claim(ctx context.Context) (workClaim, error) {
+	batch, err := q.consumer.Fetch(1, jetstream.FetchMaxWait(workPoll))
+	if err != nil {
+		return nil, err
+	}
+	for msg := range batch.Messages() {
+		claim := &natsClaim{queue: q, msg: msg}
+		if err := json.Unmarshal(msg.Data(), &claim.work); err != nil {
+			msg.Term()
+			return nil, fmt.Errorf("invalid work item %q: %w", msg.Data(), err)
+		}
+		// Redeliveries after a lease expired count as attempts too
+		if meta, err := msg.Metadata(); err == nil {
+			claim.work.Attempt = max(claim.work.Attempt, int(meta.NumDelivered)-1)
+		}
+		return claim, nil
+	}
+	return nil, batch.Error()
+}
+
+// close implements workQueue
+func (q *natsQueue) close() {
+	q.sink.close()
+}
+
+// natsClaim is an item leased from a natsQueue
+type natsClaim struct {
+	queue *natsQueue
+	msg   jetstream.Msg
+	work  workItem
+}
+
+// item implements workClaim
+func (c *natsClaim) item() workItem { return c.work }
+
+// extend implements workClaim
+func (c *natsClaim) extend(ctx context.Context) error {
+	return c.msg.InProgress()
+}
+
+// done implements workClaim
+func (c *natsClaim) done(ctx context.Context) error {
+	return c.msg.DoubleAck(ctx)
+}
+
+// fail implements workClaim; the item is published again with its attempt
+// count, since a redelivered message cannot carry it
+func (c *natsClaim) fail(ctx context.Context, attempts int) (bool, error) {
+	next := c.work
+	next.Attempt++
+	retry := next.Attempt < attempts
+	subject := c.queue.name + ".work"
+	if !retry {
+		subject = c.queue.name + ".dead"
+	}
+	return retry, c.republish(ctx, subject, next)
+}
+
+// release implements workClaim; the item is published again rather than
+// redelivered, which would count as an attempt
+func (c *natsClaim) release(ctx context.Context) error {
+	return c.republish(ctx, c.queue.name+".work", c.work)
+}
+
+// republish replaces the claimed message with an item on a subject
+func (c *natsClaim) republish(ctx context.Context, subject string, item workItem) error {
+	data, _ := json.Marshal(item)
+	if _, err := c.queue.sink.js.Publish(ctx, subject, data); err != nil {
+		return err
+	}
+	return c.msg.DoubleAck(ctx)
+}